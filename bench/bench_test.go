@@ -0,0 +1,167 @@
+//go:build benchgen
+
+package bench
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// plainWriter is an io.Writer with no other methods, as an http.ResponseWriter is to the render.
+type plainWriter struct{ io.Writer }
+
+var discard = plainWriter{io.Discard}
+
+// buildBenchData returns the data of the bench templates: customers customers with orders
+// orders of lines lines each.
+func buildBenchData(customers, orders, lines int) map[string]any {
+	list := make([]any, customers)
+	top := make([]any, 0, 10)
+	revenue := 0.0
+	for c := range list {
+		orderList := make([]any, orders)
+		spent := 0.0
+		for o := range orderList {
+			lineList := make([]any, lines)
+			total := 0.0
+			for l := range lineList {
+				price := float64(l%7+1) * 4.75
+				lineList[l] = map[string]any{
+					"sku":   fmt.Sprintf("SKU-%04d", l*31%10000),
+					"name":  fmt.Sprintf("Item <%d> & co", l),
+					"qty":   l%3 + 1,
+					"price": price,
+				}
+				total += price * float64(l%3+1)
+			}
+			orderList[o] = map[string]any{
+				"id":    c*orders + o,
+				"date":  fmt.Sprintf("2026-%02d-%02d", o%12+1, o%28+1),
+				"paid":  o%2 == 0,
+				"lines": lineList,
+				"total": total,
+			}
+			spent += total
+		}
+		customer := map[string]any{
+			"id":     c,
+			"name":   fmt.Sprintf("Customer %d", c),
+			"email":  fmt.Sprintf("Customer%d@Example.com", c),
+			"city":   []string{"Kyiv", "Lviv", "Odesa", ""}[c%4],
+			"orders": orderList,
+		}
+		list[c] = customer
+		revenue += spent
+		if len(top) < cap(top) {
+			top = append(top, map[string]any{
+				"name":   customer["name"],
+				"email":  customer["email"],
+				"note":   "A long note about the customer's preferences & history",
+				"spent":  spent,
+				"orders": orders,
+				"city":   customer["city"],
+			})
+		}
+	}
+	return map[string]any{
+		"title":     "Orders <report>",
+		"year":      2026,
+		"customers": list,
+		"top":       top,
+		"stats": map[string]any{
+			"customers": customers,
+			"orders":    customers * orders,
+			"revenue":   revenue,
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	out, err := RenderMainString(MainContextFromMap(buildBenchData(2, 2, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<section id="customer-1" class="customer">`,
+		`<table class="order paid">`,
+		"<tr><td>SKU-0031</td><td>Item &lt;1&gt; &amp; co</td><td>2</td><td>9.5</td></tr>",
+		"<footer>Orders &lt;report&gt; &copy; 2026</footer>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("main lacks %q:\n%s", want, out)
+		}
+	}
+	out, err = RenderHelperHeavyString(HelperHeavyContextFromMap(buildBenchData(2, 12, 1)))
+	if err != nil || !strings.Contains(out, "<li>CUSTOMER 0 (customer0@example.com)") || !strings.Contains(out, "regular") {
+		t.Errorf("helper_heavy: %v\n%s", err, out)
+	}
+}
+
+func BenchmarkRenderMain(b *testing.B) {
+	data := MainContextFromMap(buildBenchData(100, 12, 8))
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := RenderMain(discard, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderSummary(b *testing.B) {
+	data := SummaryContextFromMap(buildBenchData(100, 12, 8))
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := RenderSummary(discard, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderHelperHeavy(b *testing.B) {
+	data := HelperHeavyContextFromMap(buildBenchData(100, 12, 8))
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := RenderHelperHeavy(discard, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderMainString(b *testing.B) {
+	data := MainContextFromMap(buildBenchData(100, 12, 8))
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := RenderMainString(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderMain_RecreateData(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := RenderMain(discard, MainContextFromMap(buildBenchData(100, 12, 8))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderSummary_RecreateData(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := RenderSummary(discard, SummaryContextFromMap(buildBenchData(100, 12, 8))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderHelperHeavy_RecreateData(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := RenderHelperHeavy(discard, HelperHeavyContextFromMap(buildBenchData(100, 12, 8))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
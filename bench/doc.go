@@ -0,0 +1,4 @@
+// Package bench holds render benchmarks of templates compiled by hbc; see README.md.
+package bench
+
+//go:generate go run ../cmd/hbc -in templates -out templates_gen.go -pkg bench
@@ -7,6 +7,7 @@ import (
 
 	"github.com/andriyg76/glog"
 	"github.com/andriyg76/go-hbars/internal/processor"
+	"github.com/andriyg76/go-hbars/pkg/interpreter"
 	"github.com/andriyg76/go-hbars/pkg/renderer"
 	"github.com/andriyg76/hexerr"
 )
@@ -20,8 +21,10 @@ func main() {
 		rootPath      = flag.String("root", "", "base directory for resolving relative paths (default: current working directory)")
 		dataPath      = flag.String("data-path", "data", "path to data files directory")
 		sharedPath    = flag.String("shared-path", "shared", "path to shared data directory")
+		templatesPath = flag.String("templates-path", ".processor/templates", "path to templates directory")
+		templatePkg   = flag.String("template-pkg", "", "deprecated and ignored: templates are parsed from -templates-path (compiled templates run with the bootstrap NewQuickProcessor)")
 		outputPath    = flag.String("output-path", "pages", "path to output directory")
-		templatePkg   = flag.String("template-pkg", "", "path to compiled template package")
+		keepKeyOrder  = flag.Bool("keep-key-order", false, "iterate objects in data files in the order of their keys in the file instead of in sorted order")
 	)
 	flag.Parse()
 
@@ -37,14 +40,19 @@ func main() {
 
 	// Create configuration
 	config := &processor.Config{
-		RootPath:   root,
-		DataPath:   *dataPath,
-		SharedPath: *sharedPath,
-		OutputPath: *outputPath,
+		RootPath:     root,
+		DataPath:     *dataPath,
+		SharedPath:   *sharedPath,
+		OutputPath:   *outputPath,
+		KeepKeyOrder: *keepKeyOrder,
+	}
+
+	if *templatePkg != "" {
+		log.Warn("-template-pkg is deprecated and ignored: templates are parsed from %s", filepath.Join(root, *templatesPath))
 	}
 
 	// Create renderer
-	renderer, err := createRenderer(*templatePkg)
+	renderer, err := createRenderer(filepath.Join(root, *templatesPath))
 	if err != nil {
 		log.Fatal("Failed to create renderer: %v", err)
 	}
@@ -53,6 +61,7 @@ func main() {
 	proc := processor.NewProcessor(config, renderer)
 
 	// Process all files
+	log.Info("Templates path: %s", filepath.Join(root, *templatesPath))
 	log.Info("Processing files from %s", filepath.Join(root, *dataPath))
 	log.Info("Output directory: %s", filepath.Join(root, *outputPath))
 
@@ -63,9 +72,8 @@ func main() {
 	log.Info("Done!")
 }
 
-// createRenderer creates a template renderer.
-// This is a placeholder - in a real implementation, you would load the compiled template package.
-func createRenderer(templatePkg string) (renderer.TemplateRenderer, error) {
-	// For now, return an error indicating that templates need to be loaded
-	return nil, hexerr.New("template renderer not implemented - you need to load compiled templates")
+// createRenderer parses the templates in templatesDir; they are rendered by the interpreter,
+// so no compiled template package is needed.
+func createRenderer(templatesDir string) (renderer.TemplateRenderer, error) {
+	return interpreter.LoadDir(templatesDir, interpreter.Options{})
 }
@@ -13,6 +13,13 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "scaffold" {
+		if err := runScaffold(os.Args[2:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
 	var inPath string
 	var outPath string
 	var pkgName string
@@ -23,6 +30,16 @@ func main() {
 	var helpersFlags helpersFlag
 	var noCoreHelpers bool
 	var generateBootstrap bool
+	var checkHelpers bool
+	var strict bool
+	var assumeObjects bool
+	var missingHelpers string
+	var escape string
+	var stringify string
+	var format string
+	var lineDirectives bool
+	var recoverHelpers bool
+	var helperErrors string
 
 	flag.StringVar(&inPath, "in", "", "input template file or directory")
 	flag.StringVar(&outPath, "out", "templates_gen.go", "output Go file path")
@@ -34,6 +51,16 @@ func main() {
 	flag.Var(&helpersFlags, "helpers", "comma-separated helper list: [alias:]Name or [alias:]name=Ident")
 	flag.BoolVar(&noCoreHelpers, "no-core-helpers", false, "disable default core helpers registry")
 	flag.BoolVar(&generateBootstrap, "bootstrap", false, "generate bootstrap code for quick server/processor setup")
+	flag.BoolVar(&checkHelpers, "check-helpers", true, "type-check helper references against their Go packages (runs go list)")
+	flag.BoolVar(&strict, "strict", false, "fail with a positioned error on paths missing from the data instead of rendering them empty")
+	flag.BoolVar(&assumeObjects, "assume-objects", false, "fail only when an intermediate object of a path is missing (lighter than -strict)")
+	flag.StringVar(&missingHelpers, "missing-helpers", compiler.MissingHelpersError, "unknown helpers: error (fail compilation) or runtime (look them up with runtime.RegisterHelper / SetHelperMissing)")
+	flag.StringVar(&escape, "escape", compiler.EscapeHTML, "default escaping of {{value}}: html (HTML-escape every value), contextual (escape for the attribute, URL, script or style the value is in), text (no escaping) or an escaper name (csv, json-string, shell or one registered with runtime.RegisterEscaper); .txt/.md templates and {{!-- escape: mode --}} annotations override it")
+	flag.StringVar(&stringify, "stringify", compiler.StringifyGo, "how {{value}} output is converted to text: go (as fmt prints it) or js (as JavaScript does, matching handlebars.js: arrays join with \",\", objects print [object Object])")
+	flag.StringVar(&format, "format", formatGo, "output format: go (generated Go code) or bytecode (a program for runtime.LoadVM, rendered without go build; -out defaults to templates.hbc)")
+	flag.BoolVar(&lineDirectives, "line-directives", true, "emit //line directives, so panics, stack traces and coverage report template files and lines")
+	flag.BoolVar(&recoverHelpers, "recover-helpers", false, "recover panics of helpers and handle them as helper errors (runtime.PanicError)")
+	flag.StringVar(&helperErrors, "helper-errors", "", "helper error policy: fail (default), empty (log, render empty) or comment (log, render an HTML comment); comma-separated name=policy entries set it for single helpers")
 	flag.Parse()
 
 	if inPath == "" {
@@ -44,23 +71,75 @@ func main() {
 	}
 
 	exts := parseExts(extList)
-	templates, err := loadTemplates(inPath, exts)
+	templates, files, err := loadTemplateFiles(inPath, exts)
 	if err != nil {
 		fatal(err)
 	}
 	if len(templates) == 0 {
 		fatal(fmt.Errorf("no templates found under %q", inPath))
 	}
+	switch format {
+	case formatGo:
+	case formatBytecode:
+		if err := bytecodeFlagsError(flagSet); err != nil {
+			fatal(err)
+		}
+		if !flagSet("out") {
+			outPath = "templates.hbc"
+		}
+		program, err := compiler.CompileBytecode(templates, compiler.Options{Escape: escape, Stringify: stringify})
+		if err != nil {
+			fatal(err)
+		}
+		if err := writeOutput(outPath, program); err != nil {
+			fatal(err)
+		}
+		return
+	default:
+		fatal(fmt.Errorf("unknown -format %q (want %q or %q)", format, formatGo, formatBytecode))
+	}
 	helpers, err := buildHelpers(noCoreHelpers, importFlags, helpersFlags, helperFlags)
 	if err != nil {
 		fatal(err)
 	}
 
+	var helperTypes *compiler.HelperTypes
+	if checkHelpers {
+		helperTypes, err = loadHelperTypes(outPath, helpers)
+		if err != nil {
+			fatal(fmt.Errorf("%w (use -check-helpers=false to skip helper type checking)", err))
+		}
+	}
+
+	helperErrorsDefault, helperErrorPolicies, err := parseHelperErrors(helperErrors)
+	if err != nil {
+		fatal(err)
+	}
+
+	var sourceFiles map[string]string
+	if lineDirectives {
+		sourceFiles, err = relativeSourceFiles(files, outPath)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
 	code, err := compiler.CompileTemplates(templates, compiler.Options{
-		PackageName:      pkgName,
-		RuntimeImport:    runtimeImport,
-		Helpers:           helpers,
-		GenerateBootstrap: generateBootstrap,
+		PackageName:         pkgName,
+		RuntimeImport:       runtimeImport,
+		Helpers:             helpers,
+		GenerateBootstrap:   generateBootstrap,
+		HelperTypes:         helperTypes,
+		Strict:              strict,
+		AssumeObjects:       assumeObjects,
+		MissingHelpers:      missingHelpers,
+		Escape:              escape,
+		Stringify:           stringify,
+		SourceFiles:         sourceFiles,
+		OutputFile:          filepath.Base(outPath),
+		RecoverHelpers:      recoverHelpers,
+		HelperErrors:        helperErrorsDefault,
+		HelperErrorPolicies: helperErrorPolicies,
 	})
 	if err != nil {
 		fatal(err)
@@ -71,6 +150,43 @@ func main() {
 	}
 }
 
+// Output formats of -format.
+const (
+	formatGo       = "go"
+	formatBytecode = "bytecode"
+)
+
+// flagSet reports whether the command line sets flag name.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// goOnlyFlags are the flags of generated Go code, which -format=bytecode does not use.
+var goOnlyFlags = []string{
+	"pkg", "runtime-import", "helper", "import", "helpers", "no-core-helpers", "bootstrap", "check-helpers",
+	"strict", "assume-objects", "missing-helpers", "line-directives", "recover-helpers", "helper-errors",
+}
+
+// bytecodeFlagsError returns an error naming the goOnlyFlags that set reports as set, or nil.
+func bytecodeFlagsError(set func(name string) bool) error {
+	var names []string
+	for _, name := range goOnlyFlags {
+		if set(name) {
+			names = append(names, "-"+name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s cannot be used with -format=bytecode (a VM takes its helpers and helper error policies from runtime.VMOptions)", strings.Join(names, ", "))
+}
+
 func fatal(err error) {
 	fmt.Fprintln(os.Stderr, "hbc:", err)
 	os.Exit(1)
@@ -154,8 +270,11 @@ func buildHelpers(noCoreHelpers bool, importFlags importFlag, helpersFlags helpe
 		coreRegistry := helperspkg.Registry()
 		for name, ref := range coreRegistry {
 			helperMap[name] = compiler.HelperRef{
-				ImportPath: ref.ImportPath,
-				Ident:      ref.Ident,
+				ImportPath:   ref.ImportPath,
+				Ident:        ref.Ident,
+				Options:      ref.Options,
+				BlockContext: ref.BlockContext,
+				Source:       "core helpers registry",
 			}
 		}
 	}
@@ -231,6 +350,7 @@ func parseHelpersFlags(helpersFlags helpersFlag, importMap map[string]string, de
 			if helperSpec == "" {
 				continue
 			}
+			source := "-helpers " + helperSpec
 			var alias, name, ident string
 			var importPath string
 
@@ -272,6 +392,7 @@ func parseHelpersFlags(helpersFlags helpersFlag, importMap map[string]string, de
 			helpers[name] = compiler.HelperRef{
 				ImportPath: importPath,
 				Ident:      ident,
+				Source:     source,
 			}
 		}
 	}
@@ -302,25 +423,62 @@ func parseLegacyHelpers(values []string, helpers map[string]compiler.HelperRef)
 			ident = ref
 		}
 		// Legacy flags can override existing helpers
-		helpers[name] = compiler.HelperRef{ImportPath: importPath, Ident: ident}
+		helpers[name] = compiler.HelperRef{ImportPath: importPath, Ident: ident, Source: "-helper " + raw}
 	}
 	return nil
 }
 
+// parseHelperErrors parses -helper-errors: a policy for all helpers and name=policy entries
+// for single helpers, e.g. "comment,formatDate=fail". Policies are checked by the compiler.
+func parseHelperErrors(value string) (string, map[string]string, error) {
+	var policy string
+	var policies map[string]string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, p, ok := strings.Cut(entry, "=")
+		if !ok {
+			if policy != "" {
+				return "", nil, fmt.Errorf("-helper-errors: more than one policy for all helpers (%q and %q)", policy, entry)
+			}
+			policy = entry
+			continue
+		}
+		name, p = strings.TrimSpace(name), strings.TrimSpace(p)
+		if name == "" || p == "" {
+			return "", nil, fmt.Errorf("-helper-errors: invalid entry %q (want name=policy)", entry)
+		}
+		if policies == nil {
+			policies = make(map[string]string)
+		}
+		policies[name] = p
+	}
+	return policy, policies, nil
+}
+
 func loadTemplates(path string, exts map[string]bool) (map[string]string, error) {
+	templates, _, err := loadTemplateFiles(path, exts)
+	return templates, err
+}
+
+// loadTemplateFiles is loadTemplates that also returns the file path of each template.
+func loadTemplateFiles(path string, exts map[string]bool) (map[string]string, map[string]string, error) {
 	info, err := os.Stat(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if !info.IsDir() {
 		content, err := os.ReadFile(path)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		name := templateName(path)
-		return map[string]string{name: string(content)}, nil
+		return map[string]string{name: string(content)}, map[string]string{name: path}, nil
 	}
 	templates := make(map[string]string)
+	files := make(map[string]string)
 	root := path
 	err = filepath.WalkDir(path, func(full string, d os.DirEntry, errWalk error) error {
 		if errWalk != nil {
@@ -346,12 +504,36 @@ func loadTemplates(path string, exts map[string]bool) (map[string]string, error)
 			return fmt.Errorf("duplicate template name %q", name)
 		}
 		templates[name] = string(content)
+		files[name] = full
 		return nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return templates, files, nil
+}
+
+// relativeSourceFiles returns the template files relative to the directory of the generated
+// file, as compiler.Options.SourceFiles: Go resolves relative //line file names against the
+// directory of the file that contains them.
+func relativeSourceFiles(files map[string]string, outPath string) (map[string]string, error) {
+	outDir, err := filepath.Abs(filepath.Dir(outPath))
 	if err != nil {
 		return nil, err
 	}
-	return templates, nil
+	sourceFiles := make(map[string]string, len(files))
+	for name, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(outDir, abs)
+		if err != nil {
+			rel = abs
+		}
+		sourceFiles[name] = filepath.ToSlash(rel)
+	}
+	return sourceFiles, nil
 }
 
 func templateName(path string) string {
@@ -374,6 +556,16 @@ func defaultPackage(outPath string) string {
 	return filepath.Base(dir)
 }
 
+// loadHelperTypes type-checks the helper packages from the directory of the generated file,
+// so that helpers without an import path are looked up in that package.
+func loadHelperTypes(outPath string, helpers map[string]compiler.HelperRef) (*compiler.HelperTypes, error) {
+	dir := filepath.Dir(outPath)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = "."
+	}
+	return compiler.LoadHelperTypes(dir, filepath.Base(outPath), helpers)
+}
+
 func writeOutput(outPath string, code []byte) error {
 	dir := filepath.Dir(outPath)
 	if dir != "." && dir != "" {
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -269,7 +272,7 @@ func TestBuildHelpers(t *testing.T) {
 			importFlags:     importFlag{},
 			helpersFlags:    helpersFlag{},
 			legacyFlags:     helperFlag{},
-			wantHelperCount: 57, // All helpers from registry
+			wantHelperCount: 63, // All helpers from registry
 			wantErr:         false,
 			checkHelpers: map[string]compiler.HelperRef{
 				"upper": {ImportPath: "github.com/andriyg76/go-hbars/helpers/handlebars", Ident: "Upper"},
@@ -291,7 +294,7 @@ func TestBuildHelpers(t *testing.T) {
 			importFlags:     importFlag{"github.com/example/extra"},
 			helpersFlags:    helpersFlag{"CustomHelper"},
 			legacyFlags:     helperFlag{},
-			wantHelperCount: 58, // 57 core + 1 custom
+			wantHelperCount: 64, // 63 core + 1 custom
 			wantErr:         false,
 			checkHelpers: map[string]compiler.HelperRef{
 				"upper":        {ImportPath: "github.com/andriyg76/go-hbars/helpers/handlebars", Ident: "Upper"},
@@ -304,7 +307,7 @@ func TestBuildHelpers(t *testing.T) {
 			importFlags:     importFlag{},
 			helpersFlags:    helpersFlag{},
 			legacyFlags:     helperFlag{"upper=github.com/example/custom:MyUpper"},
-			wantHelperCount: 57, // Same count, but upper is overridden
+			wantHelperCount: 63, // Same count, but upper is overridden
 			wantErr:         false,
 			checkHelpers: map[string]compiler.HelperRef{
 				"upper": {ImportPath: "github.com/example/custom", Ident: "MyUpper"},
@@ -316,7 +319,7 @@ func TestBuildHelpers(t *testing.T) {
 			importFlags:     importFlag{"github.com/example/custom"},
 			helpersFlags:    helpersFlag{"upper=MyUpper"},
 			legacyFlags:     helperFlag{},
-			wantHelperCount: 57, // Same count, but upper is overridden
+			wantHelperCount: 63, // Same count, but upper is overridden
 			wantErr:         false,
 			checkHelpers: map[string]compiler.HelperRef{
 				"upper": {ImportPath: "github.com/example/custom", Ident: "MyUpper"},
@@ -328,7 +331,7 @@ func TestBuildHelpers(t *testing.T) {
 			importFlags:     importFlag{"github.com/example/custom"},
 			helpersFlags:    helpersFlag{"upper=MyUpper"},
 			legacyFlags:     helperFlag{"upper=github.com/example/legacy:LegacyUpper"},
-			wantHelperCount: 57,
+			wantHelperCount: 63,
 			wantErr:         false,
 			checkHelpers: map[string]compiler.HelperRef{
 				"upper": {ImportPath: "github.com/example/legacy", Ident: "LegacyUpper"},
@@ -460,6 +463,84 @@ func TestParseLegacyHelpers(t *testing.T) {
 	}
 }
 
+func TestBuildHelpers_Source(t *testing.T) {
+	helpers, err := buildHelpers(false, importFlag{"extra:github.com/example/extra"}, helpersFlag{"extra:myJoin=Join"}, helperFlag{"shout=Shout"})
+	if err != nil {
+		t.Fatalf("buildHelpers() error = %v", err)
+	}
+	want := map[string]string{
+		"upper":  "core helpers registry",
+		"myJoin": "-helpers extra:myJoin=Join",
+		"shout":  "-helper shout=Shout",
+	}
+	for name, source := range want {
+		if got := helpers[name].Source; got != source {
+			t.Errorf("helpers[%q].Source = %q, want %q", name, got, source)
+		}
+	}
+}
+
+func TestRelativeSourceFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"views/main.hbs", "views/parts/nav.hbs"} {
+		full := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte("{{title}}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, files, err := loadTemplateFiles(filepath.Join(dir, "views"), parseExts(".hbs"))
+	if err != nil {
+		t.Fatalf("loadTemplateFiles() error = %v", err)
+	}
+	got, err := relativeSourceFiles(files, filepath.Join(dir, "templates", "templates_gen.go"))
+	if err != nil {
+		t.Fatalf("relativeSourceFiles() error = %v", err)
+	}
+	want := map[string]string{"main": "../views/main.hbs", "parts/nav": "../views/parts/nav.hbs"}
+	if len(got) != len(want) {
+		t.Fatalf("relativeSourceFiles() = %v, want %v", got, want)
+	}
+	for name, file := range want {
+		if got[name] != file {
+			t.Errorf("relativeSourceFiles()[%q] = %q, want %q", name, got[name], file)
+		}
+	}
+}
+
+func TestParseHelperErrors(t *testing.T) {
+	policy, policies, err := parseHelperErrors("comment, formatDate=fail,lookup=empty")
+	if err != nil {
+		t.Fatalf("parseHelperErrors() error = %v", err)
+	}
+	if policy != "comment" || len(policies) != 2 || policies["formatDate"] != "fail" || policies["lookup"] != "empty" {
+		t.Errorf("parseHelperErrors() = %q, %v", policy, policies)
+	}
+	if policy, policies, err := parseHelperErrors(""); err != nil || policy != "" || policies != nil {
+		t.Errorf("parseHelperErrors(\"\") = %q, %v, %v", policy, policies, err)
+	}
+	for _, value := range []string{"empty,comment", "=fail", "upper="} {
+		if _, _, err := parseHelperErrors(value); err == nil {
+			t.Errorf("parseHelperErrors(%q): want error", value)
+		}
+	}
+}
+
+func TestBytecodeFlagsError(t *testing.T) {
+	set := func(names ...string) func(string) bool {
+		return func(name string) bool { return slices.Contains(names, name) }
+	}
+	if err := bytecodeFlagsError(set("in", "out", "escape", "stringify")); err != nil {
+		t.Errorf("bytecode flags: error = %v", err)
+	}
+	err := bytecodeFlagsError(set("strict", "helpers", "check-helpers", "escape"))
+	if want := "-helpers, -check-helpers, -strict cannot be used with -format=bytecode"; err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Go code flags: error = %v, want prefix %q", err, want)
+	}
+}
+
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
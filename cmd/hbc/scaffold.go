@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// runScaffold implements "hbc scaffold": it writes a skeleton data file (JSON, YAML or TOML)
+// for one template, built from the context inferred from the template and its partials, and
+// with -shared the skeleton of the _shared data it uses, one file per key in that directory.
+func runScaffold(args []string) error {
+	fs := flag.NewFlagSet("hbc scaffold", flag.ExitOnError)
+	var inPath, extList, tmplName, format, outPath, pageOutput, sharedDir, missingHelpers string
+	var items int
+	var helperFlags helperFlag
+	var importFlags importFlag
+	var helpersFlags helpersFlag
+	var noCoreHelpers bool
+	fs.StringVar(&inPath, "in", "", "input template file or directory")
+	fs.StringVar(&extList, "ext", ".hbs,.handlebars", "comma-separated template extensions")
+	fs.StringVar(&tmplName, "template", "", "template to scaffold data for (default: the only template, or \"main\")")
+	fs.StringVar(&format, "format", "", "output format: json, yaml or toml (default: from -out extension, else json)")
+	fs.StringVar(&outPath, "out", "", "output data file (default: stdout)")
+	fs.StringVar(&pageOutput, "page-output", "", "value for _page.output (default: <template>.html)")
+	fs.StringVar(&sharedDir, "shared", "", "shared data directory to write the _shared skeleton to (existing files are kept)")
+	fs.StringVar(&missingHelpers, "missing-helpers", compiler.MissingHelpersError, "unknown helpers policy the templates are compiled with: error or runtime")
+	fs.IntVar(&items, "items", 2, "number of sample items for each {{#each}} collection")
+	fs.Var(&helperFlags, "helper", "helper mapping name=Ident or name=import/path:Ident (legacy)")
+	fs.Var(&importFlags, "import", "import path for helpers: path or path:alias")
+	fs.Var(&helpersFlags, "helpers", "comma-separated helper list: [alias:]Name or [alias:]name=Ident")
+	fs.BoolVar(&noCoreHelpers, "no-core-helpers", false, "disable default core helpers registry")
+	_ = fs.Parse(args)
+
+	if inPath == "" {
+		return errors.New("scaffold: missing -in path")
+	}
+	templates, err := loadTemplates(inPath, parseExts(extList))
+	if err != nil {
+		return err
+	}
+	if len(templates) == 0 {
+		return fmt.Errorf("scaffold: no templates found under %q", inPath)
+	}
+	if tmplName == "" {
+		tmplName = defaultScaffoldTemplate(templates)
+		if tmplName == "" {
+			return errors.New("scaffold: -template is required when there are several templates and none is named \"main\"")
+		}
+	}
+	helpers, err := buildHelpers(noCoreHelpers, importFlags, helpersFlags, helperFlags)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = scaffoldFormatFromPath(outPath)
+	}
+
+	opts := compiler.ScaffoldOptions{
+		Helpers:        helpers,
+		Items:          items,
+		Output:         pageOutput,
+		MissingHelpers: missingHelpers,
+	}
+	data, err := compiler.ScaffoldData(templates, tmplName, opts)
+	if err != nil {
+		return err
+	}
+	content, err := encodeScaffold(data, format)
+	if err != nil {
+		return err
+	}
+	shared, err := compiler.ScaffoldSharedData(templates, tmplName, opts)
+	if err != nil {
+		return err
+	}
+	if sharedDir != "" {
+		if err := writeSharedScaffold(sharedDir, shared, format); err != nil {
+			return err
+		}
+	} else if len(shared) > 0 {
+		fmt.Fprintf(os.Stderr, "hbc scaffold: _shared values (%s) are not in the page data; they come from the shared data directory (-shared writes a skeleton there)\n",
+			strings.Join(sortedKeys(shared), ", "))
+	}
+	if outPath == "" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	return writeOutput(outPath, content)
+}
+
+// writeSharedScaffold writes each key of shared to <dir>/<key>.<format>, the file
+// processor.LoadSharedData reads it from. Keys that already have a data file, and keys that are
+// not objects, are skipped.
+func writeSharedScaffold(dir string, shared map[string]any, format string) error {
+	ext := "." + strings.ToLower(format)
+	for _, key := range sortedKeys(shared) {
+		if sharedFileExists(dir, key) {
+			continue
+		}
+		data, ok := shared[key].(map[string]any)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "hbc scaffold: _shared.%s is not an object; shared data files hold objects, skipped\n", key)
+			continue
+		}
+		content, err := encodeScaffold(data, format)
+		if err != nil {
+			return err
+		}
+		if err := writeOutput(filepath.Join(dir, key+ext), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sharedFileExists(dir, key string) bool {
+	for _, ext := range []string{".json", ".json5", ".yaml", ".yml", ".toml"} {
+		if _, err := os.Stat(filepath.Join(dir, key+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func defaultScaffoldTemplate(templates map[string]string) string {
+	if len(templates) == 1 {
+		for name := range templates {
+			return name
+		}
+	}
+	if _, ok := templates["main"]; ok {
+		return "main"
+	}
+	return ""
+}
+
+func scaffoldFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// encodeScaffold encodes data in one of the formats accepted by processor.LoadDataFile.
+func encodeScaffold(data map[string]any, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "json":
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "yaml", "yml":
+		return yaml.Marshal(data)
+	case "toml":
+		return toml.Marshal(data)
+	default:
+		return nil, fmt.Errorf("scaffold: unsupported format %q (supported: json, yaml, toml)", format)
+	}
+}
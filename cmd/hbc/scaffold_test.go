@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/processor"
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+func TestEncodeScaffold_RoundTrip(t *testing.T) {
+	data := map[string]any{
+		"_page": map[string]any{"template": "main", "output": "main.html"},
+		"title": "title",
+		"items": []any{map[string]any{"name": "items[0].name"}},
+	}
+	for _, format := range []string{"json", "yaml", "toml"} {
+		t.Run(format, func(t *testing.T) {
+			content, err := encodeScaffold(data, format)
+			if err != nil {
+				t.Fatalf("encodeScaffold: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "page."+format)
+			if err := os.WriteFile(path, content, 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			loaded, err := processor.LoadDataFile(path)
+			if err != nil {
+				t.Fatalf("LoadDataFile: %v\n%s", err, content)
+			}
+			cfg, err := processor.ExtractPageConfig(loaded)
+			if err != nil || cfg == nil {
+				t.Fatalf("ExtractPageConfig: %v, %v", cfg, err)
+			}
+			if cfg.Template != "main" || cfg.Output != "main.html" {
+				t.Errorf("page config = %+v", cfg)
+			}
+			if loaded["title"] != "title" {
+				t.Errorf("title = %#v", loaded["title"])
+			}
+		})
+	}
+}
+
+func TestEncodeScaffold_UnknownFormat(t *testing.T) {
+	if _, err := encodeScaffold(map[string]any{}, "xml"); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+}
+
+func TestScaffoldFormatFromPath(t *testing.T) {
+	cases := map[string]string{
+		"":             "json",
+		"data/a.json":  "json",
+		"data/a.yaml":  "yaml",
+		"data/a.YML":   "yaml",
+		"data/a.toml":  "toml",
+		"data/a.json5": "json",
+	}
+	for path, want := range cases {
+		if got := scaffoldFormatFromPath(path); got != want {
+			t.Errorf("scaffoldFormatFromPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRunScaffold(t *testing.T) {
+	dir := t.TempDir()
+	tmplDir := filepath.Join(dir, "templates")
+	if err := os.MkdirAll(tmplDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmplDir, "main.hbs"), []byte("{{title}} {{upper user.name}}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := filepath.Join(dir, "data", "index.yaml")
+	if err := runScaffold([]string{"-in", tmplDir, "-out", out, "-page-output", "index.html"}); err != nil {
+		t.Fatalf("runScaffold: %v", err)
+	}
+	loaded, err := processor.LoadDataFile(out)
+	if err != nil {
+		t.Fatalf("LoadDataFile: %v", err)
+	}
+	cfg, err := processor.ExtractPageConfig(loaded)
+	if err != nil || cfg == nil || cfg.Template != "main" || cfg.Output != "index.html" {
+		t.Fatalf("ExtractPageConfig = %+v, %v", cfg, err)
+	}
+	user, _ := loaded["user"].(map[string]any)
+	if user["name"] != "user.name" {
+		t.Errorf("user = %#v", loaded["user"])
+	}
+}
+
+func TestRunScaffold_Shared(t *testing.T) {
+	dir := t.TempDir()
+	tmplDir := filepath.Join(dir, "templates")
+	sharedDir := filepath.Join(dir, "shared")
+	if err := os.MkdirAll(sharedDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.MkdirAll(tmplDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmplDir, "main.hbs"), []byte("{{title}} {{_shared.site.title}} {{_shared.nav.home}}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sharedDir, "nav.json"), []byte(`{"home": "/"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := filepath.Join(dir, "data", "index.json")
+	if err := runScaffold([]string{"-in", tmplDir, "-out", out, "-shared", sharedDir}); err != nil {
+		t.Fatalf("runScaffold: %v", err)
+	}
+	page, err := processor.LoadDataFile(out)
+	if err != nil {
+		t.Fatalf("LoadDataFile: %v", err)
+	}
+	if _, ok := page["_shared"]; ok {
+		t.Errorf("page data has _shared: %#v", page)
+	}
+	shared, err := processor.LoadSharedData(sharedDir)
+	if err != nil {
+		t.Fatalf("LoadSharedData: %v", err)
+	}
+	if site := runtime.MapOf(shared["site"]); site["title"] != "_shared.site.title" {
+		t.Errorf("shared site = %#v", shared["site"])
+	}
+	if nav := runtime.MapOf(shared["nav"]); nav["home"] != "/" {
+		t.Errorf("existing shared file overwritten: %#v", shared["nav"])
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/andriyg76/glog"
 	"github.com/andriyg76/go-hbars/internal/processor"
 	"github.com/andriyg76/go-hbars/internal/server"
+	"github.com/andriyg76/go-hbars/pkg/interpreter"
 	"github.com/andriyg76/go-hbars/pkg/renderer"
 	"github.com/andriyg76/hexerr"
 )
@@ -23,9 +24,10 @@ func main() {
 		dataPath      = flag.String("data-path", "data", "path to data files directory")
 		sharedPath    = flag.String("shared-path", "shared", "path to shared data directory")
 		templatesPath = flag.String("templates-path", ".processor/templates", "path to templates directory")
+		templatePkg   = flag.String("template-pkg", "", "deprecated and ignored: templates are parsed from -templates-path (compiled templates run with the bootstrap NewQuickServer)")
 		staticDir     = flag.String("static-dir", "", "path to static files directory (optional)")
 		addr          = flag.String("addr", ":8080", "address to listen on")
-		templatePkg   = flag.String("template-pkg", "", "path to compiled template package (e.g., github.com/your/project/templates)")
+		keepKeyOrder  = flag.Bool("keep-key-order", false, "iterate objects in data files in the order of their keys in the file instead of in sorted order")
 	)
 	flag.Parse()
 
@@ -41,22 +43,29 @@ func main() {
 
 	// Create configuration
 	config := &processor.Config{
-		RootPath:   root,
-		DataPath:   *dataPath,
-		SharedPath: *sharedPath,
-		OutputPath: "", // Not used for server
+		RootPath:     root,
+		DataPath:     *dataPath,
+		SharedPath:   *sharedPath,
+		OutputPath:   "", // Not used for server
+		KeepKeyOrder: *keepKeyOrder,
 	}
 
 	// Load shared data
-	sharedData, err := processor.LoadSharedData(filepath.Join(root, *sharedPath))
+	loadSharedData := processor.LoadSharedData
+	if *keepKeyOrder {
+		loadSharedData = processor.LoadOrderedSharedData
+	}
+	sharedData, err := loadSharedData(filepath.Join(root, *sharedPath))
 	if err != nil {
 		log.Fatal("Failed to load shared data: %v", err)
 	}
 
+	if *templatePkg != "" {
+		log.Warn("-template-pkg is deprecated and ignored: templates are parsed from %s", filepath.Join(root, *templatesPath))
+	}
+
 	// Create renderer
-	// Note: In a real implementation, you would load the compiled template package
-	// For now, we'll create a placeholder that needs to be implemented
-	renderer, err := createRenderer(*templatePkg)
+	renderer, err := createRenderer(filepath.Join(root, *templatesPath))
 	if err != nil {
 		log.Fatal("Failed to create renderer: %v", err)
 	}
@@ -81,11 +90,9 @@ func main() {
 	}
 }
 
-// createRenderer creates a template renderer.
-// This is a placeholder - in a real implementation, you would load the compiled template package.
-func createRenderer(templatePkg string) (renderer.TemplateRenderer, error) {
-	// For now, return an error indicating that templates need to be loaded
-	// In a real implementation, you would use reflection or a registry to load
-	// the compiled template package
-	return nil, hexerr.New("template renderer not implemented - you need to load compiled templates")
+// createRenderer parses the templates in templatesDir; they are rendered by the interpreter,
+// so no compiled template package is needed. A panicking helper fails the request with a
+// positioned error instead of dropping the response.
+func createRenderer(templatesDir string) (renderer.TemplateRenderer, error) {
+	return interpreter.LoadDir(templatesDir, interpreter.Options{RecoverHelpers: true})
 }
@@ -7,33 +7,18 @@ import (
 	"github.com/andriyg76/go-hbars/runtime"
 )
 
-// rawGetter is implemented by typed context interfaces (e.g. MainContext).
-type rawGetter interface{ Raw() any }
-
-// Lookup looks up a value from the context or data by key.
+// Lookup looks up a value from the context or data by key: a map entry, a field or
+// zero-arg method of a Go struct, or a slice element by index (see runtime.Resolve).
 func Lookup(args []any) (any, error) {
 	obj := helpers.GetArg(args, 0)
 	key := helpers.GetStringArg(args, 1)
-	
 	if key == "" {
 		return nil, nil
 	}
-	// Typed context interfaces expose Raw(); use it for map lookup
-	if r, ok := obj.(rawGetter); ok {
-		obj = r.Raw()
+	if m, ok := obj.(map[any]any); ok {
+		return m[key], nil
 	}
-	switch v := obj.(type) {
-	case map[string]any:
-		if val, ok := v[key]; ok {
-			return val, nil
-		}
-	case map[any]any:
-		if val, ok := v[key]; ok {
-			return val, nil
-		}
-	}
-	
-	return nil, nil
+	return runtime.Resolve(obj, key), nil
 }
 
 // Default returns the first argument if it's truthy, otherwise returns the default value.
@@ -73,6 +58,8 @@ func Length(args []any) (any, error) {
 		return len(v), nil
 	case map[string]any:
 		return len(v), nil
+	case *runtime.OrderedMap:
+		return v.Len(), nil
 	case map[any]any:
 		return len(v), nil
 	default:
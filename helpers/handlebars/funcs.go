@@ -0,0 +1,74 @@
+package handlebars
+
+import "github.com/andriyg76/go-hbars/runtime"
+
+// Helpers returns the helpers of helpers.Registry() as functions, by name, for rendering
+// without code generation (pkg/interpreter) or registering in a runtime.Registry. Values are
+// runtime.Helper, or runtime.OptionsBlockHelper for the iterating block helpers.
+func Helpers() map[string]any {
+	return map[string]any{
+		"upper":            runtime.Helper(Upper),
+		"lower":            runtime.Helper(Lower),
+		"capitalize":       runtime.Helper(Capitalize),
+		"capitalizeAll":    runtime.Helper(CapitalizeAll),
+		"truncate":         runtime.Helper(Truncate),
+		"reverse":          runtime.Helper(Reverse),
+		"replace":          runtime.Helper(Replace),
+		"stripTags":        runtime.Helper(StripTags),
+		"stripQuotes":      runtime.Helper(StripQuotes),
+		"join":             runtime.Helper(Join),
+		"split":            runtime.Helper(Split),
+		"eq":               runtime.Helper(Eq),
+		"ne":               runtime.Helper(Ne),
+		"lt":               runtime.Helper(Lt),
+		"lte":              runtime.Helper(Lte),
+		"gt":               runtime.Helper(Gt),
+		"gte":              runtime.Helper(Gte),
+		"and":              runtime.Helper(And),
+		"or":               runtime.Helper(Or),
+		"not":              runtime.Helper(Not),
+		"formatDate":       runtime.Helper(FormatDate),
+		"now":              runtime.Helper(Now),
+		"ago":              runtime.Helper(Ago),
+		"lookup":           runtime.Helper(Lookup),
+		"default":          runtime.Helper(Default),
+		"length":           runtime.Helper(Length),
+		"first":            runtime.Helper(First),
+		"last":             runtime.Helper(Last),
+		"inArray":          runtime.Helper(InArray),
+		"repeat":           runtime.OptionsBlockHelper(Repeat),
+		"range":            runtime.OptionsBlockHelper(Range),
+		"sortBy":           runtime.OptionsBlockHelper(SortBy),
+		"filterBy":         runtime.OptionsBlockHelper(FilterBy),
+		"groupBy":          runtime.OptionsBlockHelper(GroupBy),
+		"chunk":            runtime.OptionsBlockHelper(Chunk),
+		"add":              runtime.Helper(Add),
+		"subtract":         runtime.Helper(Subtract),
+		"multiply":         runtime.Helper(Multiply),
+		"divide":           runtime.Helper(Divide),
+		"modulo":           runtime.Helper(Modulo),
+		"floor":            runtime.Helper(Floor),
+		"ceil":             runtime.Helper(Ceil),
+		"round":            runtime.Helper(Round),
+		"abs":              runtime.Helper(Abs),
+		"min":              runtime.Helper(Min),
+		"max":              runtime.Helper(Max),
+		"formatNumber":     runtime.Helper(FormatNumber),
+		"toInt":            runtime.Helper(ToInt),
+		"toFloat":          runtime.Helper(ToFloat),
+		"random":           runtime.Helper(Random),
+		"toFixed":          runtime.Helper(ToFixed),
+		"toString":         runtime.Helper(ToString),
+		"toNumber":         runtime.Helper(ToNumber),
+		"has":              runtime.Helper(Has),
+		"keys":             runtime.Helper(Keys),
+		"values":           runtime.Helper(Values),
+		"size":             runtime.Helper(Size),
+		"isEmpty":          runtime.Helper(IsEmpty),
+		"isNotEmpty":       runtime.Helper(IsNotEmpty),
+		"encodeURI":        runtime.Helper(EncodeURI),
+		"decodeURI":        runtime.Helper(DecodeURI),
+		"stripProtocol":    runtime.Helper(StripProtocol),
+		"stripQuerystring": runtime.Helper(StripQuerystring),
+	}
+}
@@ -0,0 +1,28 @@
+package handlebars
+
+import (
+	"reflect"
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/helpers"
+)
+
+func TestHelpersMatchRegistry(t *testing.T) {
+	funcs := Helpers()
+	registry := helpers.Registry()
+	if len(funcs) != len(registry) {
+		t.Errorf("Helpers() has %d helpers, helpers.Registry() %d", len(funcs), len(registry))
+	}
+	for name, ref := range registry {
+		fn, ok := funcs[name]
+		if !ok {
+			t.Errorf("Helpers() lacks %q", name)
+			continue
+		}
+		if got := goruntime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name(); !strings.HasSuffix(got, "."+ref.Ident) {
+			t.Errorf("Helpers()[%q] is %s, want %s", name, got, ref.Ident)
+		}
+	}
+}
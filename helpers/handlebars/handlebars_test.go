@@ -1,6 +1,9 @@
 package handlebars
 
 import (
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -240,3 +243,119 @@ func TestCollectionHelpers(t *testing.T) {
 	}
 }
 
+
+// renderBlock calls an iterating block helper with a body that writes the context,
+// @index, @first/@last and the block params, and an {{else}} that writes "else".
+func renderBlock(t *testing.T, helper runtime.OptionsBlockHelper, args []any, hash runtime.Hash) string {
+	t.Helper()
+	opts := &runtime.HelperOptions{Context: "caller", Data: runtime.NewRootFrame(nil), Hash: hash}
+	opts.SetBlock(func(w io.Writer, ctx any, data *runtime.DataFrame) error {
+		s := runtime.Stringify(runtime.LookupPath(ctx, "title"))
+		if s == "" {
+			s = runtime.Stringify(ctx)
+		}
+		if data.Get("first") == true {
+			s = "^" + s
+		}
+		if data.Get("last") == true {
+			s += "$"
+		}
+		_, err := io.WriteString(w, s+"@"+runtime.Stringify(data.Get("index"))+"="+runtime.Stringify(data.BlockParam(1))+" ")
+		return err
+	}, func(w io.Writer, ctx any, data *runtime.DataFrame) error {
+		_, err := io.WriteString(w, "else:"+runtime.Stringify(ctx))
+		return err
+	})
+	var b strings.Builder
+	if err := helper(&b, args, opts); err != nil {
+		t.Fatalf("helper error: %v", err)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func TestIterateHelpers(t *testing.T) {
+	posts := []any{
+		map[string]any{"title": "a", "year": 2023.0},
+		map[string]any{"title": "b", "year": 2024.0, "draft": true},
+		map[string]any{"title": "c", "year": 2023.0},
+	}
+	tests := []struct {
+		name   string
+		helper runtime.OptionsBlockHelper
+		args   []any
+		hash   runtime.Hash
+		want   string
+	}{
+		{"repeat", Repeat, []any{2}, nil, "^caller@0= caller$@1="},
+		{"repeat zero", Repeat, []any{0}, nil, "else:caller"},
+		{"range", Range, []any{1, 4}, nil, "^1@0=0 2@1=1 3$@2=2"},
+		{"range step", Range, []any{10, 0, -4}, nil, "^10@0=0 6@1=1 2$@2=2"},
+		{"range empty", Range, []any{3, 3}, nil, "else:caller"},
+		{"sortBy", SortBy, []any{posts, "year"}, runtime.Hash{"desc": true}, "^b@0=0 a@1=1 c$@2=2"},
+		{"sortBy typed slice", SortBy, []any{[]string{"y", "x"}}, nil, "^x@0=0 y$@1=1"},
+		{"filterBy truthy", FilterBy, []any{posts, "draft"}, nil, "^b$@0=0"},
+		{"filterBy value", FilterBy, []any{posts, "year", 2023}, nil, "^a@0=0 c$@1=1"},
+		{"filterBy none", FilterBy, []any{posts, "year", 1999}, nil, "else:caller"},
+		{"groupBy", GroupBy, []any{posts, "year"}, nil, "^map[items:[map[title:a year:2023] map[title:c year:2023]] key:2023]@0=2023 map[items:[map[draft:true title:b year:2024]] key:2024]$@1=2024"},
+		{"chunk", Chunk, []any{posts, 2}, nil, "^[map[title:a year:2023] map[draft:true title:b year:2024]]@0=0 [map[title:c year:2023]]$@1=1"},
+		{"chunk bad size", Chunk, []any{posts, 0}, nil, "else:caller"},
+	}
+	for _, tt := range tests {
+		if got := renderBlock(t, tt.helper, tt.args, tt.hash); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+type lookupAuthor struct {
+	Name string `json:"name"`
+}
+
+func (a *lookupAuthor) Initials() string { return a.Name[:1] }
+
+type lookupPost struct {
+	*lookupAuthor
+	Title string
+}
+
+func TestLookupStruct(t *testing.T) {
+	post := lookupPost{lookupAuthor: &lookupAuthor{Name: "ann"}, Title: "Post"}
+	for key, want := range map[string]any{"title": "Post", "name": "ann", "initials": "a", "missing": nil} {
+		got, err := Lookup([]any{post, key})
+		if err == nil {
+			got, err = runtime.Value(nil, got)
+		}
+		if err != nil || got != want {
+			t.Errorf("Lookup(post, %q) = %v, %v; want %v", key, got, err, want)
+		}
+	}
+	if got, _ := Lookup([]any{[]any{"a", "b"}, "1"}); got != "b" {
+		t.Errorf("Lookup(slice, 1) = %v", got)
+	}
+}
+
+func TestKeysValuesOrder(t *testing.T) {
+	m := map[string]any{"c": 3, "a": 1, "b": 2}
+	if got, _ := Keys([]any{m}); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("Keys(map) = %v", got)
+	}
+	if got, _ := Values([]any{m}); !reflect.DeepEqual(got, []any{1, 2, 3}) {
+		t.Errorf("Values(map) = %v", got)
+	}
+	om := runtime.NewOrderedMap().Set("c", 3).Set("a", 1)
+	if got, _ := Keys([]any{om}); !reflect.DeepEqual(got, []string{"c", "a"}) {
+		t.Errorf("Keys(OrderedMap) = %v", got)
+	}
+	if got, _ := Values([]any{om}); !reflect.DeepEqual(got, []any{3, 1}) {
+		t.Errorf("Values(OrderedMap) = %v", got)
+	}
+	if got, _ := Keys([]any{map[any]any{2: "b", 1: "a"}}); !reflect.DeepEqual(got, []any{1, 2}) {
+		t.Errorf("Keys(map[any]any) = %v", got)
+	}
+	if got, _ := Has([]any{om, "a"}); got != true {
+		t.Error("Has(OrderedMap, a) = false")
+	}
+	if got, _ := Length([]any{om}); got != 2 {
+		t.Errorf("Length(OrderedMap) = %v", got)
+	}
+}
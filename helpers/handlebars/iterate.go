@@ -0,0 +1,279 @@
+package handlebars
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/andriyg76/go-hbars/helpers"
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+// Iterating block helpers. Each renders its body once per item with @index, @first and @last
+// set and the block params described below, and renders {{else}} when there is nothing to iterate.
+// They are runtime.OptionsBlockHelper values and are registered with Options set.
+
+// Repeat renders the body n times with the caller's context: {{#repeat 3 as |i|}}.
+func Repeat(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	n, err := helpers.GetNumberArg(args, 0)
+	if err != nil || n < 1 {
+		return options.Inverse(w, options.Context, nil)
+	}
+	count := int(n)
+	for i := 0; i < count; i++ {
+		if err := options.Fn(w, options.Context, iterFrame(options, i, count).SetBlockParams(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Range renders the body for each integer from start up to (not including) end, with the
+// number as context: {{#range 1 10 2 as |n i|}}. The step defaults to 1, or -1 when end < start.
+func Range(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	start, err1 := helpers.GetNumberArg(args, 0)
+	end, err2 := helpers.GetNumberArg(args, 1)
+	if err1 != nil || err2 != nil {
+		return options.Inverse(w, options.Context, nil)
+	}
+	step := 1.0
+	if end < start {
+		step = -1
+	}
+	if len(args) > 2 {
+		s, err := helpers.GetNumberArg(args, 2)
+		if err != nil || s == 0 {
+			return options.Inverse(w, options.Context, nil)
+		}
+		step = math.Trunc(s)
+	}
+	from, to, by := int(start), int(end), int(step)
+	count := 0
+	if (by > 0 && to > from) || (by < 0 && to < from) {
+		count = (to - from + by - sign(by)) / by
+	}
+	if count == 0 {
+		return options.Inverse(w, options.Context, nil)
+	}
+	for i := 0; i < count; i++ {
+		n := from + i*by
+		if err := options.Fn(w, n, iterFrame(options, i, count).SetBlockParams(n, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SortBy renders the body for each item of a list in order of the field key (the items
+// themselves when key is omitted): {{#sortBy posts "date" desc=true as |post i|}}.
+// Numbers compare numerically, other values as strings; the sort is stable.
+func SortBy(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	list := listArg(args, 0)
+	key := helpers.GetStringArg(args, 1)
+	desc := helpers.IsTruthy(options.HashValue("desc", false))
+	type sortItem struct{ item, key any }
+	items := make([]sortItem, len(list))
+	for i, item := range list {
+		v, err := fieldValue(options, item, key)
+		if err != nil {
+			return err
+		}
+		items[i] = sortItem{item, v}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		c := compareValues(items[i].key, items[j].key)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	sorted := make([]any, len(items))
+	for i, it := range items {
+		sorted[i] = it.item
+	}
+	return eachItem(w, sorted, options)
+}
+
+// FilterBy renders the body for each item of a list whose field equals value, or is truthy
+// when value is omitted: {{#filterBy posts "draft" false as |post|}}.
+func FilterBy(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	field := helpers.GetStringArg(args, 1)
+	var kept []any
+	for _, item := range listArg(args, 0) {
+		v, err := fieldValue(options, item, field)
+		if err != nil {
+			return err
+		}
+		if len(args) > 2 {
+			if valuesEqual(v, args[2]) {
+				kept = append(kept, item)
+			}
+		} else if helpers.IsTruthy(v) {
+			kept = append(kept, item)
+		}
+	}
+	return eachItem(w, kept, options)
+}
+
+// GroupBy renders the body once per distinct value of field, in order of first appearance.
+// The context is {key, items}; @key is the value and the block params are the items and the key:
+// {{#groupBy posts "year" as |posts year|}}.
+func GroupBy(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	field := helpers.GetStringArg(args, 1)
+	var keys []any
+	groups := make(map[string][]any)
+	for _, item := range listArg(args, 0) {
+		v, err := fieldValue(options, item, field)
+		if err != nil {
+			return err
+		}
+		k := runtime.Stringify(v)
+		if _, seen := groups[k]; !seen {
+			keys = append(keys, v)
+		}
+		groups[k] = append(groups[k], item)
+	}
+	if len(keys) == 0 {
+		return options.Inverse(w, options.Context, nil)
+	}
+	for i, key := range keys {
+		group := groups[runtime.Stringify(key)]
+		ctx := map[string]any{"key": key, "items": group}
+		data := iterFrame(options, i, len(keys)).Set("key", key).SetBlockParams(group, key)
+		if err := options.Fn(w, ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chunk renders the body once per row of up to size items, with the row as context:
+// {{#chunk photos 3 as |row i|}}{{#each row}}...{{/each}}{{/chunk}}.
+func Chunk(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	items := listArg(args, 0)
+	size, err := helpers.GetNumberArg(args, 1)
+	if err != nil || size < 1 || len(items) == 0 {
+		return options.Inverse(w, options.Context, nil)
+	}
+	n := int(size)
+	count := (len(items) + n - 1) / n
+	for i := 0; i < count; i++ {
+		row := items[i*n : min((i+1)*n, len(items))]
+		if err := options.Fn(w, row, iterFrame(options, i, count).SetBlockParams(row, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachItem renders the body for each item, with the item as context and block params [item, index].
+func eachItem(w io.Writer, items []any, options *runtime.HelperOptions) error {
+	if len(items) == 0 {
+		return options.Inverse(w, options.Context, nil)
+	}
+	for i, item := range items {
+		if err := options.Fn(w, item, iterFrame(options, i, len(items)).SetBlockParams(item, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// iterFrame returns the @data frame for item i of count.
+func iterFrame(options *runtime.HelperOptions, i, count int) *runtime.DataFrame {
+	return runtime.NewDataFrame(options.Data).Set("index", i).Set("first", i == 0).Set("last", i == count-1)
+}
+
+// listArg returns args[idx] as a list; slices of any element type (including generated
+// context types) are accepted, anything else is an empty list.
+func listArg(args []any, idx int) []any {
+	v := helpers.GetArg(args, idx)
+	if s, ok := v.([]any); ok {
+		return s
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	out := make([]any, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out
+}
+
+// fieldValue returns the (dotted) field of item, or item itself when field is empty. Function
+// values are called with the render's context (see runtime.Value).
+func fieldValue(options *runtime.HelperOptions, item any, field string) (any, error) {
+	if field == "" {
+		return runtime.RawValue(item), nil
+	}
+	return runtime.Value(options.Ctx, runtime.LookupPath(item, field))
+}
+
+// compareValues orders nil first, then numbers numerically, then everything else as strings.
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if x, ok := numberValue(a); ok {
+		if y, ok := numberValue(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	sa, sb := runtime.Stringify(a), runtime.Stringify(b)
+	switch {
+	case sa < sb:
+		return -1
+	case sa > sb:
+		return 1
+	}
+	return 0
+}
+
+// valuesEqual compares numbers numerically and other values by their string form.
+func valuesEqual(a, b any) bool {
+	if x, ok := numberValue(a); ok {
+		y, ok := numberValue(b)
+		return ok && x == y
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return runtime.Stringify(a) == runtime.Stringify(b)
+}
+
+// numberValue returns v as a float64 when it is a Go number (strings are not converted).
+func numberValue(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
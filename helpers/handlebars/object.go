@@ -1,7 +1,11 @@
 package handlebars
 
 import (
+	"slices"
+	"sort"
+
 	"github.com/andriyg76/go-hbars/helpers"
+	"github.com/andriyg76/go-hbars/runtime"
 )
 
 // Has returns true if an object has a property.
@@ -17,6 +21,9 @@ func Has(args []any) (any, error) {
 	case map[string]any:
 		_, ok := v[key]
 		return ok, nil
+	case *runtime.OrderedMap:
+		_, ok := v.Get(key)
+		return ok, nil
 	case map[any]any:
 		_, ok := v[key]
 		return ok, nil
@@ -24,48 +31,61 @@ func Has(args []any) (any, error) {
 	return false, nil
 }
 
-// Keys returns the keys of an object.
+// Keys returns the keys of an object: in sorted order for a map, in its order for a
+// runtime.OrderedMap, as {{#each}} iterates them.
 func Keys(args []any) (any, error) {
 	obj := helpers.GetArg(args, 0)
 	
 	switch v := obj.(type) {
 	case map[string]any:
-		keys := make([]string, 0, len(v))
-		for k := range v {
-			keys = append(keys, k)
-		}
-		return keys, nil
+		return runtime.SortedKeys(v), nil
+	case *runtime.OrderedMap:
+		return slices.Clone(v.Keys()), nil
 	case map[any]any:
 		keys := make([]any, 0, len(v))
 		for k := range v {
 			keys = append(keys, k)
 		}
+		sortAnyKeys(keys)
 		return keys, nil
 	}
 	return []any{}, nil
 }
 
-// Values returns the values of an object.
+// Values returns the values of an object, in the order of Keys.
 func Values(args []any) (any, error) {
 	obj := helpers.GetArg(args, 0)
 	
 	switch v := obj.(type) {
-	case map[string]any:
-		values := make([]any, 0, len(v))
-		for _, val := range v {
-			values = append(values, val)
+	case map[string]any, *runtime.OrderedMap:
+		entries := runtime.Entries(v)
+		values := make([]any, 0, len(entries))
+		for _, e := range entries {
+			values = append(values, e.Value)
 		}
 		return values, nil
 	case map[any]any:
+		keys := make([]any, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sortAnyKeys(keys)
 		values := make([]any, 0, len(v))
-		for _, val := range v {
-			values = append(values, val)
+		for _, k := range keys {
+			values = append(values, v[k])
 		}
 		return values, nil
 	}
 	return []any{}, nil
 }
 
+// sortAnyKeys sorts map keys by their string form.
+func sortAnyKeys(keys []any) {
+	sort.Slice(keys, func(i, j int) bool {
+		return runtime.Stringify(keys[i]) < runtime.Stringify(keys[j])
+	})
+}
+
 // Size returns the size of an object or array.
 func Size(args []any) (any, error) {
 	return Length(args)
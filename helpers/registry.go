@@ -4,6 +4,10 @@ package helpers
 type HelperRef struct {
 	ImportPath string
 	Ident      string
+	Options    bool // the helper is a runtime.OptionsHelper or runtime.OptionsBlockHelper
+	// BlockContext tells context inference what the body of an Options block helper is
+	// rendered with: "this", "item", "group" or "row" (see compiler.HelperRef); empty means unknown.
+	BlockContext string
 }
 
 // Registry returns a map of helper names to their HelperRef for use in compiler.Options.
@@ -48,6 +52,14 @@ func Registry() map[string]HelperRef {
 		"first":   {ImportPath: importPath, Ident: "First"},
 		"last":    {ImportPath: importPath, Ident: "Last"},
 		"inArray": {ImportPath: importPath, Ident: "InArray"},
+
+		// Iterating block helpers
+		"repeat":   {ImportPath: importPath, Ident: "Repeat", Options: true, BlockContext: "this"},
+		"range":    {ImportPath: importPath, Ident: "Range", Options: true},
+		"sortBy":   {ImportPath: importPath, Ident: "SortBy", Options: true, BlockContext: "item"},
+		"filterBy": {ImportPath: importPath, Ident: "FilterBy", Options: true, BlockContext: "item"},
+		"groupBy":  {ImportPath: importPath, Ident: "GroupBy", Options: true, BlockContext: "group"},
+		"chunk":    {ImportPath: importPath, Ident: "Chunk", Options: true, BlockContext: "row"},
 		
 		// Math helpers
 		"add":      {ImportPath: importPath, Ident: "Add"},
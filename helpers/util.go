@@ -84,6 +84,10 @@ func IsTruthy(v any) bool {
 		return len(t) > 0
 	case map[string]any:
 		return len(t) > 0
+	case *runtime.OrderedMap:
+		return t.Len() > 0
+	case runtime.TemplateValue:
+		return t.TemplateTruthy()
 	default:
 		rv := reflect.ValueOf(v)
 		switch rv.Kind() {
@@ -114,6 +118,10 @@ func IsEmpty(v any) bool {
 		return len(t) == 0
 	case map[string]any:
 		return len(t) == 0
+	case *runtime.OrderedMap:
+		return t.Len() == 0
+	case runtime.TemplateValue:
+		return !t.TemplateTruthy()
 	default:
 		rv := reflect.ValueOf(v)
 		switch rv.Kind() {
@@ -130,25 +138,7 @@ func IsEmpty(v any) bool {
 	}
 }
 
-// ParseTime attempts to parse a time string using common formats.
+// ParseTime attempts to parse a time string using common formats (see runtime.ParseTime).
 func ParseTime(s string) (time.Time, error) {
-	formats := []string{
-		time.RFC3339,
-		time.RFC3339Nano,
-		"2006-01-02T15:04:05Z07:00",
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04:05",
-		"2006-01-02",
-		time.RFC1123,
-		time.RFC1123Z,
-		time.RFC822,
-		time.RFC822Z,
-	}
-	for _, fmt := range formats {
-		if t, err := time.Parse(fmt, s); err == nil {
-			return t, nil
-		}
-	}
-	return time.Time{}, hexerr.Newf("unable to parse time: %q", s)
+	return runtime.ParseTime(s)
 }
-
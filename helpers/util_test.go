@@ -112,8 +112,21 @@ func TestIsTruthy(t *testing.T) {
 	if IsTruthy(0.0) {
 		t.Error("IsTruthy(0.0) want false")
 	}
+	if IsTruthy(flag(false)) || !IsTruthy(flag(true)) {
+		t.Error("IsTruthy(TemplateValue) does not use TemplateTruthy")
+	}
+	if !IsEmpty(flag(false)) || IsEmpty(flag(true)) {
+		t.Error("IsEmpty(TemplateValue) does not use TemplateTruthy")
+	}
 }
 
+// flag is a runtime.TemplateValue that is truthy when it is true.
+type flag bool
+
+func (f flag) TemplateHTML() string   { return f.TemplateString() }
+func (f flag) TemplateString() string { return "flag" }
+func (f flag) TemplateTruthy() bool   { return bool(f) }
+
 func TestIsEmpty(t *testing.T) {
 	if !IsEmpty(nil) {
 		t.Error("IsEmpty(nil) want true")
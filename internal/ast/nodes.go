@@ -1,12 +1,34 @@
 package ast
 
+import "strconv"
+
 // Node is a template AST node.
 type Node interface {
 	node()
+	Position() Pos
+}
+
+// Pos is a position in the template source (1-based line and column).
+// The zero Pos means the position is unknown.
+type Pos struct {
+	Line int
+	Col  int
+}
+
+// Position returns p; embedding Pos gives every node a Position method.
+func (p Pos) Position() Pos { return p }
+
+// IsValid reports whether p holds a known position.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+// String formats p as "line:col".
+func (p Pos) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Col)
 }
 
 // Text is a raw text node.
 type Text struct {
+	Pos
 	Value string
 }
 
@@ -14,6 +36,7 @@ func (*Text) node() {}
 
 // Mustache is a simple mustache expression.
 type Mustache struct {
+	Pos
 	Expr string
 	Raw  bool
 }
@@ -22,6 +45,7 @@ func (*Mustache) node() {}
 
 // Partial is a partial invocation.
 type Partial struct {
+	Pos
 	Expr string
 }
 
@@ -29,6 +53,7 @@ func (*Partial) node() {}
 
 // Block is a block helper invocation with an optional else branch.
 type Block struct {
+	Pos
 	Name   string
 	Args   string
 	Params []string
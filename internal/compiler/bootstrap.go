@@ -1,7 +1,7 @@
 package compiler
 
 // generateBootstrapCode generates helper functions for quick server/processor setup.
-// It writes rendererFuncs, NewRenderer, NewQuickProcessor, and NewQuickServer.
+// It writes rendererFuncs, rendererContextFuncs, NewRenderer, NewQuickProcessor, and NewQuickServer.
 // partialParamTypes: when a partial uses another template's context (e.g. footer uses MainContext),
 // the bootstrap uses that context type and its FromMap for the wrapper.
 // useLayoutBlocks: when true, templates use {{#block}}/{{#partial}} layout and rendererFuncs call RenderXxxWithBlocks with runtime.NewBlocks().
@@ -35,13 +35,43 @@ func generateBootstrapCode(w *codeWriter, templateNames []string, funcNames map[
 	w.indentDec()
 	w.line("}")
 
+	// Generate the context-aware renderer map, used by NewRenderer
+	w.line("")
+	w.line("// rendererContextFuncs maps template names to render functions that take the render's context.")
+	w.line("var rendererContextFuncs = map[string]func(context.Context, io.Writer, any) error{")
+	w.indentInc()
+	for _, name := range templateNames {
+		goName := funcNames[name]
+		rootContext := partialParamTypes[name]
+		if rootContext == "" {
+			rootContext = goName + "Context"
+		}
+		fromMap := rootContext + "FromMap"
+		w.line("%q: func(ctx context.Context, w io.Writer, data any) error {", name)
+		w.indentInc()
+		if useLayoutBlocks {
+			w.line("env := &runtime.Env{Context: ctx}")
+			w.line("if c, ok := data.(%s); ok { return runtime.WrapError(render%s(c, w, c, runtime.NewBlocks(), env), %q, 0, 0) }", rootContext, goName, name)
+			w.line("if m, ok := data.(map[string]any); ok { c := %s(m); return runtime.WrapError(render%s(c, w, c, runtime.NewBlocks(), env), %q, 0, 0) }", fromMap, goName, name)
+		} else {
+			w.line("if c, ok := data.(%s); ok { return Render%sContext(ctx, w, c) }", rootContext, goName)
+			w.line("if m, ok := data.(map[string]any); ok { return Render%sContext(ctx, w, %s(m)) }", goName, fromMap)
+		}
+		w.line("return fmt.Errorf(%q, data)", name+": expected "+rootContext+" or map[string]any, got %T")
+		w.indentDec()
+		w.line("},")
+	}
+	w.indentDec()
+	w.line("}")
+
 	// Generate NewRenderer function
 	w.line("")
 	w.line("// NewRenderer returns a ready-to-use template renderer.")
-	w.line("// This renderer can be used with sitegen.NewProcessor or sitegen.NewServer.")
+	w.line("// This renderer can be used with sitegen.NewProcessor or sitegen.NewServer; it implements")
+	w.line("// renderer.ContextTemplateRenderer, so the server stops rendering when a request is cancelled.")
 	w.line("func NewRenderer() renderer.TemplateRenderer {")
 	w.indentInc()
-	w.line("return sitegen.NewRendererFromFunctions(rendererFuncs)")
+	w.line("return sitegen.NewRendererFromContextFunctions(rendererContextFuncs)")
 	w.indentDec()
 	w.line("}")
 
@@ -37,10 +37,21 @@ func TestCompileTemplates_GenerateBootstrap(t *testing.T) {
 		t.Fatalf("missing header in rendererFuncs")
 	}
 
+	// Check for rendererContextFuncs map
+	if !strings.Contains(src, "var rendererContextFuncs = map[string]func(context.Context, io.Writer, any) error") {
+		t.Fatalf("missing rendererContextFuncs map")
+	}
+	if !strings.Contains(src, "RenderMainContext(ctx, w, c)") {
+		t.Fatalf("missing main in rendererContextFuncs")
+	}
+
 	// Check for NewRenderer function
 	if !strings.Contains(src, "func NewRenderer() renderer.TemplateRenderer") {
 		t.Fatalf("missing NewRenderer function")
 	}
+	if !strings.Contains(src, "sitegen.NewRendererFromContextFunctions(rendererContextFuncs)") {
+		t.Fatalf("NewRenderer does not use rendererContextFuncs")
+	}
 
 	// Check for NewQuickProcessor function
 	if !strings.Contains(src, "func NewQuickProcessor() (*sitegen.Processor, error)") {
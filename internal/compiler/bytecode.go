@@ -0,0 +1,451 @@
+package compiler
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/internal/ast"
+	"github.com/andriyg76/go-hbars/internal/parser"
+	"github.com/andriyg76/go-hbars/runtime"
+	"github.com/andriyg76/hexerr"
+)
+
+// CompileBytecode compiles templates to the bytecode format (hbc -format=bytecode), which
+// runtime.LoadVM loads and renders without go build. Of opts only Escape and TemplateEscape
+// apply: helpers are bound when the program is loaded (runtime.VMOptions) and resolved at
+// render time, as in pkg/interpreter, and contextual escaping and StringifyJS need generated
+// Go code.
+func CompileBytecode(templates map[string]string, opts Options) ([]byte, error) {
+	p, err := compileProgram(templates, opts)
+	if err != nil {
+		return nil, err
+	}
+	return p.MarshalBinary()
+}
+
+// compileProgram compiles templates to a runtime.Program, in template name order.
+func compileProgram(templates map[string]string, opts Options) (*runtime.Program, error) {
+	if opts.Stringify == StringifyJS {
+		return nil, hexerr.New("compiler: stringify mode \"js\" needs generated Go code")
+	}
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := &bytecodeCompiler{
+		prog:      &runtime.Program{},
+		templates: templates,
+		strings:   make(map[string]int32),
+		helpers:   make(map[string]int32),
+		partials:  make(map[string]int32),
+	}
+	for _, name := range names {
+		src := templates[name]
+		nodes, err := parser.Parse(src)
+		if err != nil {
+			return nil, hexerr.Wrapf(err, "compiler: template %q", name)
+		}
+		escape, err := templateEscape(name, src, opts)
+		if err != nil {
+			return nil, hexerr.Wrapf(err, "compiler: template %q", name)
+		}
+		if escape == EscapeContextual {
+			return nil, hexerr.Newf("compiler: template %q: contextual escaping needs generated Go code", name)
+		}
+		c.tmpl = &runtime.ProgramTemplate{Name: name, Escape: escape}
+		c.pos = ast.Pos{}
+		if err := c.nodes(nodes); err != nil {
+			return nil, hexerr.Wrapf(err, "compiler: template %q line %s", name, c.pos)
+		}
+		c.prog.Templates = append(c.prog.Templates, *c.tmpl)
+	}
+	return c.prog, nil
+}
+
+// bytecodeCompiler emits the code of a runtime.Program (see runtime.Opcode).
+type bytecodeCompiler struct {
+	prog      *runtime.Program
+	templates map[string]string
+	strings   map[string]int32 // indexes of prog.Strings
+	helpers   map[string]int32 // indexes of prog.Helpers
+	partials  map[string]int32 // indexes of prog.Partials
+	tmpl      *runtime.ProgramTemplate
+	pos       ast.Pos // node being compiled, for errors and the line table
+}
+
+// tableIndex returns the index of s in table, adding it when it is missing.
+func tableIndex(table *[]string, indexes map[string]int32, s string) int32 {
+	if i, ok := indexes[s]; ok {
+		return i
+	}
+	i := int32(len(*table))
+	*table = append(*table, s)
+	indexes[s] = i
+	return i
+}
+
+func (c *bytecodeCompiler) str(s string) int32 {
+	return tableIndex(&c.prog.Strings, c.strings, s)
+}
+
+func (c *bytecodeCompiler) helper(name string) int32 {
+	return tableIndex(&c.prog.Helpers, c.helpers, name)
+}
+
+func (c *bytecodeCompiler) partial(name string) int32 {
+	return tableIndex(&c.prog.Partials, c.partials, name)
+}
+
+// emit appends an instruction and returns its offset. Operands after the given ones are 0.
+func (c *bytecodeCompiler) emit(op runtime.Opcode, operands ...int32) int32 {
+	pc := int32(len(c.tmpl.Code))
+	if n := len(c.tmpl.Lines); c.pos.IsValid() && (n == 0 || c.tmpl.Lines[n-1].Line != int32(c.pos.Line) || c.tmpl.Lines[n-1].Col != int32(c.pos.Col)) {
+		c.tmpl.Lines = append(c.tmpl.Lines, runtime.LinePos{PC: pc, Line: int32(c.pos.Line), Col: int32(c.pos.Col)})
+	}
+	in := runtime.Instr{Op: op}
+	setOperands(&in, operands)
+	c.tmpl.Code = append(c.tmpl.Code, in)
+	return pc
+}
+
+// patch sets the operands of the instruction at pc, once the offsets it jumps to are known.
+func (c *bytecodeCompiler) patch(pc int32, operands ...int32) {
+	setOperands(&c.tmpl.Code[pc], operands)
+}
+
+func setOperands(in *runtime.Instr, operands []int32) {
+	for i, p := range []*int32{&in.A, &in.B, &in.C, &in.D}[:len(operands)] {
+		*p = operands[i]
+	}
+}
+
+func (c *bytecodeCompiler) pc() int32 {
+	return int32(len(c.tmpl.Code))
+}
+
+func (c *bytecodeCompiler) nodes(nodes []ast.Node) error {
+	for _, node := range nodes {
+		c.pos = node.Position()
+		var err error
+		switch n := node.(type) {
+		case *ast.Text:
+			c.emit(runtime.OpText, c.str(n.Value))
+		case *ast.Mustache:
+			err = c.mustache(n)
+		case *ast.Partial:
+			err = c.partialNode(n)
+		case *ast.Block:
+			err = c.block(n)
+		default:
+			err = hexerr.Newf("unsupported node %T", node)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// section compiles the body or {{else}} section of a block, which ends with OpReturn.
+func (c *bytecodeCompiler) section(nodes []ast.Node) error {
+	pos := c.pos
+	if err := c.nodes(nodes); err != nil {
+		return err
+	}
+	c.pos = pos
+	c.emit(runtime.OpReturn)
+	return nil
+}
+
+// elseSection compiles the {{else}} section of a block, if any, and returns the offsets of
+// the else section and of the end of the block.
+func (c *bytecodeCompiler) elseSection(nodes []ast.Node) (int32, int32, error) {
+	elseAt := c.pc()
+	if len(nodes) == 0 {
+		return elseAt, elseAt, nil
+	}
+	if err := c.section(nodes); err != nil {
+		return 0, 0, err
+	}
+	return elseAt, c.pc(), nil
+}
+
+func (c *bytecodeCompiler) mustache(n *ast.Mustache) error {
+	parts, hash, err := parser.ParseExpr(n.Expr)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		if len(hash) > 0 {
+			return hexerr.New("unexpected hash arguments")
+		}
+		return nil
+	}
+	switch first := parts[0]; {
+	case len(parts) > 1:
+		if first.Kind != parser.ExprPath {
+			return hexerr.New("helper name must be a path")
+		}
+		err = c.call(first.Value, parts[1:], hash)
+	case len(hash) > 0:
+		if first.Kind != parser.ExprPath || !runtimeHelperName(first.Value) {
+			return hexerr.New("hash arguments require a helper")
+		}
+		err = c.call(first.Value, nil, hash)
+	case first.Kind == parser.ExprPath && runtimeHelperName(first.Value):
+		// A helper when the VM has one of that name, else a path.
+		c.emit(runtime.OpName, c.helper(first.Value))
+	default:
+		err = c.value(first)
+	}
+	if err != nil {
+		return err
+	}
+	raw := int32(0)
+	if n.Raw {
+		raw = 1
+	}
+	c.emit(runtime.OpOutput, raw)
+	return nil
+}
+
+// value compiles an expression that pushes its value.
+func (c *bytecodeCompiler) value(e parser.Expr) error {
+	switch e.Kind {
+	case parser.ExprPath:
+		c.emit(runtime.OpPath, c.str(e.Value))
+	case parser.ExprString:
+		c.emit(runtime.OpString, c.str(e.Value))
+	case parser.ExprNumber:
+		if _, err := strconv.ParseFloat(e.Value, 64); err != nil {
+			return hexerr.Newf("invalid number %q", e.Value)
+		}
+		c.emit(runtime.OpNumber, c.str(e.Value))
+	case parser.ExprBool:
+		b := int32(0)
+		if e.Value == "true" {
+			b = 1
+		}
+		c.emit(runtime.OpBool, b)
+	case parser.ExprNull:
+		c.emit(runtime.OpNull)
+	case parser.ExprCall:
+		return c.call(e.Name, e.Args, e.Hash)
+	default:
+		return hexerr.New("invalid expression")
+	}
+	return nil
+}
+
+// args compiles helper arguments and returns the argc operand of OpCall and OpBlock.
+func (c *bytecodeCompiler) args(args []parser.Expr, hash []parser.HashArg) (int32, error) {
+	for _, a := range args {
+		if err := c.value(a); err != nil {
+			return 0, err
+		}
+	}
+	argc := int32(len(args)) << 1
+	if len(hash) > 0 {
+		for _, h := range hash {
+			c.emit(runtime.OpString, c.str(h.Key))
+			if err := c.value(h.Value); err != nil {
+				return 0, err
+			}
+		}
+		c.emit(runtime.OpHash, int32(len(hash)))
+		argc |= 1
+	}
+	return argc, nil
+}
+
+func (c *bytecodeCompiler) call(name string, args []parser.Expr, hash []parser.HashArg) error {
+	argc, err := c.args(args, hash)
+	if err != nil {
+		return err
+	}
+	c.emit(runtime.OpCall, c.helper(name), argc)
+	return nil
+}
+
+// params emits the block params of the block instruction that follows.
+func (c *bytecodeCompiler) params(params []string) {
+	if len(params) > 0 {
+		c.emit(runtime.OpParams, c.str(strings.Join(params, " ")))
+	}
+}
+
+// checkParams checks the number of block params of a built-in block.
+func checkParams(n *ast.Block, max int) error {
+	switch {
+	case len(n.Params) <= max:
+		return nil
+	case max == 1:
+		return hexerr.Newf("block %q supports a single param", n.Name)
+	}
+	return hexerr.Newf("block %q supports up to %d params", n.Name, max)
+}
+
+func (c *bytecodeCompiler) block(n *ast.Block) error {
+	switch n.Name {
+	case "if", "unless":
+		return c.ifBlock(n)
+	case "with":
+		return c.scopeBlock(n, runtime.OpWith, 1)
+	case "each":
+		return c.scopeBlock(n, runtime.OpEach, 2)
+	case "block":
+		return c.layoutBlock(n, runtime.OpLayoutBlock)
+	case "partial":
+		return c.layoutBlock(n, runtime.OpLayoutPartial)
+	}
+	// A block helper, or a universal section when the VM has no helper of that name.
+	parts, hash, err := parser.ParseExpr(n.Args)
+	if err != nil {
+		return err
+	}
+	argc, err := c.args(parts, hash)
+	if err != nil {
+		return err
+	}
+	c.params(n.Params)
+	at := c.emit(runtime.OpBlock, c.helper(n.Name), argc)
+	if err := c.section(n.Body); err != nil {
+		return err
+	}
+	elseAt, end, err := c.elseSection(n.Else)
+	if err != nil {
+		return err
+	}
+	c.patch(at, c.helper(n.Name), argc, elseAt, end)
+	return nil
+}
+
+// singleExpr compiles the only argument of a built-in block.
+func (c *bytecodeCompiler) singleExpr(n *ast.Block, parts []parser.Expr) error {
+	if len(parts) != 1 {
+		return hexerr.Newf("block %q requires a single expression", n.Name)
+	}
+	return c.value(parts[0])
+}
+
+func (c *bytecodeCompiler) ifBlock(n *ast.Block) error {
+	parts, hash, err := parser.ParseExpr(n.Args)
+	if err != nil {
+		return err
+	}
+	if err := checkParams(n, 1); err != nil {
+		return err
+	}
+	if err := c.singleExpr(n, parts); err != nil {
+		return err
+	}
+	var flags int32
+	if n.Name == "unless" {
+		flags |= runtime.IfUnless
+	}
+	for _, h := range hash {
+		if h.Key == "includeZero" && h.Value.Kind == parser.ExprBool && h.Value.Value == "true" {
+			flags |= runtime.IfIncludeZero
+		}
+	}
+	c.params(n.Params)
+	at := c.emit(runtime.OpIf)
+	if err := c.section(n.Body); err != nil {
+		return err
+	}
+	elseAt, end, err := c.elseSection(n.Else)
+	if err != nil {
+		return err
+	}
+	c.patch(at, elseAt, flags, end)
+	return nil
+}
+
+// scopeBlock compiles {{#with}} and {{#each}}, which render their body with a new context.
+func (c *bytecodeCompiler) scopeBlock(n *ast.Block, op runtime.Opcode, maxParams int) error {
+	parts, _, err := parser.ParseExpr(n.Args)
+	if err != nil {
+		return err
+	}
+	if op == runtime.OpEach && len(parts) == 2 && parts[0].Kind == parser.ExprPath && parts[0].Value == "in" {
+		parts = parts[1:]
+	}
+	if err := checkParams(n, maxParams); err != nil {
+		return err
+	}
+	if err := c.singleExpr(n, parts); err != nil {
+		return err
+	}
+	c.params(n.Params)
+	at := c.emit(op)
+	if err := c.section(n.Body); err != nil {
+		return err
+	}
+	elseAt, end, err := c.elseSection(n.Else)
+	if err != nil {
+		return err
+	}
+	c.patch(at, elseAt, end)
+	return nil
+}
+
+// layoutBlock compiles {{#block "name"}} and {{#partial "name"}}.
+func (c *bytecodeCompiler) layoutBlock(n *ast.Block, op runtime.Opcode) error {
+	parts, _, err := parser.ParseExpr(n.Args)
+	if err != nil {
+		return err
+	}
+	if err := c.singleExpr(n, parts); err != nil {
+		return err
+	}
+	at := c.emit(op)
+	if err := c.section(n.Body); err != nil {
+		return err
+	}
+	c.patch(at, c.pc())
+	return nil
+}
+
+func (c *bytecodeCompiler) partialNode(n *ast.Partial) error {
+	parts, hash, err := parser.ParseExpr(n.Expr)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return hexerr.New("partial invocation is empty")
+	}
+	if len(parts) > 2 {
+		return hexerr.New("partial: context must be a single expression")
+	}
+	nameExpr := parts[0]
+	static := nameExpr.Kind == parser.ExprString || nameExpr.Kind == parser.ExprPath
+	if static {
+		if _, ok := c.templates[nameExpr.Value]; !ok {
+			return hexerr.Newf("partial %q is not defined", nameExpr.Value)
+		}
+	} else if err := c.value(nameExpr); err != nil {
+		return err
+	}
+	var flags int32
+	if len(parts) == 2 {
+		if err := c.value(parts[1]); err != nil {
+			return err
+		}
+		flags |= runtime.PartialContext
+	}
+	if len(hash) > 0 {
+		if _, err := c.args(nil, hash); err != nil {
+			return err
+		}
+		flags |= runtime.PartialHash
+	}
+	if static {
+		c.emit(runtime.OpPartial, c.partial(nameExpr.Value), flags)
+	} else {
+		c.emit(runtime.OpDynamicPartial, flags)
+	}
+	return nil
+}
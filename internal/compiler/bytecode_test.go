@@ -0,0 +1,342 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/helpers/handlebars"
+	"github.com/andriyg76/go-hbars/pkg/interpreter"
+	"github.com/andriyg76/go-hbars/pkg/renderer"
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+var _ renderer.ContextTemplateRenderer = (*runtime.VM)(nil)
+
+func loadBytecode(t *testing.T, tmpls map[string]string, opts runtime.VMOptions) *runtime.VM {
+	t.Helper()
+	b, err := CompileBytecode(tmpls, Options{})
+	if err != nil {
+		t.Fatalf("CompileBytecode: %v", err)
+	}
+	vm, err := runtime.LoadVM(b, opts)
+	if err != nil {
+		t.Fatalf("LoadVM: %v", err)
+	}
+	return vm
+}
+
+// TestCompileBytecode_MatchesInterpreter renders templates with the VM and with
+// pkg/interpreter and checks that the outputs are the same, and as expected.
+func TestCompileBytecode_MatchesInterpreter(t *testing.T) {
+	type user struct {
+		Name   string
+		Email  string `json:"mail"`
+		Active bool
+	}
+	data := map[string]any{
+		"title": "Hi <all>",
+		"count": 0,
+		"user":  map[string]any{"name": "Ada", "role": "admin"},
+		"users": []any{
+			map[string]any{"name": "Ada", "active": true},
+			map[string]any{"name": "Bob", "active": false},
+		},
+		"settings": map[string]any{"theme": "dark", "lang": "en"},
+		"owner":    &user{Name: "Eve", Email: "eve@example.com", Active: true},
+		"which":    "card",
+	}
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"values", "{{title}} {{{title}}} {{user.name}} {{user.missing}}|", "Hi &lt;all&gt; Hi <all> Ada |"},
+		{"helpers", `{{upper (lower user.name)}} {{default user.nickname value="(none)"}} {{add 1 2}} {{add 1.5 1}}`, "ADA (none) 3 2.5"},
+		{"if", "{{#if user}}yes{{else}}no{{/if}}{{#if count includeZero=true}}zero{{/if}}{{#unless count}}none{{/unless}}", "yeszeronone"},
+		{"if param", "{{#if user.name as |n|}}{{n}}{{/if}}", "Ada"},
+		{"with", "{{#with user as |u|}}{{name}}/{{u.role}}/{{../title}}{{/with}}{{#with missing}}x{{else}}-{{/with}}", "Ada/admin/Hi &lt;all&gt;-"},
+		{"each", "{{#each users}}{{@index}}:{{name}}{{#if active}}*{{/if}}{{#unless @last}},{{/unless}}{{/each}}", "0:Ada*,1:Bob"},
+		{"each params", "{{#each users as |u i|}}{{i}}={{u.name}} {{/each}}{{#each in settings}}{{@key}}={{this}};{{/each}}", "0=Ada 1=Bob lang=en;theme=dark;"},
+		{"each else and parent", "{{#each missing}}x{{else}}empty{{/each}} {{#each users}}{{../user.role}}{{/each}}", "empty adminadmin"},
+		{"struct fields", "{{owner.Name}} {{owner.mail}} {{owner.name}}", "Eve eve@example.com Eve"},
+		{"universal section", "{{#user}}{{role}}{{/user}}{{#missing}}x{{else}}-{{/missing}}", "admin-"},
+		{"options block helper", "{{#repeat 2 as |i|}}{{i}}{{user.name}} {{/repeat}}{{#range 1 3 as |n|}}[{{n}}{{this}}]{{/range}}", "0Ada 1Ada [11][22]"},
+		{"partials", `{{> card user}}|{{> card user role="guest"}}|{{> (lookup . "which") user}}|{{> (lookup . "title")}}`, `Ada (admin)|Ada (guest)|Ada (admin)|<!-- partial "Hi &lt;all&gt;" is not defined -->`},
+		{"layout", `{{#partial "content"}}<p>{{title}}</p>{{/partial}}{{> layout}}`, "<main><p>Hi &lt;all&gt;</p></main><aside>side</aside>"},
+	}
+	tmpls := map[string]string{
+		"card":   "{{name}} ({{role}})",
+		"layout": `<main>{{#block "content"}}default{{/block}}</main><aside>{{#block "side"}}side{{/block}}</aside>`,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpls["main"] = tt.src
+			vm := loadBytecode(t, tmpls, runtime.VMOptions{Helpers: handlebars.Helpers()})
+			got, err := vm.RenderString("main", data)
+			if err != nil {
+				t.Fatalf("vm: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("vm: got %q, want %q", got, tt.want)
+			}
+			set := interpreter.New(interpreter.Options{})
+			for name, src := range tmpls {
+				if err := set.Add(name, src); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if want, err := set.RenderString("main", data); err != nil || got != want {
+				t.Errorf("vm: got %q, interpreter: %q (%v)", got, want, err)
+			}
+		})
+	}
+}
+
+func TestCompileBytecode_HelperKinds(t *testing.T) {
+	reg := runtime.NewRegistry()
+	reg.SetHelperMissing(func(_ []any, options *runtime.HelperOptions) (any, error) {
+		return "missing " + options.Name, nil
+	})
+	var out strings.Builder
+	vm := loadBytecode(t, map[string]string{
+		"main":   "{{shout name}} {{nope a=1}} {{name}}",
+		"blocks": "{{#legacy name}}{{name}}{{/legacy}}{{#box name}}yes{{/box}}{{#box nope}}yes{{else}}no{{/box}}",
+	}, runtime.VMOptions{Registry: reg, Helpers: map[string]any{
+		"shout": func(args []any) (any, error) {
+			return strings.ToUpper(runtime.Stringify(args[0])) + "!", nil
+		},
+		"box": runtime.BlockHelper(func(args []any, options runtime.BlockOptions) error {
+			if runtime.IsTruthy(args[0]) {
+				return options.Fn(&out)
+			}
+			return options.Inverse(&out)
+		}),
+		"legacy": func(args []any) error {
+			options, _ := runtime.GetBlockOptions(args)
+			out.WriteString("<")
+			if err := options.Fn(&out); err != nil {
+				return err
+			}
+			out.WriteString(">")
+			return nil
+		},
+	}})
+	got, err := vm.RenderString("main", map[string]any{"name": "ada"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if want := "ADA! missing nope ada"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := vm.RenderString("blocks", map[string]any{"name": "ada"}); err != nil {
+		t.Fatalf("block helpers: %v", err)
+	}
+	if out.String() != "<ada>yesno" {
+		t.Errorf("block helpers: got %q", out.String())
+	}
+}
+
+func TestCompileBytecode_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		tmpls map[string]string
+		opts  Options
+		want  string
+	}{
+		{"missing partial", map[string]string{"main": "a\n {{> nope}}"}, Options{}, `template "main" line 2:2: partial "nope" is not defined`},
+		{"bad block", map[string]string{"main": "{{#if a b}}x{{/if}}"}, Options{}, `template "main" line 1:1: block "if" requires a single expression`},
+		{"block params", map[string]string{"main": "{{#each a as |x y z|}}x{{/each}}"}, Options{}, `block "each" supports up to 2 params`},
+		{"contextual", map[string]string{"main": "x"}, Options{Escape: EscapeContextual}, "contextual escaping needs generated Go code"},
+		{"stringify js", map[string]string{"main": "x"}, Options{Stringify: StringifyJS}, `stringify mode "js" needs generated Go code`},
+		{"parse error", map[string]string{"main": "{{#if x}}"}, Options{}, `template "main"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileBytecode(tt.tmpls, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	vm := loadBytecode(t, map[string]string{"main": "line\n  {{nope a b}}"}, runtime.VMOptions{})
+	if _, err := vm.RenderString("main", nil); err == nil || !strings.Contains(err.Error(), `helper "nope" is not defined`) {
+		t.Errorf("unknown helper: err = %v", err)
+	}
+	if _, err := vm.RenderString("other", nil); err == nil {
+		t.Error("unknown template: want error")
+	}
+
+	errBoom := errors.New("boom")
+	vm = loadBytecode(t, map[string]string{
+		"page": "{{#each items}}\n  {{> row}}{{/each}}",
+		"row":  "{{#if this}}{{fail}}{{/if}}",
+	}, runtime.VMOptions{Helpers: map[string]any{
+		"fail": func([]any) (any, error) { return nil, errBoom },
+	}})
+	_, err := vm.RenderString("page", map[string]any{"items": []any{1}})
+	if want := `template "page" line 2:3: template "row" line 1:13: boom`; err == nil || err.Error() != want || !errors.Is(err, errBoom) {
+		t.Errorf("helper error in partial: err = %v, want %q", err, want)
+	}
+	var renderErr *runtime.RenderError
+	if !errors.As(err, &renderErr) || renderErr.Helper != "fail" || len(renderErr.Stack) != 2 || renderErr.Location() != (runtime.Frame{Template: "row", Line: 1, Column: 13}) {
+		t.Errorf("helper error in partial: RenderError = %+v", renderErr)
+	}
+
+	// Each call of a recursive partial is on the stack.
+	vm = loadBytecode(t, map[string]string{
+		"tree": "{{#if child}}\n  {{> tree child}}{{else}}{{fail}}{{/if}}",
+	}, runtime.VMOptions{Helpers: map[string]any{
+		"fail": func([]any) (any, error) { return nil, errBoom },
+	}})
+	_, err = vm.RenderString("tree", map[string]any{"child": map[string]any{"child": map[string]any{"leaf": true}}})
+	if want := `template "tree" line 2:3: template "tree" line 2:3: template "tree" line 2:27: boom`; err == nil || err.Error() != want {
+		t.Errorf("helper error in recursive partial: err = %v, want %q", err, want)
+	}
+
+	// With RecoverHelpers a panic is a helper error, handled under the helper's policy.
+	helpers := map[string]any{
+		"fail": func([]any) (any, error) { panic("nil map") },
+		"wrap": func(w io.Writer, args []any, options *runtime.HelperOptions) error { panic("block") },
+	}
+	vm = loadBytecode(t, map[string]string{
+		"main":  "[{{fail x}}]",
+		"block": "{{#wrap}}x{{/wrap}}",
+	}, runtime.VMOptions{Helpers: helpers, RecoverHelpers: true, HelperErrors: runtime.HelperErrorsComment,
+		HelperErrorPolicies: map[string]string{"wrap": runtime.HelperErrorsFail}})
+	out, err := vm.RenderString("main", map[string]any{"x": 1})
+	if want := `[<!-- helper "fail": template "main" line 1:2: panic: nil map -->]`; err != nil || out != want {
+		t.Errorf("comment policy: got %q, %v, want %q", out, err, want)
+	}
+	_, err = vm.RenderString("block", nil)
+	var panicErr *runtime.PanicError
+	if !errors.As(err, &renderErr) || renderErr.Helper != "wrap" || !errors.As(err, &panicErr) || panicErr.Value != "block" {
+		t.Errorf("fail policy: err = %v", err)
+	}
+}
+
+func TestCompileBytecode_Context(t *testing.T) {
+	type localeKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), localeKey{}, "uk"))
+	defer cancel()
+	vm := loadBytecode(t, map[string]string{
+		"main": "{{locale}}:{{#each items}}{{> row}}{{/each}}",
+		"row":  "{{stop this}}",
+	}, runtime.VMOptions{Helpers: map[string]any{
+		"locale": func(args []any, options *runtime.HelperOptions) (any, error) {
+			return options.Ctx.Value(localeKey{}), nil
+		},
+		"stop": func(args []any, options *runtime.HelperOptions) (any, error) {
+			cancel()
+			return args[0], nil
+		},
+	}})
+	var b strings.Builder
+	err := vm.RenderContext(ctx, "main", &b, map[string]any{"items": []any{1, 2, 3}})
+	if !errors.Is(err, context.Canceled) || b.String() != "uk:1" {
+		t.Errorf("got %q, %v; want %q, context.Canceled", b.String(), err, "uk:1")
+	}
+}
+
+func TestCompileBytecode_Limits(t *testing.T) {
+	vm := loadBytecode(t, map[string]string{
+		"self":  "x{{> self}}",
+		"times": "{{#times 1000000000}}.{{/times}}",
+	}, runtime.VMOptions{Helpers: map[string]any{
+		"times": runtime.OptionsBlockHelper(func(w io.Writer, args []any, options *runtime.HelperOptions) error {
+			for i := 0; i < args[0].(int); i++ {
+				if err := options.Fn(w, options.Context, options.Data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	}})
+	var b strings.Builder
+	err := vm.RenderWithOptions("self", &b, map[string]any{}, runtime.RenderOptions{Limits: runtime.Limits{MaxPartialDepth: 3}})
+	var limitErr *runtime.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != runtime.LimitPartialDepth || b.String() != "xxxx" {
+		t.Errorf("got %q, %v", b.String(), err)
+	}
+	b.Reset()
+	err = vm.RenderWithOptions("times", &b, map[string]any{}, runtime.RenderOptions{Limits: runtime.Limits{MaxIterations: 5}})
+	if !errors.As(err, &limitErr) || limitErr.Limit != runtime.LimitIterations || b.String() != "....." {
+		t.Errorf("block helper: got %q, %v", b.String(), err)
+	}
+}
+
+func TestCompileBytecode_Deterministic(t *testing.T) {
+	tmpls := map[string]string{"a": "{{x}}{{> b}}", "b": "{{#each y}}{{this}}{{/each}}", "c.txt": "{{z}}"}
+	first, err := CompileBytecode(tmpls, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		again, err := CompileBytecode(tmpls, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(first, again) {
+			t.Fatal("CompileBytecode output differs between runs")
+		}
+	}
+}
+
+func TestCompileBytecode_DataVariables(t *testing.T) {
+	vm := loadBytecode(t, map[string]string{
+		"main": "{{#each items}}{{@index}}{{@site.title}}{{/each}}{{> foot}}",
+		"foot": "{{@request.path}}",
+	}, runtime.VMOptions{})
+	var b strings.Builder
+	vars := map[string]any{"site": map[string]any{"title": "T"}, "request": map[string]any{"path": "/a"}}
+	err := vm.RenderWithOptions("main", &b, map[string]any{"items": []any{1, 2}}, runtime.RenderOptions{Data: vars})
+	if want := "0T1T/a"; err != nil || b.String() != want {
+		t.Errorf("got %q, %v; want %q", b.String(), err, want)
+	}
+}
+
+func TestCompileBytecode_FunctionValues(t *testing.T) {
+	vm := loadBytecode(t, map[string]string{"main": "{{title}}{{#each related}},{{this}}{{/each}}{{#author}}:{{name}}{{/author}}{{broken}}"}, runtime.VMOptions{})
+	data := map[string]any{
+		"title":   func() any { return "Post" },
+		"related": runtime.NewLazy(func(context.Context) (any, error) { return []any{1, 2}, nil }),
+		"author":  func(context.Context) (any, error) { return map[string]any{"name": "ann"}, nil },
+		"broken":  func() (any, error) { return nil, errors.New("db down") },
+	}
+	var b strings.Builder
+	err := vm.Render("main", &b, data)
+	if err == nil || err.Error() != `template "main" line 1:76: db down` || b.String() != "Post,1,2:ann" {
+		t.Errorf("got %q, %v", b.String(), err)
+	}
+
+	type userKey struct{}
+	vm = loadBytecode(t, map[string]string{"path": "{{editor.name}}|{{broken.name}}"}, runtime.VMOptions{})
+	data["editor"] = func(ctx context.Context) (any, error) { return map[string]any{"name": ctx.Value(userKey{})}, nil }
+	b.Reset()
+	err = vm.RenderContext(context.WithValue(context.Background(), userKey{}, "bob"), "path", &b, data)
+	if err == nil || err.Error() != `template "path" line 1:17: db down` || b.String() != "bob|" {
+		t.Errorf("functions in a path: got %q, %v", b.String(), err)
+	}
+}
+
+func TestCompileBytecode_EachIterators(t *testing.T) {
+	vm := loadBytecode(t, map[string]string{"main": "{{#each rows}}{{@index}}={{this}}{{#unless @last}},{{/unless}}{{else}}none{{/each}}"}, runtime.VMOptions{})
+	for _, tt := range []struct {
+		rows any
+		want string
+	}{
+		{slices.Values([]string{"a", "b"}), "0=a,1=b"},
+		{maps.All(map[string]int{"k": 1}), "k=1"},
+		{slices.Values([]string{}), "none"},
+	} {
+		var b strings.Builder
+		if err := vm.Render("main", &b, map[string]any{"rows": tt.rows}); err != nil || b.String() != tt.want {
+			t.Errorf("got %q, %v, want %q", b.String(), err, tt.want)
+		}
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"go/format"
 	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/andriyg76/go-hbars/internal/ast"
 	"github.com/andriyg76/go-hbars/internal/parser"
+	"github.com/andriyg76/go-hbars/runtime"
 	"github.com/andriyg76/hexerr"
 )
 
@@ -18,8 +20,23 @@ import (
 type HelperRef struct {
 	ImportPath string
 	Ident      string
+	Source     string // where the helper was declared (e.g. "-helpers upper=Upper"); used in error messages
+	// Options marks a runtime.OptionsHelper / runtime.OptionsBlockHelper, which receives
+	// *runtime.HelperOptions. With Options.HelperTypes the signature is detected without it.
+	Options bool
+	// BlockContext describes the context an Options block helper renders its body with, so that
+	// context inference can type the body: one of the BlockContext constants; empty means unknown.
+	BlockContext string
 }
 
+// Values of HelperRef.BlockContext.
+const (
+	BlockContextThis  = "this"  // the caller's context (e.g. a repeat helper)
+	BlockContextItem  = "item"  // each element of the first argument, a list
+	BlockContextGroup = "group" // {key, items} groups of the elements of the first argument
+	BlockContextRow   = "row"   // slices (rows) of the elements of the first argument
+)
+
 // Options configures code generation.
 type Options struct {
 	PackageName       string
@@ -27,13 +44,97 @@ type Options struct {
 	Helpers           map[string]HelperRef
 	GenerateBootstrap bool   // Generate bootstrap code for server/processor
 	GeneratorVersion  string // If set, emitted in generated file as "// Generator version: ..."
+	// HelperTypes, when set, validates helper references against their Go declarations
+	// (see LoadHelperTypes) and lets block helpers use the runtime.BlockHelper signature.
+	HelperTypes *HelperTypes
+	// Strict makes templates return a *runtime.MissingPathError for paths that are not in the
+	// data, instead of rendering them empty. {{#if}}, {{#unless}} and {{#with}} treat a missing
+	// path as false.
+	Strict bool
+	// AssumeObjects is the lighter check: only paths whose intermediate objects are missing
+	// (e.g. "user" in {{user.name}}) are errors. It is ignored when Strict is set.
+	AssumeObjects bool
+	// MissingHelpers is the policy for helper calls whose helper is not in Helpers:
+	// MissingHelpersError (the default) fails compilation, MissingHelpersRuntime looks the
+	// name up at render time in the runtime.Registry of the render and the package-wide one.
+	MissingHelpers string
+	// Escape is how {{value}} output is escaped: EscapeHTML (the default) HTML-escapes every
+	// value, EscapeContextual escapes it for where it lands in the HTML (attribute, URL,
+	// <script>, <style>; see runtime.WriteEscapedIn), EscapeText writes it as is, and any other
+	// name is an escaper registered with runtime.RegisterEscaper (csv, json-string and shell
+	// are built in). A template's own mode (see TemplateEscape) overrides it.
+	Escape string
+	// TemplateEscape sets the output mode of single templates by template name. A template is
+	// in the mode of its {{!-- escape: mode --}} annotation, else TemplateEscape, else its name's
+	// extension (.txt and .md are EscapeText, .html is HTML), else Escape.
+	TemplateEscape map[string]string
+	// Stringify is how {{value}} output is converted to text: StringifyGo (the default) as
+	// runtime.Stringify does, StringifyJS as JavaScript's String(value) does, so output matches
+	// handlebars.js: arrays join with ",", objects print [object Object] and numbers format as
+	// in JavaScript (see runtime.StringifyJS).
+	Stringify string
+	// SourceFiles maps template names to the paths of their files, relative to the directory of
+	// the generated file. The code of those templates gets //line directives, so panics, stack
+	// traces, coverage and debuggers report template positions (templates/main.hbs:42:7).
+	SourceFiles map[string]string
+	// OutputFile is the name of the generated file, for the //line directives that switch back
+	// to it after template code. Defaults to "templates_gen.go".
+	OutputFile string
+	// RecoverHelpers wraps helper calls in a recover, so a panicking helper returns a
+	// *runtime.PanicError (handled under HelperErrors) instead of crashing the render.
+	RecoverHelpers bool
+	// HelperErrors is the policy for errors of helpers: HelperErrorsFail (the default) fails the
+	// render, HelperErrorsEmpty logs the error and renders the helper empty, HelperErrorsComment
+	// logs it and renders it as an HTML comment (see runtime.HandleHelperError).
+	HelperErrors string
+	// HelperErrorPolicies overrides HelperErrors for single helpers, by helper name.
+	HelperErrorPolicies map[string]string
 }
 
+// Options.MissingHelpers policies.
+const (
+	MissingHelpersError   = "error"
+	MissingHelpersRuntime = "runtime"
+)
+
+// Options.HelperErrors policies.
+const (
+	HelperErrorsFail    = runtime.HelperErrorsFail
+	HelperErrorsEmpty   = runtime.HelperErrorsEmpty
+	HelperErrorsComment = runtime.HelperErrorsComment
+)
+
+// Options.Stringify modes.
+const (
+	StringifyGo = "go"
+	StringifyJS = "js"
+)
+
+// Options.Escape modes.
+const (
+	EscapeHTML       = "html"
+	EscapeContextual = "contextual"
+	EscapeText       = "text"
+)
+
 // CompileTemplates compiles templates into Go source code.
 func CompileTemplates(templates map[string]string, opts Options) ([]byte, error) {
 	if opts.PackageName == "" {
 		return nil, hexerr.New("compiler: package name is required")
 	}
+	runtimeHelpers, err := missingHelpersPolicy(opts.MissingHelpers)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHelperErrors(opts.HelperErrors, opts.HelperErrorPolicies); err != nil {
+		return nil, err
+	}
+	if _, err := checkEscape(opts.Escape); err != nil {
+		return nil, hexerr.Wrapf(err, "compiler")
+	}
+	if err := checkStringify(opts.Stringify); err != nil {
+		return nil, err
+	}
 	runtimeImport := opts.RuntimeImport
 	if runtimeImport == "" {
 		runtimeImport = "github.com/andriyg76/go-hbars/runtime"
@@ -45,16 +146,57 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 
 	names := make([]string, 0, len(templates))
 	parsed := make(map[string][]ast.Node, len(templates))
+	escapes := make(map[string]string, len(templates))
 	for name, tmpl := range templates {
 		nodes, err := parser.Parse(tmpl)
 		if err != nil {
 			return nil, hexerr.Wrapf(err, "compiler: template %q", name)
 		}
+		if escapes[name], err = templateEscape(name, tmpl, opts); err != nil {
+			return nil, hexerr.Wrapf(err, "compiler: template %q", name)
+		}
 		parsed[name] = nodes
 		names = append(names, name)
 	}
 	sort.Strings(names)
 
+	var helperInfos map[string]helperInfo
+	if opts.HelperTypes != nil {
+		helperInfos, err = checkHelpers(parsed, names, opts.Helpers, helperExprs, opts.HelperTypes, runtimeImport)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Helpers registered with Options use *runtime.HelperOptions even when they were not type-checked.
+	for name, ref := range opts.Helpers {
+		if _, checked := helperInfos[name]; ref.Options && !checked {
+			if helperInfos == nil {
+				helperInfos = make(map[string]helperInfo)
+			}
+			helperInfos[name] = helperInfo{kind: HelperKindOptions}
+		}
+	}
+	// Native helpers are called through generated adapters; the adapters use the original expressions.
+	adapters := &codeWriter{}
+	needTime := false
+	helperNames := make([]string, 0, len(helperInfos))
+	for name := range helperInfos {
+		helperNames = append(helperNames, name)
+	}
+	sort.Strings(helperNames)
+	adapterNames := make(map[string]bool)
+	for _, name := range helperNames {
+		info := helperInfos[name]
+		if info.native == nil {
+			continue
+		}
+		adapter := uniqueAlias("nativeHelper"+goIdent(name), adapterNames)
+		adapterNames[adapter] = true
+		emitNativeAdapter(adapters, adapter, name, helperExprs[name], info.native)
+		helperExprs[name] = adapter
+		needTime = needTime || info.native.needsTimeImport()
+	}
+
 	funcNames := make(map[string]string, len(names))
 	seenFunc := make(map[string]string, len(names))
 	for _, name := range names {
@@ -69,9 +211,15 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 	usedHelpers := collectUsedHelperNames(parsed, helperExprs)
 	helperImports = filterHelperImports(helperImports, opts.Helpers, usedHelpers)
 
-	partialParamTypes := CollectPartialParamTypes(parsed, names, funcNames, helperExprs)
+	blockContexts := make(map[string]string)
+	for name, info := range helperInfos {
+		if info.kind.usesHelperOptions() {
+			blockContexts[name] = opts.Helpers[name].BlockContext
+		}
+	}
+	partialParamTypes := CollectPartialParamTypes(parsed, names, funcNames, helperExprs, blockContexts, runtimeHelpers)
 
-	needFmt := templatesUseBlockHelpers(parsed, helperExprs) || opts.GenerateBootstrap
+	needFmt := templatesUseBlockHelpers(parsed, helperExprs, helperInfos) || opts.GenerateBootstrap
 	useLayoutBlocks := templatesUsesLayoutBlocks(parsed)
 	header := &codeWriter{}
 	header.line("// Code generated by hbc; DO NOT EDIT.")
@@ -82,11 +230,15 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 	header.line("")
 	header.line("import (")
 	header.indentInc()
+	header.line("%q", "context")
 	if needFmt {
 		header.line("%q", "fmt")
 	}
 	header.line("%q", "io")
 	header.line("%q", "strings")
+	if needTime {
+		header.line("%q", "time")
+	}
 	header.line("runtime %q", runtimeImport)
 	for _, imp := range helperImports {
 		if imp.name == "" {
@@ -108,6 +260,8 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 	for _, name := range names {
 		col := newPathCollector(helperExprs)
 		col.setParsed(parsed)
+		col.setBlockContexts(blockContexts)
+		col.runtimeHelpers = runtimeHelpers
 		if err := col.collectNodes(parsed[name]); err != nil {
 			return nil, hexerr.Wrapf(err, "compiler: template %q context inference", name)
 		}
@@ -143,34 +297,27 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 		emitContextDataTypes(contextData, name, tree)
 	}
 
-	partials := &codeWriter{}
+	// Every render function takes the per-render *runtime.Env last; layout templates also take *runtime.Blocks.
+	partialFuncType := "func(any, io.Writer, any, *runtime.Env) error"
+	renderParams := "env *runtime.Env"
 	if useLayoutBlocks {
-		partials.line("var partials map[string]func(any, io.Writer, any, *runtime.Blocks) error")
-	} else {
-		partials.line("var partials map[string]func(any, io.Writer, any) error")
+		partialFuncType = "func(any, io.Writer, any, *runtime.Blocks, *runtime.Env) error"
+		renderParams = "blocks *runtime.Blocks, env *runtime.Env"
 	}
+	partials := &codeWriter{}
+	partials.line("var partials map[string]%s", partialFuncType)
 	partials.line("")
-	partials.line("// contextMap returns map[string]any from ctx (either direct map or Raw() from context data).")
+	partials.line("// contextMap returns map[string]any from ctx: a map, the Raw() map of context data, or the")
+	partials.line("// map of a Go struct (see runtime.MapOf).")
 	partials.line("func contextMap(ctx any) map[string]any {")
 	partials.indentInc()
-	partials.line("if m, ok := ctx.(map[string]any); ok { return m }")
-	partials.line("type rawer interface{ Raw() any }")
-	partials.line("if r, ok := ctx.(rawer); ok {")
-	partials.indentInc()
-	partials.line("if m, ok := r.Raw().(map[string]any); ok { return m }")
-	partials.indentDec()
-	partials.line("}")
-	partials.line("return nil")
+	partials.line("return runtime.MapOf(ctx)")
 	partials.indentDec()
 	partials.line("}")
 	partials.line("")
 	partials.line("func init() {")
 	partials.indentInc()
-	if useLayoutBlocks {
-		partials.line("partials = map[string]func(any, io.Writer, any, *runtime.Blocks) error{")
-	} else {
-		partials.line("partials = map[string]func(any, io.Writer, any) error{")
-	}
+	partials.line("partials = map[string]%s{", partialFuncType)
 	partials.indentInc()
 	for _, name := range names {
 		goName := funcNames[name]
@@ -179,18 +326,14 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 			ctxType = goName + "Context"
 		}
 		fromMapName := strings.TrimSuffix(ctxType, "Context") + "ContextFromMap"
-		if useLayoutBlocks {
-			partials.line("%q: func(ctx any, w io.Writer, root any, blocks *runtime.Blocks) error {", name)
-		} else {
-			partials.line("%q: func(ctx any, w io.Writer, root any) error {", name)
-		}
+		partials.line("%q: func(ctx any, w io.Writer, root any, %s) error {", name, renderParams)
 		partials.indentInc()
 		partials.line("m := contextMap(ctx)")
 		partials.line("if m == nil { return nil }")
 		if useLayoutBlocks {
-			partials.line("return render%s(%s(m), w, %s(m), blocks)", goName, fromMapName, fromMapName)
+			partials.line("return render%s(%s(m), w, %s(m), blocks, env)", goName, fromMapName, fromMapName)
 		} else {
-			partials.line("return render%s(%s(m), w, %s(m))", goName, fromMapName, fromMapName)
+			partials.line("return render%s(%s(m), w, %s(m), env)", goName, fromMapName, fromMapName)
 		}
 		partials.indentDec()
 		partials.line("},")
@@ -200,6 +343,22 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 	partials.indentDec()
 	partials.line("}")
 	partials.line("")
+	partials.line("// RegisterPartials registers the templates of this package as partials in reg, so that")
+	partials.line("// templates of other packages can render them with dynamic partials ({{> (name)}}).")
+	partials.line("func RegisterPartials(reg *runtime.Registry) {")
+	partials.indentInc()
+	partials.line("for name, fn := range partials {")
+	partials.indentInc()
+	if useLayoutBlocks {
+		partials.line("reg.RegisterPartial(name, func(ctx any, w io.Writer, env *runtime.Env) error { return fn(ctx, w, ctx, nil, env) })")
+	} else {
+		partials.line("reg.RegisterPartial(name, func(ctx any, w io.Writer, env *runtime.Env) error { return fn(ctx, w, ctx, env) })")
+	}
+	partials.indentDec()
+	partials.line("}")
+	partials.indentDec()
+	partials.line("}")
+	partials.line("")
 
 	functions := &codeWriter{}
 	for _, name := range names {
@@ -215,22 +374,33 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 			ownerName = name
 		}
 		tree := typeTrees[ownerName]
-		gen := &generator{w: functions, helpers: helperExprs, partials: funcNames, typeTrees: typeTrees, tree: tree, goName: goName, rootVar: "root"}
+		gen := &generator{w: functions, helpers: helperExprs, helperInfos: helperInfos, blockContexts: blockContexts, partials: funcNames, typeTrees: typeTrees, tree: tree, goName: goName, template: name, source: filepath.ToSlash(opts.SourceFiles[name]), rootVar: "root", strict: opts.Strict, assumeObjects: opts.AssumeObjects, runtimeHelpers: runtimeHelpers,
+			recoverHelpers: opts.RecoverHelpers, helperErrors: opts.HelperErrors, helperErrorPolicies: opts.HelperErrorPolicies, jsValues: opts.Stringify == StringifyJS}
 		if useLayoutBlocks {
 			gen.blocksVar = "blocks"
 		}
-		if useLayoutBlocks {
-			functions.line("func render%s(data %s, w io.Writer, root %s, blocks *runtime.Blocks) error {", goName, rootContext, rootContext)
-		} else {
-			functions.line("func render%s(data %s, w io.Writer, root %s) error {", goName, rootContext, rootContext)
+		switch mode := escapes[name]; mode {
+		case EscapeHTML:
+		case EscapeContextual:
+			gen.contextual = true
+		default:
+			gen.escaper = mode
 		}
+		functions.line("func render%s(data %s, w io.Writer, root %s, %s) error {", goName, rootContext, rootContext, renderParams)
 		functions.indentInc()
 		functions.line("if data == nil {")
 		functions.indentInc()
 		functions.line("return nil")
 		functions.indentDec()
 		functions.line("}")
+		functions.line("if err := env.EnterPartial(); err != nil {")
+		functions.indentInc()
+		functions.line("return err")
+		functions.indentDec()
+		functions.line("}")
+		functions.line("defer env.LeavePartial()")
 		gen.pushTypedScope("data", "", tree)
+		gen.typedStack[0].dynamic = false // data is always a typed context, even with an empty tree
 		if err := gen.emitNodes(nodes); err != nil {
 			return nil, hexerr.Wrapf(err, "compiler: template %q", name)
 		}
@@ -241,9 +411,9 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 		functions.line("func Render%s(w io.Writer, data %s) error {", goName, rootContext)
 		functions.indentInc()
 		if useLayoutBlocks {
-			functions.line("return render%s(data, w, data, nil)", goName)
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, nil, nil) }), %q, 0, 0)", goName, name)
 		} else {
-			functions.line("return render%s(data, w, data)", goName)
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, nil) }), %q, 0, 0)", goName, name)
 		}
 		functions.indentDec()
 		functions.line("}")
@@ -251,11 +421,60 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 		if useLayoutBlocks {
 			functions.line("func Render%sWithBlocks(w io.Writer, data %s, blocks *runtime.Blocks) error {", goName, rootContext)
 			functions.indentInc()
-			functions.line("return render%s(data, w, data, blocks)", goName)
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, blocks, nil) }), %q, 0, 0)", goName, name)
 			functions.indentDec()
 			functions.line("}")
 			functions.line("")
 		}
+		functions.line("// Render%sWithRegistry renders with reg searched before the package-wide runtime registry", goName)
+		functions.line("// for runtime helpers and dynamic partials.")
+		functions.line("func Render%sWithRegistry(w io.Writer, data %s, reg *runtime.Registry) error {", goName, rootContext)
+		functions.indentInc()
+		if useLayoutBlocks {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, nil, &runtime.Env{Registry: reg}) }), %q, 0, 0)", goName, name)
+		} else {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, &runtime.Env{Registry: reg}) }), %q, 0, 0)", goName, name)
+		}
+		functions.indentDec()
+		functions.line("}")
+		functions.line("")
+		functions.line("// Render%sContext renders with ctx: the render stops with ctx.Err() once ctx is done, checked", goName)
+		functions.line("// at each {{#each}} iteration and each partial; helpers get ctx as HelperOptions.Ctx.")
+		functions.line("func Render%sContext(ctx context.Context, w io.Writer, data %s) error {", goName, rootContext)
+		functions.indentInc()
+		if useLayoutBlocks {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, nil, &runtime.Env{Context: ctx}) }), %q, 0, 0)", goName, name)
+		} else {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, &runtime.Env{Context: ctx}) }), %q, 0, 0)", goName, name)
+		}
+		functions.indentDec()
+		functions.line("}")
+		functions.line("")
+		functions.line("// Render%sWithData renders with the @data variables vars ({{@site.title}}) in every", goName)
+		functions.line("// template and partial of the render.")
+		functions.line("func Render%sWithData(w io.Writer, data %s, vars map[string]any) error {", goName, rootContext)
+		functions.indentInc()
+		if useLayoutBlocks {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, nil, &runtime.Env{Data: vars}) }), %q, 0, 0)", goName, name)
+		} else {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, w, data, &runtime.Env{Data: vars}) }), %q, 0, 0)", goName, name)
+		}
+		functions.indentDec()
+		functions.line("}")
+		functions.line("")
+		functions.line("// Render%sWithOptions renders with the context, registry, limits and @data variables of", goName)
+		functions.line("// opts; a render over a limit fails with a *runtime.LimitError.")
+		functions.line("func Render%sWithOptions(w io.Writer, data %s, opts runtime.RenderOptions) error {", goName, rootContext)
+		functions.indentInc()
+		functions.line("env := runtime.NewEnv(opts)")
+		if useLayoutBlocks {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, env.Writer(w), data, nil, env) }), %q, 0, 0)", goName, name)
+		} else {
+			functions.line("return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return render%s(data, env.Writer(w), data, env) }), %q, 0, 0)", goName, name)
+		}
+		functions.indentDec()
+		functions.line("}")
+		functions.line("")
 		functions.line("func Render%sString(data %s) (string, error) {", goName, rootContext)
 		functions.indentInc()
 		functions.line("var b strings.Builder")
@@ -282,6 +501,7 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 	out.WriteString(contextData.String())
 	out.WriteString(partials.String())
 	out.WriteString(functions.String())
+	out.WriteString(adapters.String())
 	if bootstrap.String() != "" {
 		out.WriteString(bootstrap.String())
 	}
@@ -290,9 +510,29 @@ func CompileTemplates(templates map[string]string, opts Options) ([]byte, error)
 	if err != nil {
 		return nil, hexerr.Wrapf(err, "compiler: format")
 	}
+	if len(opts.SourceFiles) > 0 {
+		outputFile := opts.OutputFile
+		if outputFile == "" {
+			outputFile = "templates_gen.go"
+		}
+		formatted = restoreLines(formatted, filepath.ToSlash(outputFile))
+	}
 	return formatted, nil
 }
 
+// restoreLines replaces the lineRestore directives in code with directives back to line
+// numbers of outputFile.
+func restoreLines(code []byte, outputFile string) []byte {
+	lines := strings.Split(string(code), "\n")
+	for i, line := range lines {
+		if line == lineRestore {
+			// The directive is on line i+1; it sets the position of the line after it.
+			lines[i] = fmt.Sprintf("//line %s:%d", outputFile, i+2)
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
 type importSpec struct {
 	path string
 	name string
@@ -352,14 +592,15 @@ func prepareHelpers(helpers map[string]HelperRef, runtimeImport string) (map[str
 	return helperExprs, imports, nil
 }
 
-func templatesUseBlockHelpers(parsed map[string][]ast.Node, helperExprs map[string]string) bool {
-	builtinBlocks := map[string]bool{"if": true, "unless": true, "with": true, "each": true, "block": true, "partial": true}
+// templatesUseBlockHelpers reports whether any template calls a block helper with BlockOptions
+// appended to its args (the generated check for them needs fmt).
+func templatesUseBlockHelpers(parsed map[string][]ast.Node, helperExprs map[string]string, infos map[string]helperInfo) bool {
 	var walk func(nodes []ast.Node) bool
 	walk = func(nodes []ast.Node) bool {
 		for _, node := range nodes {
 			switch n := node.(type) {
 			case *ast.Block:
-				if !builtinBlocks[n.Name] && helperExprs[n.Name] != "" {
+				if !builtinBlockNames[n.Name] && helperExprs[n.Name] != "" && !infos[n.Name].kind.takesOptions() && !infos[n.Name].kind.usesHelperOptions() {
 					return true
 				}
 				if walk(n.Body) || walk(n.Else) {
@@ -516,20 +757,59 @@ type typedScope struct {
 	pathPrefix string
 	node       *typeNode
 	eachKeyVar string // when in {{#each}} body, the loop key/index variable name for @key/@index
+	eachFirst  string // when in {{#each}} body, the Go bool expressions for @first and @last
+	eachLast   string
+	dynamic    bool   // varName holds an untyped value; unresolved paths are looked up with runtime.LookupPath
+	frameVar   string // in a helper's block body, the *runtime.DataFrame variable for @data lookups
+	paramOnly  bool   // binds a block param (each key, if/unless value) without changing the context
+	dataPath   string // Go string expression for the data path of varName (strict mode errors); "" at the root
 }
 
 type generator struct {
 	w           *codeWriter
 	helpers     map[string]string
-	partials    map[string]string
-	typeTrees   map[string]*typeNode
-	tempID      int
-	tree        *typeNode
-	goName      string
-	typedStack  []typedScope
-	rootVar     string   // name of root context variable ("root"); same as data in entry, passed in for partials
-	blocksVar   string   // non-empty when layout block/partial are used
-	writerStack []string // when non-empty, currentWriter() returns "&" + top for partial body capture
+	helperInfos map[string]helperInfo // from Options.HelperTypes; empty when helpers were not type-checked
+	// blockContexts maps Options block helpers to their HelperRef.BlockContext.
+	blockContexts map[string]string
+	partials      map[string]string
+	typeTrees     map[string]*typeNode
+	tempID        int
+	tree          *typeNode
+	goName        string
+	template      string // template name, passed to helpers in runtime.HelperOptions
+	typedStack    []typedScope
+	rootVar       string   // name of root context variable ("root"); same as data in entry, passed in for partials
+	blocksVar     string   // non-empty when layout block/partial are used
+	writerStack   []string // when non-empty, currentWriter() returns "&" + top for partial body capture
+	strict        bool     // Options.Strict
+	assumeObjects bool     // Options.AssumeObjects
+	pos           ast.Pos  // position of the node being emitted, for strict mode and helper errors
+	source        string   // Options.SourceFiles path of the template; "" emits no //line directives
+	directive     string   // last //line directive, and w.lines after it (to skip repeating it)
+	directiveEnd  int
+	guard         bool // evaluating an {{#if}}/{{#with}} condition: missing paths are not errors
+	// runtimeHelpers is set for MissingHelpersRuntime: unknown helpers are looked up at render time.
+	runtimeHelpers      bool
+	recoverHelpers      bool              // Options.RecoverHelpers
+	helperErrors        string            // Options.HelperErrors
+	helperErrorPolicies map[string]string // Options.HelperErrorPolicies
+	jsValues            bool              // Options.Stringify is StringifyJS
+	// escaper is the template's output mode when it is EscapeText or a runtime escaper name.
+	escaper string
+	// contextual is set for EscapeContextual. html is the HTML state at the node being emitted;
+	// htmlStarts holds the states the enclosing block bodies start in.
+	contextual bool
+	html       htmlState
+	htmlStarts []htmlState
+}
+
+// renderTail returns the trailing arguments of render functions and the partials map after
+// ctx, w and root: the layout blocks (when used) and the per-render env.
+func (g *generator) renderTail() string {
+	if g.blocksVar != "" {
+		return ", " + g.blocksVar + ", env"
+	}
+	return ", env"
 }
 
 func (g *generator) currentWriter() string {
@@ -548,7 +828,15 @@ func (g *generator) popWriter() {
 }
 
 func (g *generator) emitNodes(nodes []ast.Node) error {
+	if len(g.htmlStarts) > 0 {
+		g.html = g.htmlStarts[len(g.htmlStarts)-1]
+	}
+	saved := g.pos
 	for _, node := range nodes {
+		g.pos = node.Position()
+		if t, ok := node.(*ast.Text); !ok || t.Value != "" {
+			g.emitLineDirective()
+		}
 		switch n := node.(type) {
 		case *ast.Text:
 			if n.Value != "" {
@@ -558,25 +846,144 @@ func (g *generator) emitNodes(nodes []ast.Node) error {
 				g.w.indentDec()
 				g.w.line("}")
 			}
+			if g.contextual {
+				if g.html = g.html.advance(n.Value); g.html.mode == htmlModeJSAmbiguous {
+					return hexerr.New(fmt.Sprintf("contextual escaping: text at %s: '/' could start a division or a regular expression after the block before it", n.Pos))
+				}
+			}
 		case *ast.Mustache:
+			if g.contextual && g.html.inJS() && (g.html.str == '/' || g.html.str == '[') {
+				return hexerr.New(fmt.Sprintf("contextual escaping: {{%s}} at %s is in a JavaScript regular expression; build it with new RegExp from a string", n.Expr, n.Pos))
+			}
 			if err := g.emitMustache(n); err != nil {
 				return err
 			}
+			if g.contextual {
+				g.html = g.html.afterValue()
+			}
 		case *ast.Partial:
+			if g.contextual && g.html.mode != htmlModeText {
+				return hexerr.New(fmt.Sprintf("contextual escaping: {{> %s}} at %s is in %s; partials are compiled for element content", n.Expr, n.Pos, g.html))
+			}
 			if err := g.emitPartial(n); err != nil {
 				return err
 			}
 		case *ast.Block:
-			if err := g.emitBlock(n); err != nil {
+			if !g.contextual {
+				if err := g.emitBlock(n); err != nil {
+					return err
+				}
+				continue
+			}
+			start, end, err := g.htmlBlockEnd(g.html, n)
+			if err != nil {
+				return err
+			}
+			g.htmlStarts = append(g.htmlStarts, start)
+			err = g.emitBlock(n)
+			g.htmlStarts = g.htmlStarts[:len(g.htmlStarts)-1]
+			if err != nil {
 				return err
 			}
+			g.html = end
 		default:
 			return hexerr.New(fmt.Sprintf("compiler: unsupported node %T", node))
 		}
 	}
+	// The code that follows (e.g. the call of a block helper after its body) is the enclosing
+	// node's, or the generated file's after the template's top-level nodes.
+	g.pos = saved
+	if len(nodes) > 0 {
+		g.emitLineDirective()
+	}
 	return nil
 }
 
+// lineRestore is the //line directive back to the generated file; CompileTemplates replaces it
+// with the file name and line once the code is formatted.
+const lineRestore = "//line hbc-generated:1"
+
+// emitLineDirective emits the //line directive for g.pos, or lineRestore outside any node.
+// Besides at the start of nodes, it is emitted right before helper and partial calls, so
+// panics in them report the position of the call rather than a line or two below it.
+func (g *generator) emitLineDirective() {
+	if g.source == "" {
+		return
+	}
+	directive := lineRestore
+	if g.pos.Line > 0 {
+		directive = fmt.Sprintf("//line %s:%d:%d", g.source, g.pos.Line, g.pos.Col)
+	}
+	if directive == g.directive && g.w.lines == g.directiveEnd {
+		return
+	}
+	g.w.line("%s", directive)
+	g.directive, g.directiveEnd = directive, g.w.lines
+}
+
+// emitIterate emits the check at each {{#each}} iteration and each render of a block helper's
+// body or {{else}} section: once the render's context is done (RenderXxxContext) or a limit is
+// exceeded (RenderXxxWithOptions), the render stops.
+func (g *generator) emitIterate() {
+	g.w.line("if err := env.Iterate(); err != nil {")
+	g.w.indentInc()
+	g.emitReturnErr()
+	g.w.indentDec()
+	g.w.line("}")
+}
+
+// emitReturnErr emits the return of err, the error of the partial or context value used by the
+// node being emitted, wrapped with the node's template position (see runtime.WrapError).
+func (g *generator) emitReturnErr() {
+	g.w.line("return runtime.WrapError(err, %q, %d, %d)", g.template, g.pos.Line, g.pos.Col)
+}
+
+// emitReturnPartialErr emits the return of err, the error of the partial called by the node being
+// emitted, wrapped with the node's template position (see runtime.WrapPartialError).
+func (g *generator) emitReturnPartialErr() {
+	g.w.line("return runtime.WrapPartialError(err, %q, %d, %d)", g.template, g.pos.Line, g.pos.Col)
+}
+
+// emitHelperCall emits call, the call of helper. With resultVar, call returns (any, error) and
+// its value is assigned to resultVar; otherwise it returns an error. The call is wrapped in
+// runtime.RecoverHelper(Value) with Options.RecoverHelpers, and its error is handled under the
+// helper's error policy.
+func (g *generator) emitHelperCall(helper, resultVar, call string) {
+	g.emitLineDirective()
+	if resultVar != "" {
+		if g.recoverHelpers {
+			call = fmt.Sprintf("runtime.RecoverHelperValue(func() (any, error) { return %s })", call)
+		}
+		g.w.line("%s, err := %s", resultVar, call)
+		g.w.line("if err != nil {")
+	} else {
+		if g.recoverHelpers {
+			call = fmt.Sprintf("runtime.RecoverHelper(func() error { return %s })", call)
+		}
+		g.w.line("if err := %s; err != nil {", call)
+	}
+	g.w.indentInc()
+	policy := g.helperErrors
+	if p, ok := g.helperErrorPolicies[helper]; ok {
+		policy = p
+	}
+	if policy == "" || policy == HelperErrorsFail {
+		g.w.line("return runtime.WrapHelperError(err, %q, %q, %d, %d)", helper, g.template, g.pos.Line, g.pos.Col)
+	} else {
+		g.w.line("if err := runtime.HandleHelperError(%s, err, %q, %q, %q, %d, %d); err != nil {",
+			g.currentWriter(), policy, helper, g.template, g.pos.Line, g.pos.Col)
+		g.w.indentInc()
+		g.w.line("return err")
+		g.w.indentDec()
+		g.w.line("}")
+		if resultVar != "" {
+			g.w.line("%s = nil", resultVar)
+		}
+	}
+	g.w.indentDec()
+	g.w.line("}")
+}
+
 func (g *generator) emitBlock(n *ast.Block) error {
 	switch n.Name {
 	case "if":
@@ -596,6 +1003,10 @@ func (g *generator) emitBlock(n *ast.Block) error {
 		if _, ok := g.helpers[n.Name]; ok {
 			return g.emitCustomBlockHelper(n)
 		}
+		// With MissingHelpersRuntime, a block with arguments calls the runtime block helper.
+		if g.runtimeHelpers && runtimeHelperName(n.Name) && strings.TrimSpace(n.Args) != "" {
+			return g.emitCustomBlockHelper(n)
+		}
 		// Universal section: {{#anything}}...{{/anything}} => {{#with anything}}...{{/with}}
 		// (Mustache/Handlebars semantics: lookup name in context; if truthy, render block with that value as context)
 		sectionExpr := strings.TrimSpace(n.Args)
@@ -620,8 +1031,12 @@ func (g *generator) emitMustache(n *ast.Mustache) error {
 	}
 	if len(parts) == 1 {
 		if parts[0].kind == exprPath {
-			if helperExpr, ok := g.helpers[parts[0].value]; ok {
-				return g.emitHelperOutput(helperExpr, nil, hash, n.Raw)
+			if _, ok := g.helpers[parts[0].value]; ok {
+				return g.emitHelperOutput(parts[0].value, nil, hash, n.Raw)
+			}
+			// A name with hash arguments is a helper call, possibly one resolved at render time.
+			if _, _, ok := g.helperCallee(parts[0].value, false); ok && len(hash) > 0 {
+				return g.emitHelperOutput(parts[0].value, nil, hash, n.Raw)
 			}
 		}
 		if len(hash) > 0 {
@@ -637,11 +1052,10 @@ func (g *generator) emitMustache(n *ast.Mustache) error {
 	if parts[0].kind != exprPath {
 		return hexerr.New("helper name must be a path")
 	}
-	helperExpr, ok := g.helpers[parts[0].value]
-	if !ok {
+	if _, _, ok := g.helperCallee(parts[0].value, false); !ok {
 		return hexerr.New(fmt.Sprintf("helper %q is not defined", parts[0].value))
 	}
-	return g.emitHelperOutput(helperExpr, parts[1:], hash, n.Raw)
+	return g.emitHelperOutput(parts[0].value, parts[1:], hash, n.Raw)
 }
 
 func (g *generator) emitPartial(n *ast.Partial) error {
@@ -656,7 +1070,7 @@ func (g *generator) emitPartial(n *ast.Partial) error {
 		return hexerr.New("partial: context must be a single expression")
 	}
 	nameExpr := parts[0]
-	scope, _ := g.currentTypedScope()
+	scope, _ := g.currentContextScope()
 	// Current context is passed only when there are no explicit params and no hash ({{> name}}).
 	partialCtxVar := scope.varName
 	baseCtxVar := scope.varName
@@ -712,7 +1126,8 @@ func (g *generator) emitPartial(n *ast.Partial) error {
 	}
 
 	// When context is a merged map (hash) or explicit (parts==2), use partials map so contextMap+FromMap convert it.
-	usePartialsMap := len(hash) > 0 || len(parts) == 2
+	// An untyped current context (e.g. in a helper's block body) also goes through the partials map.
+	usePartialsMap := len(hash) > 0 || len(parts) == 2 || scope.dynamic
 	writerArg := g.currentWriter()
 	if nameExpr.kind == exprString {
 		name := nameExpr.value
@@ -721,20 +1136,14 @@ func (g *generator) emitPartial(n *ast.Partial) error {
 			return hexerr.New(fmt.Sprintf("partial %q is not defined", name))
 		}
 		if usePartialsMap {
-			if g.blocksVar != "" {
-				g.w.line("if err := partials[%q](%s, %s, %s, %s); err != nil {", name, partialCtxVar, writerArg, partialCtxVar, g.blocksVar)
-			} else {
-				g.w.line("if err := partials[%q](%s, %s, %s); err != nil {", name, partialCtxVar, writerArg, partialCtxVar)
-			}
+			g.emitLineDirective()
+			g.w.line("if err := partials[%q](%s, %s, %s%s); err != nil {", name, partialCtxVar, writerArg, partialCtxVar, g.renderTail())
 		} else {
-			if g.blocksVar != "" {
-				g.w.line("if err := render%s(%s, %s, %s, %s); err != nil {", goName, partialCtxVar, writerArg, partialCtxVar, g.blocksVar)
-			} else {
-				g.w.line("if err := render%s(%s, %s, %s); err != nil {", goName, partialCtxVar, writerArg, partialCtxVar)
-			}
+			g.emitLineDirective()
+			g.w.line("if err := render%s(%s, %s, %s%s); err != nil {", goName, partialCtxVar, writerArg, partialCtxVar, g.renderTail())
 		}
 		g.w.indentInc()
-		g.w.line("return err")
+		g.emitReturnPartialErr()
 		g.w.indentDec()
 		g.w.line("}")
 		return nil
@@ -742,20 +1151,14 @@ func (g *generator) emitPartial(n *ast.Partial) error {
 	if nameExpr.kind == exprPath {
 		if goName, ok := g.partials[nameExpr.value]; ok {
 			if usePartialsMap {
-				if g.blocksVar != "" {
-					g.w.line("if err := partials[%q](%s, %s, %s, %s); err != nil {", nameExpr.value, partialCtxVar, writerArg, partialCtxVar, g.blocksVar)
-				} else {
-					g.w.line("if err := partials[%q](%s, %s, %s); err != nil {", nameExpr.value, partialCtxVar, writerArg, partialCtxVar)
-				}
+				g.emitLineDirective()
+				g.w.line("if err := partials[%q](%s, %s, %s%s); err != nil {", nameExpr.value, partialCtxVar, writerArg, partialCtxVar, g.renderTail())
 			} else {
-				if g.blocksVar != "" {
-					g.w.line("if err := render%s(%s, %s, %s, %s); err != nil {", goName, partialCtxVar, writerArg, partialCtxVar, g.blocksVar)
-				} else {
-					g.w.line("if err := render%s(%s, %s, %s); err != nil {", goName, partialCtxVar, writerArg, partialCtxVar)
-				}
+				g.emitLineDirective()
+				g.w.line("if err := render%s(%s, %s, %s%s); err != nil {", goName, partialCtxVar, writerArg, partialCtxVar, g.renderTail())
 			}
 			g.w.indentInc()
-			g.w.line("return err")
+			g.emitReturnPartialErr()
 			g.w.indentDec()
 			g.w.line("}")
 			return nil
@@ -769,18 +1172,20 @@ func (g *generator) emitPartial(n *ast.Partial) error {
 	}
 	nameVar := g.nextTemp("partial")
 	g.w.line("%s := runtime.Stringify(%s)", nameVar, nameValue)
-	g.w.line("partialFn, ok := partials[%s]", nameVar)
-	g.w.line("if !ok {")
+	// Partials of this package first, then the runtime registries (which write
+	// runtime.MissingPartialOutput when they do not have it either).
+	g.emitLineDirective()
+	g.w.line("if partialFn, ok := partials[%s]; ok {", nameVar)
+	g.w.indentInc()
+	g.w.line("if err := partialFn(%s, %s, %s%s); err != nil {", partialCtxVar, writerArg, partialCtxVar, g.renderTail())
 	g.w.indentInc()
-	g.w.line("runtime.MissingPartialOutput(%s, %s)", writerArg, nameVar)
+	g.emitReturnPartialErr()
 	g.w.indentDec()
-	if g.blocksVar != "" {
-		g.w.line("} else if err := partialFn(%s, %s, %s, %s); err != nil {", partialCtxVar, writerArg, partialCtxVar, g.blocksVar)
-	} else {
-		g.w.line("} else if err := partialFn(%s, %s, %s); err != nil {", partialCtxVar, writerArg, partialCtxVar)
-	}
+	g.w.line("}")
+	g.w.indentDec()
+	g.w.line("} else if err := env.RenderPartial(%s, %s, %s); err != nil {", writerArg, nameVar, partialCtxVar)
 	g.w.indentInc()
-	g.w.line("return err")
+	g.emitReturnPartialErr()
 	g.w.indentDec()
 	g.w.line("}")
 	return nil
@@ -795,7 +1200,7 @@ func (g *generator) emitIfBlock(n *ast.Block, inverted bool) error {
 		return err
 	}
 	useIncludeZero := hashHasIncludeZero(hash)
-	valueExpr, err := g.emitExprValue(blockExpr)
+	valueExpr, err := g.emitGuardValue(blockExpr)
 	if err != nil {
 		return err
 	}
@@ -821,6 +1226,9 @@ func (g *generator) emitIfBlock(n *ast.Block, inverted bool) error {
 	if len(n.Params) > 0 && blockExpr.kind == exprPath {
 		scope, _ := g.currentTypedScope()
 		paramScopeNode = nodeAtPath(scope.node, blockExpr.value)
+		if paramScopeNode == nil {
+			_, paramScopeNode = g.resolvePath(blockExpr.value)
+		}
 	}
 
 	g.w.line("if %s {", condExpr)
@@ -832,6 +1240,10 @@ func (g *generator) emitIfBlock(n *ast.Block, inverted bool) error {
 		paramVar := g.nextTemp("p")
 		g.w.line("%s := %s", paramVar, valVar)
 		g.pushTypedScope(paramVar, n.Params[0], paramScopeNode)
+		g.typedStack[len(g.typedStack)-1].paramOnly = true
+		if blockExpr.kind == exprPath {
+			g.typedStack[len(g.typedStack)-1].dataPath = g.dataPathOfParent(blockExpr.value)
+		}
 	}
 	if err := g.emitNodes(n.Body); err != nil {
 		return err
@@ -860,7 +1272,7 @@ func (g *generator) emitWithBlock(n *ast.Block) error {
 	if err != nil {
 		return err
 	}
-	valueExpr, err := g.emitExprValue(blockExpr)
+	valueExpr, err := g.emitGuardValue(blockExpr)
 	if err != nil {
 		return err
 	}
@@ -869,11 +1281,15 @@ func (g *generator) emitWithBlock(n *ast.Block) error {
 	if blockExpr.kind == exprPath {
 		pathStr = blockExpr.value
 	}
+	withDataPath := g.dataPathOf(pathStr)
 	newPathPrefix := pathStr
 	if scope.pathPrefix != "" {
 		newPathPrefix = scope.pathPrefix + "." + pathStr
 	}
 	childNode := nodeAtPath(scope.node, pathStr)
+	if childNode == nil && blockExpr.kind == exprPath {
+		_, childNode = g.resolvePath(pathStr)
+	}
 	typedCtxVar := g.nextTemp("ctx")
 	scopePathPrefix := newPathPrefix
 	if len(n.Params) == 1 && isIdent(n.Params[0]) {
@@ -888,6 +1304,7 @@ func (g *generator) emitWithBlock(n *ast.Block) error {
 	g.w.line("if runtime.IsTruthy(%s) {", typedCtxVar)
 	g.w.indentInc()
 	g.pushTypedScope(typedCtxVar, scopePathPrefix, childNode)
+	g.typedStack[len(g.typedStack)-1].dataPath = withDataPath
 	if err := g.emitNodes(n.Body); err != nil {
 		return err
 	}
@@ -931,6 +1348,9 @@ func (g *generator) emitEachBlock(n *ast.Block) error {
 		pathStr = blockExpr.value
 	}
 	colNode := nodeAtPath(scope.node, pathStr)
+	if colNode == nil && blockExpr.kind == exprPath {
+		_, colNode = g.resolvePath(pathStr)
+	}
 	var itemNode *typeNode
 	if colNode != nil && colNode.isSlice && colNode.sliceElem != nil {
 		itemNode = colNode.sliceElem
@@ -938,39 +1358,55 @@ func (g *generator) emitEachBlock(n *ast.Block) error {
 	// Always use temps for loop vars to avoid "no new variables" in nested each
 	itemVar := g.nextTemp("item")
 	keyVar := g.nextTemp("key")
+	itemDataPath := joinDataPathKey(g.dataPathOf(pathStr), keyVar)
 	itemsVar := g.nextTemp("items")
 	rangeExpr := itemsVar
 	lenExpr := itemsVar
 	useMapAssert := false
-	if collectionExpr == "nil" {
+	ctxExpr, key, elemName, useElements := g.typedElements(collectionExpr, pathStr, colNode)
+	if useElements {
+		// A typed collection: runtime.Elements iterates an iterator or channel in a map-backed
+		// context lazily instead of collecting it with the accessor.
+		ctxVar := g.nextTemp("col")
+		g.w.line("%s := %s", ctxVar, ctxExpr)
+		g.w.line("%s, err := runtime.Elements(env, %s, %q, %s.%s, func(m map[string]any) %s { return %s{m} })",
+			itemsVar, ctxVar, key, ctxVar, goFieldName(key), elemName, contextDataStructName(elemName))
+		g.w.line("if err != nil {")
+		g.w.indentInc()
+		g.emitReturnErr()
+		g.w.indentDec()
+		g.w.line("}")
+	} else if collectionExpr == "nil" {
 		// Unresolved path: use typed nil slice so we can range and use len
 		itemType := contextItemInterfaceName(g.goName, pathStr)
 		g.w.line("var %s []%s", itemsVar, itemType)
 	} else {
-		g.w.line("%s := %s", itemsVar, collectionExpr)
 		// When collection is a map (object), use comma-ok so []any at runtime doesn't panic
 		if colNode != nil && !colNode.isSlice {
 			useMapAssert = true
+			g.w.line("%s := %s", itemsVar, collectionExpr)
+		} else if colNode == nil {
+			// Untyped value (runtime lookup or helper result): same checks, items are untyped too.
+			useMapAssert = true
+			g.w.line("%s := any(%s)", itemsVar, collectionExpr)
+		} else {
+			g.w.line("%s := %s", itemsVar, collectionExpr)
 		}
 	}
-	if useMapAssert {
-		// Type tree says map; at runtime value may be []any (JSON array) or map[string]any. Try both.
-		sliceVar := g.nextTemp("sl")
-		mapVar := g.nextTemp("m")
-		g.w.line("%s, _eachSliceOk := %s.([]any)", sliceVar, itemsVar)
-		g.w.line("if _eachSliceOk && len(%s) > 0 {", sliceVar)
-		g.w.indentInc()
-		g.w.line("for %s, %s := range %s {", keyVar, itemVar, sliceVar)
-		g.w.indentInc()
-		g.w.line("_, _ = %s, %s", keyVar, itemVar)
-		itemPathPrefix := pathStr
-		if len(n.Params) > 0 {
-			itemPathPrefix = n.Params[0]
-		}
+	itemPathPrefix := pathStr
+	if len(n.Params) > 0 {
+		itemPathPrefix = n.Params[0]
+	}
+	body := func(keyVar, itemVar, first, last string) error {
+		g.w.line("_, _ = %s, %s", keyVar, itemVar) // silence "declared and not used" when body uses @key/@index (we emit nil)
+		g.emitIterate()
 		g.pushTypedScope(itemVar, itemPathPrefix, itemNode)
-		g.typedStack[len(g.typedStack)-1].eachKeyVar = keyVar
+		top := &g.typedStack[len(g.typedStack)-1]
+		top.eachKeyVar, top.eachFirst, top.eachLast = keyVar, first, last
+		top.dataPath = itemDataPath
 		if len(n.Params) > 1 {
 			g.pushTypedScope(keyVar, n.Params[1], nil)
+			g.typedStack[len(g.typedStack)-1].paramOnly = true
 		}
 		if err := g.emitNodes(n.Body); err != nil {
 			return err
@@ -979,31 +1415,28 @@ func (g *generator) emitEachBlock(n *ast.Block) error {
 			g.popTypedScope()
 		}
 		g.popTypedScope()
-		g.w.indentDec()
-		g.w.line("}")
-		g.w.indentDec()
-		g.w.line("} else if %s, _eachMapOk := %s.(map[string]any); _eachMapOk && len(%s) > 0 {", mapVar, itemsVar, mapVar)
-		g.w.indentInc()
-		g.w.line("for %s, %s := range %s {", keyVar, itemVar, mapVar)
+		return nil
+	}
+	if useElements {
+		eachVar := g.nextTemp("each")
+		emptyVar := ""
+		if len(n.Else) > 0 {
+			emptyVar = g.nextTemp("empty")
+			g.w.line("%s := true", emptyVar)
+		}
+		g.w.line("for %s := range %s {", eachVar, itemsVar)
 		g.w.indentInc()
-		g.w.line("_, _ = %s, %s", keyVar, itemVar)
-		g.pushTypedScope(itemVar, itemPathPrefix, itemNode)
-		g.typedStack[len(g.typedStack)-1].eachKeyVar = keyVar
-		if len(n.Params) > 1 {
-			g.pushTypedScope(keyVar, n.Params[1], nil)
+		if len(n.Else) > 0 {
+			g.w.line("%s = false", emptyVar)
 		}
-		if err := g.emitNodes(n.Body); err != nil {
+		g.w.line("%s, %s := %s.Index, %s.Value", keyVar, itemVar, eachVar, eachVar)
+		if err := body(keyVar, itemVar, eachVar+".First", eachVar+".Last"); err != nil {
 			return err
 		}
-		if len(n.Params) > 1 {
-			g.popTypedScope()
-		}
-		g.popTypedScope()
 		g.w.indentDec()
 		g.w.line("}")
-		g.w.indentDec()
 		if len(n.Else) > 0 {
-			g.w.line("} else {")
+			g.w.line("if %s {", emptyVar)
 			g.w.indentInc()
 			if err := g.emitNodes(n.Else); err != nil {
 				return err
@@ -1011,31 +1444,79 @@ func (g *generator) emitEachBlock(n *ast.Block) error {
 			g.w.indentDec()
 			g.w.line("}")
 		}
+		return nil
+	}
+	if useMapAssert {
+		// Type tree says map; at runtime value may be []any (JSON array), map[string]any or any
+		// other collection runtime.Each iterates: typed slices and maps, ordered maps, iterators,
+		// channels. The body is emitted once, as a function both loops call, so nested loops do
+		// not multiply it; a []any is ranged over without runtime.Each.
+		bodyVar := g.nextTemp("body")
+		firstVar := g.nextTemp("first")
+		lastVar := g.nextTemp("last")
+		g.w.line("%s := func(%s, %s any, %s, %s bool) error {", bodyVar, keyVar, itemVar, firstVar, lastVar)
+		g.w.indentInc()
+		if err := body(keyVar, itemVar, firstVar, lastVar); err != nil {
+			return err
+		}
+		g.w.line("return nil")
 		g.w.indentDec()
 		g.w.line("}")
+		emptyVar := ""
+		if len(n.Else) > 0 {
+			emptyVar = g.nextTemp("empty")
+			g.w.line("%s := true", emptyVar)
+		}
+		call := func(key, item, first, last string) {
+			if emptyVar != "" {
+				g.w.line("%s = false", emptyVar)
+			}
+			g.w.line("if err := %s(%s, %s, %s, %s); err != nil {", bodyVar, key, item, first, last)
+			g.w.indentInc()
+			g.w.line("return err")
+			g.w.indentDec()
+			g.w.line("}")
+		}
+		sliceVar := g.nextTemp("sl")
+		posVar := g.nextTemp("pos")
+		elemVar := g.nextTemp("el")
+		g.w.line("if %s, ok := %s.([]any); ok {", sliceVar, itemsVar)
+		g.w.indentInc()
+		g.w.line("for %s, %s := range %s {", posVar, elemVar, sliceVar)
+		g.w.indentInc()
+		call(posVar, elemVar, posVar+" == 0", fmt.Sprintf("%s == len(%s)-1", posVar, sliceVar))
+		g.w.indentDec()
+		g.w.line("}")
+		g.w.indentDec()
+		g.w.line("} else {")
+		g.w.indentInc()
+		// Maps in sorted key order, so that the output does not change with Go's map order.
+		eachVar := g.nextTemp("each")
+		g.w.line("for %s := range runtime.Each(%s) {", eachVar, itemsVar)
+		g.w.indentInc()
+		call(eachVar+".Key", eachVar+".Value", eachVar+".First", eachVar+".Last")
+		g.w.indentDec()
+		g.w.line("}")
+		g.w.indentDec()
+		g.w.line("}")
+		if emptyVar != "" {
+			g.w.line("if %s {", emptyVar)
+			g.w.indentInc()
+			if err := g.emitNodes(n.Else); err != nil {
+				return err
+			}
+			g.w.indentDec()
+			g.w.line("}")
+		}
 		return nil
 	}
 	g.w.line("if len(%s) > 0 {", lenExpr)
 	g.w.indentInc()
 	g.w.line("for %s, %s := range %s {", keyVar, itemVar, rangeExpr)
 	g.w.indentInc()
-	g.w.line("_, _ = %s, %s", keyVar, itemVar) // silence "declared and not used" when body uses @key/@index (we emit nil)
-	itemPathPrefix := pathStr
-	if len(n.Params) > 0 {
-		itemPathPrefix = n.Params[0]
-	}
-	g.pushTypedScope(itemVar, itemPathPrefix, itemNode)
-	g.typedStack[len(g.typedStack)-1].eachKeyVar = keyVar
-	if len(n.Params) > 1 {
-		g.pushTypedScope(keyVar, n.Params[1], nil)
-	}
-	if err := g.emitNodes(n.Body); err != nil {
+	if err := body(keyVar, itemVar, keyVar+" == 0", fmt.Sprintf("%s == len(%s)-1", keyVar, lenExpr)); err != nil {
 		return err
 	}
-	if len(n.Params) > 1 {
-		g.popTypedScope()
-	}
-	g.popTypedScope()
 	g.w.indentDec()
 	g.w.line("}")
 	g.w.indentDec()
@@ -1051,15 +1532,38 @@ func (g *generator) emitEachBlock(n *ast.Block) error {
 	return nil
 }
 
+// typedElements returns what runtime.Elements needs to iterate collectionExpr, the accessor
+// call of the typed collection at path (e.g. data.User().Posts() for "user.posts"): the
+// context it is called on, the collection's key and the interface of its elements. ok is
+// false when collectionExpr is not such a call on a context of the template's type tree.
+func (g *generator) typedElements(collectionExpr, path string, col *typeNode) (ctxExpr, key, elemName string, ok bool) {
+	if col == nil || !col.isSlice || col.sliceElem == nil {
+		return "", "", "", false
+	}
+	key = path[strings.LastIndexAny(path, "./")+1:]
+	ctxExpr, ok = strings.CutSuffix(collectionExpr, "."+goFieldName(key)+"()")
+	if !ok || key == "" {
+		return "", "", "", false
+	}
+	colPath, ok := collectionPath(g.tree, "", col)
+	if !ok {
+		return "", "", "", false
+	}
+	return ctxExpr, key, contextItemInterfaceName(g.goName, colPath), true
+}
+
 func (g *generator) emitCustomBlockHelper(n *ast.Block) error {
 	parts, hash, err := parseParts(n.Args)
 	if err != nil {
 		return err
 	}
-	helperExpr, ok := g.helpers[n.Name]
+	helperExpr, options, ok := g.helperCallee(n.Name, true)
 	if !ok {
 		return hexerr.New(fmt.Sprintf("block helper %q is not defined", n.Name))
 	}
+	if options {
+		return g.emitOptionsBlockHelper(n, helperExpr, parts, hash)
+	}
 	if len(parts) == 0 {
 		return hexerr.New(fmt.Sprintf("block helper %q requires at least one argument", n.Name))
 	}
@@ -1071,6 +1575,7 @@ func (g *generator) emitCustomBlockHelper(n *ast.Block) error {
 	bodyFnVar := g.nextTemp("bodyFn")
 	g.w.line("%s := func(w io.Writer) error {", bodyFnVar)
 	g.w.indentInc()
+	g.emitIterate()
 	if err := g.emitNodes(n.Body); err != nil {
 		return err
 	}
@@ -1083,6 +1588,7 @@ func (g *generator) emitCustomBlockHelper(n *ast.Block) error {
 		inverseFnVar = g.nextTemp("inverseFn")
 		g.w.line("%s := func(w io.Writer) error {", inverseFnVar)
 		g.w.indentInc()
+		g.emitIterate()
 		if err := g.emitNodes(n.Else); err != nil {
 			return err
 		}
@@ -1107,6 +1613,11 @@ func (g *generator) emitCustomBlockHelper(n *ast.Block) error {
 	if err != nil {
 		return err
 	}
+	if g.helperInfos[n.Name].kind.takesOptions() {
+		// runtime.BlockHelper takes options as a separate parameter.
+		g.emitHelperCall(n.Name, "", fmt.Sprintf("%s(%s, %s)", helperExpr, argsExpr, optionsVar))
+		return nil
+	}
 	// Append options to args
 	if argsExpr == "nil" {
 		argsExpr = g.nextTemp("args")
@@ -1125,12 +1636,205 @@ func (g *generator) emitCustomBlockHelper(n *ast.Block) error {
 	g.w.line("return fmt.Errorf(\"block helper %%q did not receive BlockOptions\", %q)", n.Name)
 	g.w.indentDec()
 	g.w.line("}")
-	g.w.line("if err := %s(%s); err != nil {", helperExpr, argsExpr)
+	g.emitHelperCall(n.Name, "", fmt.Sprintf("%s(%s)", helperExpr, argsExpr))
+	return nil
+}
+
+// emitOptionsBlockHelper calls a runtime.OptionsBlockHelper. The body and {{else}} section become
+// runtime.BlockFunc closures that render with whatever context and @data frame the helper passes.
+// The helper's BlockContext lets the body use the caller's typed context or the typed elements
+// of its first argument instead of runtime lookups.
+func (g *generator) emitOptionsBlockHelper(n *ast.Block, helperExpr string, parts []expr, hash []hashArg) error {
+	hint := g.blockContexts[n.Name]
+	body := blockBody{name: n.Name, params: n.Params, sameContext: hint == BlockContextThis}
+	var argsExpr string
+	var err error
+	if colNode := g.typedCollectionNode(hint, parts); colNode != nil {
+		// Keep the typed collection so the body can assert its context to the element type.
+		colExpr, err := g.emitExprValue(parts[0])
+		if err != nil {
+			return err
+		}
+		body.collection, body.itemNode = g.nextTemp("col"), colNode.sliceElem
+		if ctxExpr, key, elemName, ok := g.typedElements(colExpr, parts[0].value, colNode); ok {
+			// Resolved as {{#each}} resolves it, with the render's context and its errors.
+			ctxVar := g.nextTemp("colCtx")
+			g.w.line("%s := %s", ctxVar, ctxExpr)
+			g.w.line("%s, err := runtime.ElementSlice(env, %s, %q, %s.%s, func(m map[string]any) %s { return %s{m} })",
+				body.collection, ctxVar, key, ctxVar, goFieldName(key), elemName, contextDataStructName(elemName))
+			g.w.line("if err != nil {")
+			g.w.indentInc()
+			g.emitReturnErr()
+			g.w.indentDec()
+			g.w.line("}")
+		} else {
+			g.w.line("%s := %s", body.collection, colExpr)
+		}
+		restExpr, err := g.emitArgs(parts[1:], nil)
+		if err != nil {
+			return err
+		}
+		argsExpr = g.nextTemp("args")
+		if restExpr == "nil" {
+			g.w.line("%s := []any{%s}", argsExpr, body.collection)
+		} else {
+			g.w.line("%s := append([]any{%s}, %s...)", argsExpr, body.collection, restExpr)
+		}
+	} else if argsExpr, err = g.emitArgs(parts, nil); err != nil {
+		return err
+	}
+	optionsVar, err := g.emitHelperOptions(n.Name, hash)
+	if err != nil {
+		return err
+	}
+	if len(n.Params) > 0 {
+		g.w.line("%s.BlockParams = %d", optionsVar, len(n.Params))
+	}
+	fnVar, err := g.emitBlockFunc(n.Body, body)
+	if err != nil {
+		return err
+	}
+	inverseVar := "nil"
+	if len(n.Else) > 0 {
+		// Helpers with a BlockContext render {{else}} with the caller's context.
+		inverse := blockBody{name: n.Name, sameContext: hint != ""}
+		if inverseVar, err = g.emitBlockFunc(n.Else, inverse); err != nil {
+			return err
+		}
+	}
+	g.w.line("%s.SetBlock(%s, %s)", optionsVar, fnVar, inverseVar)
+	g.emitHelperCall(n.Name, "", fmt.Sprintf("%s(%s, %s, %s)", helperExpr, g.currentWriter(), argsExpr, optionsVar))
+	return nil
+}
+
+// blockBody describes the context a runtime.BlockFunc renders its nodes with.
+type blockBody struct {
+	name        string   // helper name, for errors
+	params      []string // block params, read from the frame with DataFrame.BlockParam
+	sameContext bool     // the helper passes the caller's context: the body uses the enclosing scope
+	collection  string   // with itemNode: variable holding the typed collection (first argument)
+	itemNode    *typeNode
+}
+
+// typedCollectionNode returns the type node of the first argument of a BlockContextItem
+// helper when it is a typed slice, or nil.
+func (g *generator) typedCollectionNode(hint string, parts []expr) *typeNode {
+	if hint != BlockContextItem || len(parts) == 0 || parts[0].kind != exprPath {
+		return nil
+	}
+	scope, _ := g.currentTypedScope()
+	colNode := nodeAtPath(scope.node, parts[0].value)
+	if colNode == nil {
+		_, colNode = g.resolvePath(parts[0].value)
+	}
+	if colNode == nil || !colNode.isSlice || colNode.sliceElem == nil || isDynamicNode(colNode.sliceElem) {
+		return nil
+	}
+	return colNode
+}
+
+// emitBlockFunc emits a runtime.BlockFunc rendering nodes as described by body and returns its variable.
+// Without a known context the nodes are rendered with an untyped context.
+func (g *generator) emitBlockFunc(nodes []ast.Node, body blockBody) (string, error) {
+	fnVar := g.nextTemp("blockFn")
+	ctxVar := g.nextTemp("blockCtx")
+	frameVar := g.nextTemp("frame")
+	g.w.line("%s := func(w io.Writer, %s any, %s *runtime.DataFrame) error {", fnVar, ctxVar, frameVar)
+	g.w.indentInc()
+	g.w.line("_, _ = %s, %s", ctxVar, frameVar)
+	g.emitIterate()
+	savedWriters := g.writerStack
+	g.writerStack = nil
+	depth := len(g.typedStack)
+	params := body.params
+	switch {
+	case body.sameContext:
+		// Closes over the caller's typed scope; only @data comes from the frame.
+		g.pushTypedScope("", "", nil)
+		g.typedStack[len(g.typedStack)-1].dynamic = false
+	case body.itemNode != nil:
+		itemVar := g.nextTemp("item")
+		g.w.line("%s, ok := runtime.ElementOf(%s, %s)", itemVar, ctxVar, body.collection)
+		g.w.line("if !ok {")
+		g.w.indentInc()
+		g.w.line("return runtime.BlockContextError(%q, %s)", body.name, ctxVar)
+		g.w.indentDec()
+		g.w.line("}")
+		prefix := ""
+		if len(params) > 0 {
+			prefix, params = params[0], params[1:]
+		}
+		g.pushTypedScope(itemVar, prefix, body.itemNode)
+	default:
+		g.pushTypedScope(ctxVar, "", nil)
+	}
+	g.typedStack[len(g.typedStack)-1].frameVar = frameVar
+	g.typedStack[len(g.typedStack)-1].paramOnly = body.sameContext
+	for j, p := range params {
+		i := len(body.params) - len(params) + j
+		g.pushTypedScope(fmt.Sprintf("%s.BlockParam(%d)", frameVar, i), p, nil)
+		g.typedStack[len(g.typedStack)-1].paramOnly = true
+	}
+	err := g.emitNodes(nodes)
+	g.typedStack = g.typedStack[:depth]
+	g.writerStack = savedWriters
+	if err != nil {
+		return "", err
+	}
+	g.w.line("return nil")
+	g.w.indentDec()
+	g.w.line("}")
+	return fnVar, nil
+}
+
+// emitHelperOptions emits the *runtime.HelperOptions for a call of helper name and returns its variable.
+func (g *generator) emitHelperOptions(name string, hash []hashArg) (string, error) {
+	hashVar, err := g.emitHashMap(hash)
+	if err != nil {
+		return "", err
+	}
+	ctxExpr := "nil"
+	if scope, ok := g.currentContextScope(); ok {
+		ctxExpr = "runtime.RawValue(" + scope.varName + ")"
+	}
+	frameVar := g.emitDataFrame()
+	optionsVar := g.nextTemp("options")
+	g.w.line("%s := &runtime.HelperOptions{", optionsVar)
 	g.w.indentInc()
-	g.w.line("return err")
+	g.w.line("Name: %q,", name)
+	g.w.line("Template: %q,", g.template)
+	g.w.line("Context: %s,", ctxExpr)
+	g.w.line("Data: %s,", frameVar)
+	if hashVar != "nil" {
+		g.w.line("Hash: %s,", hashVar)
+	}
+	g.w.line("Ctx: env.Ctx(),")
 	g.w.indentDec()
 	g.w.line("}")
-	return nil
+	return optionsVar, nil
+}
+
+// emitDataFrame emits the @data frame at the current position: the frame of the enclosing helper
+// block body (or a new frame with @root and the render's @data variables), plus @index/@key
+// for each {{#each}} inside it.
+func (g *generator) emitDataFrame() string {
+	frame := "env.RootFrame(" + g.rootVar + ")"
+	start := 0
+	for i := len(g.typedStack) - 1; i >= 0; i-- {
+		if g.typedStack[i].frameVar != "" {
+			frame, start = g.typedStack[i].frameVar, i+1
+			break
+		}
+	}
+	for _, s := range g.typedStack[start:] {
+		if s.eachKeyVar != "" {
+			frame = fmt.Sprintf("runtime.NewDataFrame(%s).Set(\"index\", %s).Set(\"key\", %s).Set(\"first\", %s).Set(\"last\", %s)",
+				frame, s.eachKeyVar, s.eachKeyVar, s.eachFirst, s.eachLast)
+		}
+	}
+	frameVar := g.nextTemp("frame")
+	g.w.line("%s := %s", frameVar, frame)
+	return frameVar
 }
 
 func (g *generator) emitLayoutBlock(n *ast.Block) error {
@@ -1252,15 +1956,29 @@ func hashHasIncludeZero(hash []hashArg) bool {
 }
 
 func (g *generator) emitValueExpr(expr string, raw bool) {
-	if raw {
+	c := g.html.escapeContext()
+	// In <script> expressions contextual escaping writes values as JavaScript literals (JSON),
+	// which StringifyJS would turn into strings.
+	if g.jsValues && !(g.contextual && strings.Contains(c+"|", "runtime.HTMLJS|")) {
+		expr = "runtime.JSValue(" + expr + ")"
+	}
+	if raw || g.escaper == EscapeText {
 		g.writeValue("runtime.WriteRaw", expr)
 		return
 	}
+	if g.escaper != "" {
+		g.writeValue("runtime.WriteEscapedWith", strconv.Quote(g.escaper)+", "+expr)
+		return
+	}
+	if g.contextual && c != "" {
+		g.writeValue("runtime.WriteEscapedIn", c+", "+expr)
+		return
+	}
 	g.writeValue("runtime.WriteEscaped", expr)
 }
 
-func (g *generator) emitHelperOutput(helperExpr string, args []expr, hash []hashArg, raw bool) error {
-	resultVar, err := g.emitHelperValue(helperExpr, args, hash)
+func (g *generator) emitHelperOutput(name string, args []expr, hash []hashArg, raw bool) error {
+	resultVar, err := g.emitHelperValue(name, args, hash)
 	if err != nil {
 		return err
 	}
@@ -1268,32 +1986,103 @@ func (g *generator) emitHelperOutput(helperExpr string, args []expr, hash []hash
 	return nil
 }
 
-func (g *generator) emitHelperValue(helperExpr string, args []expr, hash []hashArg) (string, error) {
+// emitHelperValue calls the helper registered as name and returns the variable holding its result.
+func (g *generator) emitHelperValue(name string, args []expr, hash []hashArg) (string, error) {
+	helperExpr, options, _ := g.helperCallee(name, false)
+	if options {
+		argsExpr, err := g.emitArgs(args, nil)
+		if err != nil {
+			return "", err
+		}
+		optionsVar, err := g.emitHelperOptions(name, hash)
+		if err != nil {
+			return "", err
+		}
+		resultVar := g.nextTemp("result")
+		g.emitHelperCall(name, resultVar, fmt.Sprintf("%s(%s, %s)", helperExpr, argsExpr, optionsVar))
+		return resultVar, nil
+	}
 	argsExpr, err := g.emitArgs(args, hash)
 	if err != nil {
 		return "", err
 	}
 	resultVar := g.nextTemp("result")
-	g.w.line("%s, err := %s(%s)", resultVar, helperExpr, argsExpr)
-	g.w.line("if err != nil {")
-	g.w.indentInc()
-	g.w.line("return err")
-	g.w.indentDec()
-	g.w.line("}")
+	g.emitHelperCall(name, resultVar, fmt.Sprintf("%s(%s)", helperExpr, argsExpr))
 	return resultVar, nil
 }
 
+// helperCallee returns the Go expression to call for helper name and whether it is called with
+// runtime.HelperOptions. With MissingHelpersRuntime, names without a compiled helper resolve to
+// env.Helper / env.BlockHelper (the runtime registries); otherwise ok is false for them.
+func (g *generator) helperCallee(name string, block bool) (callee string, options bool, ok bool) {
+	if helperExpr, ok := g.helpers[name]; ok {
+		return helperExpr, g.helperInfos[name].kind.usesHelperOptions(), true
+	}
+	if !g.runtimeHelpers || !runtimeHelperName(name) {
+		return "", false, false
+	}
+	if block {
+		return fmt.Sprintf("env.BlockHelper(%q)", name), true, true
+	}
+	return fmt.Sprintf("env.Helper(%q)", name), true, true
+}
+
+// runtimeHelperName reports whether name can be a helper looked up at render time: a plain
+// identifier rather than a dotted path, "this" or an @data variable.
+func runtimeHelperName(name string) bool {
+	return name != "" && name != "this" && !strings.ContainsAny(name, "./@[")
+}
+
+// checkStringify validates Options.Stringify.
+func checkStringify(mode string) error {
+	switch mode {
+	case "", StringifyGo, StringifyJS:
+		return nil
+	}
+	return hexerr.New(fmt.Sprintf("compiler: unknown stringify mode %q (want %q or %q)", mode, StringifyGo, StringifyJS))
+}
+
+// checkHelperErrors validates Options.HelperErrors and Options.HelperErrorPolicies.
+func checkHelperErrors(policy string, policies map[string]string) error {
+	check := func(policy, what string) error {
+		switch policy {
+		case "", HelperErrorsFail, HelperErrorsEmpty, HelperErrorsComment:
+			return nil
+		}
+		return hexerr.New(fmt.Sprintf("compiler: unknown helper errors policy %q%s (want %q, %q or %q)", policy, what, HelperErrorsFail, HelperErrorsEmpty, HelperErrorsComment))
+	}
+	if err := check(policy, ""); err != nil {
+		return err
+	}
+	for name, p := range policies {
+		if err := check(p, fmt.Sprintf(" for helper %q", name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingHelpersPolicy validates Options.MissingHelpers and reports whether it is MissingHelpersRuntime.
+func missingHelpersPolicy(policy string) (bool, error) {
+	switch policy {
+	case "", MissingHelpersError:
+		return false, nil
+	case MissingHelpersRuntime:
+		return true, nil
+	}
+	return false, hexerr.New(fmt.Sprintf("compiler: unknown missing helpers policy %q (want %q or %q)", policy, MissingHelpersError, MissingHelpersRuntime))
+}
+
 func (g *generator) emitArgs(args []expr, hash []hashArg) (string, error) {
 	argExprs := make([]string, len(args))
 	for i, arg := range args {
 		var exprValue string
 		if arg.kind == exprCall {
-			helperExpr, ok := g.helpers[arg.name]
-			if !ok {
+			if _, _, ok := g.helperCallee(arg.name, false); !ok {
 				return "", hexerr.New(fmt.Sprintf("helper %q is not defined", arg.name))
 			}
 			var err error
-			exprValue, err = g.emitHelperValue(helperExpr, arg.args, arg.hash)
+			exprValue, err = g.emitHelperValue(arg.name, arg.args, arg.hash)
 			if err != nil {
 				return "", err
 			}
@@ -1360,15 +2149,19 @@ func (g *generator) emitPartialContextMap(hash []hashArg) (string, error) {
 	if len(hash) == 0 {
 		return "nil", nil
 	}
-	mapVar := g.nextTemp("partialCtx")
-	g.w.line("%s := map[string]any{", mapVar)
-	g.w.indentInc()
-	for _, h := range hash {
+	values := make([]string, len(hash))
+	for i, h := range hash {
 		valueExpr, err := g.emitExprValue(h.value)
 		if err != nil {
 			return "", err
 		}
-		g.w.line("%q: %s,", h.key, valueExpr)
+		values[i] = valueExpr
+	}
+	mapVar := g.nextTemp("partialCtx")
+	g.w.line("%s := map[string]any{", mapVar)
+	g.w.indentInc()
+	for i, h := range hash {
+		g.w.line("%q: %s,", h.key, values[i])
 	}
 	g.w.indentDec()
 	g.w.line("}")
@@ -1377,11 +2170,10 @@ func (g *generator) emitPartialContextMap(hash []hashArg) (string, error) {
 
 func (g *generator) emitExprValue(value expr) (string, error) {
 	if value.kind == exprCall {
-		helperExpr, ok := g.helpers[value.name]
-		if !ok {
+		if _, _, ok := g.helperCallee(value.name, false); !ok {
 			return "", hexerr.New(fmt.Sprintf("helper %q is not defined", value.name))
 		}
-		return g.emitHelperValue(helperExpr, value.args, value.hash)
+		return g.emitHelperValue(value.name, value.args, value.hash)
 	}
 	// Inline literals directly instead of using EvalArg
 	valueExpr, err := g.emitLiteralValue(value)
@@ -1394,7 +2186,12 @@ func (g *generator) emitExprValue(value expr) (string, error) {
 func (g *generator) emitLiteralValue(value expr) (string, error) {
 	switch value.kind {
 	case exprPath:
-		return g.emitPathValue(value.value), nil
+		g.emitStrictCheck(value.value)
+		valueExpr, node := g.resolvePath(value.value)
+		if valueExpr == "nil" || !isDynamicNode(node) {
+			return valueExpr, nil
+		}
+		return g.emitContextValue(valueExpr), nil
 	case exprString:
 		return strconv.Quote(value.value), nil
 	case exprNumber:
@@ -1408,8 +2205,153 @@ func (g *generator) emitLiteralValue(value expr) (string, error) {
 	}
 }
 
+// emitContextValue emits the value of the untyped context value expr with env.Value, which
+// calls function-valued context values (see runtime.Value); their error fails the render at
+// the node. Typed contexts resolve function values in their accessors (runtime.ValueOf).
+func (g *generator) emitContextValue(expr string) string {
+	valueVar := g.nextTemp("v")
+	g.w.line("%s, err := env.Value(%s)", valueVar, expr)
+	g.w.line("if err != nil {")
+	g.w.indentInc()
+	g.emitReturnErr()
+	g.w.indentDec()
+	g.w.line("}")
+	return valueVar
+}
+
+// emitGuardValue emits the value of an {{#if}}/{{#unless}}/{{#with}} condition. In strict mode
+// a missing path is not an error there: it is false, so templates can test for optional data.
+func (g *generator) emitGuardValue(value expr) (string, error) {
+	if value.kind != exprPath {
+		return g.emitExprValue(value)
+	}
+	saved := g.guard
+	g.guard = true
+	defer func() { g.guard = saved }()
+	return g.emitExprValue(value)
+}
+
+// emitStrictCheck emits the Options.Strict / Options.AssumeObjects check for a path before its value is used.
+func (g *generator) emitStrictCheck(path string) {
+	if (!g.strict && !g.assumeObjects) || g.guard {
+		return
+	}
+	varName, rel, dataPath, ok := g.strictTarget(path)
+	if !ok || (!g.strict && !strings.Contains(rel, ".")) {
+		return
+	}
+	check := "runtime.CheckPath"
+	if !g.strict {
+		check = "runtime.CheckPathObjects"
+	}
+	g.w.line("if err := %s(%s, %q, runtime.PathPos{Template: %q, Line: %d, Column: %d, Path: %s}); err != nil {",
+		check, varName, rel, g.template, g.pos.Line, g.pos.Col, dataPath)
+	g.w.indentInc()
+	g.w.line("return err")
+	g.w.indentDec()
+	g.w.line("}")
+}
+
+// strictTarget returns the context variable a path is looked up in, the path relative to it and
+// a Go expression for the full data path. ok is false for @data variables and the context itself.
+// It follows the scope rules of resolvePath.
+func (g *generator) strictTarget(path string) (varName, rel, dataPath string, ok bool) {
+	path = strings.TrimSpace(path)
+	var scope typedScope
+	switch {
+	case path == "@root" || strings.HasPrefix(path, "@root."):
+		scope, rel = typedScope{varName: g.rootVar}, strings.TrimPrefix(strings.TrimPrefix(path, "@root"), ".")
+	case strings.HasPrefix(path, "@"):
+		return "", "", "", false
+	case path == ".." || strings.HasPrefix(path, "../"):
+		if scope, ok = g.parentContextScope(); !ok {
+			return "", "", "", false
+		}
+		rel = strings.TrimPrefix(strings.TrimPrefix(path, ".."), "/")
+	default:
+		found := false
+		for i := len(g.typedStack) - 1; i >= 0 && !found; i-- {
+			s := g.typedStack[i]
+			if s.pathPrefix == "" || s.varName == "" {
+				continue
+			}
+			if s.pathPrefix == path {
+				return "", "", "", false
+			}
+			if strings.HasPrefix(path, s.pathPrefix+".") && (s.node != nil || s.dynamic) {
+				scope, rel, found = s, path[len(s.pathPrefix)+1:], true
+			}
+		}
+		if !found {
+			if scope, ok = g.currentContextScope(); !ok {
+				return "", "", "", false
+			}
+			rel = path
+		}
+	}
+	if rel == "this" || rel == "." {
+		rel = ""
+	}
+	rel = strings.TrimPrefix(strings.TrimPrefix(rel, "this."), "./")
+	if rel == "" || scope.varName == "" || strings.HasPrefix(rel, "..") || strings.HasPrefix(rel, "@") {
+		return "", "", "", false
+	}
+	return scope.varName, rel, joinDataPath(scope.dataPath, rel), true
+}
+
+// dataPathOf returns the Go expression for the full data path of path in the current scope.
+func (g *generator) dataPathOf(path string) string {
+	if _, _, dataPath, ok := g.strictTarget(path); ok {
+		return dataPath
+	}
+	if scope, ok := g.currentContextScope(); ok && scope.dataPath != "" {
+		return scope.dataPath
+	}
+	return strconv.Quote(path)
+}
+
+// dataPathOfParent is dataPathOf for a block param bound below the current scope.
+func (g *generator) dataPathOfParent(path string) string {
+	top := g.typedStack[len(g.typedStack)-1]
+	g.typedStack = g.typedStack[:len(g.typedStack)-1]
+	defer func() { g.typedStack = append(g.typedStack, top) }()
+	return g.dataPathOf(path)
+}
+
+// joinDataPath returns the Go string expression for rel appended to the data path expression base.
+func joinDataPath(base, rel string) string {
+	switch {
+	case base == "" || base == `""`:
+		return strconv.Quote(rel)
+	case rel == "":
+		return base
+	}
+	if prefix, err := strconv.Unquote(base); err == nil {
+		return strconv.Quote(prefix + "." + rel)
+	}
+	return base + " + " + strconv.Quote("."+rel)
+}
+
+// joinDataPathKey returns the Go string expression for the loop key keyVar appended to base.
+func joinDataPathKey(base, keyVar string) string {
+	key := "runtime.Stringify(" + keyVar + ")"
+	if prefix, err := strconv.Unquote(base); err == nil {
+		if prefix == "" {
+			return key
+		}
+		return strconv.Quote(prefix+".") + " + " + key
+	}
+	return base + ` + "." + ` + key
+}
+
 func (g *generator) pushTypedScope(varName, pathPrefix string, node *typeNode) {
-	g.typedStack = append(g.typedStack, typedScope{varName: varName, pathPrefix: pathPrefix, node: node})
+	g.typedStack = append(g.typedStack, typedScope{varName: varName, pathPrefix: pathPrefix, node: node, dynamic: isDynamicNode(node)})
+}
+
+// isDynamicNode reports whether a scope with this type node holds an untyped (any) value,
+// whose paths are looked up at render time.
+func isDynamicNode(node *typeNode) bool {
+	return node == nil || (!node.isSlice && len(node.fields) == 0)
 }
 
 func (g *generator) popTypedScope() {
@@ -1426,42 +2368,73 @@ func (g *generator) currentTypedScope() (typedScope, bool) {
 }
 
 func (g *generator) emitPathValue(path string) string {
+	value, _ := g.resolvePath(path)
+	return value
+}
+
+// resolvePath returns the Go expression for a template path and, when the expression is a
+// typed context value, its type node (nil for untyped values).
+func (g *generator) resolvePath(path string) (string, *typeNode) {
 	path = strings.TrimSpace(path)
 	// @root: resolve from root context (root param; in entry template root == data).
 	if path == "@root" || strings.HasPrefix(path, "@root.") {
 		rest := strings.TrimPrefix(path, "@root")
 		rest = strings.TrimPrefix(rest, ".")
 		if rest == "" {
-			return g.rootVar
+			return g.rootVar, g.tree
 		}
 		// Typed access when root has same type as our tree (entry or same-template partial).
 		if g.tree != nil {
 			chain, ok := resolvePathToMethodChain(g.tree, "", rest, g.goName)
 			if ok {
 				if chain == "" {
-					return g.rootVar
+					return g.rootVar, g.tree
 				}
-				return g.rootVar + "." + chain
+				return g.rootVar + "." + chain, nodeAtPath(g.tree, rest)
 			}
 		}
 		// Partial with root from another template: runtime path lookup.
-		return "runtime.LookupPath(" + g.rootVar + ", " + strconv.Quote(rest) + ")"
-	}
-	// @index and @key: use the each loop's key variable (index for slice, key for map)
-	if path == "@index" || path == "@key" {
+		return "runtime.LookupPath(" + g.rootVar + ", " + strconv.Quote(rest) + ")", nil
+	}
+	// @index and @key: use the each loop's key variable (index for slice, key for map); @first
+	// and @last its position tests.
+	// Other @data variables come from the frame passed to a helper's block body, or else from
+	// the render's @data variables (runtime.Env.Data); "@site.title" looks up title in @site.
+	if strings.HasPrefix(path, "@") {
+		name, rest, _ := strings.Cut(path[1:], ".")
+		expr := "env.DataVar(" + strconv.Quote(name) + ")"
 		for i := len(g.typedStack) - 1; i >= 0; i-- {
-			if g.typedStack[i].eachKeyVar != "" {
-				return g.typedStack[i].eachKeyVar
+			s := g.typedStack[i]
+			if s.eachKeyVar != "" && rest == "" {
+				switch name {
+				case "index", "key":
+					return s.eachKeyVar, nil
+				case "first":
+					return s.eachFirst, nil
+				case "last":
+					return s.eachLast, nil
+				}
+			}
+			if s.frameVar != "" {
+				expr = s.frameVar + ".Get(" + strconv.Quote(name) + ")"
+				break
 			}
 		}
-		return "nil"
+		if rest != "" {
+			return "runtime.ResolvePath(" + expr + ", " + strconv.Quote(rest) + ")", nil
+		}
+		return expr, nil
 	}
 	// Parent scope: "../path" or "../" - resolve rest against a parent scope (try each ancestor until one resolves)
 	if path == ".." || strings.HasPrefix(path, "../") {
 		rest := strings.TrimPrefix(path, "..")
 		rest = strings.TrimPrefix(rest, "/")
 		if len(g.typedStack) < 2 {
-			return "nil"
+			return "nil", nil
+		}
+		// An untyped parent context (e.g. a loop item without inferred fields) is looked up directly.
+		if parent, ok := g.parentContextScope(); ok && parent.dynamic && parent.node == nil {
+			return dynamicLookup(parent.varName, rest), nil
 		}
 		for j := len(g.typedStack) - 2; j >= 0; j-- {
 			parent := g.typedStack[j]
@@ -1469,49 +2442,129 @@ func (g *generator) emitPathValue(path string) string {
 				continue
 			}
 			if rest == "" {
-				return parent.varName
+				return parent.varName, parent.node
 			}
 			chain, ok := resolvePathToMethodChain(parent.node, parent.pathPrefix, rest, g.goName)
 			if !ok {
 				continue
 			}
 			if chain == "" {
-				return parent.varName
+				return parent.varName, parent.node
 			}
-			return parent.varName + "." + chain
+			return parent.varName + "." + chain, chainNode(parent.node, parent.pathPrefix, rest)
 		}
-		return "nil"
+		// No typed ancestor has the path: look it up in the parent context when that is untyped.
+		if parent, ok := g.parentContextScope(); ok && parent.dynamic {
+			return dynamicLookup(parent.varName, rest), nil
+		}
+		return "nil", nil
 	}
 	// Resolve path: find scope where pathPrefix equals path or path starts with pathPrefix+"."
 	// (e.g. "person.name" resolves from scope pathPrefix "person", not from top scope "idx")
 	for i := len(g.typedStack) - 1; i >= 0; i-- {
 		s := g.typedStack[i]
 		if s.pathPrefix == path {
-			return s.varName
+			return s.varName, s.node
 		}
 		if s.pathPrefix != "" && strings.HasPrefix(path, s.pathPrefix+".") && s.node != nil {
 			chain, ok := resolvePathToMethodChain(s.node, s.pathPrefix, path, g.goName)
 			if !ok {
+				if s.dynamic {
+					return dynamicLookup(s.varName, path[len(s.pathPrefix)+1:]), nil
+				}
 				continue
 			}
 			if chain == "" {
-				return s.varName
+				return s.varName, s.node
 			}
-			return s.varName + "." + chain
+			return s.varName + "." + chain, chainNode(s.node, s.pathPrefix, path)
+		}
+		if s.pathPrefix != "" && strings.HasPrefix(path, s.pathPrefix+".") && s.dynamic {
+			return dynamicLookup(s.varName, path[len(s.pathPrefix)+1:]), nil
 		}
 	}
 	scope, ok := g.currentTypedScope()
-	if !ok || scope.node == nil {
-		return "nil"
-	}
-	chain, ok := resolvePathToMethodChain(scope.node, scope.pathPrefix, path, g.goName)
 	if !ok {
-		return "nil"
+		return "nil", nil
 	}
-	if chain == "" {
-		return scope.varName
+	if scope.paramOnly {
+		// Block param scope: try it as before, then the context it sits in.
+		if value, node, ok := resolveInScope(scope, path, g.goName, false); ok {
+			return value, node
+		}
+		scope, _ = g.currentContextScope()
 	}
-	return scope.varName + "." + chain
+	value, node, _ := resolveInScope(scope, path, g.goName, true)
+	return value, node
+}
+
+// resolveInScope resolves path against one scope: typed when the scope's type node has it,
+// otherwise (when allowed and the scope is untyped) by a runtime lookup.
+func resolveInScope(s typedScope, path, goName string, dynamic bool) (string, *typeNode, bool) {
+	if s.node != nil {
+		if chain, ok := resolvePathToMethodChain(s.node, s.pathPrefix, path, goName); ok {
+			if chain == "" {
+				return s.varName, s.node, true
+			}
+			return s.varName + "." + chain, chainNode(s.node, s.pathPrefix, path), true
+		}
+	}
+	if dynamic && s.dynamic && s.varName != "" {
+		return dynamicLookup(s.varName, path), nil, true
+	}
+	return "nil", nil, false
+}
+
+// currentContextScope returns the innermost scope that sets the context (not only a block param).
+func (g *generator) currentContextScope() (typedScope, bool) {
+	for i := len(g.typedStack) - 1; i >= 0; i-- {
+		if !g.typedStack[i].paramOnly {
+			return g.typedStack[i], true
+		}
+	}
+	return typedScope{}, false
+}
+
+// parentContextScope returns the scope of the context enclosing the current one,
+// skipping scopes that only bind block params.
+func (g *generator) parentContextScope() (typedScope, bool) {
+	seenCurrent := false
+	for i := len(g.typedStack) - 1; i >= 0; i-- {
+		s := g.typedStack[i]
+		if s.paramOnly {
+			continue
+		}
+		if seenCurrent {
+			return s, true
+		}
+		seenCurrent = true
+	}
+	return typedScope{}, false
+}
+
+// dynamicLookup returns the expression for path looked up at render time in the untyped value varName.
+func dynamicLookup(varName, path string) string {
+	if path == "this" || path == "." {
+		path = ""
+	}
+	path = strings.TrimPrefix(path, "this.")
+	path = strings.TrimPrefix(path, "./")
+	if path == "" {
+		return varName
+	}
+	return "runtime.LookupPath(" + varName + ", " + strconv.Quote(path) + ")"
+}
+
+// chainNode returns the type node that resolvePathToMethodChain reached for path.
+func chainNode(node *typeNode, pathPrefix, path string) *typeNode {
+	path = strings.TrimSpace(path)
+	if path == "" || path == "." || path == "this" || path == pathPrefix {
+		return node
+	}
+	if pathPrefix != "" && strings.HasPrefix(path, pathPrefix+".") {
+		path = path[len(pathPrefix)+1:]
+	}
+	return nodeAtPath(node, path)
 }
 
 func (g *generator) writeValue(fn string, expr string) {
@@ -1553,21 +2606,10 @@ func formatNumberLiteral(value string) (string, error) {
 	return "float64(" + literal + ")", nil
 }
 
-func isNumber(value string) bool {
-	if value == "" {
-		return false
-	}
-	_, err := strconv.ParseFloat(value, 64)
-	return err == nil
-}
-
-func isSpace(b byte) bool {
-	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
-}
-
 type codeWriter struct {
 	buf    bytes.Buffer
 	indent int
+	lines  int // lines written
 }
 
 func (w *codeWriter) indentInc() {
@@ -1583,6 +2625,7 @@ func (w *codeWriter) indentDec() {
 func (w *codeWriter) line(format string, args ...any) {
 	fmt.Fprintf(&w.buf, format, args...)
 	w.buf.WriteByte('\n')
+	w.lines++
 }
 
 func (w *codeWriter) String() string {
@@ -1,6 +1,7 @@
 package compiler
 
 import (
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -210,8 +211,10 @@ func TestCompileTemplates_DynamicPartial(t *testing.T) {
 	if !strings.Contains(src, "partials[") {
 		t.Fatalf("expected dynamic partial lookup")
 	}
-	if !strings.Contains(src, "MissingPartialOutput") {
-		t.Fatalf("expected MissingPartialOutput for dynamic partial when not found")
+	// Partials not in this package are looked up in the runtime registries, which write
+	// runtime.MissingPartialOutput when they do not have them either.
+	if !strings.Contains(src, "env.RenderPartial(w, partial") {
+		t.Fatalf("expected runtime registry lookup for dynamic partial when not found")
 	}
 }
 func TestCompileTemplates_UnknownBlock(t *testing.T) {
@@ -414,3 +417,508 @@ func grepOne(src, sub string) string {
 	return "(not found)"
 }
 
+
+func TestCompileTemplates_Strict(t *testing.T) {
+	tmpl := "{{#with user}}{{name}}{{/with}}\n{{#if user.email}}{{user.email}}{{/if}}{{#each posts as |p|}}{{p.title}}{{/each}}"
+	code, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", Strict: true})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		`runtime.CheckPath(ctx1, "name", runtime.PathPos{Template: "main", Line: 1, Column: 15, Path: "user.name"})`,
+		`runtime.CheckPath(data, "user.email", runtime.PathPos{Template: "main", Line: 2, Column: 19, Path: "user.email"})`,
+		`Path: "posts." + runtime.Stringify(key`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+	if strings.Count(src, `runtime.CheckPath(data, "user.email"`) != 1 {
+		t.Fatalf("{{#if user.email}} should not be checked:\n%s", src)
+	}
+
+	code, err = CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", AssumeObjects: true})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src = string(code)
+	if !strings.Contains(src, `runtime.CheckPathObjects(data, "user.email"`) || strings.Contains(src, `"name", runtime.PathPos`) {
+		t.Fatalf("assumeObjects should check only dotted paths:\n%s", src)
+	}
+
+	code, err = CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	if strings.Contains(string(code), "runtime.CheckPath") {
+		t.Fatalf("non-strict templates should not check paths:\n%s", code)
+	}
+}
+
+func TestCompileTemplates_MissingHelpers(t *testing.T) {
+	tmpl := `{{shout user.name}}{{#cms "banner" page=slug as |b|}}{{b}}{{title}}{{else}}{{fallback}}{{/cms}}{{upper (tr title)}}{{widget id=wid}}{{#section}}{{x}}{{/section}}`
+	helpers := map[string]HelperRef{"upper": {Ident: "Upper"}}
+	if _, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", Helpers: helpers}); err == nil || !strings.Contains(err.Error(), `helper "shout" is not defined`) {
+		t.Fatalf("default policy: err = %v", err)
+	}
+	if _, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", MissingHelpers: "later"}); err == nil {
+		t.Fatal("unknown policy should fail")
+	}
+	code, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", Helpers: helpers, MissingHelpers: MissingHelpersRuntime})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		`env.Helper("shout")(args`,
+		`env.BlockHelper("cms")(w, args`,
+		`env.Helper("tr")(args`,
+		`env.Helper("widget")(nil`,
+		`Upper(args`,
+		"Slug() any",
+		"Wid() any",
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+	// The body and {{else}} of {{#cms}} are rendered with the helper's context.
+	if strings.Contains(src, "Fallback()") {
+		t.Fatalf("{{else}} of a runtime block helper should use runtime lookups:\n%s", src)
+	}
+	// {{#section}} without arguments is still a section.
+	if strings.Contains(src, `env.BlockHelper("section")`) {
+		t.Fatalf("{{#section}} should stay a section:\n%s", src)
+	}
+}
+
+func TestCompileTemplates_ContextualEscape(t *testing.T) {
+	tmpl := `<a href="{{url}}?q={{q}}" title={{title}} onclick="go('{{q}}')" {{attr}}>{{name}}</a>` +
+		`<script>var x = {{data}}; /* {{note}} */</script><style>p { color: {{color}} }</style>` +
+		`<textarea>{{body}}</textarea>{{{raw}}}` +
+		`{{#each items}}<li class="{{this}}">{{/each}}{{#if ok}}<img src="{{src}}">{{else}}<br>{{/if}}`
+	code, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", Escape: EscapeContextual})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"runtime.WriteEscapedIn(w, runtime.HTMLURL|runtime.HTMLInAttr, v1)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLURLQuery|runtime.HTMLInAttr, v2)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLAttr|runtime.HTMLInAttr|runtime.HTMLUnquoted, v3)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLJSString|runtime.HTMLInAttr, v4)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLTag, v5)",
+		"runtime.WriteEscaped(w, v6)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLJS, v7)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLJSString, v8)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLCSS, v9)",
+		"runtime.WriteEscaped(w, v10)",
+		"runtime.WriteRaw(w, v11)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLAttr|runtime.HTMLInAttr, v19)",
+		"runtime.WriteEscapedIn(w, runtime.HTMLURL|runtime.HTMLInAttr, v27)",
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+
+	code, err = CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	if strings.Contains(string(code), "WriteEscapedIn") {
+		t.Fatalf("default escaping should not use WriteEscapedIn:\n%s", code)
+	}
+	if _, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", Escape: "x ml"}); err == nil || !strings.Contains(err.Error(), `invalid escape mode "x ml"`) {
+		t.Fatalf("invalid escape mode: err = %v", err)
+	}
+
+	for tmpl, want := range map[string]string{
+		"<script>var s = `hi {{x}}`;</script>":                       "runtime.HTMLJSString, v1)",
+		"<script>var s = `a${ {{x}} }b`;</script>":                   "runtime.HTMLJS, v1)",
+		"<script>var s = `a${ {a: 1}[{{x}}] }`;</script>":            "runtime.HTMLJS, v1)",
+		`<script>if (/"/.test(x)) { y = {{x}}; }</script>`:           "runtime.HTMLJS, v1)",
+		`<script>var r = /[/"]/g, s = "{{x}}";</script>`:             "runtime.HTMLJSString, v1)",
+		`<script>var a = b / 2, s = "{{x}}";</script>`:               "runtime.HTMLJSString, v1)",
+		`<script>return /"/, {{x}}</script>`:                         "runtime.HTMLJS, v1)",
+		`<script>var a = [{{#each xs}}{{this}}, {{/each}}]</script>`: "runtime.WriteEscapedIn(w, runtime.HTMLJS, v",
+		`<iframe srcdoc="{{x}}">`:                                    "runtime.HTMLAttr|runtime.HTMLInAttr, v1)",
+	} {
+		code, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", Escape: EscapeContextual})
+		if err != nil {
+			t.Errorf("%s: %v", tmpl, err)
+		} else if !strings.Contains(string(code), want) {
+			t.Errorf("%s: generated code lacks %q:\n%s", tmpl, want, code)
+		}
+	}
+
+	for tmpl, want := range map[string]string{
+		`{{#if x}}<a href="{{/if}}">`:                           `{{#if}} at 1:1: branches end in different HTML contexts`,
+		`<p>{{#each xs}}<i title="{{/each}}`:                    `{{#each}} at 1:4: body starts in text but ends in attribute value in <i>`,
+		`<script>var r = /a{{x}}/;</script>`:                    `{{x}} at 1:19 is in a JavaScript regular expression`,
+		`<script>x = {{#if a}}b{{else}}c +{{/if}} /2/</script>`: `text at 1:41: '/' could start a division or a regular expression`,
+		`<script>{{> widget}}</script>`:                         `{{> widget}} at 1:9 is in <script>; partials are compiled for element content`,
+		`<a title="{{> widget}}">`:                              `{{> widget}} at 1:11 is in attribute value in <a>`,
+	} {
+		_, err := CompileTemplates(map[string]string{"main": tmpl}, Options{PackageName: "templates", Escape: EscapeContextual})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", tmpl, err, want)
+		}
+	}
+}
+
+func TestCompileTemplates_OutputModes(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"mail.txt":  `Hi {{name}}`,
+		"readme.md": `# {{title}}`,
+		"page.html": `<p>{{name}}</p>`,
+		"export":    "{{!-- escape: csv --}}\n{{name}},{{title}}",
+		"run":       `echo {{name}}`,
+		"plain":     `{{name}}`,
+	}, Options{PackageName: "templates", Escape: EscapeText, TemplateEscape: map[string]string{"run": "shell", "readme.md": EscapeHTML}})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"func renderMailTxt(",
+		`runtime.WriteEscapedWith(w, "csv", v1)`,
+		`runtime.WriteEscapedWith(w, "shell", v1)`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+	// mail.txt by extension, plain by Options.Escape; page.html by extension, readme.md by
+	// TemplateEscape. Each template writes its first value as v1.
+	if n := strings.Count(src, "runtime.WriteRaw(w, v1)"); n != 2 {
+		t.Fatalf("want 2 raw writes, got %d:\n%s", n, src)
+	}
+	if n := strings.Count(src, "runtime.WriteEscaped(w, v1)"); n != 2 {
+		t.Fatalf("want 2 HTML-escaped writes, got %d:\n%s", n, src)
+	}
+
+	_, err = CompileTemplates(map[string]string{"main": "{{! escape: a b }}{{x}}"}, Options{PackageName: "templates"})
+	if err == nil || !strings.Contains(err.Error(), `template "main"`) {
+		t.Fatalf("invalid annotation: err = %v", err)
+	}
+}
+
+func TestCompileTemplates_StringifyJS(t *testing.T) {
+	templates := map[string]string{"main": `{{tags}}{{{html}}}<script>var t = {{tags}};</script>`}
+	code, err := CompileTemplates(templates, Options{PackageName: "templates", Stringify: StringifyJS, Escape: EscapeContextual})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"runtime.WriteEscaped(w, runtime.JSValue(",
+		"runtime.WriteRaw(w, runtime.JSValue(",
+		"runtime.WriteEscapedIn(w, runtime.HTMLJS, v3)",
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+	if strings.Contains(src, "runtime.WriteEscapedIn(w, runtime.HTMLJS, runtime.JSValue(") {
+		t.Fatalf("script values are JSON, not strings:\n%s", src)
+	}
+
+	code, err = CompileTemplates(templates, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	if strings.Contains(string(code), "runtime.JSValue(") {
+		t.Fatalf("default mode uses runtime.JSValue:\n%s", code)
+	}
+
+	_, err = CompileTemplates(templates, Options{PackageName: "templates", Stringify: "python"})
+	if err == nil || !strings.Contains(err.Error(), `unknown stringify mode "python"`) {
+		t.Fatalf("unknown mode: err = %v", err)
+	}
+}
+
+func TestCompileTemplates_BlockContexts(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"main": `{{#sortBy posts "year" as |post i|}}{{post.title}}{{i}}{{year}}{{/sortBy}}` +
+			`{{#repeat 2 as |n|}}{{name}}{{n}}{{/repeat}}` +
+			`{{#groupBy posts "year" as |items|}}{{key}}{{#each items as |p|}}{{p.author}}{{/each}}{{else}}{{empty}}{{/groupBy}}`,
+	}, Options{
+		PackageName: "templates",
+		Helpers: map[string]HelperRef{
+			"sortBy":  {Ident: "SortBy", Options: true, BlockContext: BlockContextItem},
+			"repeat":  {Ident: "Repeat", Options: true, BlockContext: BlockContextThis},
+			"groupBy": {Ident: "GroupBy", Options: true, BlockContext: BlockContextGroup},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"Posts() []MainPostsItemContext",
+		"Title() any",
+		"Year() any",
+		"Author() any",
+		"Name() any",
+		"Empty() any",
+		"runtime.ElementOf(blockCtx",
+		`return runtime.BlockContextError("sortBy"`,
+		".BlockParam(1))",
+		"data.Name()",
+		".BlockParams = 2",
+		`runtime.LookupPath(blockCtx`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+	if strings.Contains(src, "Key() any") || strings.Contains(src, "Items() any") {
+		t.Fatalf("group context fields should not be part of the context interface:\n%s", src)
+	}
+}
+
+func TestCompileTemplates_OptionsHelpers(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"main": "{{#each items}}{{#wrap}}{{@index}}{{label}}{{../title}}{{else}}-{{/wrap}}{{/each}}{{info title}}",
+	}, Options{
+		PackageName: "templates",
+		Helpers: map[string]HelperRef{
+			"wrap": {Ident: "Wrap", Options: true},
+			"info": {Ident: "Info", Options: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"Wrap(w, nil, options",
+		"Info(args",
+		`.Set("index", key`,
+		`.Get("index")`,
+		`runtime.LookupPath(blockCtx`,
+		`runtime.LookupPath(item2, "title")`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+	if strings.Contains(src, "Label()") {
+		t.Fatalf("paths in an options block body should not be part of the context interface:\n%s", src)
+	}
+}
+
+func TestCompileTemplates_LineDirectives(t *testing.T) {
+	tmpls := map[string]string{
+		"main": "<h1>{{title}}</h1>\n  {{> card user}}\n{{upper title}}",
+		"card": "{{name}}",
+	}
+	helpers := map[string]HelperRef{"upper": {ImportPath: "example.com/helpers", Ident: "Upper"}}
+	code, err := CompileTemplates(tmpls, Options{PackageName: "templates", Helpers: helpers,
+		SourceFiles: map[string]string{"main": "../views/main.hbs"}, OutputFile: "gen.go"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"//line ../views/main.hbs:1:5\n",
+		"//line ../views/main.hbs:2:3\n\tif err := partials[\"card\"]",
+		`return runtime.WrapError(err, "main", 2, 3)`,
+		"//line ../views/main.hbs:3:1\n\tresult",
+		`return runtime.WrapHelperError(err, "upper", "main", 3, 1)`,
+		`return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return renderMain(data, w, data, nil) }), "main", 0, 0)`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q", want)
+		}
+	}
+	restores := 0
+	for i, line := range strings.Split(src, "\n") {
+		if rest, ok := strings.CutPrefix(line, "//line gen.go:"); ok {
+			restores++
+			if want := strconv.Itoa(i + 2); rest != want {
+				t.Errorf("line %d: %q sets line %s, want %s", i+1, line, rest, want)
+			}
+		}
+	}
+	if restores != 1 || strings.Contains(src, "card.hbs") {
+		t.Errorf("want one directive back to gen.go and none for card, got:\n%s", src)
+	}
+
+	code, err = CompileTemplates(tmpls, Options{PackageName: "templates", Helpers: helpers})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	if strings.Contains(string(code), "//line") {
+		t.Error("//line directives without Options.SourceFiles")
+	}
+}
+
+func TestCompileTemplates_HelperErrors(t *testing.T) {
+	tmpls := map[string]string{"main": "{{upper title}}{{#each items}}{{lower this}}{{/each}}"}
+	helpers := map[string]HelperRef{
+		"upper": {ImportPath: "example.com/helpers", Ident: "Upper"},
+		"lower": {ImportPath: "example.com/helpers", Ident: "Lower"},
+	}
+	code, err := CompileTemplates(tmpls, Options{PackageName: "templates", Helpers: helpers, RecoverHelpers: true,
+		HelperErrors: HelperErrorsComment, HelperErrorPolicies: map[string]string{"lower": HelperErrorsFail}})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"runtime.RecoverHelperValue(func() (any, error) { return helpers.Upper(",
+		`if err := runtime.HandleHelperError(w, err, "comment", "upper", "main", 1, 1); err != nil {`,
+		"result3 = nil",
+		`return runtime.WrapHelperError(err, "lower", "main", 1, 31)`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+
+	code, err = CompileTemplates(tmpls, Options{PackageName: "templates", Helpers: helpers})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	if strings.Contains(string(code), "runtime.Recover") || strings.Contains(string(code), "HandleHelperError") {
+		t.Error("recovery or error policy code without RecoverHelpers and HelperErrors")
+	}
+
+	for _, opts := range []Options{
+		{PackageName: "templates", Helpers: helpers, HelperErrors: "ignore"},
+		{PackageName: "templates", Helpers: helpers, HelperErrorPolicies: map[string]string{"upper": "ignore"}},
+	} {
+		if _, err := CompileTemplates(tmpls, opts); err == nil || !strings.Contains(err.Error(), `unknown helper errors policy "ignore"`) {
+			t.Errorf("unknown policy: err = %v", err)
+		}
+	}
+}
+
+func TestCompileTemplates_Context(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"main": "{{#each items}}{{> row}}{{/each}}",
+		"row":  "{{fmt this}}",
+	}, Options{PackageName: "templates", Helpers: map[string]HelperRef{
+		"fmt": {ImportPath: "example.com/helpers", Ident: "Fmt", Options: true},
+	}})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"func RenderMainContext(ctx context.Context, w io.Writer, data MainContext) error {",
+		`return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return renderMain(data, w, data, &runtime.Env{Context: ctx}) }), "main", 0, 0)`,
+		"func RenderMainWithOptions(w io.Writer, data MainContext, opts runtime.RenderOptions) error {",
+		`return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return renderMain(data, env.Writer(w), data, env) }), "main", 0, 0)`,
+		"Ctx:      env.Ctx(),",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+	// Checked at the start of main and row, and in the body of the untyped each.
+	if n := strings.Count(src, "if err := env.EnterPartial(); err != nil {"); n != 2 {
+		t.Errorf("generated code has %d partial checks, want 2:\n%s", n, src)
+	}
+	if n := strings.Count(src, "if err := env.Iterate(); err != nil {\n\t\t\treturn runtime.WrapError(err, \"main\", 1, 1)"); n != 1 {
+		t.Errorf("generated code has %d iteration checks, want 1:\n%s", n, src)
+	}
+}
+
+func TestCompileTemplates_RecursivePartial(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"tree": "{{name}}{{#if child}}{{> tree child}}{{/if}}{{> self}}",
+		"self": "{{title}}{{> self}}",
+	}, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	if !strings.Contains(string(code), "func RenderSelfWithOptions(") {
+		t.Errorf("generated code lacks RenderSelfWithOptions:\n%s", code)
+	}
+}
+
+func TestCompileTemplates_DataVariables(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"main": "{{@site.title}}{{#with user}}{{name}}{{#if @user.admin}}!{{/if}}{{/with}}{{#each items}}{{@index}}{{@site.title}}{{/each}}{{> foot}}",
+		"foot": "{{@site.year}}{{#with @request}}{{path}}{{/with}}",
+	}, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"func RenderMainWithData(w io.Writer, data MainContext, vars map[string]any) error {",
+		`return runtime.WrapError(runtime.Buffered(w, func(w io.Writer) error { return renderMain(data, w, data, &runtime.Env{Data: vars}) }), "main", 0, 0)`,
+		`runtime.ResolvePath(env.DataVar("site"), "title")`,
+		`runtime.ResolvePath(env.DataVar("site"), "year")`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+	// @data variables are not context fields.
+	for _, unwanted := range []string{"Site()", "Request()", "Title()", "Path()"} {
+		if strings.Contains(src, unwanted) {
+			t.Errorf("generated code contains %q:\n%s", unwanted, src)
+		}
+	}
+}
+
+func TestCompileTemplates_FunctionValues(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"main": "{{title}}{{#each related}}{{title}}{{/each}}{{#with author}}{{name}}{{/with}}",
+	}, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"v1, err := env.Value(data.Title())\n\tif err != nil {\n\t\treturn runtime.WrapError(err, \"main\", 1, 1)",
+		"env.Value(data.Related())",
+		`env.Value(runtime.LookupPath(item3, "title"))`,
+		`m := runtime.MapOf(runtime.Field(d.m, "author"))`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestCompileTemplates_EachIterators(t *testing.T) {
+	code, err := CompileTemplates(map[string]string{
+		"main": "{{#each rows}}{{#if @first}}^{{/if}}{{#unless @last}},{{/unless}}{{else}}none{{/each}}",
+	}, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"body5 := func(key3, item2 any, first6, last7 bool) error {",
+		"env.Value(first6)",
+		"env.Value(last7)",
+		"if err := body5(pos16, el17, pos16 == 0, pos16 == len(sl15)-1); err != nil {",
+		"for each18 := range runtime.Each(items4) {",
+		"if err := body5(each18.Key, each18.Value, each18.First, each18.Last); err != nil {",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+	// The body is emitted once, whatever the collection turns out to be, so that nested loops
+	// do not multiply it.
+	if n := strings.Count(src, "env.Value(first6)"); n != 1 {
+		t.Errorf("the body is emitted %d times:\n%s", n, src)
+	}
+	nested := strings.Repeat("{{#each this}}", 6) + "{{this}}" + strings.Repeat("{{/each}}", 6)
+	code, err = CompileTemplates(map[string]string{"main": nested}, Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	if n := strings.Count(string(code), "env.Iterate()"); n != 6 {
+		t.Errorf("6 nested loops have %d iteration checks", n)
+	}
+}
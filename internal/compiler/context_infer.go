@@ -13,14 +13,26 @@ type pathScope struct {
 	params         map[string]string // block param name -> resolved path, e.g. "u" -> "user"
 	eachCollection string            // when inside {{#each col}}, this is "col"
 	eachParam      string            // when inside each, the first block param, e.g. "person"
+	dynamic        bool              // context set at render time by a helper (runtime.OptionsBlockHelper body)
+	element        bool              // the context is an element of eachCollection (iterating block helper body)
 }
 
 type pathCollector struct {
-	helpers    map[string]bool
-	paths      map[string]bool
-	eachFields map[string]map[string]bool // collection path -> set of element field names
-	scopeStack []pathScope
-	parsed     map[string][]ast.Node // template name -> AST; when set, collectPartial merges partial paths
+	helpers     map[string]bool
+	paths       map[string]bool
+	eachFields  map[string]map[string]bool // collection path -> set of element field names
+	collections map[string]bool            // paths iterated with {{#each}} (with or without element fields)
+	rootPaths   map[string]bool            // @root.xxx paths (kept out of the type tree, used by ScaffoldData)
+	scopeStack  []pathScope
+	parsed      map[string][]ast.Node // template name -> AST; when set, collectPartial merges partial paths
+	inPartials  map[string]bool       // partials being collected; a recursive partial ({{> self}}) is collected once
+	// blockContexts maps block helpers that render their body with a context of their choice
+	// (runtime.OptionsBlockHelper) to their HelperRef.BlockContext. Paths inside bodies with an
+	// unknown context are not part of the caller's context.
+	blockContexts map[string]string
+	// runtimeHelpers is set for MissingHelpersRuntime: calls of unknown helpers are helper calls
+	// (resolved at render time) and unknown blocks with arguments have helper-chosen bodies.
+	runtimeHelpers bool
 }
 
 func newPathCollector(helperNames map[string]string) *pathCollector {
@@ -29,10 +41,12 @@ func newPathCollector(helperNames map[string]string) *pathCollector {
 		helpers[name] = true
 	}
 	return &pathCollector{
-		helpers:    helpers,
-		paths:      make(map[string]bool),
-		eachFields: make(map[string]map[string]bool),
-		scopeStack: []pathScope{{}},
+		helpers:     helpers,
+		paths:       make(map[string]bool),
+		eachFields:  make(map[string]map[string]bool),
+		collections: make(map[string]bool),
+		rootPaths:   make(map[string]bool),
+		scopeStack:  []pathScope{{}},
 	}
 }
 
@@ -41,6 +55,91 @@ func (c *pathCollector) setParsed(parsed map[string][]ast.Node) {
 	c.parsed = parsed
 }
 
+// setBlockContexts sets the block helpers whose bodies get their context from the helper.
+func (c *pathCollector) setBlockContexts(blockContexts map[string]string) {
+	c.blockContexts = blockContexts
+}
+
+// pushBlockBody enters the body of a block helper from blockContexts and returns the function
+// that leaves it. The body's context follows the helper's BlockContext; the block params are
+// bound as that helper passes them (see helpers/handlebars iterating helpers).
+func (c *pathCollector) pushBlockBody(n *ast.Block, parts []expr) (pop func()) {
+	top := c.scopeStack[len(c.scopeStack)-1]
+	var collection string
+	if len(parts) > 0 && parts[0].kind == exprPath && !top.dynamic {
+		collection, _ = c.resolvePath(parts[0].value)
+	}
+	params := make(map[string]string, len(n.Params))
+	for _, p := range n.Params {
+		params[p] = "" // unknown unless bound below
+	}
+	frame := pathScope{dynamic: true, params: params}
+	switch c.blockContexts[n.Name] {
+	case BlockContextThis:
+		// Same context: bind the params in the current scope while the body is walked.
+		saved := top.params
+		merged := make(map[string]string, len(saved)+len(params))
+		for k, v := range saved {
+			merged[k] = v
+		}
+		for k, v := range params {
+			merged[k] = v
+		}
+		c.scopeStack[len(c.scopeStack)-1].params = merged
+		return func() { c.scopeStack[len(c.scopeStack)-1].params = saved }
+	case BlockContextItem:
+		if collection != "" {
+			c.addPath(collection, "")
+			c.collections[collection] = true
+			frame = pathScope{dataPath: top.dataPath, eachCollection: collection, element: true, params: params}
+			if len(n.Params) > 0 {
+				frame.eachParam = n.Params[0]
+				delete(params, n.Params[0])
+			}
+		}
+	case BlockContextGroup:
+		if collection != "" {
+			c.addPath(collection, "")
+			c.collections[collection] = true
+			params["items"] = collection
+			if len(n.Params) > 0 {
+				params[n.Params[0]] = collection
+			}
+		}
+	case BlockContextRow:
+		if collection != "" {
+			c.addPath(collection, "")
+			c.collections[collection] = true
+			params["this"] = collection
+			if len(n.Params) > 0 {
+				params[n.Params[0]] = collection
+			}
+		}
+	}
+	c.scopeStack = append(c.scopeStack, frame)
+	return c.pop
+}
+
+// blockElseDynamic reports whether the {{else}} section of a helper from blockContexts has an
+// unknown context. Helpers with a BlockContext render it with the caller's context.
+func (c *pathCollector) blockElseDynamic(name string) bool {
+	return c.blockContexts[name] == ""
+}
+
+// isHelperCall reports whether name heads a helper call with arguments.
+func (c *pathCollector) isHelperCall(name string) bool {
+	return c.helpers[name] || (c.runtimeHelpers && runtimeHelperName(name))
+}
+
+// hasBlockBody reports whether the body of block n gets its context from a helper: an Options
+// block helper, or a block left to the runtime registries (env.BlockHelper).
+func (c *pathCollector) hasBlockBody(n *ast.Block) bool {
+	if _, ok := c.blockContexts[n.Name]; ok {
+		return true
+	}
+	return c.runtimeHelpers && !c.helpers[n.Name] && !builtinBlockNames[n.Name] && runtimeHelperName(n.Name) && strings.TrimSpace(n.Args) != ""
+}
+
 func (c *pathCollector) pushWith(dataPath string, params []string) {
 	paramMap := make(map[string]string)
 	if len(params) > 0 {
@@ -49,6 +148,7 @@ func (c *pathCollector) pushWith(dataPath string, params []string) {
 	c.scopeStack = append(c.scopeStack, pathScope{
 		dataPath: dataPath,
 		params:   paramMap,
+		dynamic:  c.scopeStack[len(c.scopeStack)-1].dynamic,
 	})
 }
 
@@ -56,6 +156,7 @@ func (c *pathCollector) pushEach(collectionPath string, params []string) {
 	frame := pathScope{
 		dataPath:       c.scopeStack[len(c.scopeStack)-1].dataPath,
 		eachCollection: collectionPath,
+		dynamic:        c.scopeStack[len(c.scopeStack)-1].dynamic,
 	}
 	if len(params) > 0 {
 		frame.eachParam = params[0]
@@ -63,6 +164,18 @@ func (c *pathCollector) pushEach(collectionPath string, params []string) {
 	c.scopeStack = append(c.scopeStack, frame)
 }
 
+// markDataVariable makes the scope of a {{#with}} or {{#each}} over an @data variable (other
+// than @root) dynamic: the paths in its body are not context fields.
+func (c *pathCollector) markDataVariable(parts []expr) {
+	last := len(parts) - 1
+	if last < 0 || parts[last].kind != exprPath {
+		return
+	}
+	if v := parts[last].value; strings.HasPrefix(v, "@") && v != "@root" && !strings.HasPrefix(v, "@root.") {
+		c.scopeStack[len(c.scopeStack)-1].dynamic = true
+	}
+}
+
 func (c *pathCollector) pop() {
 	if len(c.scopeStack) > 1 {
 		c.scopeStack = c.scopeStack[:len(c.scopeStack)-1]
@@ -117,6 +230,10 @@ func (c *pathCollector) resolvePathAt(pathStr string, scopeIdx int) (fullPath st
 		}
 		return strings.Join(parts[1:], "."), ""
 	}
+	// Other @data variables (@index, @site.title) are not context fields.
+	if strings.HasPrefix(parts[0], "@") {
+		return "", ""
+	}
 	if parts[0] == ".." || strings.HasPrefix(pathStr, "../") {
 		if scopeIdx == 0 {
 			if len(parts) == 1 {
@@ -125,6 +242,9 @@ func (c *pathCollector) resolvePathAt(pathStr string, scopeIdx int) (fullPath st
 			return strings.Join(parts[1:], "."), ""
 		}
 		parent := c.scopeStack[scopeIdx-1]
+		if parent.dynamic {
+			return "", ""
+		}
 		if len(parts) == 1 {
 			return parent.dataPath, ""
 		}
@@ -152,9 +272,24 @@ func (c *pathCollector) resolvePathAt(pathStr string, scopeIdx int) (fullPath st
 			if len(parts) == 1 {
 				return base, ""
 			}
+			if base == "" {
+				return "", ""
+			}
 			return base + "." + strings.Join(parts[1:], "."), ""
 		}
 	}
+	if top.dynamic {
+		return "", ""
+	}
+	if top.element {
+		if parts[0] == "this" || parts[0] == "." {
+			parts = parts[1:]
+		}
+		if len(parts) == 0 {
+			return "", ""
+		}
+		return top.eachCollection, strings.Join(parts, ".")
+	}
 	if top.dataPath != "" {
 		return top.dataPath + "." + pathStr, ""
 	}
@@ -227,7 +362,7 @@ func (c *pathCollector) collectNode(node ast.Node) error {
 }
 
 func (c *pathCollector) collectMustache(n *ast.Mustache) error {
-	parts, _, err := parseParts(n.Expr)
+	parts, hash, err := parseParts(n.Expr)
 	if err != nil {
 		return err
 	}
@@ -235,27 +370,43 @@ func (c *pathCollector) collectMustache(n *ast.Mustache) error {
 		return nil
 	}
 	if len(parts) == 1 {
-		if parts[0].kind == exprPath && !c.helpers[parts[0].value] {
+		if parts[0].kind == exprPath && !c.helpers[parts[0].value] && !(len(hash) > 0 && c.isHelperCall(parts[0].value)) {
 			pathStr := parts[0].value
 			// Don't add @root paths to type tree so partial context interfaces don't require root-only methods
 			if strings.HasPrefix(pathStr, "@root") {
+				if rest := strings.TrimPrefix(pathStr, "@root."); rest != pathStr && rest != "" {
+					c.rootPaths[rest] = true
+				}
 				return nil
 			}
 			full, elem := c.resolvePath(pathStr)
 			c.addPath(full, elem)
+		} else {
+			c.addArgPaths(nil, hash)
 		}
 		return nil
 	}
-	if parts[0].kind != exprPath || !c.helpers[parts[0].value] {
+	if parts[0].kind != exprPath || !c.isHelperCall(parts[0].value) {
 		return nil
 	}
-	for _, p := range parts[1:] {
+	c.addArgPaths(parts[1:], hash)
+	return nil
+}
+
+// addArgPaths adds the paths used by helper arguments and hash values.
+func (c *pathCollector) addArgPaths(args []expr, hash []hashArg) {
+	for _, p := range args {
 		for _, pathStr := range pathsFromExpr(p) {
 			full, elem := c.resolvePath(pathStr)
 			c.addPath(full, elem)
 		}
 	}
-	return nil
+	for _, h := range hash {
+		for _, pathStr := range pathsFromExpr(h.value) {
+			full, elem := c.resolvePath(pathStr)
+			c.addPath(full, elem)
+		}
+	}
 }
 
 func (c *pathCollector) collectPartial(n *ast.Partial) error {
@@ -280,9 +431,15 @@ func (c *pathCollector) collectPartial(n *ast.Partial) error {
 		default:
 			partialName = ""
 		}
-		if partialName != "" {
+		if partialName != "" && !c.inPartials[partialName] {
 			if partialNodes, ok := c.parsed[partialName]; ok {
-				if err := c.collectNodes(partialNodes); err != nil {
+				if c.inPartials == nil {
+					c.inPartials = make(map[string]bool)
+				}
+				c.inPartials[partialName] = true
+				err := c.collectNodes(partialNodes)
+				delete(c.inPartials, partialName)
+				if err != nil {
 					return err
 				}
 			}
@@ -298,7 +455,7 @@ func (c *pathCollector) collectPartial(n *ast.Partial) error {
 }
 
 func (c *pathCollector) collectBlock(n *ast.Block) error {
-	parts, _, err := parseParts(n.Args)
+	parts, hash, err := parseParts(n.Args)
 	if err != nil {
 		return nil
 	}
@@ -323,6 +480,7 @@ func (c *pathCollector) collectBlock(n *ast.Block) error {
 			c.addPath(full, "")
 		}
 		c.pushWith(dataPath, n.Params)
+		c.markDataVariable(parts)
 		err := c.collectNodes(n.Body)
 		c.pop()
 		if err != nil {
@@ -345,7 +503,11 @@ func (c *pathCollector) collectBlock(n *ast.Block) error {
 			collectionPath = full
 			c.addPath(full, "")
 		}
+		if collectionPath != "" {
+			c.collections[collectionPath] = true
+		}
 		c.pushEach(collectionPath, n.Params)
+		c.markDataVariable(parts)
 		err := c.collectNodes(n.Body)
 		c.pop()
 		if err != nil {
@@ -361,13 +523,21 @@ func (c *pathCollector) collectBlock(n *ast.Block) error {
 			full, _ := c.resolvePath(parts[0].value)
 			c.addPath(full, "")
 		}
-		if c.helpers[n.Name] {
-			for _, p := range parts {
-				for _, pathStr := range pathsFromExpr(p) {
-					full, elem := c.resolvePath(pathStr)
-					c.addPath(full, elem)
-				}
+		if c.helpers[n.Name] || c.hasBlockBody(n) {
+			c.addArgPaths(parts, hash)
+		}
+		if c.hasBlockBody(n) {
+			pop := c.pushBlockBody(n, parts)
+			err := c.collectNodes(n.Body)
+			pop()
+			if err != nil {
+				return err
+			}
+			if c.blockElseDynamic(n.Name) {
+				c.scopeStack = append(c.scopeStack, pathScope{dynamic: true})
+				defer c.pop()
 			}
+			return c.collectNodes(n.Else)
 		}
 		if err := c.collectNodes(n.Body); err != nil {
 			return err
@@ -408,6 +578,9 @@ func (c *pathCollector) walkPartialsCollectNode(node ast.Node, goName string, ad
 			return nil // dynamic partial name, skip
 		}
 		sameScope := len(parts) == 1
+		if sameScope && c.scopeStack[len(c.scopeStack)-1].dynamic {
+			return nil // untyped context: called through the partials map
+		}
 		var paramType string
 		if sameScope {
 			paramType = c.currentScopeType(goName)
@@ -431,6 +604,7 @@ func (c *pathCollector) walkPartialsCollectNode(node ast.Node, goName string, ad
 				dataPath = full
 			}
 			c.pushWith(dataPath, n.Params)
+			c.markDataVariable(parts)
 			err := c.walkPartialsCollect(n.Body, goName, add)
 			c.pop()
 			if err != nil {
@@ -447,6 +621,7 @@ func (c *pathCollector) walkPartialsCollectNode(node ast.Node, goName string, ad
 				collectionPath = full
 			}
 			c.pushEach(collectionPath, n.Params)
+			c.markDataVariable(parts)
 			err := c.walkPartialsCollect(n.Body, goName, add)
 			c.pop()
 			if err != nil {
@@ -454,6 +629,19 @@ func (c *pathCollector) walkPartialsCollectNode(node ast.Node, goName string, ad
 			}
 			return c.walkPartialsCollect(n.Else, goName, add)
 		default:
+			if c.hasBlockBody(n) {
+				pop := c.pushBlockBody(n, parts)
+				err := c.walkPartialsCollect(n.Body, goName, add)
+				pop()
+				if err != nil {
+					return err
+				}
+				if c.blockElseDynamic(n.Name) {
+					c.scopeStack = append(c.scopeStack, pathScope{dynamic: true})
+					defer c.pop()
+				}
+				return c.walkPartialsCollect(n.Else, goName, add)
+			}
 			// if/unless/helper: recurse without changing scope
 			if err := c.walkPartialsCollect(n.Body, goName, add); err != nil {
 				return err
@@ -469,12 +657,16 @@ func (c *pathCollector) walkPartialsCollectNode(node ast.Node, goName string, ad
 // Only same-scope calls ({{> name}} with no expr) contribute: then we use the caller's type so partial and caller share one interface.
 // When a partial is called with explicit context (e.g. {{> orderRow order}}), we do not set result[partialName], so the partial keeps its own context interface (e.g. OrderRowContext) and is called with the row data explicitly.
 // Returns map[partialName]contextTypeName; empty string means use the partial's own context interface.
-func CollectPartialParamTypes(parsed map[string][]ast.Node, names []string, funcNames map[string]string, helperExprs map[string]string) map[string]string {
+// blockContexts are the block helpers that choose their body's context (see pathCollector.blockContexts);
+// runtimeHelpers is set for MissingHelpersRuntime.
+func CollectPartialParamTypes(parsed map[string][]ast.Node, names []string, funcNames map[string]string, helperExprs map[string]string, blockContexts map[string]string, runtimeHelpers bool) map[string]string {
 	typeSet := make(map[string]map[string]bool) // partialName -> set of param types (from same-scope calls only)
 	for _, name := range names {
 		goName := funcNames[name]
 		col := newPathCollector(helperExprs)
 		col.setParsed(parsed)
+		col.setBlockContexts(blockContexts)
+		col.runtimeHelpers = runtimeHelpers
 		add := func(partialName, paramType string, sameScope bool) {
 			if !sameScope {
 				return // explicit context: partial keeps its own interface (e.g. OrderRowContext)
@@ -718,6 +910,28 @@ func resolvePathToMethodChain(node *typeNode, pathPrefix, path, goIdent string)
 	return strings.Join(chain, "."), true
 }
 
+// collectionPath returns the path of the collection node target below n, as the context data
+// types name its elements (see emitContextDataMethods), and false when target is not in n.
+func collectionPath(n *typeNode, pathPrefix string, target *typeNode) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	for field, child := range n.fields {
+		path := pathPrefix + field
+		if child == target {
+			return path, true
+		}
+		next := child
+		if child.isSlice && child.sliceElem != nil {
+			next = child.sliceElem
+		}
+		if p, ok := collectionPath(next, path+".", target); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
 // nodeAtPath returns the type node at the given path from root, or nil.
 func nodeAtPath(root *typeNode, path string) *typeNode {
 	path = strings.TrimSpace(path)
@@ -979,14 +1193,12 @@ func emitContextDataMethods(w *codeWriter, templateName, goIdent, pathPrefix str
 			elemDataName := contextDataStructName(elemName)
 			w.line("func (d %s) %s() []%s {", dataName, methodName, elemName)
 			w.indentInc()
-			w.line("v := d.m[%q]", mapKey)
-			w.line("if v == nil { return nil }")
-			w.line("s, ok := v.([]any)")
-			w.line("if !ok { return nil }")
+			w.line("s := runtime.SliceOf(runtime.Field(d.m, %q))", mapKey)
+			w.line("if s == nil { return nil }")
 			w.line("out := make([]%s, len(s))", elemName)
 			w.line("for i := range s {")
 			w.indentInc()
-			w.line("if m, ok := s[i].(map[string]any); ok {")
+			w.line("if m := runtime.MapOf(s[i]); m != nil {")
 			w.indentInc()
 			w.line("out[i] = %s{m}", elemDataName)
 			w.indentDec()
@@ -1003,16 +1215,14 @@ func emitContextDataMethods(w *codeWriter, templateName, goIdent, pathPrefix str
 			nestedDataName := contextDataStructName(ifaceName)
 			w.line("func (d %s) %s() %s {", dataName, methodName, ifaceName)
 			w.indentInc()
-			w.line("v := d.m[%q]", mapKey)
-			w.line("if v == nil { return %s{map[string]any{}} }", nestedDataName)
-			w.line("m, ok := v.(map[string]any)")
-			w.line("if !ok { return %s{map[string]any{}} }", nestedDataName)
+			w.line("m := runtime.MapOf(runtime.Field(d.m, %q))", mapKey)
+			w.line("if m == nil { return %s{map[string]any{}} }", nestedDataName)
 			w.line("return %s{m}", nestedDataName)
 			w.indentDec()
 			w.line("}")
 			continue
 		}
-		w.line("func (d %s) %s() any { return d.m[%q] }", dataName, methodName, mapKey)
+		w.line("func (d %s) %s() any { return runtime.Field(d.m, %q) }", dataName, methodName, mapKey)
 	}
 }
 
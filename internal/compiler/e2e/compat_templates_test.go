@@ -48,7 +48,7 @@ func loadCompatTemplates(t *testing.T) (map[string]string, compiler.Options) {
 }
 
 // TestE2E_Compat_IteratorGenerated compiles compat and checks that {{#each users}} produces
-// correct iterator code (Users() and len/range). Use to debug iterator issues.
+// correct iterator code (Users() and runtime.Elements/range). Use to debug iterator issues.
 func TestE2E_Compat_IteratorGenerated(t *testing.T) {
 	tmpls, opts := loadCompatTemplates(t)
 	code, err := compiler.CompileTemplates(tmpls, opts)
@@ -60,8 +60,8 @@ func TestE2E_Compat_IteratorGenerated(t *testing.T) {
 	if !strings.Contains(src, "func (d MainContextData) Users()") {
 		t.Errorf("generated code should have MainContextData.Users(); snippet:\n%s", grepSnippet(src, "MainContextData", "Users", "func"))
 	}
-	if !strings.Contains(src, "if len(") {
-		t.Errorf("generated code should have if len(...) for each; snippet:\n%s", grepSnippet(src, "len(", "range", "if"))
+	if !strings.Contains(src, `runtime.Elements(env, col`) {
+		t.Errorf("generated code should iterate users with runtime.Elements; snippet:\n%s", grepSnippet(src, "Elements(", "range", "Users"))
 	}
 	if !strings.Contains(src, "range ") {
 		t.Errorf("generated code should have range for each block")
@@ -0,0 +1,115 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_RenderContext renders generated code with RenderMainContext: an options helper reads a
+// request-scoped value from HelperOptions.Ctx, and cancelling the context stops the {{#each}}
+// at the next iteration with a *runtime.RenderError caused by context.Canceled.
+func TestE2E_RenderContext(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-render-context\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("helpers/helpers.go", `package helpers
+
+import "github.com/andriyg76/go-hbars/runtime"
+
+type LocaleKey struct{}
+
+// Cancel is set by main; Stop calls it when it renders "stop".
+var Cancel func()
+
+func Locale(args []any, options *runtime.HelperOptions) (any, error) {
+	return options.Ctx.Value(LocaleKey{}), nil
+}
+
+func Stop(args []any, options *runtime.HelperOptions) (any, error) {
+	if args[0] == "stop" {
+		Cancel()
+	}
+	return args[0], nil
+}
+`)
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	"test-render-context/helpers"
+	templates "test-render-context/templates"
+)
+
+func main() {
+	data := templates.MainContextFromMap(map[string]any{"items": []any{"a", "stop", "b"}})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), helpers.LocaleKey{}, "uk"))
+	helpers.Cancel = cancel
+	var b strings.Builder
+	err := templates.RenderMainContext(ctx, &b, data)
+	var renderErr *runtime.RenderError
+	fmt.Printf("cancelled: %q %v %v %v\n", b.String(), errors.Is(err, context.Canceled), errors.As(err, &renderErr), err)
+	out, err := templates.RenderMainString(data)
+	fmt.Printf("background: %q %v\n", out, err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": "{{locale}}:{{#each items}}[{{stop this}}]{{/each}}",
+	}, compiler.Options{
+		PackageName: "templates",
+		Helpers: map[string]compiler.HelperRef{
+			"locale": {ImportPath: "test-render-context/helpers", Ident: "Locale", Options: true},
+			"stop":   {ImportPath: "test-render-context/helpers", Ident: "Stop", Options: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`cancelled: "uk:[a][stop]" true true template "main" line 1:12: context canceled`,
+		`background: ":[a][stop][b]" <nil>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_RenderWithData renders generated code with @data variables of the render
+// (RenderXxxWithData and RenderOptions.Data): they are seen in loops, blocks and partials.
+func TestE2E_RenderWithData(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-render-data\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-render-data/templates"
+)
+
+type user struct{ Name string }
+
+func main() {
+	vars := map[string]any{
+		"site":    map[string]any{"title": "Blog"},
+		"request": map[string]any{"path": "/posts"},
+		"user":    user{Name: "ann"},
+	}
+	data := templates.MainContextFromMap(map[string]any{"title": "Post", "tags": []any{"a", "b"}})
+	var b strings.Builder
+	err := templates.RenderMainWithData(&b, data, vars)
+	fmt.Printf("data %q %v\n", b.String(), err)
+	b.Reset()
+	err = templates.RenderMainWithOptions(&b, data, runtime.RenderOptions{Data: vars})
+	fmt.Printf("options %q %v\n", b.String(), err)
+	out, err := templates.RenderMainString(data)
+	fmt.Printf("none %q %v\n", out, err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": "{{title}} - {{@site.title}}{{#each tags}} {{@index}}{{this}}{{@site.title}}{{/each}}{{#if @user}} {{@user.Name}}{{/if}}{{> foot}}",
+		"foot": "{{#with @request}} [{{path}}]{{/with}}",
+	}, compiler.Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`data "Post - Blog 0aBlog 1bBlog ann [/posts]" <nil>`,
+		`options "Post - Blog 0aBlog 1bBlog ann [/posts]" <nil>`,
+		`none "Post -  0a 1b" <nil>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
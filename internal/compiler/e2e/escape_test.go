@@ -0,0 +1,102 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_ContextualEscape renders a template compiled with Options.Escape = EscapeContextual
+// and checks that each value is escaped for its place in the HTML.
+func TestE2E_ContextualEscape(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-escape\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	"test-escape/templates"
+)
+
+func main() {
+	data := map[string]any{
+		"links": []any{
+			map[string]any{"url": "javascript:alert(1)", "q": "a&b c", "label": "<b>x</b>"},
+			map[string]any{"url": "/search", "q": "go", "label": "Go"},
+			map[string]any{"url": runtime.SafeURL("javascript:void(0)"), "q": "", "label": runtime.SafeString("<i>ok</i>")},
+		},
+		"cls":   "a b",
+		"user":  map[string]any{"id": 7, "name": "Ann"},
+		"color": "red;background:url(x)",
+		"init":  runtime.SafeJS("start()"),
+		"name":  "${alert(document.cookie)}",
+		"code":  "alert(1)",
+	}
+	out, err := templates.RenderMainString(templates.MainContextFromMap(data))
+	fmt.Println(out)
+	fmt.Println("err:", err)
+}
+`)
+
+	tmpl := map[string]string{
+		"main": `{{#each links}}<a href="{{url}}?q={{q}}">{{label}}</a>
+{{/each}}<script>var user = {{user}}; {{init}};</script>
+<p class={{cls}} style="color: {{color}}">{{user.name}}</p>
+<script>var s = ` + "`hi {{name}}`, t = `${ {{code}} }`" + `;</script>
+<script>if (/"/.test(x)) { y = {{code}}; }</script>`,
+	}
+	code, err := compiler.CompileTemplates(tmpl, compiler.Options{PackageName: "templates", Escape: compiler.EscapeContextual})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, output)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`<a href="#ZgotmplZ?q=a%26b%20c">&lt;b&gt;x&lt;/b&gt;</a>`,
+		`<a href="/search?q=go">Go</a>`,
+		`<a href="javascript:void%280%29?q="><i>ok</i></a>`,
+		`<script>var user = {"id":7,"name":"Ann"}; start();</script>`,
+		`<p class=a&#32;b style="color: ZgotmplZ">Ann</p>`,
+		"<script>var s = `hi \\u0024\\u007Balert(document.cookie)\\u007D`, t = `${ \"alert(1)\" }`;</script>",
+		`<script>if (/"/.test(x)) { y = "alert(1)"; }</script>`,
+		"err: <nil>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+}
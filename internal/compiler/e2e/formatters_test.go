@@ -0,0 +1,93 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_Formatters renders generated code with values of types that have a formatter
+// (runtime.RegisterFormatter) or implement runtime.TemplateValue.
+func TestE2E_Formatters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-formatters\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-formatters/templates"
+)
+
+type Money int64
+
+type Badge int
+
+func (b Badge) TemplateHTML() string   { return fmt.Sprintf("<span class=\"badge\">%d</span>", b) }
+func (b Badge) TemplateString() string { return fmt.Sprint(int(b)) }
+func (b Badge) TemplateTruthy() bool   { return b > 0 }
+
+func init() {
+	runtime.RegisterFormatterFor(func(t time.Time) string { return t.Format(time.DateOnly) })
+	runtime.RegisterFormatterFor(func(m Money) string { return fmt.Sprintf("%d.%02d <EUR>", m/100, m%100) })
+}
+
+func main() {
+	for _, unread := range []Badge{3, 0} {
+		out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+			"date":   time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC),
+			"price":  Money(1999),
+			"unread": unread,
+		}))
+		fmt.Printf("main %q %v\n", out, err)
+	}
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{date}} {{price}} {{{price}}}|{{#if unread}}{{unread}} {{{unread}}}{{else}}none{{/if}}`,
+	}, compiler.Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	want := `main "2026-05-04 19.99 &lt;EUR&gt; 19.99 <EUR>|<span class=\"badge\">3</span> 3" <nil>
+main "2026-05-04 19.99 &lt;EUR&gt; 19.99 <EUR>|none" <nil>`
+	if got := strings.TrimSpace(string(output)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
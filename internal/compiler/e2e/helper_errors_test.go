@@ -0,0 +1,118 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_HelperErrors compiles with RecoverHelpers and helper error policies: a panicking
+// helper under the comment policy renders an HTML comment, the same helper under the fail
+// policy fails the render with a positioned *runtime.RenderError caused by a *runtime.PanicError,
+// whose stack has each call of a recursive partial.
+func TestE2E_HelperErrors(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-helper-errors\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("helpers/helpers.go", `package helpers
+
+import "errors"
+
+// Check fails for "bad" and panics for "panic", as a Lookup on a nil map would.
+func Check(args []any) (any, error) {
+	switch args[0] {
+	case "bad":
+		return nil, errors.New("bad name")
+	case "panic":
+		var m map[string]int
+		m["x"]++
+	}
+	return "ok", nil
+}
+`)
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-helper-errors/templates"
+)
+
+func main() {
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{"a": "bad", "b": "panic", "c": "fine"}))
+	fmt.Printf("comment: %s %v\n", out, err)
+	_, err = templates.RenderMainString(templates.MainContextFromMap(map[string]any{"a": "ok", "b": "ok", "c": "panic"}))
+	var renderErr *runtime.RenderError
+	var panicErr *runtime.PanicError
+	fmt.Printf("fail: %v\n", err)
+	if errors.As(err, &renderErr) && errors.As(err, &panicErr) {
+		fmt.Printf("helper: %s at %v, stack: %v\n", renderErr.Helper, renderErr.Location(), len(panicErr.Stack) > 0)
+	}
+	_, err = templates.RenderTreeString(templates.TreeContextFromMap(map[string]any{"child": map[string]any{"child": map[string]any{"name": "panic"}}}))
+	fmt.Printf("tree: %v\n", err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": "<p>{{check a}}</p><p>{{check b}}</p>\n{{mustCheck c}}",
+		"tree": "{{#if child}}\n  {{> tree child}}{{else}}{{mustCheck name}}{{/if}}",
+	}, compiler.Options{
+		PackageName: "templates",
+		Helpers: map[string]compiler.HelperRef{
+			"check":     {ImportPath: "test-helper-errors/helpers", Ident: "Check"},
+			"mustCheck": {ImportPath: "test-helper-errors/helpers", Ident: "Check"},
+		},
+		RecoverHelpers:      true,
+		HelperErrors:        compiler.HelperErrorsComment,
+		HelperErrorPolicies: map[string]string{"mustCheck": compiler.HelperErrorsFail},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`comment: <p><!-- helper "check": template "main" line 1:4: bad name --></p>` +
+			`<p><!-- helper "check": template "main" line 1:22: panic: assignment to entry in nil map --></p>` + "\nok <nil>",
+		`fail: template "main" line 2:1: panic: assignment to entry in nil map`,
+		"helper: mustCheck at {main 2 1}, stack: true",
+		`tree: template "tree" line 2:3: template "tree" line 2:3: template "tree" line 2:27: panic: assignment to entry in nil map`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package e2e
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/helpers/handlebars"
+	"github.com/andriyg76/go-hbars/internal/compiler"
+	"github.com/andriyg76/go-hbars/pkg/interpreter"
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+// interpreterFeatureTemplates are rendered by both the generated code and the interpreter,
+// next to the examples/compat templates, with examples/compat/data.json.
+var interpreterFeatureTemplates = map[string]string{
+	"features": `{{#each users}}{{@index}}:{{name}}{{#if active}}+{{else}}-{{/if}} {{/each}}
+{{#repeat 2 as |i|}}[{{i}}]{{/repeat}}
+{{#if 0 includeZero=true}}zero{{/if}}{{#unless user.nickname}}no nick{{/unless}}
+{{#user}}{{name}}{{/user}} {{#nothing}}x{{else}}no section{{/nothing}}
+{{join (split "a,b" ",") "-"}} {{default missing value=(upper "dflt")}}
+{{#with user as |u|}}{{@root.title}} {{u.name}} {{role}}{{/with}}
+{{#each settings as |v k|}}
+  {{k}}={{v}}
+{{/each}}
+{{> userCard user role="guest"}}`,
+	"page":   `{{#partial "content"}}<p>{{title}}</p>{{/partial}}{{> layout}}`,
+	"layout": `<main>{{#block "content"}}default{{/block}}</main><aside>{{#block "aside"}}aside{{/block}}</aside>`,
+}
+
+// TestE2E_InterpreterMatchesCompiled renders examples/compat (and a few more templates) with
+// the generated code, with pkg/interpreter and with the bytecode VM (hbc -format=bytecode)
+// and checks that the outputs are the same.
+func TestE2E_InterpreterMatchesCompiled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpls, opts := loadCompatTemplates(t)
+	for name, src := range interpreterFeatureTemplates {
+		tmpls[name] = src
+	}
+	repeat := opts.Helpers["repeat"]
+	repeat.Options, repeat.BlockContext = true, compiler.BlockContextThis
+	opts.Helpers["repeat"] = repeat
+	root := repoRoot(t)
+	dataBytes, err := os.ReadFile(filepath.Join(root, "examples", "compat", "data.json"))
+	if err != nil {
+		t.Fatalf("read data.json: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	code, err := compiler.CompileTemplates(tmpls, opts)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("go.mod", "module test-interpreter\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/templates_gen.go", string(code))
+	writeFile("data.json", string(dataBytes))
+	writeFile("main.go", `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	"test-interpreter/templates"
+)
+
+func main() {
+	raw, err := os.ReadFile("data.json")
+	if err != nil {
+		panic(err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		panic(err)
+	}
+	type output struct {
+		name, out string
+		err       error
+	}
+	var page strings.Builder
+	err = templates.RenderPageWithBlocks(&page, templates.PageContextFromMap(data), runtime.NewBlocks())
+	outputs := []output{{"page", page.String(), err}}
+	out, err := templates.RenderMainString(templates.MainContextFromMap(data))
+	outputs = append(outputs, output{"main", out, err})
+	out, err = templates.RenderFeaturesString(templates.FeaturesContextFromMap(data))
+	outputs = append(outputs, output{"features", out, err})
+	for _, o := range outputs {
+		if o.err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", o.name, o.err)
+			os.Exit(1)
+		}
+		fmt.Printf("=== %s\n%s\n", o.name, o.out)
+	}
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, output)
+	}
+	compiled := splitSections(string(output))
+
+	set := interpreter.New(interpreter.Options{})
+	for name, src := range tmpls {
+		if err := set.Add(name, src); err != nil {
+			t.Fatalf("interpreter: %v", err)
+		}
+	}
+	program, err := compiler.CompileBytecode(tmpls, opts)
+	if err != nil {
+		t.Fatalf("compile bytecode: %v", err)
+	}
+	vm, err := runtime.LoadVM(program, runtime.VMOptions{Helpers: handlebars.Helpers()})
+	if err != nil {
+		t.Fatalf("load bytecode: %v", err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(dataBytes, &data); err != nil {
+		t.Fatalf("parse data.json: %v", err)
+	}
+	renderers := []struct {
+		name   string
+		render func(name string, w io.Writer, data any, blocks *runtime.Blocks) error
+	}{
+		{"interpreter", set.RenderWithBlocks},
+		{"vm", vm.RenderWithBlocks},
+	}
+	for _, r := range renderers {
+		for _, name := range []string{"page", "main", "features"} {
+			var b strings.Builder
+			if err := r.render(name, &b, data, runtime.NewBlocks()); err != nil {
+				t.Fatalf("%s: render %s: %v", r.name, name, err)
+			}
+			want, ok := compiled[name]
+			if !ok {
+				t.Fatalf("no compiled output for %s:\n%s", name, output)
+			}
+			if got := b.String(); got != want {
+				t.Errorf("%s: %s output differs from compiled output\n%s:\n%s\ncompiled:\n%s", name, r.name, r.name, got, want)
+			}
+		}
+	}
+}
+
+// splitSections splits "=== name" separated program output into sections by name.
+func splitSections(s string) map[string]string {
+	sections := make(map[string]string)
+	for _, part := range strings.Split(s, "=== ")[1:] {
+		name, body, _ := strings.Cut(part, "\n")
+		sections[name] = strings.TrimSuffix(body, "\n")
+	}
+	return sections
+}
@@ -0,0 +1,101 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/helpers"
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_IterateHelpers runs the iterating block helpers from the core registry: typed
+// element bodies (sortBy, filterBy), the caller's context (repeat), untyped bodies (range,
+// groupBy, chunk), block params, @index/@last and {{else}}.
+func TestE2E_IterateHelpers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-iterate\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"os"
+
+	templates "test-iterate/templates"
+)
+
+func main() {
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"title": "Doc",
+		"posts": []any{
+			map[string]any{"title": "a", "year": 2023.0},
+			map[string]any{"title": "b", "year": 2024.0, "draft": true},
+			map[string]any{"title": "c", "year": 2023.0},
+		},
+	}))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(out)
+}
+`)
+	refs := make(map[string]compiler.HelperRef)
+	for name, ref := range helpers.Registry() {
+		refs[name] = compiler.HelperRef{ImportPath: ref.ImportPath, Ident: ref.Ident, Options: ref.Options, BlockContext: ref.BlockContext}
+	}
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{#repeat 2 as |i|}}{{title}}{{i}}{{#if @last}}.{{/if}}{{/repeat}}|` +
+			`{{#range 1 7 2 as |n i|}}{{n}}@{{i}}{{#unless @last}},{{/unless}}{{/range}}|` +
+			`{{#sortBy posts "year" desc=true as |post i|}}{{i}}:{{post.title}}({{year}}){{/sortBy}}|` +
+			`{{#filterBy posts "draft" as |post|}}{{post.title}}{{/filterBy}}|` +
+			`{{#filterBy posts "year" 2025}}{{title}}{{else}}none in {{title}}{{/filterBy}}|` +
+			`{{#groupBy posts "year" as |items year|}}{{year}}={{#each items as |p|}}{{p.title}}{{/each}};{{/groupBy}}|` +
+			`{{#chunk posts 2 as |row|}}[{{#each row as |p|}}{{p.title}}{{/each}}]{{/chunk}}|` +
+			`{{#sortBy posts "title"}}{{> chip}}{{/sortBy}}`,
+		"chip": `<{{title}}>`,
+	}, compiler.Options{PackageName: "templates", Helpers: refs})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if !strings.Contains(string(code), "runtime.ElementOf(") {
+		t.Errorf("sortBy body is not typed:\n%s", code)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+	// Tidy after generating: the generated code imports the helpers package.
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	want := "Doc0Doc1.|1@0,3@1,5@2|0:b(2024)1:a(2023)2:c(2023)|b|none in Doc|" +
+		"2023=ac;2024=b;|[ab][c]|<a><b><c>"
+	if got := strings.TrimSpace(string(output)); got != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
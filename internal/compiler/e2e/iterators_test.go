@@ -0,0 +1,107 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_EachIterators renders generated code with {{#each}} over iter.Seq, iter.Seq2,
+// channels and runtime.Iterable values: @index, @key, @first, @last and block params are set
+// as for slices, and {{else}} renders for an empty sequence.
+func TestE2E_EachIterators(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-each-iterators\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-each-iterators/templates"
+)
+
+type Row struct {
+	Name string `+"`json:\"name\"`"+`
+}
+
+type words []string
+
+func (w words) All() iter.Seq2[any, any] {
+	return func(yield func(any, any) bool) {
+		for i, s := range w {
+			if !yield(i, s) {
+				return
+			}
+		}
+	}
+}
+
+var _ runtime.Iterable = words(nil)
+
+func main() {
+	lines := make(chan string, 2)
+	lines <- "x"
+	lines <- "y"
+	close(lines)
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"rows":  slices.Values([]Row{{"ann"}, {"bob"}}),
+		"pairs": maps.All(map[string]int{"k": 1}),
+		"lines": (<-chan string)(lines),
+		"words": words{"a", "b"},
+		"none":  slices.Values([]int{}),
+	}))
+	fmt.Printf("main %q %v\n", out, err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{#each rows}}{{@index}}:{{name}}{{#unless @last}},{{/unless}}{{/each}}|` +
+			`{{#each pairs as |v k|}}{{k}}={{v}}{{#if @first}}!{{/if}}{{/each}}|` +
+			`{{#each lines}}{{#if @first}}[{{/if}}{{this}}{{#if @last}}]{{/if}}{{/each}}|` +
+			`{{#each words}}{{@key}}{{this}}{{/each}}|` +
+			`{{#each none}}x{{else}}empty{{/each}}`,
+	}, compiler.Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	if got, want := string(output), `main "0:ann,1:bob|k=1!|[xy]|0a1b|empty" <nil>`; !strings.Contains(got, want) {
+		t.Errorf("output does not contain %q:\n%s", want, got)
+	}
+}
@@ -0,0 +1,117 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/helpers"
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_RenderLimits renders generated code with RenderXxxWithOptions: a recursive partial,
+// nested loops, a block helper that repeats its body, a typed {{#each}} over an unbounded
+// iter.Seq and a big output each fail with a *runtime.LimitError, and render to the end
+// without limits.
+func TestE2E_RenderLimits(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-render-limits\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-render-limits/templates"
+)
+
+func main() {
+	for _, l := range []runtime.Limits{{MaxPartialDepth: 3}, {MaxOutputBytes: 5}} {
+		var b strings.Builder
+		err := templates.RenderSelfWithOptions(&b, templates.SelfContextFromMap(map[string]any{"n": 2}), runtime.RenderOptions{Limits: l})
+		var limitErr *runtime.LimitError
+		fmt.Printf("self %q %v %v\n", b.String(), errors.As(err, &limitErr), err)
+	}
+	var b strings.Builder
+	err := templates.RenderLoopWithOptions(&b, templates.LoopContextFromMap(map[string]any{"items": []any{1, 2, 3}}), runtime.RenderOptions{Limits: runtime.Limits{MaxIterations: 5}})
+	fmt.Printf("loop %q %v\n", b.String(), err)
+	b.Reset()
+	err = templates.RenderRepeatWithOptions(&b, templates.RepeatContextFromMap(map[string]any{}), runtime.RenderOptions{Limits: runtime.Limits{MaxIterations: 5}})
+	fmt.Printf("repeat %q %v\n", b.String(), err)
+	b.Reset()
+	posts := iter.Seq[any](func(yield func(any) bool) {
+		for i := 0; yield(map[string]any{"title": i}); i++ {
+		}
+	})
+	err = templates.RenderFeedWithOptions(&b, templates.FeedContextFromMap(map[string]any{"posts": posts}), runtime.RenderOptions{Limits: runtime.Limits{MaxIterations: 3}})
+	fmt.Printf("feed %q %v\n", b.String(), err)
+	out, err := templates.RenderLoopString(templates.LoopContextFromMap(map[string]any{"items": []any{1, 2, 3}}))
+	fmt.Printf("unlimited %q %v\n", out, err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	refs := make(map[string]compiler.HelperRef)
+	for name, ref := range helpers.Registry() {
+		refs[name] = compiler.HelperRef{ImportPath: ref.ImportPath, Ident: ref.Ident, Options: ref.Options, BlockContext: ref.BlockContext}
+	}
+	code, err := compiler.CompileTemplates(map[string]string{
+		"self":   "{{n}}{{> self}}",
+		"loop":   "{{#each items}}{{#each ../items}}{{this}}{{/each}}{{/each}}",
+		"repeat": "{{#repeat 1000000000000}}.{{/repeat}}",
+		"feed":   "{{#each posts as |p|}}{{p.title}},{{/each}}",
+	}, compiler.Options{PackageName: "templates", Helpers: refs})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if !strings.Contains(string(code), "runtime.Elements(") {
+		t.Errorf("the posts of feed are not iterated as a typed collection:\n%s", code)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	got := string(output)
+	for _, want := range []string{
+		// Each call of the recursive partial is on the stack.
+		`self "2222" true ` + strings.Repeat(`template "self" line 1:6: `, 4) + `render limit exceeded: partial depth over 3`,
+		`self "22222" true ` + strings.Repeat(`template "self" line 1:6: `, 5) + `render limit exceeded: output bytes over 5`,
+		`loop "123" template "loop" line 1:16: render limit exceeded: loop iterations over 5`,
+		`repeat "....." template "repeat" line 1:1: render limit exceeded: loop iterations over 5`,
+		`feed "0,1,2," template "feed" line 1:1: render limit exceeded: loop iterations over 3`,
+		`unlimited "123123123" <nil>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
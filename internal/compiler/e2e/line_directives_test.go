@@ -0,0 +1,127 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_LineDirectives compiles templates with Options.SourceFiles and checks that helper
+// errors name the template positions of the calls and that a helper panic's stack trace has
+// the template file and line.
+func TestE2E_LineDirectives(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-lines\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("helpers/helpers.go", `package helpers
+
+import "errors"
+
+// ErrBad is returned by Check for "bad".
+var ErrBad = errors.New("bad name")
+
+// Check fails for "bad" and panics for "panic".
+func Check(args []any) (any, error) {
+	switch args[0] {
+	case "bad":
+		return nil, ErrBad
+	case "panic":
+		panic("check: " + args[0].(string))
+	}
+	return "ok", nil
+}
+`)
+	templates := map[string]string{
+		"main": "<h1>{{title}}</h1>\n{{#if item}}\n  {{> card item}}\n{{/if}}\n",
+		"card": "<b>{{name}}</b>\n  {{check name}}\n",
+	}
+	for name, src := range templates {
+		writeFile("views/"+name+".hbs", src)
+	}
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"test-lines/helpers"
+	templates "test-lines/templates"
+)
+
+func render(name string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	_, err = templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"title": "T",
+		"item":  map[string]any{"name": name},
+	}))
+	return err
+}
+
+func main() {
+	err := render("bad")
+	fmt.Printf("error: %v (is ErrBad: %v)\n", err, errors.Is(err, helpers.ErrBad))
+	if err := render("panic"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(templates, compiler.Options{
+		PackageName: "templates",
+		Helpers:     map[string]compiler.HelperRef{"check": {ImportPath: "test-lines/helpers", Ident: "Check"}},
+		SourceFiles: map[string]string{"main": "../views/main.hbs", "card": "../views/card.hbs"},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`error: template "main" line 3:3: template "card" line 2:3: bad name (is ErrBad: true)`,
+		"panic: check: panic",
+		filepath.ToSlash(filepath.Join(tmpDir, "views", "card.hbs")) + ":2",
+		filepath.ToSlash(filepath.Join(tmpDir, "views", "main.hbs")) + ":3",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
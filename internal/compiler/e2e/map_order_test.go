@@ -0,0 +1,86 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_MapOrder renders generated code with {{#each}} over maps: Go maps iterate in sorted
+// key order, the same on every render, and runtime.OrderedMap values in their own order.
+func TestE2E_MapOrder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-map-order\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-map-order/templates"
+)
+
+func main() {
+	settings := map[string]any{}
+	for _, k := range []string{"e", "b", "d", "a", "c"} {
+		settings[k] = k
+	}
+	menu := runtime.NewOrderedMap().
+		Set("home", map[string]any{"title": "Home"}).
+		Set("blog", map[string]any{"title": "Blog"}).
+		Set("about", map[string]any{"title": "About"})
+	for range 3 {
+		out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+			"settings": settings,
+			"menu":     menu,
+		}))
+		fmt.Printf("main %q %v\n", out, err)
+	}
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{#each settings}}{{@key}}{{#unless @last}},{{/unless}}{{/each}}|` +
+			`{{#each menu}}{{@key}}:{{title}}{{#unless @last}} {{/unless}}{{/each}}`,
+	}, compiler.Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	want := `main "a,b,c,d,e|home:Home blog:Blog about:About" <nil>`
+	if got := string(output); strings.Count(got, want) != 3 {
+		t.Errorf("output does not contain %q three times:\n%s", want, got)
+	}
+}
@@ -0,0 +1,97 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_MissingHelpers compiles with MissingHelpersRuntime and registers the unknown helpers at
+// startup: a runtime helper, a runtime block helper and the helperMissing/blockHelperMissing hooks.
+func TestE2E_MissingHelpers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-missing\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-missing/templates"
+)
+
+func main() {
+	runtime.RegisterHelper("shout", func(args []any, options *runtime.HelperOptions) (any, error) {
+		return strings.ToUpper(runtime.Stringify(args[0])) + runtime.Stringify(options.HashValue("end", "")), nil
+	})
+	runtime.RegisterBlockHelper("cms", func(w io.Writer, args []any, options *runtime.HelperOptions) error {
+		if args[0] == "missing" {
+			return options.Inverse(w, options.Context, nil)
+		}
+		block := map[string]any{"text": "block " + runtime.Stringify(args[0])}
+		return options.Fn(w, block, runtime.NewDataFrame(options.Data).SetBlockParams(args[0]))
+	})
+	runtime.SetHelperMissing(func(args []any, options *runtime.HelperOptions) (any, error) {
+		return "?" + options.Name, nil
+	})
+	runtime.SetBlockHelperMissing(func(w io.Writer, args []any, options *runtime.HelperOptions) error {
+		return options.Fn(w, options.Context, nil)
+	})
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"title": "Doc",
+		"slug":  "intro",
+	}))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(out)
+}
+`)
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{shout title end="!"}}|{{unknown slug}}|{{#cms slug as |name|}}{{text}}:{{name}}{{/cms}}|` +
+			`{{#cms "missing"}}-{{else}}no {{title}}{{/cms}}|{{#frame title}}{{title}}{{/frame}}|{{shout (unknown 1)}}`,
+	}, compiler.Options{PackageName: "templates", MissingHelpers: compiler.MissingHelpersRuntime})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	want := "DOC!|?unknown|block intro:intro|no Doc|Doc|?UNKNOWN"
+	if got := strings.TrimSpace(string(output)); got != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_NativeHelpers generates adapters for helpers with ordinary Go signatures
+// (type-checked with compiler.LoadHelperTypes) and runs the result.
+func TestE2E_NativeHelpers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-native\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("helpers/helpers.go", `package helpers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+func Repeat(s string, n int) string { return strings.Repeat(s, n) }
+
+func Year(t time.Time) (int, error) { return t.Year(), nil }
+
+func Sum(nums ...float64) float64 {
+	total := 0.0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+func Greet(name string, hash runtime.Hash) string {
+	if g, ok := hash["greeting"].(string); ok {
+		return g + ", " + name
+	}
+	return "Hello, " + name
+}
+`)
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"os"
+
+	templates "test-native/templates"
+)
+
+func main() {
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"name": "Ann", "when": "2024-05-01", "count": 3.0,
+	}))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(out)
+	_, err = templates.RenderBadString(templates.BadContextFromMap(map[string]any{"count": "many"}))
+	fmt.Println("bad:", err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	const helpersImport = "test-native/helpers"
+	helpers := map[string]compiler.HelperRef{
+		"repeat": {ImportPath: helpersImport, Ident: "Repeat"},
+		"year":   {ImportPath: helpersImport, Ident: "Year"},
+		"sum":    {ImportPath: helpersImport, Ident: "Sum"},
+		"greet":  {ImportPath: helpersImport, Ident: "Greet"},
+	}
+	ht, err := compiler.LoadHelperTypes(filepath.Join(tmpDir, "templates"), "templates_gen.go", helpers)
+	if err != nil {
+		t.Fatalf("LoadHelperTypes: %v", err)
+	}
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{repeat "ab" count}}|{{year when}}|{{sum 1 2.5 count}}|{{greet name greeting="Hi"}}|{{greet name}}`,
+		"bad":  `{{repeat "x" count}}`,
+	}, compiler.Options{PackageName: "templates", Helpers: helpers, HelperTypes: ht})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, output)
+	}
+	got := string(output)
+	if !strings.Contains(got, "ababab|2024|6.5|Hi, Ann|Hello, Ann") {
+		t.Fatalf("unexpected output:\n%s", got)
+	}
+	if !strings.Contains(got, `helper "repeat" argument 2 (int)`) || !strings.Contains(got, `cannot convert "many" to int`) {
+		t.Fatalf("expected argument coercion error, got:\n%s", got)
+	}
+}
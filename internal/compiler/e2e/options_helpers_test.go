@@ -0,0 +1,119 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_OptionsHelpers runs helpers that receive *runtime.HelperOptions: they read the
+// current context, @data and hash, and render their block body with a new context and frame.
+func TestE2E_OptionsHelpers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-options\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("helpers/helpers.go", `package helpers
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+// Whoami describes the call site.
+func Whoami(args []any, options *runtime.HelperOptions) (any, error) {
+	return fmt.Sprintf("%s in %s, this.title=%s, @index=%s, sep=%s", options.Name, options.Template,
+		runtime.Stringify(runtime.LookupPath(options.Context, "title")), runtime.Stringify(options.Data.Get("index")),
+		runtime.Stringify(options.HashValue("sep", "-"))), nil
+}
+
+// Letters renders the body once per letter of args[0], with the letter as context.
+func Letters(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	s := runtime.Stringify(args[0])
+	if s == "" {
+		return options.Inverse(w, options.Context, nil)
+	}
+	for i, r := range s {
+		data := runtime.NewDataFrame(options.Data).Set("index", i).Set("last", i == len(s)-1).Set("word", s)
+		if err := options.Fn(w, map[string]any{"ch": string(r)}, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+`)
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"os"
+
+	templates "test-options/templates"
+)
+
+func main() {
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"title": "Doc",
+		"rows":  []any{map[string]any{"title": "r0", "word": "ab"}, map[string]any{"title": "r1", "word": ""}},
+	}))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(out)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	const helpersImport = "test-options/helpers"
+	helpers := map[string]compiler.HelperRef{
+		"whoami":  {ImportPath: helpersImport, Ident: "Whoami", Options: true},
+		"letters": {ImportPath: helpersImport, Ident: "Letters", Options: true},
+	}
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{whoami sep=","}}|{{#each rows}}{{#letters word}}{{ch}}{{@index}}{{#if @last}}!{{/if}}({{@word}},{{../title}},{{whoami}}){{> chip}}{{else}}empty {{title}}{{/letters}};{{/each}}`,
+		"chip": `<{{ch}}>`,
+	}, compiler.Options{PackageName: "templates", Helpers: helpers})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	want := "whoami in main, this.title=Doc, @index=, sep=,|" +
+		"a0(ab,r0,whoami in main, this.title=, @index=0, sep=-)<a>" +
+		"b1!(ab,r0,whoami in main, this.title=, @index=1, sep=-)<b>;" +
+		"empty r1;"
+	if got := strings.TrimSpace(string(output)); got != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
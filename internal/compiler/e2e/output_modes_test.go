@@ -0,0 +1,92 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_OutputModes renders templates in text mode (by extension), with the built-in csv
+// escaper (by annotation) and with an escaper the program registers.
+func TestE2E_OutputModes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-modes\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	"test-modes/templates"
+)
+
+func main() {
+	runtime.RegisterEscaper("upper", strings.ToUpper)
+	data := map[string]any{"name": "Tom & Jerry", "note": "say \"hi\", <b>"}
+
+	out, err := templates.RenderMailTxtString(templates.MailTxtContextFromMap(data))
+	fmt.Printf("mail: %q %v\n", out, err)
+	out, err = templates.RenderExportString(templates.ExportContextFromMap(data))
+	fmt.Printf("export: %q %v\n", out, err)
+	out, err = templates.RenderShoutString(templates.ShoutContextFromMap(data))
+	fmt.Printf("shout: %q %v\n", out, err)
+	out, err = templates.RenderPageString(templates.PageContextFromMap(data))
+	fmt.Printf("page: %q %v\n", out, err)
+}
+`)
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"mail.txt": "Hello {{name}}: {{note}}",
+		"export":   "{{!-- escape: csv --}}{{name}},{{note}}",
+		"shout":    "{{note}}",
+		"page":     "<p>{{name}}</p>",
+	}, compiler.Options{PackageName: "templates", TemplateEscape: map[string]string{"shout": "upper"}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, output)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`mail: "Hello Tom & Jerry: say \"hi\", <b>" <nil>`,
+		`export: "Tom & Jerry,\"say \"\"hi\"\", <b>\"" <nil>`,
+		`shout: "SAY \"HI\", <B>" <nil>`,
+		`page: "<p>Tom &amp; Jerry</p>" <nil>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_Registry renders partials of another generated package through dynamic partials:
+// the plugin package registers its templates in a runtime.Registry passed per render, and a
+// runtime helper registered in the same registry picks the partial name.
+func TestE2E_Registry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-registry\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	"test-registry/plugin"
+	templates "test-registry/templates"
+)
+
+func main() {
+	reg := runtime.NewRegistry()
+	plugin.RegisterPartials(reg)
+	reg.RegisterHelper("pick", func(args []any, options *runtime.HelperOptions) (any, error) {
+		return "widget-" + runtime.Stringify(args[0]), nil
+	})
+	data := templates.MainContextFromMap(map[string]any{
+		"title": "Doc",
+		"items": []any{
+			map[string]any{"kind": "card", "title": "a"},
+			map[string]any{"kind": "badge", "title": "b"},
+		},
+	})
+	var b strings.Builder
+	if err := templates.RenderMainWithRegistry(&b, data, reg); err != nil {
+		fmt.Fprintf(os.Stderr, "render: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(b.String())
+	// Without the registry the helper is not defined.
+	if _, err := templates.RenderMainString(data); err == nil || !strings.Contains(err.Error(), "helper \"pick\" is not defined") {
+		fmt.Fprintf(os.Stderr, "render without registry: %v\n", err)
+		os.Exit(1)
+	}
+}
+`)
+	plugin, err := compiler.CompileTemplates(map[string]string{
+		"widget-card":  `[card {{title}}]`,
+		"widget-badge": `({{title}}{{> widget-card}})`,
+	}, compiler.Options{PackageName: "plugin"})
+	if err != nil {
+		t.Fatalf("compile plugin: %v", err)
+	}
+	writeFile("plugin/templates_gen.go", string(plugin))
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{title}}:{{#each items}}{{> (pick kind)}}{{/each}}|{{> (pick "none")}}`,
+	}, compiler.Options{PackageName: "templates", MissingHelpers: compiler.MissingHelpersRuntime})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	want := `Doc:[card a](b[card b])|<!-- partial "widget&#45;none" is not defined -->`
+	if got := strings.TrimSpace(string(output)); !strings.HasSuffix(got, want) {
+		t.Fatalf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_Strict renders templates compiled with Options.Strict and Options.AssumeObjects
+// and checks the positioned errors for missing paths.
+func TestE2E_Strict(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-strict\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("strict/doc.go", "package strict\n")
+	writeFile("objects/doc.go", "package objects\n")
+	writeFile("main.go", `package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	"test-strict/objects"
+	"test-strict/strict"
+)
+
+func main() {
+	good := map[string]any{"user": map[string]any{"name": "Ann"}, "posts": []any{map[string]any{"title": "a"}}}
+	out, err := strict.RenderMainString(strict.MainContextFromMap(good))
+	fmt.Printf("good: %q %v\n", out, err)
+
+	noTitle := map[string]any{"user": map[string]any{"name": "Ann"}, "posts": []any{map[string]any{"title": "a"}, map[string]any{}}}
+	_, err = strict.RenderMainString(strict.MainContextFromMap(noTitle))
+	var missing *runtime.MissingPathError
+	fmt.Println("missing:", err, errors.As(err, &missing))
+
+	_, err = strict.RenderMainString(strict.MainContextFromMap(map[string]any{"posts": []any{}}))
+	fmt.Println("no user:", err)
+
+	out, err = objects.RenderMainString(objects.MainContextFromMap(map[string]any{"user": map[string]any{}, "posts": []any{}}))
+	fmt.Printf("objects: %q %v\n", out, err)
+	_, err = objects.RenderMainString(objects.MainContextFromMap(map[string]any{"posts": []any{}}))
+	fmt.Println("objects no user:", err)
+}
+`)
+
+	tmpl := map[string]string{
+		"main": "{{#if user.email}}<{{user.email}}>{{/if}}{{user.name}}\n{{#each posts as |p|}}[{{p.title}}]{{/each}}",
+	}
+	for _, pkg := range []struct {
+		name string
+		opts compiler.Options
+	}{
+		{"strict", compiler.Options{PackageName: "strict", Strict: true}},
+		{"objects", compiler.Options{PackageName: "objects", AssumeObjects: true}},
+	} {
+		code, err := compiler.CompileTemplates(tmpl, pkg.opts)
+		if err != nil {
+			t.Fatalf("compile %s: %v", pkg.name, err)
+		}
+		writeFile(pkg.name+"/templates_gen.go", string(code))
+	}
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, output)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`good: "Ann\n[a]" <nil>`,
+		`missing: template "main" line 2:24: "posts.1.title" is not defined (missing "title") true`,
+		`no user: template "main" line 1:42: "user.name" is not defined (missing "user")`,
+		`objects: "\n" <nil>`,
+		`objects no user: template "main" line 1:42: "user.name" is not defined (missing "user")`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+}
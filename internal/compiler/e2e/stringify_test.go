@@ -0,0 +1,83 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_StringifyJS renders generated code compiled with Options.Stringify = StringifyJS:
+// values print as handlebars.js prints them.
+func TestE2E_StringifyJS(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-stringify-js\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-stringify-js/templates"
+)
+
+func main() {
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"tags":  []any{"a", "b", 3},
+		"obj":   runtime.NewOrderedMap().Set("a", 1),
+		"big":   1e21,
+		"small": 1e-7,
+		"num":   json.Number("2.50"),
+		"no":    false,
+		"nan":   math.NaN(),
+		"none":  nil,
+	}))
+	fmt.Printf("main %q %v\n", out, err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": `{{tags}}|{{obj}}|{{big}}|{{small}}|{{num}}|{{no}}|{{nan}}|{{none}}|{{{tags}}}`,
+	}, compiler.Options{PackageName: "templates", Stringify: compiler.StringifyJS})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	want := `main "a,b,3|[object Object]|1e+21|1e-7|2.5|false|NaN||a,b,3" <nil>`
+	if got := strings.TrimSpace(string(output)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_StructValues renders generated code with Go structs in map data: paths find their
+// fields by json tag or name, promoted fields of embedded structs and zero-arg methods.
+func TestE2E_StructValues(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-struct-values\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"fmt"
+
+	templates "test-struct-values/templates"
+)
+
+type Base struct {
+	ID int
+}
+
+type Author struct {
+	Name string `+"`"+`json:"name"`+"`"+`
+}
+
+func (a *Author) Initials() string { return a.Name[:1] }
+
+type Post struct {
+	Base
+	Title  string `+"`"+`json:"title"`+"`"+`
+	Slug   string
+	Author *Author
+}
+
+func (p Post) URL() string { return "/posts/" + p.Slug }
+
+func main() {
+	post := &Post{Base: Base{ID: 7}, Title: "Hi", Slug: "hi", Author: &Author{Name: "ann"}}
+	out, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{"post": post}))
+	fmt.Printf("main %q %v\n", out, err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main": "{{post.title}} by {{post.author.name}} ({{post.author.initials}}){{#with post}} #{{id}}{{/with}}{{> card post}} {{lookup post \"slug\"}}",
+		"card": " [{{url}}]",
+	}, compiler.Options{
+		PackageName: "templates",
+		Helpers: map[string]compiler.HelperRef{
+			"lookup": {ImportPath: "github.com/andriyg76/go-hbars/helpers/handlebars", Ident: "Lookup"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`main "Hi by ann (a) #7 [/posts/hi] hi" <nil>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
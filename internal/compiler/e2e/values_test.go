@@ -0,0 +1,120 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/internal/compiler"
+)
+
+// TestE2E_FunctionValues renders generated code with function-valued context values: they
+// are called when the template uses them, with the render's context, also in the middle of a
+// path, and their errors fail the render at the node.
+func TestE2E_FunctionValues(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e test in short mode")
+	}
+
+	tmpDir := t.TempDir()
+	root := repoRoot(t)
+	writeFile := func(path, content string) {
+		full := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile("go.mod", "module test-function-values\n\ngo 1.24\n\nreplace github.com/andriyg76/go-hbars => "+filepath.ToSlash(root)+"\n")
+	writeFile("templates/doc.go", "package templates\n")
+	writeFile("main.go", `package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	templates "test-function-values/templates"
+)
+
+type key struct{}
+
+func main() {
+	queries := 0
+	data := templates.MainContextFromMap(map[string]any{
+		"title": func() any { return "Post" },
+		"related": runtime.NewLazy(func(ctx context.Context) (any, error) {
+			queries++
+			return []any{map[string]any{"title": ctx.Value(key{})}}, nil
+		}),
+		"author": func() (any, error) { return map[string]any{"name": "ann"}, nil },
+	})
+	ctx := context.WithValue(context.Background(), key{}, "Other")
+	for range 2 {
+		var b strings.Builder
+		err := templates.RenderMainContext(ctx, &b, data)
+		fmt.Printf("main %q %v\n", b.String(), err)
+	}
+	fmt.Printf("queries %d\n", queries)
+
+	_, err := templates.RenderMainString(templates.MainContextFromMap(map[string]any{
+		"related": func(context.Context) (any, error) { return nil, errors.New("db down") },
+	}))
+	fmt.Printf("error %v\n", err)
+
+	out, err := templates.RenderShortString(templates.ShortContextFromMap(map[string]any{
+		"title":   "Post",
+		"related": runtime.NewLazy(func(context.Context) (any, error) { panic("computed") }),
+	}))
+	fmt.Printf("unused %q %v\n", out, err)
+
+	var b strings.Builder
+	err = templates.RenderBylineContext(ctx, &b, templates.BylineContextFromMap(map[string]any{
+		"author": func(ctx context.Context) (any, error) { return map[string]any{"name": ctx.Value(key{})}, nil },
+		"editor": func() (any, error) { return nil, errors.New("no editor") },
+	}))
+	fmt.Printf("byline %q %v\n", b.String(), err)
+}
+`)
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = tmpDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+
+	code, err := compiler.CompileTemplates(map[string]string{
+		"main":   "{{title}}{{#each related}} {{title}}{{/each}}{{#with author}} by {{name}}{{/with}}",
+		"short":  "{{title}}",
+		"byline": "{{author.name}}|{{#with editor}}{{name}}{{/with}}",
+	}, compiler.Options{PackageName: "templates"})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	writeFile("templates/templates_gen.go", string(code))
+
+	cmd = exec.Command("go", "run", ".")
+	cmd.Dir = tmpDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, output, code)
+	}
+	got := string(output)
+	for _, want := range []string{
+		`main "Post Other by ann" <nil>`,
+		`queries 1`,
+		`error template "main" line 1:10: db down`,
+		`unused "Post" <nil>`,
+		`byline "Other|" template "byline" line 1:33: no editor`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+}
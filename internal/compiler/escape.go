@@ -0,0 +1,46 @@
+package compiler
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/andriyg76/go-hbars/internal/parser"
+	"github.com/andriyg76/hexerr"
+)
+
+// escaperName matches the names of runtime escapers (runtime.RegisterEscaper).
+var escaperName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// templateEscape returns the output mode of template name with source src (see
+// Options.TemplateEscape).
+func templateEscape(name, src string, opts Options) (string, error) {
+	mode := opts.Escape
+	switch path.Ext(name) {
+	case ".txt", ".md":
+		mode = EscapeText
+	case ".html", ".htm":
+		if mode != EscapeContextual {
+			mode = EscapeHTML
+		}
+	}
+	if m, ok := opts.TemplateEscape[name]; ok {
+		mode = m
+	}
+	if m, ok := parser.EscapeAnnotation(src); ok {
+		mode = m
+	}
+	return checkEscape(mode)
+}
+
+// checkEscape validates an output mode: EscapeHTML (also for ""), EscapeContextual,
+// EscapeText or the name of a runtime escaper, which is looked up at render time.
+func checkEscape(mode string) (string, error) {
+	if mode == "" {
+		return EscapeHTML, nil
+	}
+	if !escaperName.MatchString(mode) {
+		return "", hexerr.New(fmt.Sprintf("invalid escape mode %q (want %q, %q, %q or an escaper name)", mode, EscapeHTML, EscapeContextual, EscapeText))
+	}
+	return mode, nil
+}
@@ -0,0 +1,456 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	goast "go/ast"
+	"go/build"
+	"go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/internal/ast"
+	"github.com/andriyg76/hexerr"
+)
+
+// HelperKind classifies a helper by its Go signature.
+type HelperKind int
+
+const (
+	// HelperKindUnknown means the signature was not inspected or is not supported.
+	HelperKindUnknown HelperKind = iota
+	// HelperKindHelper is runtime.Helper: func(args []any) (any, error).
+	HelperKindHelper
+	// HelperKindBlock is func(args []any) error; runtime.BlockOptions is passed as the last arg.
+	HelperKindBlock
+	// HelperKindBlockHelper is runtime.BlockHelper: func(args []any, options runtime.BlockOptions) error.
+	HelperKindBlockHelper
+	// HelperKindNative is an ordinary Go function such as func(s string, n int) string;
+	// the compiler generates a runtime.Helper adapter that coerces the arguments.
+	HelperKindNative
+	// HelperKindNativeBlock is a native function with a trailing runtime.BlockOptions parameter,
+	// adapted to runtime.BlockHelper.
+	HelperKindNativeBlock
+	// HelperKindOptions is runtime.OptionsHelper: func(args []any, options *runtime.HelperOptions) (any, error).
+	HelperKindOptions
+	// HelperKindOptionsBlock is runtime.OptionsBlockHelper:
+	// func(w io.Writer, args []any, options *runtime.HelperOptions) error.
+	HelperKindOptionsBlock
+)
+
+// HelperTypes holds go/types information about the packages that implement helpers.
+// It is produced by LoadHelperTypes and passed to the compiler via Options.HelperTypes.
+type HelperTypes struct {
+	dir   string
+	pkgs  map[string]*types.Package
+	local *types.Package // package of the generated file, for helpers without an import path
+}
+
+// LoadHelperTypes type-checks the packages referenced by helpers. Export data comes from
+// "go list -export" run in dir, so dir must be inside the module that builds the generated code.
+// Helpers without an import path live in the generated package itself: the Go files in dir
+// (except skipFile, the generated output) are type-checked for them.
+func LoadHelperTypes(dir, skipFile string, helpers map[string]HelperRef) (*HelperTypes, error) {
+	ht := &HelperTypes{dir: dir, pkgs: make(map[string]*types.Package)}
+	fset := gotoken.NewFileSet()
+
+	pathSet := make(map[string]bool)
+	needLocal := false
+	for _, ref := range helpers {
+		if ref.ImportPath == "" {
+			needLocal = true
+			continue
+		}
+		pathSet[ref.ImportPath] = true
+	}
+
+	var localFiles []*goast.File
+	localName := ""
+	if needLocal {
+		bp, err := build.ImportDir(dir, 0)
+		var noGo *build.NoGoError
+		if err != nil && !errors.As(err, &noGo) {
+			return nil, hexerr.Wrapf(err, "compiler: load package in %s", dir)
+		}
+		if bp != nil {
+			for _, name := range bp.GoFiles {
+				if name == skipFile {
+					continue
+				}
+				f, err := goparser.ParseFile(fset, filepath.Join(dir, name), nil, goparser.SkipObjectResolution)
+				if err != nil {
+					return nil, hexerr.Wrapf(err, "compiler: parse %s", name)
+				}
+				localName = f.Name.Name
+				localFiles = append(localFiles, f)
+				for _, imp := range f.Imports {
+					if p, err := strconv.Unquote(imp.Path.Value); err == nil && p != "C" {
+						pathSet[p] = true
+					}
+				}
+			}
+		}
+	}
+	if len(pathSet) == 0 && len(localFiles) == 0 {
+		return ht, nil
+	}
+
+	paths := make([]string, 0, len(pathSet))
+	for p := range pathSet {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	exports, listErrs, err := goListExports(dir, paths)
+	if err != nil {
+		return nil, err
+	}
+	imp := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		file := exports[path]
+		if file == "" {
+			return nil, fmt.Errorf("no export data for %q", path)
+		}
+		return os.Open(file)
+	})
+	for _, ref := range helpers {
+		if ref.ImportPath == "" || ht.pkgs[ref.ImportPath] != nil {
+			continue
+		}
+		if msg := listErrs[ref.ImportPath]; msg != "" {
+			return nil, hexerr.New(fmt.Sprintf("compiler: load helper package %q: %s", ref.ImportPath, msg))
+		}
+		pkg, err := imp.Import(ref.ImportPath)
+		if err != nil {
+			return nil, hexerr.Wrapf(err, "compiler: load helper package %q", ref.ImportPath)
+		}
+		ht.pkgs[ref.ImportPath] = pkg
+	}
+	if len(localFiles) > 0 {
+		// The package may reference the generated code we are about to (re)write; its errors are ignored.
+		conf := types.Config{Importer: imp, Error: func(error) {}}
+		ht.local, _ = conf.Check(localName, fset, localFiles, nil)
+	}
+	return ht, nil
+}
+
+// goListExports runs "go list -export -deps" for paths and returns export data files and load errors by import path.
+func goListExports(dir string, paths []string) (map[string]string, map[string]string, error) {
+	args := append([]string{"list", "-e", "-export", "-deps", "-json=ImportPath,Export,Error", "--"}, paths...)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, nil, hexerr.New(fmt.Sprintf("compiler: go list in %s: %v: %s", dir, err, strings.TrimSpace(stderr.String())))
+	}
+	exports := make(map[string]string)
+	listErrs := make(map[string]string)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var p struct {
+			ImportPath string
+			Export     string
+			Error      *struct{ Err string }
+		}
+		if err := dec.Decode(&p); err != nil {
+			return nil, nil, hexerr.Wrapf(err, "compiler: decode go list output")
+		}
+		exports[p.ImportPath] = p.Export
+		if p.Error != nil {
+			listErrs[p.ImportPath] = p.Error.Err
+		}
+	}
+	return exports, listErrs, nil
+}
+
+// lookup returns the Go signature of the helper's identifier, or a description of why there is none.
+func (ht *HelperTypes) lookup(ref HelperRef) (*types.Signature, string) {
+	pkg := ht.local
+	where := "the package in " + ht.dir
+	if ref.ImportPath != "" {
+		pkg = ht.pkgs[ref.ImportPath]
+		where = "package " + ref.ImportPath
+	} else if strings.Contains(ref.Ident, ".") {
+		return nil, "" // qualified identifier from the generated package's imports; not checked
+	}
+	if pkg == nil {
+		if ref.ImportPath == "" {
+			return nil, fmt.Sprintf("%s is not declared (no Go files in %s)", ref.Ident, ht.dir)
+		}
+		return nil, fmt.Sprintf("%s is not declared: %s was not loaded", ref.Ident, where)
+	}
+	obj := pkg.Scope().Lookup(ref.Ident)
+	if obj == nil {
+		return nil, fmt.Sprintf("%s is not declared in %s", ref.Ident, where)
+	}
+	if ref.ImportPath != "" && !obj.Exported() {
+		return nil, fmt.Sprintf("%s is not exported by %s", ref.Ident, where)
+	}
+	switch obj.(type) {
+	case *types.Func, *types.Var:
+	default:
+		return nil, fmt.Sprintf("%s.%s is not a function", pkg.Path(), ref.Ident)
+	}
+	sig, ok := obj.Type().Underlying().(*types.Signature)
+	if !ok {
+		return nil, fmt.Sprintf("%s.%s has type %s, not a function", pkg.Path(), ref.Ident, obj.Type())
+	}
+	return sig, ""
+}
+
+// helperInfo is what the compiler learned about a helper from its Go declaration.
+type helperInfo struct {
+	kind   HelperKind
+	native *nativeSig // for HelperKindNative and HelperKindNativeBlock
+}
+
+// classifyHelper maps a helper signature to the calling convention the generated code uses.
+// For signatures that are neither runtime.Helper nor a block helper form, it tries a native
+// signature and returns the reason when that is not supported either.
+func classifyHelper(sig *types.Signature, runtimeImport string, qualify typeQualifier) (helperInfo, string) {
+	params, results := sig.Params(), sig.Results()
+	if sig.TypeParams().Len() == 0 && !sig.Variadic() && params.Len() > 1 && isHelperOptions(params.At(params.Len()-1).Type(), runtimeImport) {
+		switch {
+		case params.Len() == 2 && isAnySlice(params.At(0).Type()) && results.Len() == 2 && isEmptyInterface(results.At(0).Type()) && isError(results.At(1).Type()):
+			return helperInfo{kind: HelperKindOptions}, ""
+		case params.Len() == 3 && isIOWriter(params.At(0).Type()) && isAnySlice(params.At(1).Type()) && results.Len() == 1 && isError(results.At(0).Type()):
+			return helperInfo{kind: HelperKindOptionsBlock}, ""
+		}
+		return helperInfo{}, "helpers taking *runtime.HelperOptions must be runtime.OptionsHelper (func(args []any, options *runtime.HelperOptions) (any, error)) or runtime.OptionsBlockHelper (func(w io.Writer, args []any, options *runtime.HelperOptions) error)"
+	}
+	if sig.TypeParams().Len() == 0 && !sig.Variadic() && params.Len() > 0 && isAnySlice(params.At(0).Type()) {
+		switch {
+		case params.Len() == 1 && results.Len() == 2 && isEmptyInterface(results.At(0).Type()) && isError(results.At(1).Type()):
+			return helperInfo{kind: HelperKindHelper}, ""
+		case params.Len() == 1 && results.Len() == 1 && isError(results.At(0).Type()):
+			return helperInfo{kind: HelperKindBlock}, ""
+		case params.Len() == 2 && results.Len() == 1 && isError(results.At(0).Type()) && isRuntimeType(params.At(1).Type(), runtimeImport, "BlockOptions"):
+			return helperInfo{kind: HelperKindBlockHelper}, ""
+		}
+	}
+	ns, reason := parseNativeSig(sig, runtimeImport, qualify)
+	if ns == nil {
+		return helperInfo{}, reason
+	}
+	if ns.options {
+		return helperInfo{kind: HelperKindNativeBlock, native: ns}, ""
+	}
+	return helperInfo{kind: HelperKindNative, native: ns}, ""
+}
+
+// takesOptions reports whether the helper is called as runtime.BlockHelper (options as a separate parameter).
+func (k HelperKind) takesOptions() bool {
+	return k == HelperKindBlockHelper || k == HelperKindNativeBlock
+}
+
+// usesHelperOptions reports whether the helper is called with *runtime.HelperOptions.
+func (k HelperKind) usesHelperOptions() bool {
+	return k == HelperKindOptions || k == HelperKindOptionsBlock
+}
+
+func isAnySlice(t types.Type) bool {
+	s, ok := t.Underlying().(*types.Slice)
+	return ok && isEmptyInterface(s.Elem())
+}
+
+func isEmptyInterface(t types.Type) bool {
+	iface, ok := t.Underlying().(*types.Interface)
+	return ok && iface.Empty()
+}
+
+func isError(t types.Type) bool {
+	return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+// isHelperOptions reports whether t is *runtime.HelperOptions.
+func isHelperOptions(t types.Type, runtimeImport string) bool {
+	ptr, ok := t.(*types.Pointer)
+	return ok && isRuntimeType(ptr.Elem(), runtimeImport, "HelperOptions")
+}
+
+func isIOWriter(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "io" && obj.Name() == "Writer"
+}
+
+func isRuntimeType(t types.Type, runtimeImport, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == runtimeImport && obj.Name() == name
+}
+
+// helperUse is one reference to a helper in a template.
+type helperUse struct {
+	template string
+	pos      ast.Pos
+	name     string
+	block    bool
+}
+
+// collectHelperUses returns helper references in template order (first use of each helper/role per template).
+func collectHelperUses(parsed map[string][]ast.Node, names []string, helpers map[string]HelperRef) []helperUse {
+	var uses []helperUse
+	for _, tmpl := range names {
+		seen := make(map[string]bool)
+		add := func(name string, pos ast.Pos, block bool) {
+			key := name
+			if block {
+				key = "#" + name
+			}
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+			uses = append(uses, helperUse{template: tmpl, pos: pos, name: name, block: block})
+		}
+		var walkExpr func(e expr, pos ast.Pos)
+		walkExpr = func(e expr, pos ast.Pos) {
+			if e.kind != exprCall {
+				return
+			}
+			if _, ok := helpers[e.name]; ok {
+				add(e.name, pos, false)
+			}
+			for _, a := range e.args {
+				walkExpr(a, pos)
+			}
+			for _, h := range e.hash {
+				walkExpr(h.value, pos)
+			}
+		}
+		walkArgs := func(parts []expr, hash []hashArg, pos ast.Pos) {
+			for _, p := range parts {
+				walkExpr(p, pos)
+			}
+			for _, h := range hash {
+				walkExpr(h.value, pos)
+			}
+		}
+		var walk func(nodes []ast.Node)
+		walk = func(nodes []ast.Node) {
+			for _, node := range nodes {
+				switch n := node.(type) {
+				case *ast.Mustache:
+					parts, hash, err := parseParts(n.Expr)
+					if err != nil || len(parts) == 0 {
+						continue
+					}
+					if parts[0].kind == exprPath {
+						if _, ok := helpers[parts[0].value]; ok {
+							add(parts[0].value, n.Pos, false)
+						}
+					}
+					walkArgs(parts[1:], hash, n.Pos)
+					if parts[0].kind == exprCall {
+						walkExpr(parts[0], n.Pos)
+					}
+				case *ast.Partial:
+					parts, hash, err := parseParts(n.Expr)
+					if err == nil {
+						walkArgs(parts, hash, n.Pos)
+					}
+				case *ast.Block:
+					if !builtinBlockNames[n.Name] {
+						if _, ok := helpers[n.Name]; ok {
+							add(n.Name, n.Pos, true)
+						}
+					}
+					if parts, hash, err := parseParts(n.Args); err == nil {
+						walkArgs(parts, hash, n.Pos)
+					}
+					walk(n.Body)
+					walk(n.Else)
+				}
+			}
+		}
+		walk(parsed[tmpl])
+	}
+	return uses
+}
+
+// builtinBlockNames are block names handled by the compiler rather than by helpers.
+var builtinBlockNames = map[string]bool{"if": true, "unless": true, "with": true, "each": true, "block": true, "partial": true}
+
+// checkHelpers validates every helper referenced by the templates against ht and returns what
+// was learned about each of them. Errors name the template position and the flag
+// (HelperRef.Source) that declared the helper.
+func checkHelpers(parsed map[string][]ast.Node, names []string, helpers map[string]HelperRef, helperExprs map[string]string, ht *HelperTypes, runtimeImport string) (map[string]helperInfo, error) {
+	infos := make(map[string]helperInfo)
+	var problems []string
+	for _, use := range collectHelperUses(parsed, names, helpers) {
+		ref := helpers[use.name]
+		sig, msg := ht.lookup(ref)
+		if sig == nil && msg == "" {
+			continue
+		}
+		if sig != nil {
+			info, reason := classifyHelper(sig, runtimeImport, ht.qualifier(ref, helperExprs[use.name], runtimeImport))
+			infos[use.name] = info
+			switch {
+			case ref.Options && reason == "" && !info.kind.usesHelperOptions():
+				msg = fmt.Sprintf("%s has signature %s; helpers registered with Options must be runtime.OptionsHelper or runtime.OptionsBlockHelper", ref.Ident, sig)
+			case use.block && (info.kind == HelperKindBlock || info.kind.takesOptions() || info.kind == HelperKindOptionsBlock):
+				continue
+			case !use.block && (info.kind == HelperKindHelper || info.kind == HelperKindNative || info.kind == HelperKindOptions):
+				continue
+			case reason != "":
+				msg = fmt.Sprintf("%s has signature %s: %s", ref.Ident, sig, reason)
+			case use.block:
+				msg = fmt.Sprintf("%s has signature %s; block helpers must be runtime.BlockHelper (func(args []any, options runtime.BlockOptions) error), runtime.OptionsBlockHelper, func(args []any) error, or take a trailing runtime.BlockOptions and return error", ref.Ident, sig)
+			default:
+				msg = fmt.Sprintf("%s has signature %s; helpers must be runtime.Helper (func(args []any) (any, error)), runtime.OptionsHelper, or return a value", ref.Ident, sig)
+			}
+		}
+		problems = append(problems, formatHelperProblem(use, ref, msg))
+	}
+	if len(problems) > 0 {
+		return nil, hexerr.New(strings.Join(problems, "\n"))
+	}
+	return infos, nil
+}
+
+// qualifier returns how packages are named in the generated file for types in ref's signature:
+// the helper's own package by its import alias, the runtime package as "runtime", and the
+// generated package itself unqualified. Other packages are not imported by the generated file.
+func (ht *HelperTypes) qualifier(ref HelperRef, helperExpr, runtimeImport string) typeQualifier {
+	return func(pkg *types.Package) (string, bool) {
+		switch {
+		case pkg.Path() == runtimeImport:
+			return "runtime", true
+		case ref.ImportPath != "" && pkg.Path() == ref.ImportPath:
+			return strings.TrimSuffix(helperExpr, "."+ref.Ident), true
+		case ref.ImportPath == "" && ht.local != nil && pkg.Path() == ht.local.Path():
+			return "", true
+		}
+		return "", false
+	}
+}
+
+func formatHelperProblem(use helperUse, ref HelperRef, msg string) string {
+	what := "helper"
+	if use.block {
+		what = "block helper"
+	}
+	from := ""
+	if ref.Source != "" {
+		from = " (" + ref.Source + ")"
+	}
+	return fmt.Sprintf("compiler: template %q at %s: %s %q%s: %s", use.template, use.pos, what, use.name, from, msg)
+}
@@ -0,0 +1,194 @@
+package compiler
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	helperspkg "github.com/andriyg76/go-hbars/helpers"
+)
+
+const helperCheckImport = "github.com/andriyg76/go-hbars/internal/compiler/testdata/helpercheck"
+
+func loadHelperTypes(t *testing.T, dir string, helpers map[string]HelperRef) *HelperTypes {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping go list based helper check in short mode")
+	}
+	ht, err := LoadHelperTypes(dir, "templates_gen.go", helpers)
+	if err != nil {
+		t.Fatalf("LoadHelperTypes: %v", err)
+	}
+	return ht
+}
+
+func TestCheckHelpers_ValidSignatures(t *testing.T) {
+	helpers := map[string]HelperRef{
+		"shout":  {ImportPath: helperCheckImport, Ident: "Shout"},
+		"repeat": {ImportPath: helperCheckImport, Ident: "Repeat"},
+		"legacy": {ImportPath: helperCheckImport, Ident: "Legacy"},
+	}
+	code, err := CompileTemplates(map[string]string{
+		"main": "{{shout name}}{{#repeat n}}x{{/repeat}}{{#legacy n}}y{{/legacy}}",
+	}, Options{PackageName: "templates", Helpers: helpers, HelperTypes: loadHelperTypes(t, ".", helpers)})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	if !strings.Contains(src, "helpercheck.Repeat(args") || !strings.Contains(src, ", options") {
+		t.Fatalf("expected runtime.BlockHelper call with separate options, got:\n%s", src)
+	}
+	if !strings.Contains(src, "runtime.GetBlockOptions") {
+		t.Fatalf("expected args-only block helper call for legacy, got:\n%s", src)
+	}
+}
+
+func TestCheckHelpers_Errors(t *testing.T) {
+	helpers := map[string]HelperRef{
+		"missing": {ImportPath: helperCheckImport, Ident: "Missng", Source: "-helpers missing=Missng"},
+		"repeat":  {ImportPath: helperCheckImport, Ident: "Repeat", Source: "-helpers Repeat"},
+		"wrong":   {ImportPath: helperCheckImport, Ident: "Wrong"},
+		"notfunc": {ImportPath: helperCheckImport, Ident: "NotFunc"},
+	}
+	ht := loadHelperTypes(t, ".", helpers)
+	tests := []struct {
+		tmpl string
+		want []string
+	}{
+		{"ok\n  {{missing x}}", []string{`template "main" at 2:3`, `helper "missing" (-helpers missing=Missng)`, "Missng is not declared"}},
+		{"{{#if x}}{{repeat x}}{{/if}}", []string{`at 1:10`, `(-helpers Repeat)`, "must be runtime.Helper"}},
+		{"{{#wrong x}}{{/wrong}}", []string{`block helper "wrong"`, "func(s string) string", "runtime.BlockHelper"}},
+		{"{{upper (notfunc x)}}", []string{`helper "notfunc"`, "not a function"}},
+	}
+	for _, tt := range tests {
+		_, err := CompileTemplates(map[string]string{"main": tt.tmpl}, Options{PackageName: "templates", Helpers: helpers, HelperTypes: ht})
+		if err == nil {
+			t.Fatalf("%q: expected error", tt.tmpl)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Fatalf("%q: error %q does not contain %q", tt.tmpl, err, want)
+			}
+		}
+	}
+}
+
+func TestCheckHelpers_LocalPackage(t *testing.T) {
+	helpers := map[string]HelperRef{
+		"shout":   {Ident: "Shout"},
+		"missing": {Ident: "Missing"},
+	}
+	ht := loadHelperTypes(t, "testdata/helpercheck", helpers)
+	if _, err := CompileTemplates(map[string]string{"main": "{{shout x}}"}, Options{PackageName: "helpercheck", Helpers: helpers, HelperTypes: ht}); err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	_, err := CompileTemplates(map[string]string{"main": "{{missing x}}"}, Options{PackageName: "helpercheck", Helpers: helpers, HelperTypes: ht})
+	if err == nil || !strings.Contains(err.Error(), "Missing is not declared") {
+		t.Fatalf("expected not declared error, got %v", err)
+	}
+}
+
+func TestCheckHelpers_CoreRegistry(t *testing.T) {
+	helpers := make(map[string]HelperRef)
+	names := make([]string, 0)
+	for name, ref := range helperspkg.Registry() {
+		helpers[name] = HelperRef{ImportPath: ref.ImportPath, Ident: ref.Ident, Options: ref.Options, BlockContext: ref.BlockContext}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var tmpl strings.Builder
+	for _, name := range names {
+		if helpers[name].Options {
+			tmpl.WriteString("{{#" + name + " x 1 as |a b|}}{{a}}{{b}}{{@index}}{{else}}-{{/" + name + "}}")
+			continue
+		}
+		tmpl.WriteString("{{" + name + " x}}")
+	}
+	ht := loadHelperTypes(t, ".", helpers)
+	if _, err := CompileTemplates(map[string]string{"main": tmpl.String()}, Options{PackageName: "templates", Helpers: helpers, HelperTypes: ht}); err != nil {
+		t.Fatalf("core helpers do not match runtime.Helper: %v", err)
+	}
+}
+
+func TestCheckHelpers_NativeAdapters(t *testing.T) {
+	helpers := map[string]HelperRef{
+		"pad":   {ImportPath: helperCheckImport, Ident: "Pad"},
+		"day":   {ImportPath: helperCheckImport, Ident: "Day"},
+		"sum":   {ImportPath: helperCheckImport, Ident: "Sum"},
+		"greet": {ImportPath: helperCheckImport, Ident: "Greet"},
+		"times": {ImportPath: helperCheckImport, Ident: "Times"},
+		"level": {ImportPath: helperCheckImport, Ident: "LevelName"},
+	}
+	code, err := CompileTemplates(map[string]string{
+		"main": `{{pad name 8}} {{day when "2006"}} {{sum 1 2 (sum 3 4)}} {{greet name greeting="Hi"}} {{level 2}}{{#times n}}x{{/times}}`,
+	}, Options{PackageName: "templates", Helpers: helpers, HelperTypes: loadHelperTypes(t, ".", helpers)})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{
+		"func nativeHelperPad(args []any) (any, error) {",
+		`runtime.ArityError("pad", 2, false, len(args))`,
+		"a1Raw, err := runtime.ToInt(args[1], 64)",
+		"return helpercheck.Pad(a0, a1), nil",
+		"a0, err := runtime.ToTime(args[0])",
+		"return helpercheck.Day(a0, a1)",
+		"rest := make([]float64, 0, len(args)-0)",
+		"return helpercheck.Greet(a0, hash), nil",
+		"a0 := helpercheck.Level(a0Raw)",
+		"func nativeHelperTimes(args []any, options runtime.BlockOptions) error {",
+		"nativeHelperTimes(args",
+		"nativeHelperSum(args",
+	} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code missing %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestCheckHelpers_NativeUnsupported(t *testing.T) {
+	helpers := map[string]HelperRef{
+		"chan": {ImportPath: helperCheckImport, Ident: "Chan", Source: "-helpers Chan"},
+	}
+	_, err := CompileTemplates(map[string]string{"main": "{{chan x}}"}, Options{PackageName: "templates", Helpers: helpers, HelperTypes: loadHelperTypes(t, ".", helpers)})
+	if err == nil || !strings.Contains(err.Error(), "parameter 1 has unsupported type chan int") {
+		t.Fatalf("expected unsupported parameter error, got %v", err)
+	}
+}
+
+func TestCheckHelpers_HelperOptions(t *testing.T) {
+	helpers := map[string]HelperRef{
+		"describe": {ImportPath: helperCheckImport, Ident: "Describe"},
+		"twice":    {ImportPath: helperCheckImport, Ident: "Twice"},
+		"bad":      {ImportPath: helperCheckImport, Ident: "BadOptions"},
+		"shout":    {ImportPath: helperCheckImport, Ident: "Shout", Options: true},
+	}
+	ht := loadHelperTypes(t, ".", helpers)
+	code, err := CompileTemplates(map[string]string{
+		"main": "{{describe x sep=\",\"}}{{#twice}}{{@index}}:{{name}}{{/twice}}",
+	}, Options{PackageName: "templates", Helpers: helpers, HelperTypes: ht})
+	if err != nil {
+		t.Fatalf("CompileTemplates error: %v", err)
+	}
+	src := string(code)
+	for _, want := range []string{"helpercheck.Describe(args", "helpercheck.Twice(w, nil, options", `Name:     "twice"`, ".SetBlock("} {
+		if !strings.Contains(src, want) {
+			t.Fatalf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"{{bad x}}", "must be runtime.OptionsHelper"},
+		{"{{#describe x}}{{/describe}}", "block helpers must be"},
+		{"{{shout x}}", "registered with Options"},
+	}
+	for _, tt := range tests {
+		_, err := CompileTemplates(map[string]string{"main": tt.tmpl}, Options{PackageName: "templates", Helpers: helpers, HelperTypes: ht})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("%q: error %v does not contain %q", tt.tmpl, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/internal/ast"
+	"github.com/andriyg76/hexerr"
+)
+
+// Contextual escaping (Options.Escape = EscapeContextual) tracks where each {{value}} lands in the
+// HTML produced by the template's text and picks the matching runtime.HTMLContext escaper, in the
+// manner of html/template. The tracker is a small HTML tokenizer over the Text nodes: it knows
+// tags, attribute names and values (quoted or not), URL, event handler and style attributes,
+// <script>, <style>, comments and the RCDATA elements <textarea> and <title>. In JavaScript it
+// tracks strings, template literals and their ${...} substitutions, comments and regular
+// expression literals: as in html/template, the previous token decides whether a '/' starts a
+// division or a regular expression, and a '/' after block branches that disagree fails
+// compilation. Character references in attribute values are not decoded.
+
+type htmlMode uint8
+
+const (
+	htmlModeText        htmlMode = iota // element content
+	htmlModeComment                     // <!-- ... -->
+	htmlModeRCDATA                      // <textarea>, <title>: text up to the end tag
+	htmlModeTag                         // inside a tag, between attributes
+	htmlModeAttrName                    // after an attribute name, before = (if any)
+	htmlModeBeforeValue                 // after =, before the value
+	htmlModeValue                       // inside an attribute value
+	htmlModeScript                      // inside <script>
+	htmlModeStyle                       // inside <style>
+	htmlModeJSAmbiguous                 // after a JavaScript '/' that may start a division or a regular expression
+)
+
+// jsCtx is what a '/' starts in JavaScript code: a regular expression after an operator or
+// a keyword like return, a division after a value.
+type jsCtx uint8
+
+const (
+	jsCtxRegexp jsCtx = iota
+	jsCtxDivOp
+	jsCtxUnknown // block branches end after different tokens
+)
+
+type htmlAttr uint8
+
+const (
+	htmlAttrPlain htmlAttr = iota
+	htmlAttrURL
+	htmlAttrJS
+	htmlAttrCSS
+)
+
+type htmlURLPart uint8
+
+const (
+	htmlURLStart htmlURLPart = iota
+	htmlURLPath
+	htmlURLQuery
+)
+
+// htmlState is the tokenizer state between two nodes. It is comparable, so the ends of
+// block branches can be checked for agreement.
+type htmlState struct {
+	mode    htmlMode
+	tag     string // current tag name (lower case), or the <script>/<style>/RCDATA element
+	closing bool   // the current tag is an end tag
+	attr    htmlAttr
+	quote   byte // attribute value quote, 0 for unquoted values
+	url     htmlURLPart
+	// str is the JavaScript/CSS string quote the scanner is in, '`' for a template literal,
+	// 'l' / 'b' for a line or block comment, '/' for a regular expression literal and '[' for
+	// a character class in it; 0 in code.
+	str byte
+	js  jsCtx
+	// braces holds the JavaScript braces open in code, innermost last: '{' for a block or an
+	// object, '`' for a template literal substitution (${...}).
+	braces string
+}
+
+// urlAttrs are attributes whose values are URLs (besides names containing "src", "uri" or "url").
+var urlAttrs = map[string]bool{
+	"href": true, "action": true, "formaction": true, "cite": true, "poster": true, "background": true,
+	"longdesc": true, "manifest": true, "codebase": true, "data": true, "icon": true, "profile": true, "usemap": true,
+}
+
+func htmlAttrOf(name string) htmlAttr {
+	name = strings.ToLower(name)
+	name = strings.TrimPrefix(name, "data-")
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[i+1:] // xlink:href, xml:base
+	}
+	switch {
+	case strings.HasPrefix(name, "on"):
+		return htmlAttrJS
+	case name == "style":
+		return htmlAttrCSS
+	case name == "srcdoc":
+		return htmlAttrPlain // an HTML document
+	case urlAttrs[name] || strings.Contains(name, "src") || strings.Contains(name, "uri") || strings.Contains(name, "url"):
+		return htmlAttrURL
+	}
+	return htmlAttrPlain
+}
+
+// advance returns the state after text.
+func (s htmlState) advance(text string) htmlState {
+	for i := 0; i < len(text); {
+		i = s.step(text, i)
+	}
+	return s
+}
+
+// step consumes text from i and returns the index of the first byte not consumed.
+func (s *htmlState) step(text string, i int) int {
+	switch s.mode {
+	case htmlModeText:
+		j := strings.IndexByte(text[i:], '<')
+		if j < 0 {
+			return len(text)
+		}
+		j += i
+		if strings.HasPrefix(text[j:], "<!--") {
+			s.mode = htmlModeComment
+			return j + 4
+		}
+		closing := j+1 < len(text) && text[j+1] == '/'
+		start := j + 1
+		if closing {
+			start++
+		}
+		end := start
+		for end < len(text) && isTagNameByte(text[end], end == start) {
+			end++
+		}
+		if end == start {
+			return j + 1
+		}
+		*s = htmlState{mode: htmlModeTag, tag: strings.ToLower(text[start:end]), closing: closing}
+		return end
+	case htmlModeJSAmbiguous:
+		return len(text)
+	case htmlModeComment:
+		j := strings.Index(text[i:], "-->")
+		if j < 0 {
+			return len(text)
+		}
+		s.mode = htmlModeText
+		return i + j + 3
+	case htmlModeRCDATA, htmlModeScript, htmlModeStyle:
+		if s.mode != htmlModeRCDATA && text[i] != '<' {
+			return s.stepCode(text, i)
+		}
+		if end := "</" + s.tag; len(text)-i >= len(end) && strings.EqualFold(text[i:i+len(end)], end) {
+			*s = htmlState{mode: htmlModeTag, tag: s.tag, closing: true}
+			return i + len(end)
+		}
+		if s.mode == htmlModeRCDATA {
+			return i + 1
+		}
+		return s.stepCode(text, i)
+	case htmlModeTag:
+		c := text[i]
+		switch {
+		case isHTMLSpace(c) || c == '/':
+			return i + 1
+		case c == '>':
+			s.endTag()
+			return i + 1
+		}
+		end := i
+		for end < len(text) && !isHTMLSpace(text[end]) && text[end] != '/' && text[end] != '>' && text[end] != '=' {
+			end++
+		}
+		if end == i {
+			end++ // a stray '='
+		}
+		s.mode, s.attr = htmlModeAttrName, htmlAttrOf(text[i:end])
+		return end
+	case htmlModeAttrName:
+		c := text[i]
+		switch {
+		case isHTMLSpace(c):
+			return i + 1
+		case c == '=':
+			s.mode = htmlModeBeforeValue
+			return i + 1
+		}
+		s.mode, s.attr = htmlModeTag, htmlAttrPlain
+		return i
+	case htmlModeBeforeValue:
+		c := text[i]
+		switch {
+		case isHTMLSpace(c):
+			return i + 1
+		case c == '"' || c == '\'':
+			s.mode, s.quote, s.url = htmlModeValue, c, htmlURLStart
+			s.resetCode()
+			return i + 1
+		case c == '>':
+			s.endTag()
+			return i + 1
+		}
+		s.mode, s.quote, s.url = htmlModeValue, 0, htmlURLStart
+		s.resetCode()
+		return i
+	case htmlModeValue:
+		c := text[i]
+		switch {
+		case s.quote != 0 && c == s.quote, s.quote == 0 && isHTMLSpace(c):
+			s.mode, s.attr, s.quote = htmlModeTag, htmlAttrPlain, 0
+			s.resetCode()
+			return i + 1
+		case s.quote == 0 && c == '>':
+			s.endTag()
+			return i + 1
+		}
+		switch s.attr {
+		case htmlAttrURL:
+			if c == '?' || c == '#' {
+				s.url = htmlURLQuery
+			} else if s.url == htmlURLStart {
+				s.url = htmlURLPath
+			}
+		case htmlAttrJS, htmlAttrCSS:
+			return s.stepCode(text, i)
+		}
+		return i + 1
+	}
+	return len(text)
+}
+
+// stepCode consumes one token of JavaScript or CSS: string quotes, escapes and comments, and
+// in JavaScript regular expressions, template literals and braces.
+func (s *htmlState) stepCode(text string, i int) int {
+	c := text[i]
+	js := s.inJS()
+	next := byte(0)
+	if i+1 < len(text) {
+		next = text[i+1]
+	}
+	switch s.str {
+	case 0:
+		switch {
+		case c == '"' || c == '\'' || c == '`' && js:
+			s.str = c
+		case c == '/' && next == '*':
+			s.str = 'b'
+			return i + 2
+		case c == '/' && next == '/' && js:
+			s.str = 'l'
+			return i + 2
+		case !js:
+		case c == '/':
+			switch s.js {
+			case jsCtxRegexp:
+				s.str = '/'
+			case jsCtxDivOp:
+				s.js = jsCtxRegexp
+			default:
+				s.mode = htmlModeJSAmbiguous
+			}
+		case c == '{':
+			s.braces += "{"
+			s.js = jsCtxRegexp
+		case c == '}':
+			if n := len(s.braces); n > 0 {
+				if s.braces[n-1] == '`' {
+					s.str = '`'
+				}
+				s.braces = s.braces[:n-1]
+			}
+			s.js = jsCtxRegexp
+		case c == ')' || c == ']':
+			s.js = jsCtxDivOp
+		case isJSIdentByte(c):
+			end := i + 1
+			for end < len(text) && (isJSIdentByte(text[end]) || text[end] == '.' && c >= '0' && c <= '9') {
+				end++
+			}
+			s.js = jsCtxDivOp
+			if jsRegexpKeywords[text[i:end]] {
+				s.js = jsCtxRegexp
+			}
+			return end
+		case !isHTMLSpace(c):
+			s.js = jsCtxRegexp
+		}
+	case 'l':
+		if c == '\n' {
+			s.str = 0
+		}
+	case 'b':
+		if c == '*' && next == '/' {
+			s.str = 0
+			return i + 2
+		}
+	case '/', '[':
+		switch {
+		case c == '\\':
+			return min(i+2, len(text))
+		case c == '[' && s.str == '/':
+			s.str = '['
+		case c == ']' && s.str == '[':
+			s.str = '/'
+		case c == '/' && s.str == '/':
+			s.str, s.js = 0, jsCtxDivOp
+		}
+	default:
+		switch {
+		case c == '\\':
+			return min(i+2, len(text))
+		case c == s.str:
+			s.str, s.js = 0, jsCtxDivOp
+		case c == '$' && next == '{' && s.str == '`':
+			s.str, s.js = 0, jsCtxRegexp
+			s.braces += "`"
+			return i + 2
+		}
+	}
+	return i + 1
+}
+
+// inJS reports whether code in s is JavaScript (rather than CSS).
+func (s *htmlState) inJS() bool {
+	return s.mode == htmlModeScript || s.attr == htmlAttrJS && s.mode == htmlModeValue
+}
+
+// resetCode clears the JavaScript/CSS scanner state at the start or end of an attribute value.
+func (s *htmlState) resetCode() {
+	s.str, s.js, s.braces = 0, jsCtxRegexp, ""
+}
+
+// jsRegexpKeywords are the keywords after which a '/' starts a regular expression.
+var jsRegexpKeywords = map[string]bool{
+	"break": true, "case": true, "continue": true, "delete": true, "do": true, "else": true, "finally": true,
+	"in": true, "instanceof": true, "return": true, "throw": true, "try": true, "typeof": true, "void": true,
+	"yield": true, "await": true, "new": true,
+}
+
+func isJSIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+// endTag leaves a tag at its '>'.
+func (s *htmlState) endTag() {
+	tag, closing := s.tag, s.closing
+	*s = htmlState{mode: htmlModeText}
+	if closing {
+		return
+	}
+	switch tag {
+	case "script":
+		*s = htmlState{mode: htmlModeScript, tag: tag}
+	case "style":
+		*s = htmlState{mode: htmlModeStyle, tag: tag}
+	case "textarea", "title":
+		*s = htmlState{mode: htmlModeRCDATA, tag: tag}
+	}
+}
+
+// afterValue returns the state after a {{value}}: a value at the start of an attribute value
+// begins it, and one at the start of a URL makes the rest of the URL its path.
+func (s htmlState) afterValue() htmlState {
+	if s.mode == htmlModeBeforeValue {
+		s.mode, s.quote, s.url = htmlModeValue, 0, htmlURLStart
+		s.resetCode()
+	}
+	if s.mode == htmlModeValue && s.attr == htmlAttrURL && s.url == htmlURLStart {
+		s.url = htmlURLPath
+	}
+	if s.inJS() && s.str == 0 {
+		s.js = jsCtxDivOp // the value is an expression
+	}
+	return s
+}
+
+// escapeContext returns the runtime.HTMLContext expression for a {{value}} in state s,
+// or "" for element content (plain runtime.WriteEscaped).
+func (s htmlState) escapeContext() string {
+	if s.mode == htmlModeBeforeValue {
+		s.mode, s.quote, s.url = htmlModeValue, 0, htmlURLStart
+		s.resetCode()
+	}
+	switch s.mode {
+	case htmlModeTag, htmlModeAttrName:
+		return "runtime.HTMLTag"
+	case htmlModeScript:
+		if s.str != 0 {
+			return "runtime.HTMLJSString"
+		}
+		return "runtime.HTMLJS"
+	case htmlModeStyle:
+		if s.str != 0 {
+			return "runtime.HTMLCSSString"
+		}
+		return "runtime.HTMLCSS"
+	case htmlModeValue:
+		var c string
+		switch s.attr {
+		case htmlAttrURL:
+			c = [...]string{"runtime.HTMLURL", "runtime.HTMLURLPart", "runtime.HTMLURLQuery"}[s.url]
+		case htmlAttrJS:
+			c = "runtime.HTMLJS"
+			if s.str != 0 {
+				c = "runtime.HTMLJSString"
+			}
+		case htmlAttrCSS:
+			c = "runtime.HTMLCSS"
+			if s.str != 0 {
+				c = "runtime.HTMLCSSString"
+			}
+		default:
+			c = "runtime.HTMLAttr"
+		}
+		c += "|runtime.HTMLInAttr"
+		if s.quote == 0 {
+			c += "|runtime.HTMLUnquoted"
+		}
+		return c
+	}
+	return ""
+}
+
+func (s htmlState) String() string {
+	switch s.mode {
+	case htmlModeComment:
+		return "HTML comment"
+	case htmlModeRCDATA:
+		return "<" + s.tag + "> text"
+	case htmlModeTag, htmlModeAttrName, htmlModeBeforeValue:
+		return "<" + s.tag + "> tag"
+	case htmlModeValue:
+		return "attribute value in <" + s.tag + ">"
+	case htmlModeScript:
+		switch s.str {
+		case 0:
+			return "<script>"
+		case '/', '[':
+			return "<script> regular expression"
+		}
+		return "<script> string"
+	case htmlModeJSAmbiguous:
+		return "JavaScript after an ambiguous '/'"
+	case htmlModeStyle:
+		if s.str != 0 {
+			return "<style> string"
+		}
+		return "<style>"
+	}
+	return "text"
+}
+
+// htmlNodesEnd returns the state after nodes rendered from state s.
+func (g *generator) htmlNodesEnd(s htmlState, nodes []ast.Node) (htmlState, error) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *ast.Text:
+			s = s.advance(n.Value)
+		case *ast.Mustache:
+			s = s.afterValue()
+		case *ast.Block:
+			var err error
+			if _, s, err = g.htmlBlockEnd(s, n); err != nil {
+				return s, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// htmlBlockEnd returns the states the body of block n starts and ends in when the block is at
+// state s. The body and the {{else}} section (or skipping the block) must end in the same state,
+// and so must a body that can be repeated ({{#each}} and block helpers) and the state it starts
+// in. States that differ only in what a JavaScript '/' starts are joined: a '/' after them is
+// ambiguous. A {{#partial}} body is content for a {{#block}}, assumed to be in element content.
+func (g *generator) htmlBlockEnd(s htmlState, n *ast.Block) (start, end htmlState, err error) {
+	if n.Name == "partial" {
+		// The body is captured for a {{#block}} elsewhere; nothing is written here.
+		if _, err := g.htmlNodesEnd(htmlState{}, n.Body); err != nil {
+			return s, s, err
+		}
+		return htmlState{}, s, nil
+	}
+	start = s
+	body, err := g.htmlNodesEnd(start, n.Body)
+	if err != nil {
+		return s, s, err
+	}
+	if g.repeatsBody(n) && body != start {
+		joined, ok := joinJS(start, body)
+		if ok {
+			start = joined
+			body, err = g.htmlNodesEnd(start, n.Body)
+			if err != nil {
+				return s, s, err
+			}
+			body, ok = joinJS(start, body)
+		}
+		if !ok {
+			return s, s, hexerr.New(fmt.Sprintf("contextual escaping: {{#%s}} at %s: body starts in %s but ends in %s", n.Name, n.Pos, s, body))
+		}
+	}
+	alt := s
+	if len(n.Else) > 0 {
+		if alt, err = g.htmlNodesEnd(start, n.Else); err != nil {
+			return s, s, err
+		}
+	}
+	end, ok := joinJS(body, alt)
+	if !ok {
+		return s, s, hexerr.New(fmt.Sprintf("contextual escaping: {{#%s}} at %s: branches end in different HTML contexts (%s, %s)", n.Name, n.Pos, body, alt))
+	}
+	return start, end, nil
+}
+
+// joinJS returns a and whether a and b are the same state, but for what a JavaScript '/'
+// starts after them: where that differs, it is unknown in the result.
+func joinJS(a, b htmlState) (htmlState, bool) {
+	if a.js != b.js {
+		a.js, b.js = jsCtxUnknown, jsCtxUnknown
+	}
+	return a, a == b
+}
+
+// repeatsBody reports whether the body of n may be rendered more than once: {{#each}} and
+// block helpers (as decided by emitBlock), but not {{#if}}, {{#with}} or universal sections.
+func (g *generator) repeatsBody(n *ast.Block) bool {
+	if n.Name == "each" {
+		return true
+	}
+	if builtinBlockNames[n.Name] {
+		return false
+	}
+	if _, ok := g.helpers[n.Name]; ok {
+		return true
+	}
+	return g.runtimeHelpers && runtimeHelperName(n.Name) && strings.TrimSpace(n.Args) != ""
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isTagNameByte(c byte, first bool) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+		return true
+	}
+	return !first && (c >= '0' && c <= '9' || c == '-' || c == ':')
+}
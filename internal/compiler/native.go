@@ -0,0 +1,277 @@
+package compiler
+
+import (
+	"fmt"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// coercion is how a template value is converted to a native helper parameter.
+type coercion int
+
+const (
+	coerceAny coercion = iota // passed through (parameter of type any)
+	coerceString
+	coerceBool
+	coerceInt
+	coerceUint
+	coerceFloat
+	coerceTime
+)
+
+// nativeParam is one positional parameter of a native helper (the element type for a variadic one).
+type nativeParam struct {
+	conv     coercion
+	bits     int    // for coerceInt/coerceUint
+	typeExpr string // Go type in the generated file ("int", "mypkg.Level"); "" for coerceAny/coerceTime
+}
+
+// nativeSig describes a helper with an ordinary Go signature, e.g. func(s string, n int) string.
+type nativeSig struct {
+	params   []nativeParam
+	variadic bool // last param is variadic
+	hash     bool // trailing runtime.Hash parameter
+	options  bool // trailing runtime.BlockOptions parameter (block helper)
+	value    bool // returns a value (first result)
+	err      bool // returns an error (last result)
+	display  string
+}
+
+// needsTimeImport reports whether the adapter names time.Time (a variadic time.Time parameter).
+func (ns *nativeSig) needsTimeImport() bool {
+	return ns.variadic && ns.params[len(ns.params)-1].conv == coerceTime
+}
+
+// typeQualifier returns the name a package is referred to by in the generated file.
+type typeQualifier func(pkg *types.Package) (string, bool)
+
+// parseNativeSig checks that every parameter of sig can be coerced from a template value.
+// On failure it returns a reason suitable for an error message.
+func parseNativeSig(sig *types.Signature, runtimeImport string, qualify typeQualifier) (*nativeSig, string) {
+	if sig.TypeParams().Len() > 0 {
+		return nil, "generic helpers are not supported"
+	}
+	ns := &nativeSig{variadic: sig.Variadic(), display: sig.String()}
+	params := sig.Params()
+	n := params.Len()
+	if !ns.variadic && n > 0 && isRuntimeType(params.At(n-1).Type(), runtimeImport, "BlockOptions") {
+		ns.options = true
+		n--
+	}
+	if !ns.variadic && n > 0 && isRuntimeType(params.At(n-1).Type(), runtimeImport, "Hash") {
+		ns.hash = true
+		n--
+	}
+	for i := 0; i < n; i++ {
+		t := params.At(i).Type()
+		if ns.variadic && i == n-1 {
+			t = t.(*types.Slice).Elem()
+		}
+		p, ok := nativeParamFor(t, qualify)
+		if !ok {
+			return nil, fmt.Sprintf("parameter %d has unsupported type %s (supported: string, bool, integer and float kinds, time.Time, any, and a trailing runtime.Hash or runtime.BlockOptions)", i+1, t)
+		}
+		ns.params = append(ns.params, p)
+	}
+
+	results := sig.Results()
+	switch {
+	case ns.options:
+		if results.Len() != 1 || !isError(results.At(0).Type()) {
+			return nil, "block helpers with a runtime.BlockOptions parameter must return only error"
+		}
+		ns.err = true
+	case results.Len() == 1 && !isError(results.At(0).Type()):
+		ns.value = true
+	case results.Len() == 2 && isError(results.At(1).Type()):
+		ns.value, ns.err = true, true
+	default:
+		return nil, "helpers must return a value, or a value and an error"
+	}
+	return ns, ""
+}
+
+func nativeParamFor(t types.Type, qualify typeQualifier) (nativeParam, bool) {
+	t = types.Unalias(t)
+	if named, ok := t.(*types.Named); ok {
+		obj := named.Obj()
+		if obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			return nativeParam{conv: coerceTime}, true
+		}
+	}
+	if _, named := t.(*types.Named); !named && isEmptyInterface(t) {
+		return nativeParam{conv: coerceAny}, true
+	}
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return nativeParam{}, false
+	}
+	expr, ok := typeExprFor(t, qualify)
+	if !ok {
+		return nativeParam{}, false
+	}
+	p := nativeParam{typeExpr: expr}
+	switch basic.Kind() {
+	case types.String:
+		p.conv = coerceString
+	case types.Bool:
+		p.conv = coerceBool
+	case types.Int, types.Int64:
+		p.conv, p.bits = coerceInt, 64
+	case types.Int8:
+		p.conv, p.bits = coerceInt, 8
+	case types.Int16:
+		p.conv, p.bits = coerceInt, 16
+	case types.Int32:
+		p.conv, p.bits = coerceInt, 32
+	case types.Uint, types.Uint64, types.Uintptr:
+		p.conv, p.bits = coerceUint, 64
+	case types.Uint8:
+		p.conv, p.bits = coerceUint, 8
+	case types.Uint16:
+		p.conv, p.bits = coerceUint, 16
+	case types.Uint32:
+		p.conv, p.bits = coerceUint, 32
+	case types.Float32, types.Float64:
+		p.conv = coerceFloat
+	default:
+		return nativeParam{}, false
+	}
+	return p, true
+}
+
+// typeExprFor returns the Go expression for a basic or named type in the generated file.
+func typeExprFor(t types.Type, qualify typeQualifier) (string, bool) {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t.Name(), true
+	case *types.Named:
+		obj := t.Obj()
+		if obj.Pkg() == nil || t.TypeArgs().Len() > 0 {
+			return "", false
+		}
+		q, ok := qualify(obj.Pkg())
+		if !ok {
+			return "", false
+		}
+		if q == "" {
+			return obj.Name(), true
+		}
+		return q + "." + obj.Name(), true
+	}
+	return "", false
+}
+
+// emitNativeAdapter writes a function that adapts a native helper to runtime.Helper
+// (or runtime.BlockHelper when the helper takes runtime.BlockOptions).
+func emitNativeAdapter(w *codeWriter, adapter, name, helperExpr string, ns *nativeSig) {
+	fail := "return nil, "
+	w.line("// %s adapts %s (%s) for helper %q.", adapter, helperExpr, ns.display, name)
+	if ns.options {
+		fail = "return "
+		w.line("func %s(args []any, options runtime.BlockOptions) error {", adapter)
+	} else {
+		w.line("func %s(args []any) (any, error) {", adapter)
+	}
+	w.indentInc()
+	if ns.hash {
+		w.line("hash, _ := runtime.HashArg(args)")
+	}
+	w.line("args = runtime.PositionalArgs(args)")
+	want := len(ns.params)
+	if ns.variadic {
+		want--
+		w.line("if len(args) < %d {", want)
+	} else {
+		w.line("if len(args) != %d {", want)
+	}
+	w.indentInc()
+	w.line("%sruntime.ArityError(%q, %d, %v, len(args))", fail, name, want, ns.variadic)
+	w.indentDec()
+	w.line("}")
+
+	callArgs := make([]string, 0, len(ns.params)+2)
+	for i := 0; i < want; i++ {
+		v := "a" + strconv.Itoa(i)
+		emitCoercion(w, v, fmt.Sprintf("args[%d]", i), strconv.Itoa(i), ns.params[i], name, fail)
+		callArgs = append(callArgs, v)
+	}
+	if ns.variadic {
+		p := ns.params[want]
+		elemType := p.typeExpr
+		if p.conv == coerceTime {
+			elemType = "time.Time"
+		}
+		if p.conv == coerceAny {
+			callArgs = append(callArgs, fmt.Sprintf("args[%d:]...", want))
+		} else {
+			w.line("rest := make([]%s, 0, len(args)-%d)", elemType, want)
+			w.line("for i, v := range args[%d:] {", want)
+			w.indentInc()
+			emitCoercion(w, "x", "v", fmt.Sprintf("%d+i", want), p, name, fail)
+			w.line("rest = append(rest, x)")
+			w.indentDec()
+			w.line("}")
+			callArgs = append(callArgs, "rest...")
+		}
+	}
+	if ns.hash {
+		callArgs = append(callArgs, "hash")
+	}
+	if ns.options {
+		callArgs = append(callArgs, "options")
+	}
+	call := helperExpr + "(" + strings.Join(callArgs, ", ") + ")"
+	switch {
+	case ns.options || (ns.value && ns.err):
+		w.line("return %s", call)
+	default:
+		w.line("return %s, nil", call)
+	}
+	w.indentDec()
+	w.line("}")
+	w.line("")
+}
+
+// emitCoercion declares v holding src converted for parameter p; index is the 0-based argument index expression.
+func emitCoercion(w *codeWriter, v, src, index string, p nativeParam, name, fail string) {
+	argErr := func(typ string) {
+		w.line("if err != nil {")
+		w.indentInc()
+		w.line("%sruntime.ArgError(%q, %s, %q, err)", fail, name, index, typ)
+		w.indentDec()
+		w.line("}")
+	}
+	switch p.conv {
+	case coerceAny:
+		w.line("%s := %s", v, src)
+	case coerceString:
+		w.line("%s := %s", v, convertExpr(p.typeExpr, "string", "runtime.ToString("+src+")"))
+	case coerceBool:
+		w.line("%s := %s", v, convertExpr(p.typeExpr, "bool", "runtime.IsTruthy("+src+")"))
+	case coerceInt:
+		w.line("%sRaw, err := runtime.ToInt(%s, %d)", v, src, p.bits)
+		argErr(p.typeExpr)
+		w.line("%s := %s(%sRaw)", v, p.typeExpr, v)
+	case coerceUint:
+		w.line("%sRaw, err := runtime.ToUint(%s, %d)", v, src, p.bits)
+		argErr(p.typeExpr)
+		w.line("%s := %s(%sRaw)", v, p.typeExpr, v)
+	case coerceFloat:
+		w.line("%sRaw, err := runtime.ToFloat(%s)", v, src)
+		argErr(p.typeExpr)
+		w.line("%s := %s(%sRaw)", v, p.typeExpr, v)
+	case coerceTime:
+		w.line("%s, err := runtime.ToTime(%s)", v, src)
+		argErr("time.Time")
+	}
+}
+
+// convertExpr wraps value (of type from) in a conversion to typeExpr when the types differ.
+func convertExpr(typeExpr, from, value string) string {
+	if typeExpr == from {
+		return value
+	}
+	return typeExpr + "(" + value + ")"
+}
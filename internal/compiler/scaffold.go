@@ -0,0 +1,176 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/internal/ast"
+	"github.com/andriyg76/go-hbars/internal/parser"
+	"github.com/andriyg76/hexerr"
+)
+
+// ScaffoldOptions configures ScaffoldData.
+type ScaffoldOptions struct {
+	// Helpers are the helper names known to the compiler; they are not treated as context paths.
+	Helpers map[string]HelperRef
+	// Items is the number of sample elements emitted for each {{#each}} collection (default 2).
+	Items int
+	// Output is the _page.output value (default: template name + ".html").
+	Output string
+	// MissingHelpers is the Options.MissingHelpers policy the templates are compiled with.
+	MissingHelpers string
+}
+
+// ScaffoldData builds a skeleton data file for the named template from its inferred context tree.
+// Paths used by the template and the partials it includes get placeholder values (the path itself),
+// {{#each}} collections get opts.Items sample elements, @root paths are included, and a _page section
+// is added so that processor.ExtractPageConfig accepts the result. _shared paths are left out:
+// processor.MergeSharedData replaces the page's _shared key with the shared data directory, so they
+// belong there (see ScaffoldSharedData).
+func ScaffoldData(templates map[string]string, name string, opts ScaffoldOptions) (map[string]any, error) {
+	out, err := scaffold(templates, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	delete(out, "_shared")
+	output := opts.Output
+	if output == "" {
+		output = name + ".html"
+	}
+	out["_page"] = map[string]any{
+		"template": name,
+		"output":   output,
+	}
+	return out, nil
+}
+
+// ScaffoldSharedData builds the skeleton of the shared data the named template uses: one entry per
+// file of the shared data directory, keyed by the file name without extension (_shared.site.title
+// is "title" in site.json). It is empty when the template does not use _shared.
+func ScaffoldSharedData(templates map[string]string, name string, opts ScaffoldOptions) (map[string]any, error) {
+	out, err := scaffold(templates, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	shared, _ := out["_shared"].(map[string]any)
+	if shared == nil {
+		shared = make(map[string]any)
+	}
+	return shared, nil
+}
+
+// scaffold builds the skeleton of the named template's whole context, _shared included.
+func scaffold(templates map[string]string, name string, opts ScaffoldOptions) (map[string]any, error) {
+	if _, ok := templates[name]; !ok {
+		return nil, hexerr.New(fmt.Sprintf("compiler: template %q not found", name))
+	}
+	parsed := make(map[string][]ast.Node, len(templates))
+	for tmplName, tmpl := range templates {
+		nodes, err := parser.Parse(tmpl)
+		if err != nil {
+			return nil, hexerr.Wrapf(err, "compiler: template %q", tmplName)
+		}
+		parsed[tmplName] = nodes
+	}
+	helperExprs := make(map[string]string, len(opts.Helpers))
+	blockContexts := make(map[string]string)
+	for helperName, ref := range opts.Helpers {
+		helperExprs[helperName] = ref.Ident
+		if ref.Options {
+			blockContexts[helperName] = ref.BlockContext
+		}
+	}
+	runtimeHelpers, err := missingHelpersPolicy(opts.MissingHelpers)
+	if err != nil {
+		return nil, err
+	}
+	col := newPathCollector(helperExprs)
+	col.setParsed(parsed)
+	col.setBlockContexts(blockContexts)
+	col.runtimeHelpers = runtimeHelpers
+	if err := col.collectNodes(parsed[name]); err != nil {
+		return nil, hexerr.Wrapf(err, "compiler: template %q context inference", name)
+	}
+	paths := make(map[string]bool, len(col.paths)+len(col.rootPaths))
+	for p := range col.paths {
+		paths[p] = true
+	}
+	for p := range col.rootPaths {
+		paths[p] = true
+	}
+	tree := buildTypeTree(paths, col.eachFields)
+
+	items := opts.Items
+	if items <= 0 {
+		items = 2
+	}
+	s := scaffolder{collections: col.collections, items: items}
+	return s.object(tree, ""), nil
+}
+
+type scaffolder struct {
+	collections map[string]bool
+	items       int
+}
+
+// object returns a map with one entry per field of n; path is the dotted path of n ("" at root).
+func (s scaffolder) object(n *typeNode, path string) map[string]any {
+	out := make(map[string]any)
+	if n == nil {
+		return out
+	}
+	names := make([]string, 0, len(n.fields))
+	for f := range n.fields {
+		if f == "" || f[0] == '@' || f[0] == '.' || f == "this" {
+			continue
+		}
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	for _, field := range names {
+		sub := field
+		if path != "" {
+			sub = path + "." + field
+		}
+		setDotted(out, field, s.value(n.fields[field], sub))
+	}
+	return out
+}
+
+func (s scaffolder) value(n *typeNode, path string) any {
+	switch {
+	case n != nil && n.isSlice:
+		list := make([]any, s.items)
+		for i := range list {
+			list[i] = s.object(n.sliceElem, fmt.Sprintf("%s[%d]", path, i))
+		}
+		return list
+	case n != nil && len(n.fields) > 0:
+		return s.object(n, path)
+	case s.collections[path]:
+		list := make([]any, s.items)
+		for i := range list {
+			list[i] = fmt.Sprintf("%s[%d]", path, i)
+		}
+		return list
+	default:
+		return path
+	}
+}
+
+// setDotted stores v in m under key; element fields inferred inside {{#each}} may be dotted
+// (e.g. "customer.name"), in which case nested maps are created.
+func setDotted(m map[string]any, key string, v any) {
+	parts := strings.Split(key, ".")
+	cur := m
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			cur[p] = next
+		}
+		cur = next
+	}
+	cur[parts[len(parts)-1]] = v
+}
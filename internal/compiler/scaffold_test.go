@@ -0,0 +1,81 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScaffoldData(t *testing.T) {
+	data, err := ScaffoldData(map[string]string{
+		"main":   "{{title}} {{#with user}}{{name}}{{/with}}{{#each orders as |o|}}{{o.id}} {{o.customer.name}}{{/each}}{{#each tags}}{{this}}{{/each}}{{@root._shared.site.title}}{{> footer}}",
+		"footer": "{{note}}",
+	}, "main", ScaffoldOptions{Items: 1})
+	if err != nil {
+		t.Fatalf("ScaffoldData error: %v", err)
+	}
+	want := map[string]any{
+		"_page": map[string]any{"template": "main", "output": "main.html"},
+		"title": "title",
+		"note":  "note",
+		"user":  map[string]any{"name": "user.name"},
+		"orders": []any{
+			map[string]any{
+				"id":       "orders[0].id",
+				"customer": map[string]any{"name": "orders[0].customer.name"},
+			},
+		},
+		"tags": []any{"tags[0]"},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Fatalf("ScaffoldData =\n%#v\nwant\n%#v", data, want)
+	}
+}
+
+func TestScaffoldSharedData(t *testing.T) {
+	templates := map[string]string{
+		"main": "{{title}}{{@root._shared.site.title}}{{#each _shared.nav.items as |i|}}{{i.label}}{{/each}}",
+		"bare": "{{title}}",
+	}
+	shared, err := ScaffoldSharedData(templates, "main", ScaffoldOptions{Items: 1})
+	if err != nil {
+		t.Fatalf("ScaffoldSharedData error: %v", err)
+	}
+	want := map[string]any{
+		"site": map[string]any{"title": "_shared.site.title"},
+		"nav":  map[string]any{"items": []any{map[string]any{"label": "_shared.nav.items[0].label"}}},
+	}
+	if !reflect.DeepEqual(shared, want) {
+		t.Fatalf("ScaffoldSharedData =\n%#v\nwant\n%#v", shared, want)
+	}
+	if shared, err := ScaffoldSharedData(templates, "bare", ScaffoldOptions{}); err != nil || len(shared) != 0 {
+		t.Errorf("ScaffoldSharedData without _shared = %#v, %v", shared, err)
+	}
+}
+
+func TestScaffoldData_HelpersAndOutput(t *testing.T) {
+	data, err := ScaffoldData(map[string]string{
+		"page": "{{upper name}}",
+	}, "page", ScaffoldOptions{
+		Helpers: map[string]HelperRef{"upper": {Ident: "Upper"}},
+		Output:  "index.html",
+	})
+	if err != nil {
+		t.Fatalf("ScaffoldData error: %v", err)
+	}
+	if _, ok := data["upper"]; ok {
+		t.Fatalf("helper name must not become a data key: %#v", data)
+	}
+	if data["name"] != "name" {
+		t.Fatalf("name = %#v", data["name"])
+	}
+	page := data["_page"].(map[string]any)
+	if page["output"] != "index.html" || page["template"] != "page" {
+		t.Fatalf("_page = %#v", page)
+	}
+}
+
+func TestScaffoldData_UnknownTemplate(t *testing.T) {
+	if _, err := ScaffoldData(map[string]string{"main": "x"}, "other", ScaffoldOptions{}); err == nil {
+		t.Fatal("expected error for unknown template")
+	}
+}
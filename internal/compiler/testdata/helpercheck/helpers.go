@@ -0,0 +1,102 @@
+// Package helpercheck declares helpers with valid and invalid signatures for LoadHelperTypes tests.
+package helpercheck
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+// Shout is a runtime.Helper.
+func Shout(args []any) (any, error) {
+	return strings.ToUpper(runtime.Stringify(args[0])), nil
+}
+
+// Repeat is a runtime.BlockHelper.
+func Repeat(args []any, options runtime.BlockOptions) error {
+	return options.Fn(nil)
+}
+
+// Legacy is a block helper that receives BlockOptions as its last arg.
+func Legacy(args []any) error {
+	return nil
+}
+
+// Wrong is a native value helper; it cannot be used as a block.
+func Wrong(s string) string {
+	return s
+}
+
+// NotFunc is not a function.
+var NotFunc = 3
+
+// Pad is a native helper: it right-pads s with dots to width.
+func Pad(s string, width int) string {
+	for len(s) < width {
+		s += "."
+	}
+	return s
+}
+
+// Day is a native helper returning an error.
+func Day(t time.Time, layout string) (string, error) {
+	return t.Format(layout), nil
+}
+
+// Sum is a variadic native helper.
+func Sum(nums ...float64) float64 {
+	total := 0.0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// Greet is a native helper with a trailing hash.
+func Greet(name string, hash runtime.Hash) string {
+	greeting, _ := hash["greeting"].(string)
+	if greeting == "" {
+		greeting = "Hello"
+	}
+	return greeting + ", " + name
+}
+
+// Times is a native block helper.
+func Times(n int, options runtime.BlockOptions) error {
+	return nil
+}
+
+// Level is a named integer type from the helper package.
+type Level int8
+
+// LevelName is a native helper taking a named type.
+func LevelName(l Level) string {
+	return [...]string{"low", "mid", "high"}[l]
+}
+
+// Chan has an unsupported parameter type.
+func Chan(ch chan int) string {
+	return ""
+}
+
+// Describe is a runtime.OptionsHelper.
+func Describe(args []any, options *runtime.HelperOptions) (any, error) {
+	return options.Name + "@" + options.Template, nil
+}
+
+// Twice is a runtime.OptionsBlockHelper.
+func Twice(w io.Writer, args []any, options *runtime.HelperOptions) error {
+	for i := 0; i < 2; i++ {
+		if err := options.Fn(w, options.Context, runtime.NewDataFrame(options.Data).Set("index", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BadOptions takes *runtime.HelperOptions but is neither options helper form.
+func BadOptions(args []any, options *runtime.HelperOptions) error {
+	return nil
+}
@@ -0,0 +1,17 @@
+package parser
+
+import "regexp"
+
+// escapeAnnotation matches a {{!-- escape: mode --}} (or {{! escape: mode }}) comment at the
+// start of a template.
+var escapeAnnotation = regexp.MustCompile(`^\s*\{\{~?!(?:--)?\s*escape:\s*([^}]*?)\s*(?:--)?~?\}\}`)
+
+// EscapeAnnotation returns the output mode named by the {{!-- escape: mode --}} comment that
+// starts src, if there is one. The mode is not validated.
+func EscapeAnnotation(src string) (string, bool) {
+	m := escapeAnnotation.FindStringSubmatch(src)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
@@ -0,0 +1,270 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andriyg76/hexerr"
+)
+
+// ExprKind is the kind of an expression part.
+type ExprKind int
+
+// Expression kinds.
+const (
+	ExprPath ExprKind = iota
+	ExprString
+	ExprNumber
+	ExprBool
+	ExprNull
+	ExprCall
+)
+
+// Expr is one part of a mustache expression: a path, a literal or a subexpression (ExprCall).
+type Expr struct {
+	Kind  ExprKind
+	Value string    // path, literal text ("true"/"false" for ExprBool)
+	Name  string    // ExprCall: helper name
+	Args  []Expr    // ExprCall: positional arguments
+	Hash  []HashArg // ExprCall: hash arguments
+}
+
+// HashArg is a key=value argument.
+type HashArg struct {
+	Key   string
+	Value Expr
+}
+
+// ParseExpr parses the inside of a mustache, block opening or partial call (e.g.
+// `helper a "b" (sub c) key=d`) into its positional parts and hash arguments.
+func ParseExpr(input string) ([]Expr, []HashArg, error) {
+	tokens, err := tokenizeExpr(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := exprParser{tokens: tokens}
+	parts, hash, err := p.parseParts(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.hasNext() {
+		return nil, nil, hexerr.New(fmt.Sprintf("unexpected token %q", p.peek().value))
+	}
+	return parts, hash, nil
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) hasNext() bool {
+	return p.pos < len(p.tokens)
+}
+
+func (p *exprParser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{typ: tokEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) peekNext() token {
+	if p.pos+1 >= len(p.tokens) {
+		return token{typ: tokEOF}
+	}
+	return p.tokens[p.pos+1]
+}
+
+func (p *exprParser) next() token {
+	if p.pos >= len(p.tokens) {
+		return token{typ: tokEOF}
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+func (p *exprParser) parseParts(stopAtRParen bool) ([]Expr, []HashArg, error) {
+	var parts []Expr
+	var hash []HashArg
+	for p.hasNext() {
+		if p.peek().typ == tokRParen {
+			if stopAtRParen {
+				return parts, hash, nil
+			}
+			return nil, nil, hexerr.New("unexpected )")
+		}
+		if p.peek().typ == tokEquals {
+			return nil, nil, hexerr.New("unexpected =")
+		}
+		if p.peek().typ == tokWord && p.peekNext().typ == tokEquals {
+			key := p.next().value
+			p.next()
+			if key == "" {
+				return nil, nil, hexerr.New("empty hash key")
+			}
+			value, err := p.parseExpr()
+			if err != nil {
+				return nil, nil, err
+			}
+			hash = append(hash, HashArg{Key: key, Value: value})
+			continue
+		}
+		part, err := p.parseExpr()
+		if err != nil {
+			return nil, nil, err
+		}
+		parts = append(parts, part)
+	}
+	if stopAtRParen {
+		return nil, nil, hexerr.New("missing )")
+	}
+	return parts, hash, nil
+}
+
+func (p *exprParser) parseExpr() (Expr, error) {
+	tok := p.next()
+	switch tok.typ {
+	case tokWord:
+		return classifyWord(tok.value), nil
+	case tokString:
+		return Expr{Kind: ExprString, Value: tok.value}, nil
+	case tokLParen:
+		return p.parseSubexpr()
+	case tokRParen:
+		return Expr{}, hexerr.New("unexpected )")
+	case tokEquals:
+		return Expr{}, hexerr.New("unexpected =")
+	case tokEOF:
+		return Expr{}, hexerr.New("unexpected end of expression")
+	default:
+		return Expr{}, hexerr.New("unexpected token")
+	}
+}
+
+func (p *exprParser) parseSubexpr() (Expr, error) {
+	parts, hash, err := p.parseParts(true)
+	if err != nil {
+		return Expr{}, err
+	}
+	if !p.hasNext() || p.peek().typ != tokRParen {
+		return Expr{}, hexerr.New("missing )")
+	}
+	p.next()
+	if len(parts) == 0 {
+		return Expr{}, hexerr.New("empty subexpression")
+	}
+	if len(parts) == 1 && len(hash) == 0 {
+		return parts[0], nil
+	}
+	if parts[0].Kind != ExprPath {
+		return Expr{}, hexerr.New("subexpression must start with a helper name")
+	}
+	return Expr{
+		Kind: ExprCall,
+		Name: parts[0].Value,
+		Args: parts[1:],
+		Hash: hash,
+	}, nil
+}
+
+func classifyWord(value string) Expr {
+	lower := strings.ToLower(value)
+	switch lower {
+	case "true", "false":
+		return Expr{Kind: ExprBool, Value: lower}
+	case "null", "nil":
+		return Expr{Kind: ExprNull}
+	default:
+		if isNumber(value) {
+			return Expr{Kind: ExprNumber, Value: value}
+		}
+		return Expr{Kind: ExprPath, Value: value}
+	}
+}
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokWord
+	tokString
+	tokLParen
+	tokRParen
+	tokEquals
+)
+
+type token struct {
+	typ   tokenType
+	value string
+}
+
+func tokenizeExpr(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		for i < len(input) && isSpace(input[i]) {
+			i++
+		}
+		if i >= len(input) {
+			break
+		}
+		switch input[i] {
+		case '(':
+			tokens = append(tokens, token{typ: tokLParen, value: "("})
+			i++
+		case ')':
+			tokens = append(tokens, token{typ: tokRParen, value: ")"})
+			i++
+		case '=':
+			tokens = append(tokens, token{typ: tokEquals, value: "="})
+			i++
+		case '"', '\'':
+			quote := input[i]
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(input) {
+				ch := input[i]
+				if ch == '\\' && i+1 < len(input) {
+					next := input[i+1]
+					if next == quote || next == '\\' {
+						sb.WriteByte(next)
+						i += 2
+						continue
+					}
+				}
+				if ch == quote {
+					i++
+					closed = true
+					break
+				}
+				sb.WriteByte(ch)
+				i++
+			}
+			if !closed {
+				return nil, hexerr.New("unclosed string literal")
+			}
+			tokens = append(tokens, token{typ: tokString, value: sb.String()})
+		default:
+			start := i
+			for i < len(input) && !isSpace(input[i]) && input[i] != '(' && input[i] != ')' && input[i] != '=' {
+				i++
+			}
+			tokens = append(tokens, token{typ: tokWord, value: input[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+// isNumber reports whether value is a number literal. As in handlebars.js, it starts with a
+// digit or a minus and a digit: names ParseFloat accepts, such as NaN and Inf, are paths.
+func isNumber(value string) bool {
+	digits := strings.TrimPrefix(value, "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
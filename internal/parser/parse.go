@@ -43,7 +43,7 @@ func parseUntilStop(input string, start int, endBlock string) ([]ast.Node, int,
 		open := strings.Index(input[i:], "{{")
 		if open < 0 {
 			if i < len(input) {
-				nodes = append(nodes, &ast.Text{Value: input[i:]})
+				nodes = append(nodes, &ast.Text{Pos: posAt(input, i), Value: input[i:]})
 			}
 			if endBlock != "" {
 				return nil, 0, stopNone, hexerr.New(fmt.Sprintf("parser: unclosed block %q", endBlock))
@@ -52,7 +52,7 @@ func parseUntilStop(input string, start int, endBlock string) ([]ast.Node, int,
 		}
 		open += i
 		if open > i {
-			nodes = append(nodes, &ast.Text{Value: input[i:open]})
+			nodes = append(nodes, &ast.Text{Pos: posAt(input, i), Value: input[i:open]})
 		}
 
 		if strings.HasPrefix(input[open:], "{{{{") {
@@ -165,6 +165,7 @@ func parseUntilStop(input string, start int, endBlock string) ([]ast.Node, int,
 				return nil, 0, stopNone, err
 			}
 			nodes = append(nodes, &ast.Block{
+				Pos:    posAt(input, open),
 				Name:   name,
 				Args:   args,
 				Params: params,
@@ -179,10 +180,10 @@ func parseUntilStop(input string, start int, endBlock string) ([]ast.Node, int,
 			if rest == "" {
 				return nil, 0, stopNone, hexerr.New("parser: empty partial name")
 			}
-			nodes = append(nodes, &ast.Partial{Expr: rest})
+			nodes = append(nodes, &ast.Partial{Pos: posAt(input, open), Expr: rest})
 			continue
 		}
-		nodes = append(nodes, &ast.Mustache{Expr: content, Raw: raw})
+		nodes = append(nodes, &ast.Mustache{Pos: posAt(input, open), Expr: content, Raw: raw})
 	}
 	if endBlock != "" {
 		return nil, 0, stopNone, hexerr.New(fmt.Sprintf("parser: unclosed block %q", endBlock))
@@ -219,13 +220,13 @@ func parseElseBranch(input string, start int, endBlock string) ([]ast.Node, int,
 		open := strings.Index(input[i:], "{{")
 		if open < 0 {
 			if i < len(input) {
-				nodes = append(nodes, &ast.Text{Value: input[i:]})
+				nodes = append(nodes, &ast.Text{Pos: posAt(input, i), Value: input[i:]})
 			}
 			return nodes, len(input), stopNone, hexerr.New(fmt.Sprintf("parser: unclosed else branch in block %q", endBlock))
 		}
 		open += i
 		if open > i {
-			nodes = append(nodes, &ast.Text{Value: input[i:open]})
+			nodes = append(nodes, &ast.Text{Pos: posAt(input, i), Value: input[i:open]})
 		}
 
 		contentStart := open + 2
@@ -257,6 +258,7 @@ func parseElseBranch(input string, start int, endBlock string) ([]ast.Node, int,
 					return nil, 0, stopNone, hexerr.New("parser: unclosed else if block")
 				}
 				nodes = append(nodes, &ast.Block{
+					Pos:  posAt(input, open),
 					Name: "if",
 					Args: cond,
 					Body: ifBody,
@@ -269,6 +271,7 @@ func parseElseBranch(input string, start int, endBlock string) ([]ast.Node, int,
 				return nil, 0, stopNone, hexerr.New("parser: unclosed else if block")
 			}
 			nodes = append(nodes, &ast.Block{
+				Pos:  posAt(input, open),
 				Name: "if",
 				Args: cond,
 				Body: ifBody,
@@ -298,6 +301,7 @@ func parseElseBranch(input string, start int, endBlock string) ([]ast.Node, int,
 					return nil, 0, stopNone, hexerr.New("parser: unclosed elseif block")
 				}
 				nodes = append(nodes, &ast.Block{
+					Pos:  posAt(input, open),
 					Name: "if",
 					Args: cond,
 					Body: ifBody,
@@ -310,6 +314,7 @@ func parseElseBranch(input string, start int, endBlock string) ([]ast.Node, int,
 				return nil, 0, stopNone, hexerr.New("parser: unclosed elseif block")
 			}
 			nodes = append(nodes, &ast.Block{
+				Pos:  posAt(input, open),
 				Name: "if",
 				Args: cond,
 				Body: ifBody,
@@ -499,7 +504,7 @@ func parseRawBlock(input string, open int, nodes *[]ast.Node) (int, error) {
 		return 0, hexerr.New(fmt.Sprintf("parser: expected /%s, got /%s", name, closeContent))
 	}
 	if closeStart > bodyStart {
-		*nodes = append(*nodes, &ast.Text{Value: input[bodyStart:closeStart]})
+		*nodes = append(*nodes, &ast.Text{Pos: posAt(input, bodyStart), Value: input[bodyStart:closeStart]})
 	}
 	next := closeTagStart + closeEnd + len("}}}}")
 	if trimRight {
@@ -508,6 +513,17 @@ func parseRawBlock(input string, open int, nodes *[]ast.Node) (int, error) {
 	return next, nil
 }
 
+// posAt returns the 1-based line and column (in bytes) of offset in input.
+func posAt(input string, offset int) ast.Pos {
+	if offset > len(input) {
+		offset = len(input)
+	}
+	before := input[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := offset - strings.LastIndexByte(before, '\n')
+	return ast.Pos{Line: line, Col: col}
+}
+
 func stopLabel(stop stopKind, endBlock string) string {
 	switch stop {
 	case stopElse:
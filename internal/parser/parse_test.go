@@ -109,6 +109,27 @@ func TestParseRawBlock(t *testing.T) {
 	assertText(t, nodes[2], "!")
 }
 
+func TestParsePositions(t *testing.T) {
+	input := "Hi\n  {{name}}\n{{#if ok}}\n{{> footer}}{{/if}}"
+	nodes, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("expected 4 nodes, got %d", len(nodes))
+	}
+	want := []ast.Pos{{Line: 1, Col: 1}, {Line: 2, Col: 3}, {Line: 2, Col: 11}, {Line: 3, Col: 1}}
+	for i, pos := range want {
+		if got := nodes[i].Position(); got != pos {
+			t.Fatalf("node %d position = %s, want %s", i, got, pos)
+		}
+	}
+	block := assertBlock(t, nodes[3], "if", "ok", nil)
+	if got := block.Body[1].Position(); got != (ast.Pos{Line: 4, Col: 1}) {
+		t.Fatalf("partial position = %s, want 4:1", got)
+	}
+}
+
 func TestParseErrors(t *testing.T) {
 	if _, err := Parse("{{!--"); err == nil {
 		t.Fatalf("expected unclosed comment error")
@@ -139,6 +160,59 @@ func TestParseErrors(t *testing.T) {
 	}
 }
 
+func TestParseExpr(t *testing.T) {
+	parts, hash, err := ParseExpr(`helper user.name "a b" 1.5 true null (lower title) key=(upper x) n=2`)
+	if err != nil {
+		t.Fatalf("ParseExpr: %v", err)
+	}
+	kinds := []ExprKind{ExprPath, ExprPath, ExprString, ExprNumber, ExprBool, ExprNull, ExprCall}
+	if len(parts) != len(kinds) {
+		t.Fatalf("parts = %+v", parts)
+	}
+	for i, kind := range kinds {
+		if parts[i].Kind != kind {
+			t.Fatalf("part %d = %+v, want kind %d", i, parts[i], kind)
+		}
+	}
+	if parts[2].Value != "a b" || parts[3].Value != "1.5" {
+		t.Fatalf("literals = %+v, %+v", parts[2], parts[3])
+	}
+	if call := parts[6]; call.Name != "lower" || len(call.Args) != 1 || call.Args[0].Value != "title" {
+		t.Fatalf("subexpression = %+v", call)
+	}
+	if len(hash) != 2 || hash[0].Key != "key" || hash[0].Value.Kind != ExprCall || hash[1].Key != "n" || hash[1].Value.Value != "2" {
+		t.Fatalf("hash = %+v", hash)
+	}
+	if _, _, err := ParseExpr(`a "unclosed`); err == nil {
+		t.Fatalf("expected unclosed string error")
+	}
+	// Names that ParseFloat reads as numbers are paths, as in handlebars.js.
+	parts, _, err = ParseExpr(`f nan Inf infinity -1 -x`)
+	if err != nil {
+		t.Fatalf("ParseExpr: %v", err)
+	}
+	for i, kind := range []ExprKind{ExprPath, ExprPath, ExprPath, ExprPath, ExprNumber, ExprPath} {
+		if parts[i].Kind != kind {
+			t.Fatalf("part %d = %+v, want kind %d", i, parts[i], kind)
+		}
+	}
+}
+
+func TestEscapeAnnotation(t *testing.T) {
+	for src, want := range map[string]string{
+		"{{!-- escape: csv --}}{{a}}": "csv",
+		"  {{! escape: text }}\n":     "text",
+		"{{~!-- escape: x ml --~}}":   "x ml",
+	} {
+		if got, ok := EscapeAnnotation(src); !ok || got != want {
+			t.Errorf("EscapeAnnotation(%q) = %q, %v, want %q", src, got, ok, want)
+		}
+	}
+	if _, ok := EscapeAnnotation("{{a}}{{!-- escape: csv --}}"); ok {
+		t.Errorf("annotation after the start of the template was found")
+	}
+}
+
 func assertText(t *testing.T, node ast.Node, value string) {
 	t.Helper()
 	text, ok := node.(*ast.Text)
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/andriyg76/go-hbars/runtime"
 	"github.com/andriyg76/hexerr"
 	"github.com/pelletier/go-toml/v2"
 	"gopkg.in/yaml.v3"
@@ -14,6 +15,18 @@ import (
 
 // LoadDataFile loads and parses a data file (JSON, YAML, or TOML).
 func LoadDataFile(path string) (map[string]any, error) {
+	return loadDataFile(path, false)
+}
+
+// LoadOrderedDataFile is LoadDataFile with the objects nested in the file loaded as
+// *runtime.OrderedMap values, so {{#each}} iterates them in the order their keys appear in the
+// file. Code reading the data must use runtime.MapOf or runtime.LookupPath instead of
+// asserting map[string]any.
+func LoadOrderedDataFile(path string) (map[string]any, error) {
+	return loadDataFile(path, true)
+}
+
+func loadDataFile(path string, ordered bool) (map[string]any, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, hexerr.Wrapf(err, "failed to read file %q", path)
@@ -21,25 +34,38 @@ func LoadDataFile(path string) (map[string]any, error) {
 
 	ext := strings.ToLower(filepath.Ext(path))
 	var result map[string]any
+	var order keyOrder
 
 	switch ext {
 	case ".json", ".json5":
 		if err := json.Unmarshal(data, &result); err != nil {
 			return nil, hexerr.Wrapf(err, "failed to parse JSON file %q", path)
 		}
+		if ordered {
+			order = jsonKeyOrder(data)
+		}
 	case ".yaml", ".yml":
 		if err := yaml.Unmarshal(data, &result); err != nil {
 			return nil, hexerr.Wrapf(err, "failed to parse YAML file %q", path)
 		}
+		if ordered {
+			order = yamlKeyOrder(data)
+		}
 	case ".toml":
 		if err := toml.Unmarshal(data, &result); err != nil {
 			return nil, hexerr.Wrapf(err, "failed to parse TOML file %q", path)
 		}
+		if ordered {
+			order = tomlKeyOrder(data)
+		}
 	default:
 		return nil, hexerr.New(fmt.Sprintf("unsupported file format: %q (supported: .json, .yaml, .yml, .toml)", ext))
 	}
 
-	return result, nil
+	if !ordered {
+		return result, nil
+	}
+	return order.orderedMap(result, nil), nil
 }
 
 // PageConfig represents the _page configuration section.
@@ -56,7 +82,7 @@ func ExtractPageConfig(data map[string]any) (*PageConfig, error) {
 	}
 
 	// Convert to map for easier handling
-	pageMap, ok := pageRaw.(map[string]any)
+	pageMap, ok := runtime.RawValue(pageRaw).(map[string]any)
 	if !ok {
 		return nil, hexerr.New("_page section must be an object")
 	}
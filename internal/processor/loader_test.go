@@ -3,7 +3,10 @@ package processor
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/andriyg76/go-hbars/runtime"
 )
 
 func TestLoadDataFile_JSON(t *testing.T) {
@@ -84,3 +87,79 @@ func TestRemovePageConfig(t *testing.T) {
 	}
 }
 
+
+func TestLoadDataFile_KeyOrder(t *testing.T) {
+	files := map[string]string{
+		"page.json": `{"_page": {"template": "main", "output": "out.html"},
+			"settings": {"zeta": 1, "alpha": {"y": 1, "x": 2}, "mid": 3},
+			"items": [{"b": 1, "a": 2}, {"c": 3, "a": 4}]}`,
+		"page.yaml": `_page: {template: main, output: out.html}
+base: &base {mid: 3}
+settings:
+  zeta: 1
+  alpha: {y: 1, x: 2}
+  <<: *base
+items:
+  - {b: 1, a: 2}
+  - {c: 3, a: 4}
+`,
+		"page.toml": `[_page]
+template = "main"
+output = "out.html"
+
+[settings]
+zeta = 1
+alpha.y = 1
+alpha.x = 2
+mid = 3
+
+[[items]]
+b = 1
+a = 2
+
+[[items]]
+c = 3
+a = 4
+`,
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		plain, err := LoadDataFile(path)
+		if err != nil {
+			t.Fatalf("%s: LoadDataFile error: %v", name, err)
+		}
+		if _, ok := plain["settings"].(map[string]any); !ok {
+			t.Errorf("%s: LoadDataFile settings is %T, want map[string]any", name, plain["settings"])
+		}
+		data, err := LoadOrderedDataFile(path)
+		if err != nil {
+			t.Fatalf("%s: LoadOrderedDataFile error: %v", name, err)
+		}
+		keys := func(v any) string {
+			m, ok := v.(*runtime.OrderedMap)
+			if !ok {
+				t.Fatalf("%s: %T is not an OrderedMap", name, v)
+			}
+			return strings.Join(m.Keys(), ",")
+		}
+		settings := data["settings"]
+		items, _ := data["items"].([]any)
+		for _, tt := range []struct{ got, want string }{
+			{keys(settings), "zeta,alpha,mid"},
+			{keys(runtime.LookupPath(settings, "alpha")), "y,x"},
+			{keys(items[0]), "b,a"},
+			{keys(items[1]), "c,a"},
+		} {
+			if tt.got != tt.want {
+				t.Errorf("%s: keys %q, want %q", name, tt.got, tt.want)
+			}
+		}
+		if cfg, err := ExtractPageConfig(data); err != nil || cfg.Output != "out.html" {
+			t.Errorf("%s: ExtractPageConfig = %+v, %v", name, cfg, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/runtime"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// keyOrder records the keys of the objects of a data file in the order they first appear,
+// by object path. A path is the keys from the root, and the index of each array element on
+// the way (see index).
+type keyOrder map[string][]string
+
+// index returns the path element of the array element i; it is not a valid key in a data file.
+func index(i int) string {
+	return "\x01" + strconv.Itoa(i)
+}
+
+func (o keyOrder) add(path []string, key string) {
+	p := strings.Join(path, "\x00")
+	for _, k := range o[p] {
+		if k == key {
+			return
+		}
+	}
+	o[p] = append(o[p], key)
+}
+
+// addPath adds each key of a dotted key path under its parent.
+func (o keyOrder) addPath(path []string) {
+	for i := range path {
+		o.add(path[:i], path[i])
+	}
+}
+
+// ordered returns v with its maps (nested in maps and slices) converted to
+// *runtime.OrderedMap in the key order of o.
+func (o keyOrder) ordered(v any, path []string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		return runtime.OrderedMapOf(o.orderedMap(t, path), o[strings.Join(path, "\x00")])
+	case []any:
+		for i, item := range t {
+			t[i] = o.ordered(item, append(path[:len(path):len(path)], index(i)))
+		}
+	}
+	return v
+}
+
+// orderedMap converts the values of m in place and returns m.
+func (o keyOrder) orderedMap(m map[string]any, path []string) map[string]any {
+	for k, v := range m {
+		m[k] = o.ordered(v, append(path[:len(path):len(path)], k))
+	}
+	return m
+}
+
+// jsonKeyOrder returns the key order of a JSON document.
+func jsonKeyOrder(data []byte) keyOrder {
+	o := keyOrder{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var walk func(path []string) bool
+	walk = func(path []string) bool {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				tok, err := dec.Token()
+				if err != nil {
+					return false
+				}
+				key, _ := tok.(string)
+				o.add(path, key)
+				if !walk(append(path[:len(path):len(path)], key)) {
+					return false
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if !walk(append(path[:len(path):len(path)], index(i))) {
+					return false
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err == nil
+	}
+	walk(nil)
+	return o
+}
+
+// yamlKeyOrder returns the key order of a YAML document.
+func yamlKeyOrder(data []byte) keyOrder {
+	o := keyOrder{}
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil {
+		return o
+	}
+	var walk func(n *yaml.Node, path []string)
+	walk = func(n *yaml.Node, path []string) {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				walk(c, append(path[:len(path):len(path)], index(i)))
+			}
+		case yaml.AliasNode:
+			if n.Alias != nil {
+				walk(n.Alias, path)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, val := n.Content[i], n.Content[i+1]
+				if key.Tag == "!!merge" {
+					// "<<: *base" merges the keys of base here.
+					walk(val, path)
+					continue
+				}
+				o.add(path, key.Value)
+				walk(val, append(path[:len(path):len(path)], key.Value))
+			}
+		}
+	}
+	walk(&doc, nil)
+	return o
+}
+
+// tomlKeyOrder returns the key order of a TOML document.
+func tomlKeyOrder(data []byte) keyOrder {
+	o := keyOrder{}
+	keyOf := func(n *unstable.Node) []string {
+		var key []string
+		it := n.Key()
+		for it.Next() {
+			key = append(key, string(it.Node().Data))
+		}
+		return key
+	}
+	var value func(n *unstable.Node, path []string)
+	value = func(n *unstable.Node, path []string) {
+		switch n.Kind {
+		case unstable.InlineTable:
+			it := n.Children()
+			for it.Next() {
+				if kv := it.Node(); kv.Kind == unstable.KeyValue {
+					key := append(path[:len(path):len(path)], keyOf(kv)...)
+					o.addPath(key)
+					value(kv.Value(), key)
+				}
+			}
+		case unstable.Array:
+			it := n.Children()
+			for i := 0; it.Next(); i++ {
+				value(it.Node(), append(path[:len(path):len(path)], index(i)))
+			}
+		}
+	}
+	// arrays counts the elements of the arrays of tables ("[[items]]") by path; a key below one
+	// is in its last element.
+	arrays := map[string]int{}
+	resolve := func(key []string) []string {
+		var path []string
+		for _, k := range key {
+			path = append(path, k)
+			if n, ok := arrays[strings.Join(path, "\x00")]; ok {
+				path = append(path, index(n-1))
+			}
+		}
+		return path
+	}
+	var table []string
+	p := unstable.Parser{}
+	p.Reset(data)
+	for p.NextExpression() {
+		e := p.Expression()
+		switch e.Kind {
+		case unstable.Table:
+			table = resolve(keyOf(e))
+			o.addPath(table)
+		case unstable.ArrayTable:
+			key := keyOf(e)
+			parent := resolve(key[:len(key)-1])
+			array := append(parent, key[len(key)-1])
+			o.addPath(array)
+			n := arrays[strings.Join(array, "\x00")]
+			arrays[strings.Join(array, "\x00")] = n + 1
+			table = append(array, index(n))
+		case unstable.KeyValue:
+			key := append(table[:len(table):len(table)], keyOf(e)...)
+			o.addPath(key)
+			value(e.Value(), key)
+		}
+	}
+	return o
+}
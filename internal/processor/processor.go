@@ -1,6 +1,7 @@
 package processor
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,6 +16,9 @@ type Config struct {
 	DataPath   string
 	SharedPath string
 	OutputPath string
+	// KeepKeyOrder loads data and shared files with LoadOrderedDataFile, so {{#each}} over an
+	// object lists its keys in the order of the file instead of in sorted order.
+	KeepKeyOrder bool
 }
 
 // DefaultConfig returns a default configuration.
@@ -45,11 +49,17 @@ func (p *Processor) Config() *Config {
 	return p.config
 }
 
+// LoadSharedData loads the shared data directory dirPath as Process does: with
+// LoadOrderedSharedData when the configuration keeps key order, else with LoadSharedData.
+func (p *Processor) LoadSharedData(dirPath string) (map[string]any, error) {
+	return loadSharedData(dirPath, p.config.KeepKeyOrder)
+}
+
 // Process processes all data files and generates output files.
 func (p *Processor) Process() error {
 	// Load shared data
 	sharedPath := p.resolvePath(p.config.SharedPath)
-	sharedData, err := LoadSharedData(sharedPath)
+	sharedData, err := p.LoadSharedData(sharedPath)
 	if err != nil {
 		return hexerr.Wrapf(err, "failed to load shared data")
 	}
@@ -65,8 +75,14 @@ func (p *Processor) Process() error {
 
 // ProcessFile processes a single data file.
 func (p *Processor) ProcessFile(dataFilePath string, sharedData map[string]any) (string, []byte, error) {
+	return p.ProcessFileContext(context.Background(), dataFilePath, sharedData)
+}
+
+// ProcessFileContext is ProcessFile with the context of the render (see
+// renderer.RenderContext): a cancelled ctx stops the render.
+func (p *Processor) ProcessFileContext(ctx context.Context, dataFilePath string, sharedData map[string]any) (string, []byte, error) {
 	// Load page data
-	pageData, err := LoadDataFile(dataFilePath)
+	pageData, err := loadDataFile(dataFilePath, p.config.KeepKeyOrder)
 	if err != nil {
 		return "", nil, err
 	}
@@ -88,7 +104,7 @@ func (p *Processor) ProcessFile(dataFilePath string, sharedData map[string]any)
 
 	// Render template
 	var buf strings.Builder
-	if err := p.renderer.Render(pageConfig.Template, &buf, pageData); err != nil {
+	if err := renderer.RenderContext(ctx, p.renderer, pageConfig.Template, &buf, pageData); err != nil {
 		return "", nil, hexerr.Wrapf(err, "failed to render template %q", pageConfig.Template)
 	}
 
@@ -1,22 +1,29 @@
 package processor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
 	"strings"
 
+	"github.com/andriyg76/go-hbars/runtime"
 	"github.com/andriyg76/hexerr"
 )
 
 // CompiledTemplateRenderer renders templates using compiled template functions.
 // When created from a map[string]func(io.Writer, any) error (e.g. bootstrap rendererFuncs),
-// it calls functions directly without reflection. When created from a struct with Render*
+// it calls functions directly without reflection. When created from a
+// map[string]func(context.Context, io.Writer, any) error (bootstrap rendererContextFuncs),
+// RenderContext passes the context on. When created from a struct with Render*
 // methods, it uses reflection for discovery and for calling.
 type CompiledTemplateRenderer struct {
 	templatePackage reflect.Value
 	// funcs is set when using a map or RegisterRenderFunc; used for direct calls (no reflection).
 	funcs map[string]func(io.Writer, any) error
+	// ctxFuncs is set when using a map of context-aware functions; used by RenderContext.
+	ctxFuncs map[string]func(context.Context, io.Writer, any) error
 	// renderFuncs is set when using struct reflection; calls use reflect.Value.Call.
 	renderFuncs map[string]reflect.Value
 }
@@ -25,6 +32,7 @@ type CompiledTemplateRenderer struct {
 // templatePackage can be:
 //   - An instance of a struct with Render* methods (e.g., templates.Templates{})
 //   - A package-level function registry (map[string]func(io.Writer, any) error)
+//   - A registry of context-aware functions (map[string]func(context.Context, io.Writer, any) error)
 //   - nil, in which case you must register functions manually
 func NewCompiledTemplateRenderer(templatePackage any) (*CompiledTemplateRenderer, error) {
 	r := &CompiledTemplateRenderer{
@@ -43,6 +51,15 @@ func NewCompiledTemplateRenderer(templatePackage any) (*CompiledTemplateRenderer
 		for name, fn := range v {
 			r.funcs[normalizeTemplateName(name)] = fn
 		}
+	case map[string]func(context.Context, io.Writer, any) error:
+		r.funcs = make(map[string]func(io.Writer, any) error, len(v))
+		r.ctxFuncs = make(map[string]func(context.Context, io.Writer, any) error, len(v))
+		for name, fn := range v {
+			r.funcs[normalizeTemplateName(name)] = func(w io.Writer, data any) error {
+				return fn(context.Background(), w, data)
+			}
+			r.ctxFuncs[normalizeTemplateName(name)] = fn
+		}
 	default:
 		// Try reflection on struct/interface
 		pkgValue := reflect.ValueOf(templatePackage)
@@ -84,7 +101,7 @@ func (r *CompiledTemplateRenderer) Render(templateName string, w io.Writer, data
 
 	if fn := r.funcs[actualName]; fn != nil {
 		if err := fn(w, data); err != nil {
-			return hexerr.Wrapf(err, "failed to render template %q", templateName)
+			return renderError(err, templateName)
 		}
 		return nil
 	}
@@ -102,12 +119,43 @@ func (r *CompiledTemplateRenderer) Render(templateName string, w io.Writer, data
 	results := renderFunc.Call(args)
 	if len(results) > 0 {
 		if err, ok := results[0].Interface().(error); ok && err != nil {
-			return hexerr.Wrapf(err, "failed to render template %q", templateName)
+			return renderError(err, templateName)
 		}
 	}
 	return nil
 }
 
+// RenderContext renders a template by name with ctx. Context-aware functions stop the render
+// once ctx is done and pass ctx to helpers; other templates are rendered with Render when ctx
+// is not done yet.
+func (r *CompiledTemplateRenderer) RenderContext(ctx context.Context, templateName string, w io.Writer, data any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	actualName, ok := r.findTemplateName(templateName)
+	if !ok {
+		return r.Render(templateName, w, data)
+	}
+	if fn := r.ctxFuncs[actualName]; fn != nil {
+		if err := fn(ctx, w, data); err != nil {
+			return renderError(err, templateName)
+		}
+		return nil
+	}
+	return r.Render(templateName, w, data)
+}
+
+// renderError returns err of rendering templateName as a *runtime.RenderError: errors of
+// generated code already are, with the template stack and position; other errors get the
+// template name.
+func renderError(err error, templateName string) error {
+	var renderErr *runtime.RenderError
+	if errors.As(err, &renderErr) {
+		return err
+	}
+	return runtime.WrapError(err, templateName, 0, 0)
+}
+
 // normalizeTemplateName converts template paths to function names.
 // Examples:
 //   - "blog/post" -> tries "blogpost", "blog/post", "post"
@@ -2,9 +2,13 @@ package processor
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/andriyg76/go-hbars/runtime"
 )
 
 func TestNewCompiledTemplateRenderer_Nil(t *testing.T) {
@@ -105,3 +109,43 @@ func TestCompiledTemplateRenderer_UnknownTemplate(t *testing.T) {
 		t.Errorf("error = %v", err)
 	}
 }
+
+func TestCompiledTemplateRenderer_RenderError(t *testing.T) {
+	errBoom := errors.New("boom")
+	helperErr := runtime.WrapHelperError(errBoom, "fail", "main", 2, 5)
+	funcs := map[string]func(io.Writer, any) error{
+		"main":  func(w io.Writer, data any) error { return helperErr },
+		"plain": func(w io.Writer, data any) error { return errBoom },
+	}
+	r, _ := NewCompiledTemplateRenderer(funcs)
+	var renderErr *runtime.RenderError
+	if err := r.Render("main", io.Discard, nil); err != helperErr {
+		t.Errorf("Render(main) = %v, want the template's *runtime.RenderError", err)
+	}
+	err := r.Render("plain", io.Discard, nil)
+	if !errors.As(err, &renderErr) || renderErr.Location().Template != "plain" || !errors.Is(err, errBoom) {
+		t.Errorf("Render(plain) = %v, want a *runtime.RenderError for template plain", err)
+	}
+}
+
+func TestCompiledTemplateRenderer_RenderContext(t *testing.T) {
+	type userKey struct{}
+	var got any
+	r, _ := NewCompiledTemplateRenderer(map[string]func(context.Context, io.Writer, any) error{
+		"main": func(ctx context.Context, w io.Writer, data any) error {
+			got = ctx.Value(userKey{})
+			return ctx.Err()
+		},
+	})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), userKey{}, "ada"))
+	if err := r.RenderContext(ctx, "main", io.Discard, nil); err != nil || got != "ada" {
+		t.Errorf("RenderContext(main) = %v, user %v", err, got)
+	}
+	if err := r.Render("main", io.Discard, nil); err != nil || got != nil {
+		t.Errorf("Render(main) = %v, user %v; want a background context", err, got)
+	}
+	cancel()
+	if err := r.RenderContext(ctx, "main", io.Discard, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("RenderContext with a cancelled context = %v", err)
+	}
+}
@@ -11,6 +11,15 @@ import (
 // LoadSharedData recursively loads shared data files from a directory.
 // File names (without extension) become keys, and nested directories become nested objects.
 func LoadSharedData(dirPath string) (map[string]any, error) {
+	return loadSharedData(dirPath, false)
+}
+
+// LoadOrderedSharedData is LoadSharedData with the files loaded by LoadOrderedDataFile.
+func LoadOrderedSharedData(dirPath string) (map[string]any, error) {
+	return loadSharedData(dirPath, true)
+}
+
+func loadSharedData(dirPath string, ordered bool) (map[string]any, error) {
 	if dirPath == "" {
 		return make(map[string]any), nil
 	}
@@ -27,14 +36,14 @@ func LoadSharedData(dirPath string) (map[string]any, error) {
 	}
 
 	result := make(map[string]any)
-	if err := loadSharedRecursive(dirPath, dirPath, result); err != nil {
+	if err := loadSharedRecursive(dirPath, dirPath, result, ordered); err != nil {
 		return nil, err
 	}
 
 	return result, nil
 }
 
-func loadSharedRecursive(basePath, currentPath string, result map[string]any) error {
+func loadSharedRecursive(basePath, currentPath string, result map[string]any, ordered bool) error {
 	entries, err := os.ReadDir(currentPath)
 	if err != nil {
 		return hexerr.Wrapf(err, "failed to read directory %q", currentPath)
@@ -45,7 +54,7 @@ func loadSharedRecursive(basePath, currentPath string, result map[string]any) er
 			// Recursively process subdirectories
 			subPath := filepath.Join(currentPath, entry.Name())
 			subMap := make(map[string]any)
-			if err := loadSharedRecursive(basePath, subPath, subMap); err != nil {
+			if err := loadSharedRecursive(basePath, subPath, subMap, ordered); err != nil {
 				return err
 			}
 			if len(subMap) > 0 {
@@ -61,7 +70,7 @@ func loadSharedRecursive(basePath, currentPath string, result map[string]any) er
 		}
 
 		filePath := filepath.Join(currentPath, entry.Name())
-		data, err := LoadDataFile(filePath)
+		data, err := loadDataFile(filePath, ordered)
 		if err != nil {
 			return hexerr.Wrapf(err, "failed to load shared file %q", filePath)
 		}
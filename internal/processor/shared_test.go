@@ -3,7 +3,11 @@ package processor
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/andriyg76/go-hbars/runtime"
 )
 
 func TestLoadSharedData(t *testing.T) {
@@ -33,6 +37,30 @@ func TestLoadSharedData(t *testing.T) {
 	}
 }
 
+func TestLoadOrderedSharedData(t *testing.T) {
+	sharedDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sharedDir, "site.json"), []byte(`{"name": "Test Site", "menu": {"zeta": 1, "alpha": 2}}`), 0644); err != nil {
+		t.Fatalf("failed to create site.json: %v", err)
+	}
+
+	plain, err := LoadSharedData(sharedDir)
+	if err != nil {
+		t.Fatalf("LoadSharedData error: %v", err)
+	}
+	if menu := runtime.LookupPath(plain, "site.menu"); reflect.TypeOf(menu) != reflect.TypeFor[map[string]any]() {
+		t.Errorf("LoadSharedData menu is %T, want map[string]any", menu)
+	}
+
+	data, err := LoadOrderedSharedData(sharedDir)
+	if err != nil {
+		t.Fatalf("LoadOrderedSharedData error: %v", err)
+	}
+	menu, ok := runtime.LookupPath(data, "site.menu").(*runtime.OrderedMap)
+	if !ok || strings.Join(menu.Keys(), ",") != "zeta,alpha" {
+		t.Errorf("LoadOrderedSharedData menu = %#v, want keys zeta,alpha", runtime.LookupPath(data, "site.menu"))
+	}
+}
+
 func TestLoadSharedData_EmptyDir(t *testing.T) {
 	tmpDir := t.TempDir()
 	sharedDir := filepath.Join(tmpDir, "shared")
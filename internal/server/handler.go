@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -81,7 +83,11 @@ func (h *Handler) handleDataFile(w http.ResponseWriter, r *http.Request) bool {
 	}
 
 	// Process the file
-	outputPath, content, err := h.processor.ProcessFile(dataPath, h.sharedData)
+	outputPath, content, err := h.processor.ProcessFileContext(r.Context(), dataPath, h.sharedData)
+	if errors.Is(err, context.Canceled) {
+		// The client has gone; there is no one to answer.
+		return true
+	}
 	if err != nil {
 		serverLog.Error("Failed to process file: %+v", err)
 		http.Error(w, fmt.Sprintf("Failed to process file: %v", err), http.StatusInternalServerError)
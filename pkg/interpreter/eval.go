@@ -0,0 +1,397 @@
+package interpreter
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/internal/ast"
+	"github.com/andriyg76/go-hbars/internal/parser"
+	"github.com/andriyg76/go-hbars/runtime"
+	"github.com/andriyg76/hexerr"
+)
+
+// render is the state of one Templates.Render call.
+type render struct {
+	t      *Templates
+	env    *runtime.Env
+	blocks *runtime.Blocks
+	tmpl   *template // template being rendered, for errors
+	pos    ast.Pos   // node being rendered, for errors
+	w      io.Writer // writer of the node being rendered, for helper error comments
+}
+
+func (r *render) errorf(format string, args ...any) error {
+	return r.wrap(hexerr.Newf(format, args...))
+}
+
+func (r *render) wrap(err error) error {
+	return runtime.WrapError(err, r.tmpl.name, r.pos.Line, r.pos.Col)
+}
+
+// helperError handles err, returned by helper called at pos, under the helper's policy
+// (see runtime.HandleHelperError); output goes to w.
+func (r *render) helperError(w io.Writer, err error, helper string, pos ast.Pos) error {
+	policy, ok := r.t.opts.HelperErrorPolicies[helper]
+	if !ok {
+		policy = r.t.opts.HelperErrors
+	}
+	return runtime.HandleHelperError(w, err, policy, helper, r.tmpl.name, pos.Line, pos.Col)
+}
+
+// template renders tmpl with data as its context and @root, unless the render's context
+// is done or a limit is exceeded (see runtime.Env.EnterPartial).
+func (r *render) template(tmpl *template, w io.Writer, data any) error {
+	if err := r.env.EnterPartial(); err != nil {
+		return err
+	}
+	defer r.env.LeavePartial()
+	saved := r.tmpl
+	r.tmpl = tmpl
+	defer func() { r.tmpl = saved }()
+	return r.nodes(w, r.env.NewScope(data), tmpl.nodes)
+}
+
+// callPartial returns err, the error of the partial called by n, with the position of n (see
+// runtime.WrapPartialError).
+func (r *render) callPartial(n *ast.Partial, err error) error {
+	pos := n.Position()
+	return runtime.WrapPartialError(err, r.tmpl.name, pos.Line, pos.Col)
+}
+
+func (r *render) nodes(w io.Writer, s *runtime.Scope, nodes []ast.Node) error {
+	for _, node := range nodes {
+		r.pos, r.w = node.Position(), w
+		var err error
+		switch n := node.(type) {
+		case *ast.Text:
+			_, err = io.WriteString(w, n.Value)
+		case *ast.Mustache:
+			err = r.mustache(w, s, n)
+		case *ast.Partial:
+			err = r.partial(w, s, n)
+		case *ast.Block:
+			err = r.block(w, s, n)
+		default:
+			err = r.errorf("unsupported node %T", node)
+		}
+		if err != nil {
+			// Helper and partial errors get the position of the node; r.pos may have
+			// moved on to a node of a block body or partial.
+			r.pos = node.Position()
+			return r.wrap(err)
+		}
+	}
+	return nil
+}
+
+func (r *render) parse(input string) ([]parser.Expr, []parser.HashArg, error) {
+	parts, hash, err := parser.ParseExpr(input)
+	if err != nil {
+		return nil, nil, r.wrap(err)
+	}
+	return parts, hash, nil
+}
+
+func (r *render) write(w io.Writer, v any, raw bool) error {
+	if r.t.opts.Stringify == StringifyJS {
+		v = runtime.JSValue(v)
+	}
+	switch mode := r.tmpl.escape; {
+	case raw || mode == EscapeText:
+		return runtime.WriteRaw(w, v)
+	case mode == EscapeHTML:
+		return runtime.WriteEscaped(w, v)
+	default:
+		return runtime.WriteEscapedWith(w, mode, v)
+	}
+}
+
+func (r *render) mustache(w io.Writer, s *runtime.Scope, n *ast.Mustache) error {
+	parts, hash, err := r.parse(n.Expr)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		if len(hash) > 0 {
+			return r.errorf("unexpected hash arguments")
+		}
+		return nil
+	}
+	var v any
+	switch {
+	case len(parts) > 1:
+		if parts[0].Kind != parser.ExprPath {
+			return r.errorf("helper name must be a path")
+		}
+		v, err = r.callHelper(s, parts[0].Value, parts[1:], hash)
+	case parts[0].Kind == parser.ExprPath && r.isHelper(parts[0].Value, len(hash) > 0):
+		v, err = r.callHelper(s, parts[0].Value, nil, hash)
+	case len(hash) > 0:
+		return r.errorf("hash arguments require a helper")
+	default:
+		v, err = r.value(s, parts[0])
+	}
+	if err != nil {
+		return err
+	}
+	return r.write(w, v, n.Raw)
+}
+
+// value evaluates a path, a literal or a subexpression.
+func (r *render) value(s *runtime.Scope, e parser.Expr) (any, error) {
+	switch e.Kind {
+	case parser.ExprPath:
+		return r.env.Value(s.Path(e.Value))
+	case parser.ExprString:
+		return e.Value, nil
+	case parser.ExprNumber:
+		if !strings.ContainsAny(e.Value, ".eE") {
+			if i, err := strconv.Atoi(e.Value); err == nil {
+				return i, nil
+			}
+		}
+		f, err := strconv.ParseFloat(e.Value, 64)
+		if err != nil {
+			return nil, r.errorf("invalid number %q", e.Value)
+		}
+		return f, nil
+	case parser.ExprBool:
+		return e.Value == "true", nil
+	case parser.ExprNull:
+		return nil, nil
+	case parser.ExprCall:
+		return r.callHelper(s, e.Name, e.Args, e.Hash)
+	}
+	return nil, r.errorf("invalid expression")
+}
+
+func (r *render) values(s *runtime.Scope, parts []parser.Expr) ([]any, error) {
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	out := make([]any, len(parts))
+	for i, p := range parts {
+		v, err := r.value(s, p)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// hash evaluates hash arguments; it returns nil when there are none.
+func (r *render) hash(s *runtime.Scope, hash []parser.HashArg) (runtime.Hash, error) {
+	if len(hash) == 0 {
+		return nil, nil
+	}
+	out := make(runtime.Hash, len(hash))
+	for _, h := range hash {
+		v, err := r.value(s, h.Value)
+		if err != nil {
+			return nil, err
+		}
+		out[h.Key] = v
+	}
+	return out, nil
+}
+
+func (r *render) block(w io.Writer, s *runtime.Scope, n *ast.Block) error {
+	switch n.Name {
+	case "if":
+		return r.ifBlock(w, s, n, false)
+	case "unless":
+		return r.ifBlock(w, s, n, true)
+	case "with":
+		return r.withBlock(w, s, n)
+	case "each":
+		return r.eachBlock(w, s, n)
+	case "block":
+		return r.layoutBlock(w, s, n)
+	case "partial":
+		return r.layoutPartial(w, s, n)
+	}
+	if h, ok := r.t.helpers[n.Name]; ok {
+		return r.callBlockHelper(w, s, n, h)
+	}
+	// Helpers of the registries, and (through the blockHelperMissing hook) unknown names
+	// called with arguments, are block helpers resolved at render time.
+	if r.hasRegistryHelper(n.Name, true) || (runtimeHelperName(n.Name) && strings.TrimSpace(n.Args) != "") {
+		return r.callBlockHelper(w, s, n, r.env.BlockHelper(n.Name))
+	}
+	// Universal section: {{#name}}...{{/name}} is {{#with name}}...{{/with}}.
+	args := strings.TrimSpace(n.Args)
+	if args == "" {
+		args = n.Name
+	}
+	return r.withBlock(w, s, &ast.Block{Pos: n.Pos, Name: "with", Args: args, Params: n.Params, Body: n.Body, Else: n.Else})
+}
+
+// singleExpr evaluates the only argument of a built-in block.
+func (r *render) singleExpr(s *runtime.Scope, n *ast.Block) (any, []parser.HashArg, error) {
+	parts, hash, err := r.parse(n.Args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parts) != 1 {
+		return nil, nil, r.errorf("block %q requires a single expression", n.Name)
+	}
+	v, err := r.value(s, parts[0])
+	return v, hash, err
+}
+
+func (r *render) ifBlock(w io.Writer, s *runtime.Scope, n *ast.Block, inverted bool) error {
+	if len(n.Params) > 1 {
+		return r.errorf("block %q supports a single param", n.Name)
+	}
+	v, hash, err := r.singleExpr(s, n)
+	if err != nil {
+		return err
+	}
+	var cond bool
+	if hashHasIncludeZero(hash) {
+		cond = runtime.IncludeZeroTruthy(v)
+	} else {
+		cond = runtime.IsTruthy(v)
+	}
+	if cond != inverted {
+		return r.nodes(w, s.WithParams(n.Params, v), n.Body)
+	}
+	return r.nodes(w, s, n.Else)
+}
+
+// hashHasIncludeZero reports whether the hash contains includeZero=true.
+func hashHasIncludeZero(hash []parser.HashArg) bool {
+	for _, h := range hash {
+		if h.Key == "includeZero" && h.Value.Kind == parser.ExprBool && h.Value.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *render) withBlock(w io.Writer, s *runtime.Scope, n *ast.Block) error {
+	if len(n.Params) > 1 {
+		return r.errorf("block %q supports a single param", n.Name)
+	}
+	v, _, err := r.singleExpr(s, n)
+	if err != nil {
+		return err
+	}
+	if runtime.IsTruthy(v) {
+		return r.nodes(w, s.WithContext(v, s.Data()).WithParams(n.Params, v), n.Body)
+	}
+	return r.nodes(w, s, n.Else)
+}
+
+func (r *render) eachBlock(w io.Writer, s *runtime.Scope, n *ast.Block) error {
+	if len(n.Params) > 2 {
+		return r.errorf("block %q supports up to 2 params", n.Name)
+	}
+	parts, _, err := r.parse(n.Args)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 2 && parts[0].Kind == parser.ExprPath && parts[0].Value == "in" {
+		parts = parts[1:]
+	}
+	if len(parts) != 1 {
+		return r.errorf("block %q requires a single expression", n.Name)
+	}
+	v, err := r.value(s, parts[0])
+	if err != nil {
+		return err
+	}
+	empty := true
+	for item := range runtime.Each(v) {
+		empty = false
+		if err := r.env.Iterate(); err != nil {
+			return err
+		}
+		data := item.Frame(s.Data())
+		if err := r.nodes(w, s.WithContext(item.Value, data).WithParams(n.Params, item.Value, item.Key), n.Body); err != nil {
+			return err
+		}
+	}
+	if empty {
+		return r.nodes(w, s, n.Else)
+	}
+	return nil
+}
+
+func (r *render) layoutBlock(w io.Writer, s *runtime.Scope, n *ast.Block) error {
+	name, _, err := r.singleExpr(s, n)
+	if err != nil {
+		return err
+	}
+	if r.blocks != nil {
+		if content, ok := r.blocks.Get(runtime.Stringify(name)); ok && content != "" {
+			_, err := io.WriteString(w, content)
+			return err
+		}
+	}
+	return r.nodes(w, s, n.Body)
+}
+
+func (r *render) layoutPartial(w io.Writer, s *runtime.Scope, n *ast.Block) error {
+	name, _, err := r.singleExpr(s, n)
+	if err != nil {
+		return err
+	}
+	if r.blocks == nil {
+		return nil
+	}
+	var b strings.Builder
+	if err := r.nodes(&b, s, n.Body); err != nil {
+		return err
+	}
+	r.blocks.Set(runtime.Stringify(name), b.String())
+	return nil
+}
+
+func (r *render) partial(w io.Writer, s *runtime.Scope, n *ast.Partial) error {
+	parts, hash, err := r.parse(n.Expr)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return r.errorf("partial invocation is empty")
+	}
+	if len(parts) > 2 {
+		return r.errorf("partial: context must be a single expression")
+	}
+	// The current context is passed only when there is neither a context argument nor a hash;
+	// a hash is merged onto the context argument (or the current context).
+	ctx := s.Context()
+	if len(parts) == 2 {
+		if ctx, err = r.value(s, parts[1]); err != nil {
+			return err
+		}
+	}
+	if len(hash) > 0 {
+		h, err := r.hash(s, hash)
+		if err != nil {
+			return err
+		}
+		ctx = runtime.MergePartialContext(runtime.ContextMap(ctx), h)
+	}
+	switch nameExpr := parts[0]; nameExpr.Kind {
+	case parser.ExprString, parser.ExprPath:
+		tmpl, ok := r.t.templates[nameExpr.Value]
+		if !ok {
+			return r.errorf("partial %q is not defined", nameExpr.Value)
+		}
+		return r.callPartial(n, r.template(tmpl, w, ctx))
+	default:
+		nameValue, err := r.value(s, nameExpr)
+		if err != nil {
+			return err
+		}
+		name := runtime.Stringify(nameValue)
+		if tmpl, ok := r.t.templates[name]; ok {
+			return r.callPartial(n, r.template(tmpl, w, ctx))
+		}
+		return r.callPartial(n, r.env.RenderPartial(w, name, ctx))
+	}
+}
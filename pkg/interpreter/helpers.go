@@ -0,0 +1,176 @@
+package interpreter
+
+import (
+	"io"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/internal/ast"
+	"github.com/andriyg76/go-hbars/internal/parser"
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+// isHelper reports whether a single-name mustache is a helper call rather than a path:
+// a helper of the set or of the registries, or any plain name called with hash arguments
+// (resolved at render time, possibly by the helperMissing hook).
+func (r *render) isHelper(name string, hasHash bool) bool {
+	if _, ok := r.t.helpers[name]; ok {
+		return true
+	}
+	return r.hasRegistryHelper(name, false) || (hasHash && runtimeHelperName(name))
+}
+
+// hasRegistryHelper reports whether name is registered in Options.Registry or the
+// package-wide registry.
+func (r *render) hasRegistryHelper(name string, block bool) bool {
+	for _, reg := range []*runtime.Registry{r.t.opts.Registry, runtime.DefaultRegistry()} {
+		if reg == nil {
+			continue
+		}
+		var ok bool
+		if block {
+			_, ok = reg.BlockHelper(name)
+		} else {
+			_, ok = reg.Helper(name)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeHelperName reports whether name can be a helper looked up at render time: a plain
+// identifier rather than a dotted path, "this" or an @data variable.
+func runtimeHelperName(name string) bool {
+	return name != "" && name != "this" && !strings.ContainsAny(name, "./@[")
+}
+
+func (r *render) options(s *runtime.Scope, name string, hash runtime.Hash) *runtime.HelperOptions {
+	return &runtime.HelperOptions{
+		Name:     name,
+		Template: r.tmpl.name,
+		Context:  runtime.RawValue(s.Context()),
+		Data:     s.Data(),
+		Hash:     hash,
+		Ctx:      r.env.Ctx(),
+	}
+}
+
+// callHelper calls helper name with args and hash and returns its result. Names that are
+// not helpers of the set are resolved in the registries at render time.
+func (r *render) callHelper(s *runtime.Scope, name string, args []parser.Expr, hash []parser.HashArg) (any, error) {
+	pos, w := r.pos, r.w
+	h, ok := r.t.helpers[name]
+	if !ok {
+		h = r.env.Helper(name)
+	}
+	argv, err := r.values(s, args)
+	if err != nil {
+		return nil, err
+	}
+	hashv, err := r.hash(s, hash)
+	if err != nil {
+		return nil, err
+	}
+	options := r.options(s, name, hashv)
+	call := func() (v any, err error) {
+		v, ok, err = runtime.CallHelper(h, argv, options)
+		return v, err
+	}
+	var v any
+	if r.t.opts.RecoverHelpers {
+		v, err = runtime.RecoverHelperValue(call)
+	} else {
+		v, err = call()
+	}
+	if err != nil {
+		// The helper renders empty when its policy does not fail the render.
+		return nil, r.helperError(w, err, name, pos)
+	}
+	if !ok {
+		return nil, r.errorf("helper %q (%T) cannot be called as a value", name, h)
+	}
+	return v, nil
+}
+
+// callBlockHelper calls h for the block n (see runtime.CallBlockHelper).
+// runtime.OptionsBlockHelper bodies render with the context and @data frame the helper
+// passes; the bodies of the other kinds render with the caller's context.
+func (r *render) callBlockHelper(w io.Writer, s *runtime.Scope, n *ast.Block, h any) error {
+	pos := r.pos
+	parts, hash, err := r.parse(n.Args)
+	if err != nil {
+		return err
+	}
+	argv, err := r.values(s, parts)
+	if err != nil {
+		return err
+	}
+	hashv, err := r.hash(s, hash)
+	if err != nil {
+		return err
+	}
+	options := r.options(s, n.Name, hashv)
+	options.BlockParams = len(n.Params)
+	var inverse runtime.BlockFunc
+	if len(n.Else) > 0 {
+		inverse = r.blockFunc(s, n.Else, nil, pos)
+	}
+	options.SetBlock(r.blockFunc(s, n.Body, n.Params, pos), inverse)
+	block := runtime.BlockOptions{Fn: func(w io.Writer) error {
+		if err := r.iterate(pos); err != nil {
+			return err
+		}
+		return r.nodes(w, s, n.Body)
+	}}
+	if len(n.Else) > 0 {
+		block.Inverse = func(w io.Writer) error {
+			if err := r.iterate(pos); err != nil {
+				return err
+			}
+			return r.nodes(w, s, n.Else)
+		}
+	}
+	var ok bool
+	call := func() (err error) {
+		ok, err = runtime.CallBlockHelper(w, h, argv, options, block)
+		return err
+	}
+	if r.t.opts.RecoverHelpers {
+		err = runtime.RecoverHelper(call)
+	} else {
+		err = call()
+	}
+	if err != nil {
+		return r.helperError(w, err, n.Name, pos)
+	}
+	if !ok {
+		return r.errorf("helper %q (%T) cannot be called as a block", n.Name, h)
+	}
+	return nil
+}
+
+// blockFunc returns the runtime.BlockFunc rendering nodes, a section of the block at pos, with
+// the context and frame it is called with; params are bound to the frame's block params.
+func (r *render) blockFunc(s *runtime.Scope, nodes []ast.Node, params []string, pos ast.Pos) runtime.BlockFunc {
+	return func(w io.Writer, ctx any, data *runtime.DataFrame) error {
+		if err := r.iterate(pos); err != nil {
+			return err
+		}
+		values := make([]any, len(params))
+		for i := range params {
+			values[i] = data.BlockParam(i)
+		}
+		return r.nodes(w, s.WithContext(ctx, data).WithParams(params, values...), nodes)
+	}
+}
+
+// iterate counts a render of a section of the block helper at pos as an iteration (see
+// runtime.Env.Iterate), so helpers that render their body per item are limited as {{#each}}
+// is. The error is a *runtime.RenderError, which the helper's error policy does not handle.
+func (r *render) iterate(pos ast.Pos) error {
+	if err := r.env.Iterate(); err != nil {
+		return runtime.WrapError(err, r.tmpl.name, pos.Line, pos.Col)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Package interpreter renders Handlebars templates at run time, without hbc and go generate.
+// Templates are parsed with the same parser as the compiler and evaluated against
+// map[string]any or struct data with the semantics of the generated code: helpers, partials,
+// layout blocks, block params and includeZero behave the same.
+//
+// Templates implements renderer.TemplateRenderer, so it can be passed to sitegen and the
+// processor in place of a compiled template package:
+//
+//	tmpls, err := interpreter.LoadDir("templates", interpreter.Options{})
+//	if err != nil { ... }
+//	proc, err := sitegen.NewProcessor(config, tmpls)
+package interpreter
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/andriyg76/go-hbars/helpers/handlebars"
+	"github.com/andriyg76/go-hbars/internal/ast"
+	"github.com/andriyg76/go-hbars/internal/parser"
+	"github.com/andriyg76/go-hbars/pkg/renderer"
+	"github.com/andriyg76/go-hbars/runtime"
+	"github.com/andriyg76/hexerr"
+)
+
+// Options configures Templates.
+type Options struct {
+	// Helpers are the helpers templates can call, by name, in addition to the core helpers
+	// (handlebars.Helpers), which they override. Values are runtime.Helper,
+	// runtime.OptionsHelper, runtime.BlockHelper, runtime.OptionsBlockHelper or functions
+	// with the same signatures.
+	Helpers map[string]any
+	// NoCoreHelpers leaves out the core helpers; only Helpers are available.
+	NoCoreHelpers bool
+	// Registry is searched, before the package-wide registry, for helpers that are not in
+	// Helpers, for the helperMissing / blockHelperMissing hooks and for dynamic partials
+	// that are not templates of this set. It may be nil.
+	Registry *runtime.Registry
+	// Escape is how {{value}} output is escaped: "html" (the default), "text" or the name of
+	// an escaper registered with runtime.RegisterEscaper. A template's own mode (see
+	// TemplateEscape) overrides it. Contextual escaping needs compiled templates.
+	Escape string
+	// TemplateEscape sets the output mode of single templates by template name. As with hbc,
+	// a template is in the mode of its {{!-- escape: mode --}} annotation, else
+	// TemplateEscape, else its name's extension (.txt and .md are text, .html is HTML),
+	// else Escape.
+	TemplateEscape map[string]string
+	// Stringify is how {{value}} output is converted to text: StringifyGo (the default, "")
+	// as runtime.Stringify does, or StringifyJS as JavaScript does, matching handlebars.js
+	// (see runtime.StringifyJS). It is hbc's -stringify.
+	Stringify string
+	// RecoverHelpers turns panics of helpers into *runtime.PanicError errors, handled under
+	// HelperErrors, instead of crashing the render.
+	RecoverHelpers bool
+	// HelperErrors is the policy for errors of helpers: runtime.HelperErrorsFail (the
+	// default), runtime.HelperErrorsEmpty or runtime.HelperErrorsComment (see
+	// runtime.HandleHelperError). HelperErrorPolicies overrides it for single helpers.
+	HelperErrors        string
+	HelperErrorPolicies map[string]string
+}
+
+// Output modes of Options.Escape.
+const (
+	EscapeHTML = "html"
+	EscapeText = "text"
+)
+
+// Modes of Options.Stringify.
+const (
+	StringifyGo = "go"
+	StringifyJS = "js"
+)
+
+// DefaultExtensions are the template file extensions LoadDir reads.
+var DefaultExtensions = []string{".hbs", ".handlebars"}
+
+// Templates is a set of parsed templates that can render each other as partials.
+// Add must not be called concurrently with rendering; rendering is safe for concurrent use.
+type Templates struct {
+	opts      Options
+	helpers   map[string]any
+	templates map[string]*template
+}
+
+var _ renderer.ContextTemplateRenderer = (*Templates)(nil)
+
+type template struct {
+	name   string
+	nodes  []ast.Node
+	escape string
+}
+
+// New returns an empty template set.
+func New(opts Options) *Templates {
+	helpers := make(map[string]any)
+	if !opts.NoCoreHelpers {
+		for name, h := range handlebars.Helpers() {
+			helpers[name] = h
+		}
+	}
+	for name, h := range opts.Helpers {
+		helpers[name] = h
+	}
+	return &Templates{opts: opts, helpers: helpers, templates: make(map[string]*template)}
+}
+
+// LoadDir parses the templates in dir and its subdirectories (files with one of
+// DefaultExtensions). Template names are paths relative to dir without the extension, as
+// with hbc: "parts/header.hbs" is the partial parts/header.
+func LoadDir(dir string, opts Options) (*Templates, error) {
+	t := New(opts)
+	err := filepath.WalkDir(dir, func(full string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !hasTemplateExt(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, full)
+		if err != nil {
+			return err
+		}
+		src, err := os.ReadFile(full)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		name = strings.TrimSuffix(name, path.Ext(name))
+		if _, ok := t.templates[name]; ok {
+			return hexerr.Newf("duplicate template name %q", name)
+		}
+		return t.Add(name, string(src))
+	})
+	if err != nil {
+		return nil, hexerr.Wrapf(err, "interpreter: load %q", dir)
+	}
+	return t, nil
+}
+
+func hasTemplateExt(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range DefaultExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Add parses src and adds it to the set as name, replacing a template of the same name.
+func (t *Templates) Add(name, src string) error {
+	nodes, err := parser.Parse(src)
+	if err != nil {
+		return hexerr.Wrapf(err, "interpreter: template %q", name)
+	}
+	escape, err := t.templateEscape(name, src)
+	if err != nil {
+		return hexerr.Wrapf(err, "interpreter: template %q", name)
+	}
+	t.templates[name] = &template{name: name, nodes: nodes, escape: escape}
+	return nil
+}
+
+// Has reports whether the set has a template name.
+func (t *Templates) Has(name string) bool {
+	_, ok := t.templates[name]
+	return ok
+}
+
+// Render renders template name with data to w. Layout blocks ({{#partial}} and {{#block}})
+// are shared by the template and the partials it renders.
+func (t *Templates) Render(name string, w io.Writer, data any) error {
+	return t.RenderWithBlocks(name, w, data, runtime.NewBlocks())
+}
+
+// RenderString renders template name with data and returns the output.
+func (t *Templates) RenderString(name string, data any) (string, error) {
+	var b strings.Builder
+	if err := t.Render(name, &b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderWithBlocks is Render with the layout blocks to use. With nil blocks {{#block}}
+// renders its default content and {{#partial}} output is dropped, as in generated code.
+func (t *Templates) RenderWithBlocks(name string, w io.Writer, data any, blocks *runtime.Blocks) error {
+	return t.render(name, w, data, blocks, runtime.RenderOptions{})
+}
+
+// RenderContext is Render with ctx as the render's context: the render stops with ctx.Err()
+// once ctx is done, checked at each {{#each}} iteration and each partial, and helpers get
+// ctx as HelperOptions.Ctx.
+func (t *Templates) RenderContext(ctx context.Context, name string, w io.Writer, data any) error {
+	return t.RenderWithOptions(name, w, data, runtime.RenderOptions{Context: ctx})
+}
+
+// RenderWithOptions is Render with the context, registry and limits of opts; a render over
+// a limit fails with a *runtime.LimitError. Without opts.Registry, Options.Registry is used.
+func (t *Templates) RenderWithOptions(name string, w io.Writer, data any, opts runtime.RenderOptions) error {
+	return t.render(name, w, data, runtime.NewBlocks(), opts)
+}
+
+func (t *Templates) render(name string, w io.Writer, data any, blocks *runtime.Blocks, opts runtime.RenderOptions) error {
+	tmpl, ok := t.templates[name]
+	if !ok {
+		return hexerr.Newf("interpreter: template %q is not defined", name)
+	}
+	if opts.Registry == nil {
+		opts.Registry = t.opts.Registry
+	}
+	env := runtime.NewEnv(opts)
+	r := &render{t: t, env: env, blocks: blocks}
+	return r.template(tmpl, env.Writer(w), data)
+}
+
+// escaperName matches the names of runtime escapers (runtime.RegisterEscaper).
+var escaperName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// templateEscape returns the output mode of template name with source src (see
+// Options.TemplateEscape).
+func (t *Templates) templateEscape(name, src string) (string, error) {
+	mode := t.opts.Escape
+	switch path.Ext(name) {
+	case ".txt", ".md":
+		mode = EscapeText
+	case ".html", ".htm":
+		mode = EscapeHTML
+	}
+	if m, ok := t.opts.TemplateEscape[name]; ok {
+		mode = m
+	}
+	if m, ok := parser.EscapeAnnotation(src); ok {
+		mode = m
+	}
+	switch {
+	case mode == "":
+		return EscapeHTML, nil
+	case mode == "contextual":
+		return "", hexerr.New("contextual escaping needs compiled templates (hbc -escape=contextual)")
+	case !escaperName.MatchString(mode):
+		return "", hexerr.Newf("invalid escape mode %q (want %q, %q or an escaper name)", mode, EscapeHTML, EscapeText)
+	}
+	return mode, nil
+}
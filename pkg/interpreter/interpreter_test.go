@@ -0,0 +1,534 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andriyg76/go-hbars/runtime"
+)
+
+func newTemplates(t *testing.T, opts Options, tmpls map[string]string) *Templates {
+	t.Helper()
+	set := New(opts)
+	for name, src := range tmpls {
+		if err := set.Add(name, src); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	return set
+}
+
+func TestRenderString(t *testing.T) {
+	type user struct {
+		Name   string
+		Email  string `json:"mail"`
+		Active bool
+	}
+	data := map[string]any{
+		"title": "Hi <all>",
+		"count": 0,
+		"user":  map[string]any{"name": "Ada", "role": "admin"},
+		"users": []any{
+			map[string]any{"name": "Ada", "active": true},
+			map[string]any{"name": "Bob", "active": false},
+		},
+		"settings": map[string]any{"theme": "dark", "lang": "en"},
+		"owner":    &user{Name: "Eve", Email: "eve@example.com", Active: true},
+		"typed":    []user{{Name: "Kim"}, {Name: "Lee"}},
+		"empty":    []any{},
+	}
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"escaped value", "{{title}}", "Hi &lt;all&gt;"},
+		{"raw value", "{{{title}}} {{& title}}", "Hi <all> Hi <all>"},
+		{"nested path", "{{user.name}} {{user.missing}}|", "Ada |"},
+		{"helper", "{{upper (lower user.name)}}", "ADA"},
+		{"helper with hash", `{{default user.nickname value="(none)"}}`, "(none)"},
+		{"literals", `{{add 1 2}} {{add 1.5 1}}`, "3 2.5"},
+		{"if else", "{{#if user}}yes{{else}}no{{/if}}{{#if count}}yes{{else}}no{{/if}}", "yesno"},
+		{"includeZero", "{{#if count includeZero=true}}zero{{/if}}", "zero"},
+		{"unless", "{{#unless count}}none{{/unless}}", "none"},
+		{"if param", "{{#if user.name as |n|}}{{n}}{{/if}}", "Ada"},
+		{"with", "{{#with user as |u|}}{{name}}/{{u.role}}/{{../title}}{{/with}}", "Ada/admin/Hi &lt;all&gt;"},
+		{"with else", "{{#with missing}}x{{else}}none{{/with}}", "none"},
+		{"each", "{{#each users}}{{@index}}:{{name}}{{#if active}}*{{/if}}{{#unless @last}},{{/unless}}{{/each}}", "0:Ada*,1:Bob"},
+		{"each params", "{{#each users as |u i|}}{{i}}={{u.name}} {{/each}}", "0=Ada 1=Bob "},
+		{"each map in key order", "{{#each settings}}{{@key}}={{this}};{{/each}}", "lang=en;theme=dark;"},
+		{"each in", "{{#each in users}}{{name}}{{/each}}", "AdaBob"},
+		{"each else", "{{#each empty}}x{{else}}empty{{/each}}", "empty"},
+		{"each parent", "{{#each users}}{{../user.role}}{{/each}}", "adminadmin"},
+		{"each typed slice", "{{#each typed}}{{Name}}{{/each}}", "KimLee"},
+		{"struct fields", "{{owner.Name}} {{owner.mail}} {{owner.name}} {{#if owner.active}}on{{/if}}", "Eve eve@example.com Eve on"},
+		{"root", "{{#with user}}{{@root.title}}{{/with}}", "Hi &lt;all&gt;"},
+		{"universal section", "{{#user}}{{role}}{{/user}}{{#missing}}x{{else}}-{{/missing}}", "admin-"},
+		{"options block helper", "{{#repeat 2 as |i|}}{{i}}{{user.name}} {{/repeat}}", "0Ada 1Ada "},
+		{"options block helper item context", "{{#range 1 3 as |n|}}[{{n}}{{this}}]{{/range}}", "[11][22]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := newTemplates(t, Options{}, map[string]string{"main": tt.src})
+			got, err := set.RenderString("main", data)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartials(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"main":         `{{> card user}}|{{> card}}|{{> note text="hi"}}|{{> card user role="guest"}}|{{> (lookup . "which") user}}|{{> (lookup . "other")}}`,
+		"card":         "{{name}} ({{role}}) root={{@root.name}}",
+		"note":         "{{text}}/{{title}}",
+		"parts/header": "<h1>{{title}}</h1>",
+	})
+	data := map[string]any{
+		"title": "T",
+		"name":  "top",
+		"user":  map[string]any{"name": "Ada", "role": "admin"},
+		"which": "card",
+		"other": "nope",
+	}
+	got, err := set.RenderString("main", data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	want := `Ada (admin) root=Ada|top () root=top|hi/T|Ada (guest) root=Ada|Ada (admin) root=Ada|<!-- partial "nope" is not defined -->`
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	if err := set.Add("bad", "a {{> nope}}"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = set.RenderString("bad", data)
+	if err == nil || !strings.Contains(err.Error(), `template "bad" line 1:3: partial "nope" is not defined`) {
+		t.Errorf("missing static partial: err = %v", err)
+	}
+}
+
+func TestLayoutBlocks(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"page":   `{{#partial "content"}}<p>{{body}}</p>{{/partial}}{{> layout}}`,
+		"layout": `<main>{{#block "content"}}default{{/block}}</main><aside>{{#block "side"}}side{{/block}}</aside>`,
+	})
+	got, err := set.RenderString("page", map[string]any{"body": "hello"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if want := "<main><p>hello</p></main><aside>side</aside>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	var b strings.Builder
+	if err := set.RenderWithBlocks("page", &b, map[string]any{"body": "hello"}, nil); err != nil {
+		t.Fatalf("render without blocks: %v", err)
+	}
+	if want := "<main>default</main><aside>side</aside>"; b.String() != want {
+		t.Errorf("nil blocks: got %q, want %q", b.String(), want)
+	}
+}
+
+func TestHelperKinds(t *testing.T) {
+	reg := runtime.NewRegistry()
+	reg.RegisterHelper("who", func(_ []any, options *runtime.HelperOptions) (any, error) {
+		return options.Template + ":" + runtime.Stringify(options.HashValue("x", "-")), nil
+	})
+	reg.SetHelperMissing(func(_ []any, options *runtime.HelperOptions) (any, error) {
+		return "missing " + options.Name, nil
+	})
+	set := newTemplates(t, Options{
+		Registry: reg,
+		Helpers: map[string]any{
+			"shout": func(args []any) (any, error) {
+				return strings.ToUpper(runtime.Stringify(args[0])) + "!", nil
+			},
+		},
+	}, map[string]string{
+		"main": `{{shout name}} {{who x=1}} {{nope a=1}} {{upper name}}`,
+	})
+	got, err := set.RenderString("main", map[string]any{"name": "ada"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if want := "ADA! main:1 missing nope ADA"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var out strings.Builder
+	set = newTemplates(t, Options{NoCoreHelpers: true, Helpers: map[string]any{
+		"box": runtime.BlockHelper(func(args []any, options runtime.BlockOptions) error {
+			if runtime.IsTruthy(args[0]) {
+				return options.Fn(&out)
+			}
+			return options.Inverse(&out)
+		}),
+		"legacy": func(args []any) error {
+			options, _ := runtime.GetBlockOptions(args)
+			out.WriteString("<")
+			if err := options.Fn(&out); err != nil {
+				return err
+			}
+			out.WriteString(">")
+			return nil
+		},
+	}}, map[string]string{
+		"main": "{{#legacy name}}{{name}}{{/legacy}}{{#box name}}yes{{/box}}{{#box nope}}yes{{else}}no{{/box}}",
+		"core": "{{upper name}}",
+	})
+	if err := set.Render("main", io.Discard, map[string]any{"name": "ada"}); err != nil {
+		t.Fatalf("block helpers without HelperOptions: %v", err)
+	}
+	if out.String() != "<ada>yesno" {
+		t.Errorf("block helpers without HelperOptions: got %q", out.String())
+	}
+	if _, err := set.RenderString("core", map[string]any{"name": "ada"}); err == nil || !strings.Contains(err.Error(), `helper "upper" is not defined`) {
+		t.Errorf("NoCoreHelpers: err = %v", err)
+	}
+}
+
+func TestOutputModes(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"page.html": "{{v}}",
+		"mail.txt":  "{{v}}",
+		"rows":      "{{!-- escape: csv --}}{{v}}",
+	})
+	for name, want := range map[string]string{
+		"page.html": "a,&lt;b&gt;",
+		"mail.txt":  "a,<b>",
+		"rows":      `"a,<b>"`,
+	} {
+		got, err := set.RenderString(name, map[string]any{"v": "a,<b>"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	if err := New(Options{Escape: "contextual"}).Add("main", "x"); err == nil {
+		t.Error("contextual escaping: want error")
+	}
+	if err := New(Options{}).Add("main", "{{!-- escape: x ml --}}"); err == nil || !strings.Contains(err.Error(), `invalid escape mode "x ml"`) {
+		t.Errorf("invalid mode: err = %v", err)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	for path, src := range map[string]string{
+		"main.hbs":         "{{> parts/header}}body",
+		"parts/header.hbs": "<h1>{{title}}</h1>",
+		"notes.md":         "ignored",
+	} {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set, err := LoadDir(dir, Options{})
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	if set.Has("notes") {
+		t.Error("LoadDir read a file without a template extension")
+	}
+	got, err := set.RenderString("main", map[string]any{"title": "T"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if got != "<h1>T</h1>body" {
+		t.Errorf("got %q", got)
+	}
+	if _, err := set.RenderString("nope", nil); err == nil {
+		t.Error("unknown template: want error")
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"main":  "line\n  {{nope a b}}",
+		"block": "{{#if a b}}x{{/if}}",
+	})
+	if _, err := set.RenderString("main", nil); err == nil || !strings.Contains(err.Error(), `helper "nope" is not defined`) {
+		t.Errorf("unknown helper: err = %v", err)
+	}
+	if _, err := set.RenderString("block", nil); err == nil || !strings.Contains(err.Error(), `template "block" line 1:1: block "if" requires a single expression`) {
+		t.Errorf("bad block: err = %v", err)
+	}
+	if err := New(Options{}).Add("broken", "{{#if x}}"); err == nil {
+		t.Error("parse error: want error")
+	}
+
+	// Helper errors name the position of the call in each template on the way.
+	errBoom := errors.New("boom")
+	set = newTemplates(t, Options{Helpers: map[string]any{
+		"fail": func([]any) (any, error) { return nil, errBoom },
+	}}, map[string]string{
+		"page": "{{#each items}}\n  {{> row}}{{/each}}",
+		"row":  "{{#if this}}{{fail}}{{/if}}",
+	})
+	_, err := set.RenderString("page", map[string]any{"items": []any{1}})
+	if want := `template "page" line 2:3: template "row" line 1:13: boom`; err == nil || err.Error() != want || !errors.Is(err, errBoom) {
+		t.Errorf("helper error in partial: err = %v, want %q", err, want)
+	}
+	var renderErr *runtime.RenderError
+	if !errors.As(err, &renderErr) || renderErr.Helper != "fail" || len(renderErr.Stack) != 2 || renderErr.Location() != (runtime.Frame{Template: "row", Line: 1, Column: 13}) {
+		t.Errorf("helper error in partial: RenderError = %+v", renderErr)
+	}
+
+	// Each call of a recursive partial is on the stack.
+	set = newTemplates(t, Options{Helpers: map[string]any{
+		"fail": func([]any) (any, error) { return nil, errBoom },
+	}}, map[string]string{
+		"tree": "{{#if child}}\n  {{> tree child}}{{else}}{{fail}}{{/if}}",
+	})
+	_, err = set.RenderString("tree", map[string]any{"child": map[string]any{"child": map[string]any{"leaf": true}}})
+	if want := `template "tree" line 2:3: template "tree" line 2:3: template "tree" line 2:27: boom`; err == nil || err.Error() != want {
+		t.Errorf("helper error in recursive partial: err = %v, want %q", err, want)
+	}
+
+	// With RecoverHelpers a panic is a helper error, handled under the helper's policy.
+	helpers := map[string]any{
+		"fail": func([]any) (any, error) { panic("nil map") },
+		"wrap": func(w io.Writer, args []any, options *runtime.HelperOptions) error { panic("block") },
+	}
+	set = newTemplates(t, Options{Helpers: helpers, RecoverHelpers: true, HelperErrors: runtime.HelperErrorsComment,
+		HelperErrorPolicies: map[string]string{"wrap": runtime.HelperErrorsFail}}, map[string]string{
+		"main":  "[{{fail x}}]",
+		"block": "{{#wrap}}x{{/wrap}}",
+	})
+	out, err := set.RenderString("main", map[string]any{"x": 1})
+	if want := `[<!-- helper "fail": template "main" line 1:2: panic: nil map -->]`; err != nil || out != want {
+		t.Errorf("comment policy: got %q, %v, want %q", out, err, want)
+	}
+	_, err = set.RenderString("block", nil)
+	var panicErr *runtime.PanicError
+	if !errors.As(err, &renderErr) || renderErr.Helper != "wrap" || !errors.As(err, &panicErr) || panicErr.Value != "block" {
+		t.Errorf("fail policy: err = %v", err)
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+	type localeKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), localeKey{}, "uk"))
+	defer cancel()
+	set := newTemplates(t, Options{Helpers: map[string]any{
+		"locale": func(args []any, options *runtime.HelperOptions) (any, error) {
+			return options.Ctx.Value(localeKey{}), nil
+		},
+		"stop": func(args []any, options *runtime.HelperOptions) (any, error) {
+			cancel()
+			return args[0], nil
+		},
+	}}, map[string]string{
+		"main": "{{locale}}:{{#each items}}{{> row}}{{/each}}",
+		"row":  "{{stop this}}",
+	})
+	var b strings.Builder
+	err := set.RenderContext(ctx, "main", &b, map[string]any{"items": []any{1, 2, 3}})
+	if !errors.Is(err, context.Canceled) || b.String() != "uk:1" {
+		t.Errorf("got %q, %v; want %q, context.Canceled", b.String(), err, "uk:1")
+	}
+	if out, err := set.RenderString("main", map[string]any{"items": []any{1}}); err != nil || out != ":1" {
+		t.Errorf("without context: got %q, %v", out, err)
+	}
+}
+
+func TestRenderLimits(t *testing.T) {
+	set := newTemplates(t, Options{Helpers: map[string]any{
+		"times": runtime.OptionsBlockHelper(func(w io.Writer, args []any, options *runtime.HelperOptions) error {
+			for i := 0; i < args[0].(int); i++ {
+				if err := options.Fn(w, options.Context, options.Data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	}}, map[string]string{
+		"self":  "x{{> self}}",
+		"loop":  "{{#each items}}{{#each ../items}}.{{/each}}{{/each}}",
+		"times": "{{#times 1000000000}}.{{/times}}",
+	})
+	items := map[string]any{"items": []any{1, 2, 3}}
+	var limitErr *runtime.LimitError
+	for _, tt := range []struct {
+		name, tmpl string
+		limits     runtime.Limits
+		limit, out string
+	}{
+		{"partial depth", "self", runtime.Limits{MaxPartialDepth: 3}, runtime.LimitPartialDepth, "xxxx"},
+		{"iterations", "loop", runtime.Limits{MaxIterations: 5}, runtime.LimitIterations, "..."},
+		{"block helper iterations", "times", runtime.Limits{MaxIterations: 5}, runtime.LimitIterations, "....."},
+		{"output bytes", "loop", runtime.Limits{MaxOutputBytes: 4}, runtime.LimitOutputBytes, "...."},
+	} {
+		var b strings.Builder
+		err := set.RenderWithOptions(tt.tmpl, &b, items, runtime.RenderOptions{Limits: tt.limits})
+		if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit || b.String() != tt.out {
+			t.Errorf("%s: got %q, %v", tt.name, b.String(), err)
+		}
+	}
+	if out, err := set.RenderString("loop", items); err != nil || out != "........." {
+		t.Errorf("without limits: got %q, %v", out, err)
+	}
+}
+
+func TestRenderDataVariables(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"main": "{{@site.title}}:{{#each items}}{{@index}}{{@site.title}}{{/each}}:{{#with user}}{{name}}{{@user.name}}{{/with}}:{{> foot}}",
+		"foot": "{{@site.year}}{{#if @request}}{{@request.path}}{{/if}}",
+	})
+	vars := map[string]any{
+		"site": map[string]any{"title": "T", "year": 2026},
+		"user": struct{ Name string }{"ann"},
+	}
+	var b strings.Builder
+	err := set.RenderWithOptions("main", &b, map[string]any{"items": []any{1, 2}, "user": map[string]any{"name": "bob"}}, runtime.RenderOptions{Data: vars})
+	if want := "T:0T1T:bobann:2026"; err != nil || b.String() != want {
+		t.Errorf("got %q, %v; want %q", b.String(), err, want)
+	}
+	if out, err := set.RenderString("main", map[string]any{}); err != nil || out != ":::" {
+		t.Errorf("without data: got %q, %v", out, err)
+	}
+}
+
+type ctxKey struct{}
+
+func TestRenderFunctionValues(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"main": "{{title}}:{{#each related}}{{title}},{{/each}}:{{author.name}}:{{#if draft}}d{{/if}}",
+		"fail": "{{title}}{{broken}}",
+		"path": "{{title}}{{broken.name}}",
+	})
+	calls := 0
+	data := map[string]any{
+		"title": func() any { return "Post" },
+		"related": runtime.NewLazy(func(ctx context.Context) (any, error) {
+			calls++
+			return []any{map[string]any{"title": ctx.Value(ctxKey{})}}, nil
+		}),
+		"author": func(ctx context.Context) (any, error) { return map[string]any{"name": ctx.Value(ctxKey{})}, nil },
+		"draft":  func(context.Context) (any, error) { return false, nil },
+		"broken": func() (any, error) { return nil, errors.New("db down") },
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "Other")
+	var b strings.Builder
+	if err := set.RenderContext(ctx, "main", &b, data); err != nil || b.String() != "Post:Other,:Other:" {
+		t.Errorf("got %q, %v", b.String(), err)
+	}
+	b.Reset()
+	if err := set.RenderContext(ctx, "main", &b, data); err != nil || calls != 1 {
+		t.Errorf("second render: %v, related computed %d times", err, calls)
+	}
+	b.Reset()
+	err := set.Render("fail", &b, data)
+	if err == nil || err.Error() != `template "fail" line 1:10: db down` || b.String() != "Post" {
+		t.Errorf("failing function: got %q, %v", b.String(), err)
+	}
+	b.Reset()
+	err = set.Render("path", &b, data)
+	if err == nil || err.Error() != `template "path" line 1:10: db down` || b.String() != "Post" {
+		t.Errorf("failing function in a path: got %q, %v", b.String(), err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	data["related"] = runtime.NewLazy(func(ctx context.Context) (any, error) {
+		if ctx == canceled {
+			cancel()
+			return nil, ctx.Err()
+		}
+		return []any{map[string]any{"title": "Other"}}, nil
+	})
+	b.Reset()
+	if err := set.RenderContext(canceled, "main", &b, data); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled render: %v, want context.Canceled", err)
+	}
+	b.Reset()
+	if err := set.Render("main", &b, data); err != nil || b.String() != "Post:Other,::" {
+		t.Errorf("render after cancel: got %q, %v", b.String(), err)
+	}
+}
+
+func TestRenderEachIterators(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"main": "{{#each rows as |row i|}}{{#if @first}}[{{/if}}{{i}}:{{row}}{{#if @last}}]{{else}},{{/if}}{{else}}none{{/each}}",
+	})
+	ch := make(chan string, 2)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	for _, tt := range []struct {
+		name string
+		rows any
+		want string
+	}{
+		{"seq", slices.Values([]int{1, 2, 3}), "[0:1,1:2,2:3]"},
+		{"seq2", maps.All(map[string]int{"k": 1}), "[k:1]"},
+		{"chan", (<-chan string)(ch), "[0:a,1:b]"},
+		{"empty", slices.Values([]int{}), "none"},
+	} {
+		var b strings.Builder
+		if err := set.Render("main", &b, map[string]any{"rows": tt.rows}); err != nil || b.String() != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, b.String(), err, tt.want)
+		}
+	}
+}
+
+func TestRenderMapOrder(t *testing.T) {
+	set := newTemplates(t, Options{}, map[string]string{
+		"main": "{{#each settings}}{{@key}}={{this}}{{#unless @last}},{{/unless}}{{/each}}",
+	})
+	for _, tt := range []struct {
+		settings any
+		want     string
+	}{
+		{map[string]any{"c": 3, "a": 1, "b": 2}, "a=1,b=2,c=3"},
+		{runtime.NewOrderedMap().Set("c", 3).Set("a", 1), "c=3,a=1"},
+	} {
+		var b strings.Builder
+		if err := set.Render("main", &b, map[string]any{"settings": tt.settings}); err != nil || b.String() != tt.want {
+			t.Errorf("got %q, %v, want %q", b.String(), err, tt.want)
+		}
+	}
+}
+
+func TestRenderStringifyJS(t *testing.T) {
+	const src = "{{tags}}|{{obj}}|{{n}}|{{nan}}|{{no}}|{{none}}"
+	data := map[string]any{
+		"tags": []any{"a", 1.5, nil, "<b>"},
+		"obj":  map[string]any{"a": 1},
+		"n":    1e21,
+		"nan":  math.NaN(),
+		"no":   false,
+		"none": nil,
+	}
+	for _, tt := range []struct {
+		stringify string
+		want      string
+	}{
+		{StringifyJS, "a,1.5,,&lt;b&gt;|[object Object]|1e+21|NaN|false|"},
+		{"", "[a 1.5 &lt;nil&gt; &lt;b&gt;]|map[a:1]|1e+21|NaN|false|"},
+	} {
+		set := newTemplates(t, Options{Stringify: tt.stringify}, map[string]string{"main": src})
+		got, err := set.RenderString("main", data)
+		if err != nil || got != tt.want {
+			t.Errorf("stringify %q: got %q, %v, want %q", tt.stringify, got, err, tt.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package renderer
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 // TemplateRenderer is the interface for rendering compiled templates.
 // It is defined in a public package so that code generated by hbc -bootstrap
@@ -8,3 +11,24 @@ import "io"
 type TemplateRenderer interface {
 	Render(templateName string, w io.Writer, data any) error
 }
+
+// ContextTemplateRenderer is a TemplateRenderer that renders with a context: the render
+// stops with ctx.Err() once ctx is done, and helpers get ctx (runtime.HelperOptions.Ctx).
+// The renderer of hbc -bootstrap code, the interpreter and the bytecode VM implement it.
+type ContextTemplateRenderer interface {
+	TemplateRenderer
+	RenderContext(ctx context.Context, templateName string, w io.Writer, data any) error
+}
+
+// RenderContext renders templateName with r.RenderContext when r is a ContextTemplateRenderer.
+// Other renderers are not cancelled mid-render: RenderContext returns ctx.Err() when ctx is
+// already done and r.Render otherwise.
+func RenderContext(ctx context.Context, r TemplateRenderer, templateName string, w io.Writer, data any) error {
+	if cr, ok := r.(ContextTemplateRenderer); ok {
+		return cr.RenderContext(ctx, templateName, w, data)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.Render(templateName, w, data)
+}
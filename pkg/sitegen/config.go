@@ -18,6 +18,10 @@ type Config struct {
 	// OutputPath is the path to output directory for static generation (default: "pages").
 	OutputPath string
 
+	// KeepKeyOrder loads objects in data and shared files as runtime.OrderedMap values, so
+	// {{#each}} lists their keys in the order of the file (default: sorted key order).
+	KeepKeyOrder bool
+
 	// StaticDir is the path to static files directory for server (optional).
 	StaticDir string
 
@@ -1,6 +1,7 @@
 package sitegen
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 
@@ -33,10 +34,11 @@ func NewProcessor(config *Config, r renderer.TemplateRenderer) (*Processor, erro
 	}
 
 	procConfig := &processor.Config{
-		RootPath:   root,
-		DataPath:   config.DataPath,
-		SharedPath: config.SharedPath,
-		OutputPath: config.OutputPath,
+		RootPath:     root,
+		DataPath:     config.DataPath,
+		SharedPath:   config.SharedPath,
+		OutputPath:   config.OutputPath,
+		KeepKeyOrder: config.KeepKeyOrder,
 	}
 
 	proc := processor.NewProcessor(procConfig, r)
@@ -55,14 +57,20 @@ func (p *Processor) Process() error {
 
 // ProcessFile processes a single data file and returns the output path and content.
 func (p *Processor) ProcessFile(dataFilePath string) (string, []byte, error) {
+	return p.ProcessFileContext(context.Background(), dataFilePath)
+}
+
+// ProcessFileContext is ProcessFile with the context of the render: with a
+// renderer.ContextTemplateRenderer a cancelled ctx stops the render.
+func (p *Processor) ProcessFileContext(ctx context.Context, dataFilePath string) (string, []byte, error) {
 	// Load shared data
 	sharedPath := filepath.Join(p.config.RootPath, p.config.SharedPath)
-	sharedData, err := processor.LoadSharedData(sharedPath)
+	sharedData, err := p.proc.LoadSharedData(sharedPath)
 	if err != nil {
 		return "", nil, hexerr.Wrap(err, "failed to load shared data")
 	}
 
-	return p.proc.ProcessFile(dataFilePath, sharedData)
+	return p.proc.ProcessFileContext(ctx, dataFilePath, sharedData)
 }
 
 // Config returns the processor configuration.
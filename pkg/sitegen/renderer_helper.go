@@ -1,6 +1,7 @@
 package sitegen
 
 import (
+	"context"
 	"io"
 
 	"github.com/andriyg76/go-hbars/internal/processor"
@@ -29,6 +30,15 @@ func NewRendererFromFunctions(funcs map[string]func(io.Writer, any) error) rende
 	return r
 }
 
+// NewRendererFromContextFunctions is NewRendererFromFunctions for render functions that take
+// the render's context, such as the generated RenderXxxContext: the renderer implements
+// renderer.ContextTemplateRenderer, so that sitegen.Server stops rendering a page when its
+// request is cancelled. Generated bootstrap code passes rendererContextFuncs.
+func NewRendererFromContextFunctions(funcs map[string]func(context.Context, io.Writer, any) error) renderer.ContextTemplateRenderer {
+	r, _ := processor.NewCompiledTemplateRenderer(funcs)
+	return r
+}
+
 // LoadRendererFromPackage attempts to load render functions from a package using reflection.
 // This works when the package has a struct with Render* methods or when you provide
 // a map of functions.
@@ -41,18 +41,19 @@ func NewServer(config *Config, r renderer.TemplateRenderer) (*Server, error) {
 		DataPath:      config.DataPath,
 		SharedPath:    config.SharedPath,
 		OutputPath:    "", // Not used for server
+		KeepKeyOrder:  config.KeepKeyOrder,
 	}
 
+	// Create processor
+	proc := processor.NewProcessor(procConfig, r)
+
 	// Load shared data
 	sharedPath := filepath.Join(root, config.SharedPath)
-	sharedData, err := processor.LoadSharedData(sharedPath)
+	sharedData, err := proc.LoadSharedData(sharedPath)
 	if err != nil {
 		return nil, hexerr.Wrap(err, "failed to load shared data")
 	}
 
-	// Create processor
-	proc := processor.NewProcessor(procConfig, r)
-
 	// Create handler
 	staticDir := ""
 	if config.StaticDir != "" {
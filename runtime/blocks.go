@@ -62,6 +62,10 @@ func IsTruthy(value any) bool {
 		return len(v) > 0
 	case SafeString:
 		return v != ""
+	case *OrderedMap:
+		return v.Len() > 0
+	case TemplateValue:
+		return v.TemplateTruthy()
 	case int:
 		return v != 0
 	case int8:
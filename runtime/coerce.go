@@ -0,0 +1,224 @@
+package runtime
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andriyg76/hexerr"
+)
+
+// The To* functions convert template values to the parameter types of helpers with native
+// Go signatures; hbc generates calls to them in helper adapters.
+
+// ToString converts v to a string (see Stringify).
+func ToString(v any) string {
+	return Stringify(v)
+}
+
+// ToInt converts v to a signed integer that fits in bits (8, 16, 32 or 64).
+// Integers, integral floats, json.Number and numeric strings are accepted; nil is 0.
+func ToInt(v any, bits int) (int64, error) {
+	var n int64
+	switch t := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		n = int64(t)
+	case int8:
+		n = int64(t)
+	case int16:
+		n = int64(t)
+	case int32:
+		n = int64(t)
+	case int64:
+		n = t
+	case uint, uint8, uint16, uint32, uint64:
+		u, err := ToUint(t, 64)
+		if err != nil {
+			return 0, err
+		}
+		if u > math.MaxInt64 {
+			return 0, hexerr.Newf("%d overflows int%d", u, bits)
+		}
+		n = int64(u)
+	case float32, float64:
+		f, _ := ToFloat(t)
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, hexerr.Newf("%v is not an integer", t)
+		}
+		n = int64(f)
+	case json.Number:
+		i, err := t.Int64()
+		if err != nil {
+			return 0, hexerr.Newf("cannot convert %q to int", string(t))
+		}
+		n = i
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+		if err != nil {
+			return 0, hexerr.Newf("cannot convert %q to int", t)
+		}
+		n = i
+	default:
+		return 0, hexerr.Newf("cannot convert %T to int", v)
+	}
+	if bits < 64 && (n < -1<<(bits-1) || n > 1<<(bits-1)-1) {
+		return 0, hexerr.Newf("%d overflows int%d", n, bits)
+	}
+	return n, nil
+}
+
+// ToUint converts v to an unsigned integer that fits in bits (8, 16, 32 or 64).
+func ToUint(v any, bits int) (uint64, error) {
+	var n uint64
+	switch t := v.(type) {
+	case uint:
+		n = uint64(t)
+	case uint8:
+		n = uint64(t)
+	case uint16:
+		n = uint64(t)
+	case uint32:
+		n = uint64(t)
+	case uint64:
+		n = t
+	case string:
+		u, err := strconv.ParseUint(strings.TrimSpace(t), 10, 64)
+		if err != nil {
+			return 0, hexerr.Newf("cannot convert %q to uint", t)
+		}
+		n = u
+	default:
+		i, err := ToInt(v, 64)
+		if err != nil {
+			return 0, err
+		}
+		if i < 0 {
+			return 0, hexerr.Newf("%d is negative", i)
+		}
+		n = uint64(i)
+	}
+	if bits < 64 && n > 1<<bits-1 {
+		return 0, hexerr.Newf("%d overflows uint%d", n, bits)
+	}
+	return n, nil
+}
+
+// ToFloat converts v to a float64. Numbers, json.Number and numeric strings are accepted; nil is 0.
+func ToFloat(v any) (float64, error) {
+	switch t := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return t, nil
+	case float32:
+		return float64(t), nil
+	case int:
+		return float64(t), nil
+	case int8:
+		return float64(t), nil
+	case int16:
+		return float64(t), nil
+	case int32:
+		return float64(t), nil
+	case int64:
+		return float64(t), nil
+	case uint:
+		return float64(t), nil
+	case uint8:
+		return float64(t), nil
+	case uint16:
+		return float64(t), nil
+	case uint32:
+		return float64(t), nil
+	case uint64:
+		return float64(t), nil
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return 0, hexerr.Newf("cannot convert %q to float", string(t))
+		}
+		return f, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err != nil {
+			return 0, hexerr.Newf("cannot convert %q to float", t)
+		}
+		return f, nil
+	default:
+		return 0, hexerr.Newf("cannot convert %T to float", v)
+	}
+}
+
+// ToTime converts v to a time.Time. Strings are parsed with ParseTime; numbers are Unix seconds.
+func ToTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, nil
+		}
+		return *t, nil
+	case nil:
+		return time.Time{}, nil
+	case string:
+		return ParseTime(t)
+	default:
+		secs, err := ToFloat(v)
+		if err != nil {
+			return time.Time{}, hexerr.Newf("cannot convert %T to time", v)
+		}
+		whole, frac := math.Modf(secs)
+		return time.Unix(int64(whole), int64(frac*1e9)), nil
+	}
+}
+
+// timeLayouts are the layouts ParseTime tries, in order.
+var timeLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC822,
+	time.RFC822Z,
+}
+
+// ParseTime parses s using common date/time layouts (RFC 3339, "2006-01-02", RFC 1123, ...).
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, hexerr.Newf("unable to parse time: %q", s)
+}
+
+// PositionalArgs returns args without the trailing Hash argument, if any.
+func PositionalArgs(args []any) []any {
+	if _, ok := HashArg(args); ok {
+		return args[:len(args)-1]
+	}
+	return args
+}
+
+// ArityError reports a helper called with the wrong number of positional arguments.
+// When variadic is true, want is the minimum.
+func ArityError(helper string, want int, variadic bool, got int) error {
+	if variadic {
+		return hexerr.Newf("helper %q expects at least %d argument(s), got %d", helper, want, got)
+	}
+	return hexerr.Newf("helper %q expects %d argument(s), got %d", helper, want, got)
+}
+
+// ArgError reports a helper argument (0-based index) that could not be converted to typ.
+func ArgError(helper string, index int, typ string, err error) error {
+	return hexerr.Wrapf(err, "helper %q argument %d (%s)", helper, index+1, typ)
+}
@@ -0,0 +1,87 @@
+package runtime
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToInt(t *testing.T) {
+	tests := []struct {
+		in   any
+		bits int
+		want int64
+		err  string
+	}{
+		{nil, 64, 0, ""},
+		{42, 64, 42, ""},
+		{3.0, 64, 3, ""},
+		{" 7 ", 64, 7, ""},
+		{json.Number("12"), 64, 12, ""},
+		{uint8(9), 64, 9, ""},
+		{3.5, 64, 0, "not an integer"},
+		{"x", 64, 0, `cannot convert "x" to int`},
+		{200, 8, 0, "overflows int8"},
+		{true, 64, 0, "cannot convert bool to int"},
+	}
+	for _, tt := range tests {
+		got, err := ToInt(tt.in, tt.bits)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ToInt(%v, %d) error = %v, want %q", tt.in, tt.bits, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ToInt(%v, %d) = %d, %v; want %d", tt.in, tt.bits, got, err, tt.want)
+		}
+	}
+}
+
+func TestToUint(t *testing.T) {
+	if got, err := ToUint(5.0, 16); err != nil || got != 5 {
+		t.Errorf("ToUint(5.0) = %d, %v", got, err)
+	}
+	if _, err := ToUint(-1, 64); err == nil {
+		t.Errorf("ToUint(-1) expected error")
+	}
+	if _, err := ToUint(300, 8); err == nil {
+		t.Errorf("ToUint(300, 8) expected overflow")
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	if got, err := ToFloat("2.5"); err != nil || got != 2.5 {
+		t.Errorf("ToFloat(\"2.5\") = %v, %v", got, err)
+	}
+	if got, err := ToFloat(int32(4)); err != nil || got != 4 {
+		t.Errorf("ToFloat(int32) = %v, %v", got, err)
+	}
+	if _, err := ToFloat([]int{1}); err == nil {
+		t.Errorf("ToFloat(slice) expected error")
+	}
+}
+
+func TestToTime(t *testing.T) {
+	got, err := ToTime("2024-05-01")
+	if err != nil || got.Year() != 2024 || got.Month() != time.May {
+		t.Errorf("ToTime(date) = %v, %v", got, err)
+	}
+	if got, err := ToTime(float64(86400)); err != nil || !got.Equal(time.Unix(86400, 0)) {
+		t.Errorf("ToTime(unix) = %v, %v", got, err)
+	}
+	if _, err := ToTime("soon"); err == nil {
+		t.Errorf("ToTime(\"soon\") expected error")
+	}
+}
+
+func TestPositionalArgs(t *testing.T) {
+	args := PositionalArgs([]any{"a", 1, Hash{"k": "v"}})
+	if len(args) != 2 {
+		t.Fatalf("PositionalArgs kept hash: %v", args)
+	}
+	if len(PositionalArgs([]any{"a"})) != 1 {
+		t.Fatalf("PositionalArgs dropped a positional arg")
+	}
+}
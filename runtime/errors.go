@@ -0,0 +1,202 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Frame is a position in a template: in a RenderError stack, the call of the next frame's
+// template (a partial) or, for the last frame, the node that failed. Line is 0 when the
+// position is not known.
+type Frame struct {
+	Template string
+	Line     int
+	Column   int
+}
+
+// RenderError is the error of a render: generated code, the interpreter and the VM return
+// it for errors of helpers, partials and strict lookups. Use errors.As to get it:
+//
+//	var renderErr *runtime.RenderError
+//	if errors.As(err, &renderErr) {
+//		loc := renderErr.Location() // group by loc.Template, loc.Line
+//	}
+type RenderError struct {
+	// Stack is the template call stack, outermost first: the rendered template and the
+	// position of its partial call, then each partial called, down to the failing node.
+	Stack  []Frame
+	Helper string // the helper whose error this is, if any
+	Path   string // the context path whose lookup failed, if any (see MissingPathError)
+	Err    error  // the underlying cause
+}
+
+// Location returns the last frame of the stack: the template and position of the node
+// that failed.
+func (e *RenderError) Location() Frame {
+	if len(e.Stack) == 0 {
+		return Frame{}
+	}
+	return e.Stack[len(e.Stack)-1]
+}
+
+func (e *RenderError) Error() string {
+	var b strings.Builder
+	for _, f := range e.Stack {
+		b.WriteString("template ")
+		b.WriteString(strconv.Quote(f.Template))
+		if f.Line > 0 {
+			b.WriteString(" line ")
+			b.WriteString(strconv.Itoa(f.Line))
+			b.WriteString(":")
+			b.WriteString(strconv.Itoa(f.Column))
+		}
+		b.WriteString(": ")
+	}
+	if missing, ok := e.Err.(*MissingPathError); ok {
+		// The last frame is its position.
+		missing.writeMessage(&b)
+	} else if e.Err != nil {
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// WrapError wraps err, returned by the helper or partial called at line:col of template, in
+// a *RenderError with that position: `template "main" line 3:7: ...`. An error that already
+// has a position in the same template (an error from a block body, returned again by its
+// block helper) is returned as is, so each template in the chain is named once; partial calls
+// use WrapPartialError. WrapError returns nil for a nil err.
+func WrapError(err error, template string, line, col int) error {
+	return wrapError(err, Frame{Template: template, Line: line, Column: col}, false)
+}
+
+// WrapPartialError is WrapError for the error of the partial called at line:col of template:
+// the frame of the call is added even when the partial is template itself, so each call of a
+// recursive partial is on the stack.
+func WrapPartialError(err error, template string, line, col int) error {
+	return wrapError(err, Frame{Template: template, Line: line, Column: col}, true)
+}
+
+func wrapError(err error, frame Frame, partial bool) error {
+	if err == nil {
+		return nil
+	}
+	var inner *RenderError
+	if !errors.As(err, &inner) {
+		return &RenderError{Stack: []Frame{frame}, Err: err}
+	}
+	if !partial && len(inner.Stack) > 0 && inner.Stack[0].Template == frame.Template {
+		return err
+	}
+	if inner != err {
+		// Wrapped in the error of a helper (or of a partial of another package): its stack
+		// is in the message, a new stack starts here.
+		return &RenderError{Stack: []Frame{frame}, Err: err}
+	}
+	wrapped := *inner
+	wrapped.Stack = append([]Frame{frame}, inner.Stack...)
+	return &wrapped
+}
+
+// WrapHelperError is WrapError for the error of helper: the *RenderError names the helper.
+// An error from a block body that the helper returns as is keeps its position and helper.
+func WrapHelperError(err error, helper, template string, line, col int) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*RenderError); !ok {
+		err = &RenderError{Helper: helper, Err: err}
+	}
+	return WrapError(err, template, line, col)
+}
+
+// Helper error policies: how a render handles the error of a helper (compiler.Options.HelperErrors,
+// hbc -helper-errors).
+const (
+	HelperErrorsFail    = "fail"    // the render fails (the default)
+	HelperErrorsEmpty   = "empty"   // the helper renders empty; the error is logged
+	HelperErrorsComment = "comment" // the helper renders the error as an HTML comment; it is logged
+)
+
+// HandleHelperError handles err, returned by helper called at line:col of template, under
+// policy. HelperErrorsFail (or "") returns WrapHelperError(err, ...). HelperErrorsEmpty logs
+// the error with log.Printf and returns nil, so the render continues; HelperErrorsComment
+// also writes it to w as an HTML comment, like MissingPartialOutput. An error from a block
+// body that the helper returns as is has been handled by the body's own policy, so it is
+// returned under every policy.
+func HandleHelperError(w io.Writer, err error, policy, helper, template string, line, col int) error {
+	if err == nil {
+		return nil
+	}
+	_, fromBody := err.(*RenderError)
+	err = WrapHelperError(err, helper, template, line, col)
+	if fromBody || (policy != HelperErrorsEmpty && policy != HelperErrorsComment) {
+		return err
+	}
+	msg := fmt.Sprintf("helper %q: %v", helper, err)
+	log.Printf("[ERROR] %s", msg)
+	if policy == HelperErrorsComment {
+		htmlComment := "<!-- " + commentText(msg) + " -->"
+		if lw, ok := w.(LazyBlockWriter); ok {
+			lw.WriteLazyBlock(func(out io.Writer) {
+				io.WriteString(out, htmlComment)
+			})
+			return nil
+		}
+		io.WriteString(w, htmlComment)
+	}
+	return nil
+}
+
+// commentReplacer escapes the characters that could end an HTML comment or start markup in it.
+var commentReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "-", "&#45;")
+
+// commentText returns s for the text of an HTML comment: with no "-" or ">" left, nothing in
+// it (such as "--->" in a helper error that echoes user input) can close the comment.
+func commentText(s string) string {
+	return commentReplacer.Replace(s)
+}
+
+// PanicError is the error of a helper that panicked, for templates compiled with
+// RecoverHelpers (hbc -recover-helpers).
+type PanicError struct {
+	Value any    // the value passed to panic
+	Stack []byte // the stack trace of the panic; with //line directives it has template positions
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// RecoverHelper calls fn, a block helper call, and returns a panic in it as a *PanicError.
+func RecoverHelper(fn func() error) (err error) {
+	defer recoverPanic(&err)
+	return fn()
+}
+
+// RecoverHelperValue is RecoverHelper for a helper that returns a value.
+func RecoverHelperValue(fn func() (any, error)) (v any, err error) {
+	defer recoverPanic(&err)
+	return fn()
+}
+
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrapError(t *testing.T) {
+	errBoom := errors.New("boom")
+	err := WrapHelperError(errBoom, "check", "card", 2, 3)
+	if want := `template "card" line 2:3: boom`; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	// The call of the partial adds its position; a block helper returning its body's error does not.
+	err = WrapHelperError(WrapError(err, "main", 5, 1), "each", "main", 4, 1)
+	if want := `template "main" line 5:1: template "card" line 2:3: boom`; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if !errors.Is(err, errBoom) {
+		t.Error("errors.Is(err, errBoom) = false")
+	}
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("errors.As(%v, *RenderError) = false", err)
+	}
+	wantStack := []Frame{{Template: "main", Line: 5, Column: 1}, {Template: "card", Line: 2, Column: 3}}
+	if !reflect.DeepEqual(renderErr.Stack, wantStack) || renderErr.Helper != "check" || renderErr.Err != errBoom {
+		t.Errorf("got %+v, want stack %v, helper \"check\" and cause boom", renderErr, wantStack)
+	}
+	if loc := renderErr.Location(); loc != wantStack[1] {
+		t.Errorf("Location() = %v, want %v", loc, wantStack[1])
+	}
+
+	missing := CheckPath(map[string]any{}, "x", PathPos{Template: "card", Line: 3, Column: 1, Path: "x"})
+	if err := WrapError(missing, "card", 1, 1); err != missing {
+		t.Errorf("missing path of the same template: got %v", err)
+	}
+	err = WrapError(missing, "main", 2, 1)
+	if want := `template "main" line 2:1: template "card" line 3:1: "x" is not defined (missing "x")`; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if !errors.As(err, &renderErr) || renderErr.Path != "x" || renderErr.Helper != "" || len(renderErr.Stack) != 2 {
+		t.Errorf("missing path from a partial: got %+v", renderErr)
+	}
+	// Each call of a recursive partial adds its position.
+	err = WrapPartialError(WrapPartialError(WrapHelperError(errBoom, "fail", "tree", 1, 30), "tree", 1, 3), "tree", 1, 3)
+	if want := `template "tree" line 1:3: template "tree" line 1:3: template "tree" line 1:30: boom`; WrapError(err, "tree", 0, 0).Error() != want {
+		t.Errorf("recursive partial: got %q, want %q", WrapError(err, "tree", 0, 0), want)
+	}
+	if err := WrapError(errBoom, "main", 0, 0); err.Error() != `template "main": boom` {
+		t.Errorf("no position: got %q", err)
+	}
+	if WrapError(nil, "main", 1, 1) != nil || WrapHelperError(nil, "x", "main", 1, 1) != nil {
+		t.Error("WrapError(nil) != nil")
+	}
+}
+
+func TestHandleHelperError(t *testing.T) {
+	errBoom := errors.New("boom -->")
+	var b strings.Builder
+	err := HandleHelperError(&b, errBoom, HelperErrorsFail, "check", "main", 2, 3)
+	if want := `template "main" line 2:3: boom -->`; err == nil || err.Error() != want || b.Len() != 0 {
+		t.Errorf("fail: got %v, output %q", err, b.String())
+	}
+	if err := HandleHelperError(&b, errBoom, HelperErrorsEmpty, "check", "main", 2, 3); err != nil || b.Len() != 0 {
+		t.Errorf("empty: got %v, output %q", err, b.String())
+	}
+	if err := HandleHelperError(&b, errBoom, HelperErrorsComment, "check", "main", 2, 3); err != nil {
+		t.Errorf("comment: got %v", err)
+	}
+	if want := `<!-- helper "check": template "main" line 2:3: boom &#45;&#45;&gt; -->`; b.String() != want {
+		t.Errorf("comment: output %q, want %q", b.String(), want)
+	}
+	// Input echoed by the error cannot close the comment.
+	b.Reset()
+	xss := errors.New("bad ---><script>alert(1)</script>")
+	if err := HandleHelperError(&b, xss, HelperErrorsComment, "check", "main", 1, 1); err != nil {
+		t.Errorf("comment: got %v", err)
+	}
+	out := b.String()
+	if body := strings.TrimSuffix(strings.TrimPrefix(out, "<!--"), "-->"); strings.ContainsAny(body, "<>-") {
+		t.Errorf("comment can be closed early: %q", out)
+	}
+	if want := `<!-- helper "check": template "main" line 1:1: bad &#45;&#45;&#45;&gt;&lt;script&gt;alert(1)&lt;/script&gt; -->`; out != want {
+		t.Errorf("comment: output %q, want %q", out, want)
+	}
+	// An error of the block body is not the helper's.
+	bodyErr := WrapError(errBoom, "main", 4, 1)
+	if err := HandleHelperError(&b, bodyErr, HelperErrorsEmpty, "each", "main", 1, 1); err != bodyErr {
+		t.Errorf("body error: got %v", err)
+	}
+}
+
+func TestRecoverHelper(t *testing.T) {
+	errPanic := errors.New("nil map")
+	_, err := RecoverHelperValue(func() (any, error) { panic(errPanic) })
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || !errors.Is(err, errPanic) || len(panicErr.Stack) == 0 {
+		t.Fatalf("RecoverHelperValue: got %v", err)
+	}
+	if err.Error() != "panic: nil map" {
+		t.Errorf("Error() = %q", err)
+	}
+	if err := RecoverHelper(func() error { panic("boom") }); err == nil || err.Error() != "panic: boom" {
+		t.Errorf("RecoverHelper: got %v", err)
+	}
+	if v, err := RecoverHelperValue(func() (any, error) { return 1, nil }); v != 1 || err != nil {
+		t.Errorf("RecoverHelperValue without panic: got %v, %v", v, err)
+	}
+}
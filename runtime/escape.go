@@ -0,0 +1,344 @@
+package runtime
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SafeURL marks a value as a trusted URL: it is written to URL attributes without the scheme
+// check (javascript: and other non-http(s)/mailto schemes are otherwise replaced).
+type SafeURL string
+
+// SafeJS marks a value as a trusted JavaScript expression, written as is inside <script>
+// and on* attributes.
+type SafeJS string
+
+// SafeCSS marks a value as trusted CSS, written as is inside <style> and style attributes.
+type SafeCSS string
+
+// HTMLContext is the position of a {{value}} in HTML output. Templates compiled with
+// contextual escaping (hbc -escape=contextual) pass it to WriteEscapedIn.
+type HTMLContext uint8
+
+// HTML contexts. A context may be combined with HTMLInAttr and HTMLUnquoted.
+const (
+	HTMLText      HTMLContext = iota // element content, comments, <title>, <textarea>
+	HTMLTag                          // inside a tag, where attribute names go
+	HTMLAttr                         // attribute value
+	HTMLURL                          // start of a URL attribute value (href, src, ...)
+	HTMLURLPart                      // URL attribute value after its start, before ? or #
+	HTMLURLQuery                     // URL attribute value after ? or #
+	HTMLJS                           // JavaScript expression (<script>, on* attributes)
+	HTMLJSString                     // inside a JavaScript string literal or comment
+	HTMLCSS                          // CSS value (<style>, style attributes)
+	HTMLCSSString                    // inside a CSS string literal
+
+	// HTMLInAttr marks a value inside an attribute value: the result is also HTML-escaped.
+	HTMLInAttr HTMLContext = 1 << 6
+	// HTMLUnquoted marks a value inside an unquoted attribute value; whitespace and
+	// the characters that would end the value are escaped as well.
+	HTMLUnquoted HTMLContext = 1 << 7
+)
+
+const htmlContextFlags = HTMLInAttr | HTMLUnquoted
+
+// unsafeValue replaces values that cannot be made safe in their context, as html/template does.
+const unsafeValue = "ZgotmplZ"
+
+// WriteEscapedIn writes v escaped for the HTML context c. SafeString is trusted in text, tag and
+// attribute positions, SafeURL in URLs, SafeJS in scripts and SafeCSS in styles; any other
+// value (including SafeString in a URL, script or style) is escaped or filtered.
+func WriteEscapedIn(w io.Writer, c HTMLContext, v any) error {
+	if w == nil || v == nil {
+		return nil
+	}
+	if c == HTMLText {
+		return WriteEscaped(w, v)
+	}
+	s := EscapeIn(c, v)
+	if s == "" {
+		return nil
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// EscapeIn returns v escaped for the HTML context c (see WriteEscapedIn).
+func EscapeIn(c HTMLContext, v any) string {
+	v = RawValue(v)
+	var s string
+	switch c &^ htmlContextFlags {
+	case HTMLText:
+		switch t := v.(type) {
+		case SafeString:
+			return string(t)
+		case TemplateValue:
+			return t.TemplateHTML()
+		}
+		return html.EscapeString(Stringify(v))
+	case HTMLTag:
+		if t, ok := v.(SafeString); ok {
+			return string(t)
+		}
+		return filterAttrName(Stringify(v))
+	case HTMLAttr:
+		if t, ok := v.(SafeString); ok {
+			s = string(t)
+			if c&HTMLUnquoted == 0 {
+				return s
+			}
+			return escapeUnquoted(s)
+		}
+		s = Stringify(v)
+	case HTMLURL:
+		if t, ok := v.(SafeURL); ok {
+			s = normalizeURL(string(t))
+		} else {
+			s = normalizeURL(filterURL(Stringify(v)))
+		}
+	case HTMLURLPart:
+		if t, ok := v.(SafeURL); ok {
+			s = normalizeURL(string(t))
+		} else {
+			s = normalizeURL(Stringify(v))
+		}
+	case HTMLURLQuery:
+		s = escapeURLQuery(Stringify(v))
+	case HTMLJS:
+		if t, ok := v.(SafeJS); ok {
+			s = string(t)
+		} else {
+			s = jsValue(v)
+		}
+	case HTMLJSString:
+		s = escapeJSString(Stringify(v))
+	case HTMLCSS:
+		if t, ok := v.(SafeCSS); ok {
+			s = string(t)
+		} else {
+			s = filterCSS(Stringify(v))
+		}
+	case HTMLCSSString:
+		s = escapeCSSString(Stringify(v))
+	default:
+		s = html.EscapeString(Stringify(v))
+	}
+	if c&HTMLUnquoted != 0 {
+		return escapeUnquoted(html.EscapeString(s))
+	}
+	if c&HTMLInAttr != 0 || c&^htmlContextFlags == HTMLAttr {
+		return html.EscapeString(s)
+	}
+	return s
+}
+
+// filterAttrName keeps values that are plain attribute names (for {{name}} between attributes).
+func filterAttrName(s string) string {
+	if s == "" {
+		return ""
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9' && i > 0:
+		case (c == '-' || c == '_' || c == ':' || c == '.') && i > 0:
+		default:
+			return unsafeValue
+		}
+	}
+	// Event handler attributes would take script from the rest of the tag.
+	if lower := strings.ToLower(s); strings.HasPrefix(lower, "on") && lower != "open" {
+		return unsafeValue
+	}
+	return s
+}
+
+// filterURL replaces URLs whose scheme is not http, https, mailto or tel.
+// Relative URLs (no scheme) are kept.
+func filterURL(s string) string {
+	if i := strings.IndexByte(s, ':'); i >= 0 && !strings.ContainsAny(s[:i], "/?#") {
+		switch strings.ToLower(strings.TrimSpace(s[:i])) {
+		case "http", "https", "mailto", "tel":
+		default:
+			return "#" + unsafeValue
+		}
+	}
+	return s
+}
+
+// normalizeURL percent-encodes the bytes that may not appear in a URL, keeping existing
+// %-escapes and the reserved characters as they are.
+func normalizeURL(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isURLChar(c) || (c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2])) {
+			b.WriteByte(c)
+			continue
+		}
+		writePercent(&b, c)
+	}
+	return b.String()
+}
+
+// escapeURLQuery percent-encodes everything except unreserved characters, for values in the
+// query or fragment of a URL.
+func escapeURLQuery(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) {
+			b.WriteByte(c)
+			continue
+		}
+		writePercent(&b, c)
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isURLChar(c byte) bool {
+	if isUnreserved(c) {
+		return true
+	}
+	switch c {
+	case '!', '#', '$', '&', '*', '+', ',', '/', ':', ';', '=', '?', '@', '[', ']':
+		return true
+	}
+	return false
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+const hexDigits = "0123456789ABCDEF"
+
+func writePercent(b *strings.Builder, c byte) {
+	b.WriteByte('%')
+	b.WriteByte(hexDigits[c>>4])
+	b.WriteByte(hexDigits[c&15])
+}
+
+// jsValue returns v as a JavaScript literal (JSON, with <, > and & escaped).
+func jsValue(v any) string {
+	switch t := v.(type) {
+	case SafeString:
+		v = string(t)
+	case SafeURL:
+		v = string(t)
+	case SafeCSS:
+		v = string(t)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		out, _ = json.Marshal(Stringify(v))
+	}
+	return string(out)
+}
+
+// escapeJSString escapes s for use inside a JavaScript string literal (any quote, template
+// literals included) or comment. Quotes, the HTML-special characters and $, { and } (which would
+// start a ${...} substitution in a template literal) become \uXXXX escapes, so the result is
+// also safe inside <script> and HTML attributes.
+func escapeJSString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '/':
+			b.WriteString(`\/`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\'', '"', '`', '<', '>', '&', '$', '{', '}', 0x2028, 0x2029:
+			writeJSUnicode(&b, r)
+		default:
+			if r < 0x20 {
+				writeJSUnicode(&b, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writeJSUnicode writes r (at most U+FFFF) as a \uXXXX escape.
+func writeJSUnicode(b *strings.Builder, r rune) {
+	b.WriteString(`\u`)
+	for shift := 12; shift >= 0; shift -= 4 {
+		b.WriteByte(hexDigits[(r>>shift)&15])
+	}
+}
+
+// filterCSS keeps CSS values made of plain words, numbers, units, colors and lists.
+func filterCSS(s string) string {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '#' || c == '%' || c == '.' || c == ',' || c == '-' || c == '+' || c == ' ' || c == '_':
+		default:
+			return unsafeValue
+		}
+	}
+	return s
+}
+
+// escapeCSSString escapes s for use inside a CSS string literal: everything but letters,
+// digits and spaces becomes a \HEX escape.
+func escapeCSSString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= 0xA0 || (r < utf8.RuneSelf && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ' ')) {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte('\\')
+		writeHexRune(&b, r)
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func writeHexRune(b *strings.Builder, r rune) {
+	var buf [8]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = hexDigits[r&15]
+		r >>= 4
+		if r == 0 {
+			break
+		}
+	}
+	b.Write(buf[i:])
+}
+
+// escapeUnquoted escapes the characters that would end an unquoted attribute value.
+func escapeUnquoted(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n', '\f', '\r', '=', '`', '<', '>', '"', '\'':
+			b.WriteString("&#")
+			b.WriteString(strconv.Itoa(int(c)))
+			b.WriteByte(';')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
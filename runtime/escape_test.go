@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapeIn(t *testing.T) {
+	u := func(hex string) string { return `\` + "u" + hex } // \uXXXX JavaScript escape
+	tests := []struct {
+		name string
+		c    HTMLContext
+		v    any
+		want string
+	}{
+		{"text", HTMLText, "<b>", "&lt;b&gt;"},
+		{"text safe", HTMLText, SafeString("<b>"), "<b>"},
+		{"attr", HTMLAttr | HTMLInAttr, `a"b`, "a&#34;b"},
+		{"attr unquoted", HTMLAttr | HTMLInAttr | HTMLUnquoted, "a b=c", "a&#32;b&#61;c"},
+		{"attr safe", HTMLAttr | HTMLInAttr, SafeString("a&amp;b"), "a&amp;b"},
+		{"tag name", HTMLTag, "disabled", "disabled"},
+		{"tag injection", HTMLTag, `x onload="alert(1)"`, unsafeValue},
+		{"tag event handler", HTMLTag, "onclick", unsafeValue},
+		{"url", HTMLURL | HTMLInAttr, "https://example.com/a b?x=1&y=2", "https://example.com/a%20b?x=1&amp;y=2"},
+		{"url relative", HTMLURL | HTMLInAttr, "/posts/1", "/posts/1"},
+		{"url javascript", HTMLURL | HTMLInAttr, "javascript:alert(1)", "#" + unsafeValue},
+		{"url javascript mixed case", HTMLURL | HTMLInAttr, " JavaScript:alert(1)", "#" + unsafeValue},
+		{"url safe", HTMLURL | HTMLInAttr, SafeURL("javascript:void(0)"), "javascript:void%280%29"},
+		{"url safe string is not trusted", HTMLURL | HTMLInAttr, SafeString("javascript:x"), "#" + unsafeValue},
+		{"url part", HTMLURLPart | HTMLInAttr, "a b/c:d", "a%20b/c:d"},
+		{"url query", HTMLURLQuery | HTMLInAttr, "a&b=c d", "a%26b%3Dc%20d"},
+		{"js value", HTMLJS, map[string]any{"a": "</script>"}, `{"a":"` + u("003c") + "/script" + u("003e") + `"}`},
+		{"js string value", HTMLJS, "x", `"x"`},
+		{"js number", HTMLJS, 42, "42"},
+		{"js safe", HTMLJS, SafeJS("init()"), "init()"},
+		{"js in attr", HTMLJS | HTMLInAttr, "a", "&#34;a&#34;"},
+		{"js string", HTMLJSString, `'a'\` + "\n", u("0027") + "a" + u("0027") + `\\\n`},
+		{"js string script end", HTMLJSString, "</script>", u("003C") + `\/script` + u("003E")},
+		{"js string template literal", HTMLJSString, "${alert(document.cookie)}", u("0024") + u("007B") + "alert(document.cookie)" + u("007D")},
+		{"css", HTMLCSS, "#fff", "#fff"},
+		{"css injection", HTMLCSS, "red; background: url(x)", unsafeValue},
+		{"css safe", HTMLCSS, SafeCSS("url(/a.png)"), "url(/a.png)"},
+		{"css string", HTMLCSSString, `a"b`, `a\22 b`},
+		{"nil", HTMLAttr, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EscapeIn(tt.c, tt.v); got != tt.want {
+				t.Errorf("EscapeIn(%v, %#v) = %q, want %q", tt.c, tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteEscapedIn(t *testing.T) {
+	var b strings.Builder
+	if err := WriteEscapedIn(&b, HTMLText, "<i>"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteEscapedIn(&b, HTMLURLQuery|HTMLInAttr, "a b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteEscapedIn(&b, HTMLJS, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != "&lt;i&gt;a%20b" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,83 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/andriyg76/hexerr"
+)
+
+// Escaper escapes the string form of a {{value}} for an output format. Templates compiled with
+// an escaper's name as their output mode (hbc -escape=csv, {{!-- escape: csv --}}) write
+// every {{value}} through it.
+type Escaper func(s string) string
+
+var escapers = struct {
+	mu sync.RWMutex
+	m  map[string]Escaper
+}{m: map[string]Escaper{
+	"csv":         EscapeCSV,
+	"json-string": EscapeJSONString,
+	"shell":       EscapeShell,
+}}
+
+// RegisterEscaper registers e under name, replacing an escaper of the same name
+// (including the built-in csv, json-string and shell).
+func RegisterEscaper(name string, e Escaper) {
+	escapers.mu.Lock()
+	defer escapers.mu.Unlock()
+	escapers.m[name] = e
+}
+
+// LookupEscaper returns the escaper registered under name.
+func LookupEscaper(name string) (Escaper, bool) {
+	escapers.mu.RLock()
+	defer escapers.mu.RUnlock()
+	e, ok := escapers.m[name]
+	return e, ok
+}
+
+// WriteEscapedWith writes v escaped by the escaper registered under name. SafeString values are
+// written as is.
+func WriteEscapedWith(w io.Writer, name string, v any) error {
+	if w == nil || v == nil {
+		return nil
+	}
+	if t, ok := v.(SafeString); ok {
+		_, err := io.WriteString(w, string(t))
+		return err
+	}
+	e, ok := LookupEscaper(name)
+	if !ok {
+		return hexerr.Newf("escaper %q is not registered", name)
+	}
+	_, err := io.WriteString(w, e(Stringify(v)))
+	return err
+}
+
+// EscapeCSV returns s as a CSV field: quoted, with quotes doubled, when it contains a comma,
+// a quote or a line break.
+func EscapeCSV(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// EscapeJSONString returns s escaped for the inside of a JSON string literal (without the quotes).
+func EscapeJSONString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // a string always encodes
+	out := bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+	return string(out[1 : len(out)-1])
+}
+
+// EscapeShell returns s as a single POSIX shell word, in single quotes.
+func EscapeShell(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
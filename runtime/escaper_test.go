@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapers(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"csv", "plain", "plain"},
+		{"csv", `say "hi", ok`, `"say ""hi"", ok"`},
+		{"csv", "two\nlines", "\"two\nlines\""},
+		{"json-string", "a\"b\\c\n<d>", `a\"b\\c\n<d>`},
+		{"shell", "it's $HOME", `'it'\''s $HOME'`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := WriteEscapedWith(&b, tt.name, tt.in); err != nil {
+			t.Fatalf("%s(%q): %v", tt.name, tt.in, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("%s(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+
+	var b strings.Builder
+	if err := WriteEscapedWith(&b, "yaml", "x"); err == nil || err.Error() != `escaper "yaml" is not registered` {
+		t.Fatalf("unregistered escaper: err = %v", err)
+	}
+	RegisterEscaper("yaml", func(s string) string { return `"` + s + `"` })
+	t.Cleanup(func() {
+		escapers.mu.Lock()
+		delete(escapers.m, "yaml")
+		escapers.mu.Unlock()
+	})
+	if err := WriteEscapedWith(&b, "yaml", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteEscapedWith(&b, "yaml", SafeString("[1]")); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != `"x"[1]` {
+		t.Fatalf("got %q", got)
+	}
+}
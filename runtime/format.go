@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Formatter returns the text of a value of the type it is registered for (see
+// RegisterFormatter).
+type Formatter func(v any) string
+
+// TemplateValue is implemented by types that control how templates write and test them.
+type TemplateValue interface {
+	// TemplateHTML returns what {{value}} writes in HTML output; it is not escaped again.
+	TemplateHTML() string
+	// TemplateString returns what {{{value}}} writes, and the text other output modes, HTML
+	// attributes, URLs, scripts and helpers escape or use (see Stringify).
+	TemplateString() string
+	// TemplateTruthy reports whether the value is true for {{#if}}, {{#unless}} and
+	// {{#with}} (see IsTruthy).
+	TemplateTruthy() bool
+}
+
+var formatters = struct {
+	mu     sync.RWMutex
+	types  map[reflect.Type]Formatter
+	ifaces []typeFormatter // in registration order
+	cache  sync.Map        // reflect.Type -> Formatter, nil when none applies
+	set    atomic.Bool     // a formatter is registered
+}{types: map[reflect.Type]Formatter{}}
+
+type typeFormatter struct {
+	t reflect.Type
+	f Formatter
+}
+
+// RegisterFormatter registers f for output of values of type t, replacing a formatter
+// registered for t before. When t is an interface type, f formats the values whose type
+// implements it and has no formatter of its own; interfaces are tried in the order they were
+// registered. Formatters apply wherever values are converted to text (Stringify), so
+// {{value}}, {{{value}}} and helpers that take strings see their result, and take precedence
+// over fmt.Stringer. They are global: register them before rendering, for example in init.
+func RegisterFormatter(t reflect.Type, f Formatter) {
+	formatters.mu.Lock()
+	defer formatters.mu.Unlock()
+	if t.Kind() == reflect.Interface {
+		for i, tf := range formatters.ifaces {
+			if tf.t == t {
+				formatters.ifaces = append(formatters.ifaces[:i], formatters.ifaces[i+1:]...)
+				break
+			}
+		}
+		formatters.ifaces = append(formatters.ifaces, typeFormatter{t, f})
+	} else {
+		formatters.types[t] = f
+	}
+	formatters.cache.Clear()
+	formatters.set.Store(true)
+}
+
+// RegisterFormatterFor registers f for values of type T, which may be an interface type, as
+// RegisterFormatter does:
+//
+//	runtime.RegisterFormatterFor(func(t time.Time) string { return t.Format(time.DateOnly) })
+func RegisterFormatterFor[T any](f func(T) string) {
+	RegisterFormatter(reflect.TypeFor[T](), func(v any) string { return f(v.(T)) })
+}
+
+// LookupFormatter returns the formatter for values of type t: the one registered for t, else
+// the first registered for an interface t implements.
+func LookupFormatter(t reflect.Type) (Formatter, bool) {
+	if f, ok := formatters.cache.Load(t); ok {
+		return f.(Formatter), f.(Formatter) != nil
+	}
+	formatters.mu.RLock()
+	f := formatters.types[t]
+	if f == nil {
+		for _, tf := range formatters.ifaces {
+			if t.Implements(tf.t) {
+				f = tf.f
+				break
+			}
+		}
+	}
+	// Stored under the read lock, so that RegisterFormatter cannot clear the cache in between.
+	formatters.cache.Store(t, f)
+	formatters.mu.RUnlock()
+	return f, f != nil
+}
+
+// format returns the text of v from its registered formatter, if it has one.
+func format(v any) (string, bool) {
+	if !formatters.set.Load() {
+		return "", false
+	}
+	f, ok := LookupFormatter(reflect.TypeOf(v))
+	if !ok {
+		return "", false
+	}
+	return f(v), true
+}
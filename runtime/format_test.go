@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMoney struct{ cents int }
+
+type testStamp time.Time
+
+func (s testStamp) String() string { return "stamp" }
+
+type testAmount interface{ Amount() float64 }
+
+type testFee float64
+
+func (f testFee) Amount() float64 { return float64(f) }
+
+type testTax float64
+
+func (t testTax) Amount() float64 { return float64(t) }
+
+type testBadge struct{ n int }
+
+func (b testBadge) TemplateHTML() string   { return fmt.Sprintf("<b>%d</b>", b.n) }
+func (b testBadge) TemplateString() string { return fmt.Sprintf("%d new", b.n) }
+func (b testBadge) TemplateTruthy() bool   { return b.n > 0 }
+
+func TestFormatters(t *testing.T) {
+	RegisterFormatterFor(func(m testMoney) string { return fmt.Sprintf("$%d.%02d", m.cents/100, m.cents%100) })
+	RegisterFormatterFor(func(s testStamp) string { return time.Time(s).Format(time.DateOnly) })
+	RegisterFormatter(reflect.TypeFor[testAmount](), func(v any) string {
+		return fmt.Sprintf("%.1f%%", v.(testAmount).Amount())
+	})
+	RegisterFormatterFor(func(t testTax) string { return "tax" })
+
+	stamp := testStamp(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	for _, tt := range []struct {
+		v    any
+		want string
+	}{
+		{testMoney{1205}, "$12.05"},
+		{stamp, "2026-03-01"},   // before fmt.Stringer
+		{testFee(2.5), "2.5%"},  // by interface
+		{testTax(7), "tax"},     // its own formatter before the interface's
+		{&testMoney{5}, "&{5}"}, // formatters apply to their exact type
+		{42, "42"},
+	} {
+		if got := Stringify(tt.v); got != tt.want {
+			t.Errorf("Stringify(%#v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+
+	var b strings.Builder
+	_ = WriteEscaped(&b, testMoney{-0})
+	_ = WriteRaw(&b, testFee(1))
+	_ = WriteEscapedWith(&b, "csv", testFee(1))
+	if got, want := b.String(), "$0.001.0%1.0%"; got != want {
+		t.Errorf("writes = %q, want %q", got, want)
+	}
+	if got := EscapeIn(HTMLAttr, testMoney{100}); got != "$1.00" {
+		t.Errorf("EscapeIn = %q", got)
+	}
+	if got := StringifyJS([]any{testMoney{1}, stamp}); got != "$0.01,2026-03-01" {
+		t.Errorf("StringifyJS = %q", got)
+	}
+
+	// A later registration for a type replaces the earlier one.
+	RegisterFormatterFor(func(m testMoney) string { return "money" })
+	if got := Stringify(testMoney{1}); got != "money" {
+		t.Errorf("replaced formatter: got %q", got)
+	}
+	if _, ok := LookupFormatter(reflect.TypeFor[int]()); ok {
+		t.Error("int has a formatter")
+	}
+}
+
+func TestTemplateValue(t *testing.T) {
+	var b strings.Builder
+	_ = WriteEscaped(&b, testBadge{3})
+	b.WriteString("|")
+	_ = WriteRaw(&b, testBadge{3})
+	b.WriteString("|")
+	_ = WriteEscapedIn(&b, HTMLText, testBadge{3})
+	b.WriteString("|")
+	_ = WriteEscapedIn(&b, HTMLAttr, testBadge{3})
+	b.WriteString("|")
+	_ = WriteEscapedWith(&b, "shell", testBadge{3})
+	want := "<b>3</b>|3 new|<b>3</b>|3 new|'3 new'"
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !IsTruthy(testBadge{1}) || IsTruthy(testBadge{0}) {
+		t.Error("IsTruthy does not use TemplateTruthy")
+	}
+	if got := JSValue(testBadge{2}); got != (testBadge{2}) {
+		t.Errorf("JSValue = %#v", got)
+	}
+}
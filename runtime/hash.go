@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"strings"
 
 	"github.com/andriyg76/hexerr"
 )
@@ -46,26 +45,15 @@ func MergePartialContext(base, additions map[string]any) map[string]any {
 	return out
 }
 
-// LookupPath returns the value at the dot-separated path from root (e.g. "title", "user.name").
-// Root can be map[string]any or implement Raw() any returning a map. Used for @root.xxx in partials.
+// LookupPath returns the value at the dot-separated path from root (e.g. "title", "user.name"),
+// or nil for an empty path. Generated code looks up untyped paths and @root.xxx in partials
+// with it; each segment is looked up with Resolve, so maps, Go structs and their methods, and
+// slices are all found. Function values on the path are called (see ValueOf).
 func LookupPath(root any, path string) any {
-	m := contextMapFromAny(root)
-	if m == nil || path == "" {
+	if path == "" {
 		return nil
 	}
-	parts := strings.Split(path, ".")
-	var cur any = m
-	for _, key := range parts {
-		if cur == nil {
-			return nil
-		}
-		if m, ok := cur.(map[string]any); ok {
-			cur = m[key]
-			continue
-		}
-		return nil
-	}
-	return cur
+	return ResolvePath(root, path)
 }
 
 func contextMapFromAny(ctx any) map[string]any {
@@ -88,7 +76,7 @@ func contextMapFromAny(ctx any) map[string]any {
 func MissingPartialOutput(w io.Writer, name string) {
 	msg := fmt.Sprintf("partial %q is not defined", name)
 	log.Printf("[ERROR] %s", msg)
-	htmlComment := "<!-- " + msg + " -->"
+	htmlComment := "<!-- " + commentText(msg) + " -->"
 	if lw, ok := w.(LazyBlockWriter); ok {
 		lw.WriteLazyBlock(func(out io.Writer) {
 			io.WriteString(out, htmlComment)
@@ -1,6 +1,10 @@
 package runtime
 
-import "io"
+import (
+	"io"
+
+	"github.com/andriyg76/hexerr"
+)
 
 // Helper is a user-defined function invoked from a template.
 // It receives only args (no context); values are resolved by the compiler.
@@ -27,3 +31,66 @@ func GetBlockOptions(args []any) (BlockOptions, bool) {
 	}
 	return BlockOptions{}, false
 }
+
+// CallHelper calls h, a Helper, an OptionsHelper or a function with the signature of one,
+// with args and options, as generated code calls helpers: a Helper gets a non-empty
+// options.Hash as its last argument. ok is false when h is none of these. pkg/interpreter
+// and the bytecode VM call the helpers of their templates with it.
+func CallHelper(h any, args []any, options *HelperOptions) (v any, ok bool, err error) {
+	switch fn := h.(type) {
+	case Helper:
+		v, err = fn(appendHash(args, options.Hash))
+	case func([]any) (any, error):
+		v, err = fn(appendHash(args, options.Hash))
+	case OptionsHelper:
+		v, err = fn(args, options)
+	case func([]any, *HelperOptions) (any, error):
+		v, err = fn(args, options)
+	default:
+		return nil, false, nil
+	}
+	return v, true, err
+}
+
+// CallBlockHelper is CallHelper for block helpers. An OptionsBlockHelper gets options, whose
+// body and {{else}} section are set with SetBlock; a BlockHelper gets block, which renders
+// them with the caller's context, and a legacy func([]any) error finds block among its
+// arguments (GetBlockOptions). Both get a non-empty options.Hash after args and require at
+// least one argument. ok is false when h is none of these.
+func CallBlockHelper(w io.Writer, h any, args []any, options *HelperOptions, block BlockOptions) (ok bool, err error) {
+	var call func(w io.Writer, args []any, options *HelperOptions) error
+	switch fn := h.(type) {
+	case OptionsBlockHelper:
+		call = fn
+	case func(io.Writer, []any, *HelperOptions) error:
+		call = fn
+	case BlockHelper, func([]any, BlockOptions) error, func([]any) error:
+	default:
+		return false, nil
+	}
+	if call != nil {
+		return true, call(w, args, options)
+	}
+	if len(args) == 0 {
+		return true, hexerr.Newf("block helper %q requires at least one argument", options.Name)
+	}
+	args = appendHash(args, options.Hash)
+	switch fn := h.(type) {
+	case BlockHelper:
+		return true, fn(args, block)
+	case func([]any, BlockOptions) error:
+		return true, fn(args, block)
+	case func([]any) error:
+		return true, fn(append(args, block))
+	}
+	return false, nil
+}
+
+// appendHash appends a non-empty hash to args, as generated code passes it to helpers
+// without HelperOptions.
+func appendHash(args []any, hash Hash) []any {
+	if len(hash) == 0 {
+		return args
+	}
+	return append(args, hash)
+}
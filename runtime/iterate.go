@@ -0,0 +1,216 @@
+package runtime
+
+import (
+	"iter"
+	"reflect"
+)
+
+// Iterable is implemented by collections that {{#each}} iterates without building a slice:
+// All yields the key and value of each entry in order. The key is what @index and @key are
+// set to (as for slices and maps, the position for sequences).
+type Iterable interface {
+	All() iter.Seq2[any, any]
+}
+
+// EachItem is one iteration of {{#each}}: the entry's key and value, and whether it is the
+// first or the last entry.
+type EachItem struct {
+	Key   any
+	Value any
+	First bool
+	Last  bool
+}
+
+// Frame returns the @data frame of the iteration: @index and @key are the key, as in
+// EachFrame, and @first and @last are set.
+func (it EachItem) Frame(parent *DataFrame) *DataFrame {
+	return NewDataFrame(parent).
+		Set("index", it.Key).
+		Set("key", it.Key).
+		Set("first", it.First).
+		Set("last", it.Last)
+}
+
+// Each returns the iterations of {{#each}} over v. Slices, arrays and maps with string keys
+// yield their Entries, Go maps in sorted key order. An iter.Seq (keyed by position), an
+// iter.Seq2, a channel that can be received from (keyed by position, until it is closed) and
+// an Iterable such as an OrderedMap are consumed lazily, one entry ahead of the template so
+// that Last is known. Other values yield nothing.
+func Each(v any) iter.Seq[EachItem] {
+	if c, ok := v.(Iterable); ok {
+		return lookahead(c.All())
+	}
+	v = RawValue(v)
+	switch c := v.(type) {
+	case nil:
+		return noItems
+	case Iterable:
+		return lookahead(c.All())
+	case iter.Seq2[any, any]:
+		return lookahead(c)
+	case iter.Seq[any]:
+		return lookahead(positions(c))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Func:
+		t := rv.Type()
+		if rv.IsNil() || t.NumIn() != 1 || t.NumOut() != 0 || !isYield(t.In(0)) {
+			return noItems
+		}
+		if t.In(0).NumIn() == 2 {
+			return lookahead(func(yield func(any, any) bool) {
+				for k, v := range rv.Seq2() {
+					if !yield(k.Interface(), v.Interface()) {
+						return
+					}
+				}
+			})
+		}
+		return lookahead(positions(values(rv)))
+	case reflect.Chan:
+		if rv.IsNil() || rv.Type().ChanDir()&reflect.RecvDir == 0 {
+			return noItems
+		}
+		return lookahead(positions(values(rv)))
+	}
+	entries := Entries(v)
+	return func(yield func(EachItem) bool) {
+		for i, e := range entries {
+			if !yield(EachItem{Key: e.Key, Value: e.Value, First: i == 0, Last: i == len(entries)-1}) {
+				return
+			}
+		}
+	}
+}
+
+func noItems(func(EachItem) bool) {}
+
+// Element is one iteration of {{#each}} over a typed collection of a generated context: the
+// element's position and value, and whether it is the first or the last element.
+type Element[T any] struct {
+	Index int
+	Value T
+	First bool
+	Last  bool
+}
+
+// Elements returns the iterations of {{#each}} over the typed collection key of ctx, a
+// generated context. The elements of a context of your own are those all returns. A
+// map-backed context (its Raw value is a map[string]any) has them in the value of key,
+// resolved with env (see Env.Value): an iterator, a channel or an Iterable is consumed
+// lazily, as Each does, so that the render's limits and context stop an unbounded one, and
+// other values are converted by SliceOf. elem makes the element of an object; elements that
+// are not objects are the zero T. Generated {{#each}} loops over typed collections use it.
+func Elements[T any](env *Env, ctx interface{ Raw() any }, key string, all func() []T, elem func(map[string]any) T) (iter.Seq[Element[T]], error) {
+	m, ok := ctx.Raw().(map[string]any)
+	if !ok {
+		items := all()
+		return func(yield func(Element[T]) bool) {
+			for i, v := range items {
+				if !yield(Element[T]{Index: i, Value: v, First: i == 0, Last: i == len(items)-1}) {
+					return
+				}
+			}
+		}, nil
+	}
+	v, err := env.Value(Field(m, key))
+	if err != nil {
+		return nil, err
+	}
+	toElem := func(v any) T {
+		var e T
+		if m := MapOf(v); m != nil {
+			e = elem(m)
+		}
+		return e
+	}
+	if v = RawValue(v); sequential(v) {
+		return func(yield func(Element[T]) bool) {
+			i := 0
+			for it := range Each(v) {
+				if !yield(Element[T]{Index: i, Value: toElem(it.Value), First: it.First, Last: it.Last}) {
+					return
+				}
+				i++
+			}
+		}, nil
+	}
+	items := SliceOf(v)
+	return func(yield func(Element[T]) bool) {
+		for i, v := range items {
+			if !yield(Element[T]{Index: i, Value: toElem(v), First: i == 0, Last: i == len(items)-1}) {
+				return
+			}
+		}
+	}, nil
+}
+
+// isYield reports whether t is the yield function of an iter.Seq or iter.Seq2.
+func isYield(t reflect.Type) bool {
+	return t.Kind() == reflect.Func && (t.NumIn() == 1 || t.NumIn() == 2) &&
+		t.NumOut() == 1 && t.Out(0).Kind() == reflect.Bool
+}
+
+// values returns the values yielded by rv, an iter.Seq or a channel.
+func values(rv reflect.Value) iter.Seq[any] {
+	return func(yield func(any) bool) {
+		for v := range rv.Seq() {
+			if !yield(v.Interface()) {
+				return
+			}
+		}
+	}
+}
+
+// positions keys the values of seq by their position.
+func positions(seq iter.Seq[any]) iter.Seq2[any, any] {
+	return func(yield func(any, any) bool) {
+		i := 0
+		for v := range seq {
+			if !yield(i, v) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// lookahead yields the entries of seq one entry behind it, so that the last one is known.
+func lookahead(seq iter.Seq2[any, any]) iter.Seq[EachItem] {
+	if seq == nil {
+		return noItems
+	}
+	return func(yield func(EachItem) bool) {
+		var prev EachItem
+		n := 0
+		for k, v := range seq {
+			if n > 0 && !yield(prev) {
+				return
+			}
+			prev = EachItem{Key: k, Value: v, First: n == 0}
+			n++
+		}
+		if n > 0 {
+			prev.Last = true
+			yield(prev)
+		}
+	}
+}
+
+// ElementSlice returns the elements Elements iterates as a slice, for the block helpers that
+// take a typed collection of a generated context ({{#sortBy posts "date"}}).
+func ElementSlice[T any](env *Env, ctx interface{ Raw() any }, key string, all func() []T, elem func(map[string]any) T) ([]T, error) {
+	if _, ok := ctx.Raw().(map[string]any); !ok {
+		return all(), nil
+	}
+	seq, err := Elements(env, ctx, key, all, elem)
+	if err != nil {
+		return nil, err
+	}
+	var out []T
+	for e := range seq {
+		out = append(out, e.Value)
+	}
+	return out, nil
+}
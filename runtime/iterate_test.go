@@ -0,0 +1,163 @@
+package runtime
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type letters string
+
+func (l letters) All() iter.Seq2[any, any] {
+	return func(yield func(any, any) bool) {
+		for i, r := range l {
+			if !yield(i, string(r)) {
+				return
+			}
+		}
+	}
+}
+
+// items renders the iterations of Each(v) as key=value, with ^ for First and $ for Last.
+func items(v any) string {
+	var parts []string
+	for it := range Each(v) {
+		s := fmt.Sprintf("%v=%v", it.Key, it.Value)
+		if it.First {
+			s = "^" + s
+		}
+		if it.Last {
+			s += "$"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestEach(t *testing.T) {
+	ch := make(chan string, 2)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	recv := make(chan int, 1)
+	recv <- 5
+	close(recv)
+	for _, tt := range []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"slice", []any{"a", "b", "c"}, "^0=a 1=b 2=c$"},
+		{"typed slice", []int{7}, "^0=7$"},
+		{"map", map[string]int{"b": 2, "a": 1}, "^a=1 b=2$"},
+		{"seq", slices.Values([]string{"a", "b"}), "^0=a 1=b$"},
+		{"seq any", iter.Seq[any](slices.Values([]any{1})), "^0=1$"},
+		{"seq2", maps.All(map[string]int{"k": 1}), "^k=1$"},
+		{"seq2 any", iter.Seq2[any, any](func(yield func(any, any) bool) { yield("x", 1) }), "^x=1$"},
+		{"chan", ch, "^0=a 1=b$"},
+		{"receive-only chan", (<-chan int)(recv), "^0=5$"},
+		{"iterable", letters("hi"), "^0=h 1=i$"},
+		{"empty seq", slices.Values([]string(nil)), ""},
+		{"send-only chan", make(chan<- int), ""},
+		{"other func", func(int) {}, ""},
+		{"string", "abc", ""},
+		{"nil", nil, ""},
+	} {
+		if got := items(tt.v); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSliceOfIterator(t *testing.T) {
+	if s := SliceOf(maps.All(map[string]int{"k": 1})); len(s) != 1 || s[0] != 1 {
+		t.Errorf("SliceOf(seq2) = %v", s)
+	}
+	if s := SliceOf(letters("ab")); len(s) != 2 || s[1] != "b" {
+		t.Errorf("SliceOf(iterable) = %v", s)
+	}
+	if SliceOf(nil) != nil {
+		t.Error("SliceOf(nil) is not nil")
+	}
+}
+
+func TestEachStops(t *testing.T) {
+	pulled := 0
+	seq := func(yield func(int) bool) {
+		for i := 0; ; i++ {
+			pulled++
+			if !yield(i) {
+				return
+			}
+		}
+	}
+	n := 0
+	for range Each(seq) {
+		if n++; n == 2 {
+			break
+		}
+	}
+	// One entry ahead of the loop: the third is pulled to tell that the second is not last.
+	if pulled != 3 {
+		t.Errorf("pulled %d entries, want 3", pulled)
+	}
+}
+
+type testRow struct{ m map[string]any }
+
+func (r testRow) Raw() any { return r.m }
+
+// testOwnContext is a context type of one's own: its Raw value is not a map.
+type testOwnContext struct{}
+
+func (testOwnContext) Raw() any { return testOwnContext{} }
+
+func TestElements(t *testing.T) {
+	elem := func(m map[string]any) testRow { return testRow{m} }
+	// elements renders the iterations as index=name, with ^ for First and $ for Last, stopping
+	// after max.
+	elements := func(ctx interface{ Raw() any }, all func() []testRow, max int) string {
+		seq, err := Elements(nil, ctx, "rows", all, elem)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		var parts []string
+		for e := range seq {
+			s := fmt.Sprintf("%d=%v", e.Index, e.Value.m["name"])
+			if e.First {
+				s = "^" + s
+			}
+			if e.Last {
+				s += "$"
+			}
+			if parts = append(parts, s); len(parts) == max {
+				break
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	all := func() []testRow { return []testRow{{map[string]any{"name": "own"}}} }
+	unbounded := func(yield func(any) bool) {
+		for i := 0; yield(map[string]any{"name": i}); i++ {
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		ctx  interface{ Raw() any }
+		want string
+	}{
+		{"own context", testOwnContext{}, "^0=own$"},
+		{"slice", testRow{map[string]any{"rows": []any{map[string]any{"name": "a"}, 1}}}, "^0=a 1=<nil>$"},
+		{"unbounded seq", testRow{map[string]any{"rows": unbounded}}, "^0=0 1=1 2=2"},
+		{"function", testRow{map[string]any{"rows": func() any { return []map[string]any{{"name": "f"}} }}}, "^0=f$"},
+		{"failing function", testRow{map[string]any{"rows": func() (any, error) { return nil, fmt.Errorf("db down") }}}, "error: db down"},
+		{"not a collection", testRow{map[string]any{"rows": map[string]any{"name": "m"}}}, ""},
+	} {
+		if got := elements(tt.ctx, all, 3); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
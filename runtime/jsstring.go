@@ -0,0 +1,152 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// StringifyJS converts a value to a string as JavaScript's String(value) does, for output
+// that matches handlebars.js: nil is empty, numbers format as Number.prototype.toString
+// (1e21, 100000000000000000000, 0.000001, 1e-7, NaN, Infinity), slices and arrays join
+// their elements with "," (nil elements are empty), and maps and structs print
+// "[object Object]". Strings, TemplateValue values, values with a formatter (see
+// RegisterFormatter), errors and fmt.Stringer values print as with Stringify.
+func StringifyJS(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case SafeString:
+		return string(t)
+	case TemplateValue:
+		return t.TemplateString()
+	}
+	if s, ok := format(v); ok {
+		return s
+	}
+	switch t := v.(type) {
+	case []byte:
+		return string(t)
+	case bool:
+		return strconv.FormatBool(t)
+	case float64:
+		return FormatNumberJS(t)
+	case float32:
+		return formatFloatJS(float64(t), 32)
+	case int:
+		return strconv.Itoa(t)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return FormatNumberJS(f)
+		}
+		return t.String()
+	case *OrderedMap:
+		return "[object Object]"
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	}
+	if r, ok := v.(interface{ Raw() any }); ok {
+		return StringifyJS(r.Raw())
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool())
+	case reflect.String:
+		return rv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32:
+		return formatFloatJS(rv.Float(), 32)
+	case reflect.Float64:
+		return FormatNumberJS(rv.Float())
+	case reflect.Slice, reflect.Array:
+		parts := make([]string, rv.Len())
+		for i := range parts {
+			parts[i] = StringifyJS(rv.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	case reflect.Map, reflect.Struct:
+		return "[object Object]"
+	}
+	return fmt.Sprint(v)
+}
+
+// FormatNumberJS formats f as JavaScript's Number.prototype.toString does: the shortest
+// digits that read back as f, in plain notation for exponents from -7 to 20 and in
+// exponent notation (1e+21, 1.5e-7) otherwise.
+func FormatNumberJS(f float64) string {
+	return formatFloatJS(f, 64)
+}
+
+func formatFloatJS(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	// d.ddde±x: the digits and the position n of the decimal point after the first digit.
+	e := strconv.FormatFloat(f, 'e', -1, bitSize)
+	mant, exp, _ := strings.Cut(e, "e")
+	digits := strings.Replace(mant, ".", "", 1)
+	x, _ := strconv.Atoi(exp)
+	n, k := x+1, len(digits)
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k)
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:]
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits
+	}
+	out := digits[:1]
+	if k > 1 {
+		out += "." + digits[1:]
+	}
+	if n-1 >= 0 {
+		return sign + out + "e+" + strconv.Itoa(n-1)
+	}
+	return sign + out + "e-" + strconv.Itoa(1-n)
+}
+
+// JSValue returns v for output in the JavaScript-compatible stringify mode (hbc -stringify js):
+// strings, nil and TemplateValue values as they are, so that SafeString, the other safe types
+// and TemplateHTML keep their meaning, and other values as StringifyJS(v).
+func JSValue(v any) any {
+	switch v.(type) {
+	case nil, string, SafeString, TemplateValue:
+		return v
+	case json.Number:
+		return StringifyJS(v)
+	}
+	if reflect.TypeOf(v).Kind() == reflect.String {
+		return v
+	}
+	return StringifyJS(v)
+}
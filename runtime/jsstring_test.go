@@ -0,0 +1,68 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestStringifyJS(t *testing.T) {
+	for _, tt := range []struct {
+		v    any
+		want string
+	}{
+		{nil, ""},
+		{false, "false"},
+		{true, "true"},
+		{"a<b", "a<b"},
+		{0, "0"},
+		{-7, "-7"},
+		{uint8(7), "7"},
+		{100.0, "100"},
+		{123.456, "123.456"},
+		{0.30000000000000004, "0.30000000000000004"},
+		{-0.5, "-0.5"},
+		{math.Copysign(0, -1), "0"},
+		{1e20, "100000000000000000000"},
+		{1e21, "1e+21"},
+		{2.5e25, "2.5e+25"},
+		{0.000001, "0.000001"},
+		{1e-7, "1e-7"},
+		{-1.5e-10, "-1.5e-10"},
+		{float32(0.1), "0.1"},
+		{math.NaN(), "NaN"},
+		{math.Inf(1), "Infinity"},
+		{math.Inf(-1), "-Infinity"},
+		{json.Number("1.50"), "1.5"},
+		{json.Number("1e21"), "1e+21"},
+		{[]any{"a", "b"}, "a,b"},
+		{[]any{1, nil, []any{2.5, "c"}, map[string]any{}}, "1,,2.5,c,[object Object]"},
+		{[]int{1, 2}, "1,2"},
+		{map[string]any{"a": 1}, "[object Object]"},
+		{struct{ A int }{1}, "[object Object]"},
+		{&struct{ A int }{1}, "[object Object]"},
+		{NewOrderedMap().Set("a", 1), "[object Object]"},
+		{errors.New("boom"), "boom"},
+		{SafeString("<b>"), "<b>"},
+	} {
+		if got := StringifyJS(tt.v); got != tt.want {
+			t.Errorf("StringifyJS(%#v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestJSValue(t *testing.T) {
+	if v := JSValue(SafeString("<b>")); v != SafeString("<b>") {
+		t.Errorf("JSValue(SafeString) = %#v", v)
+	}
+	if v := JSValue(SafeURL("/a")); v != SafeURL("/a") {
+		t.Errorf("JSValue(SafeURL) = %#v", v)
+	}
+	if v := JSValue([]any{"a", 1.0}); v != "a,1" {
+		t.Errorf("JSValue(slice) = %#v", v)
+	}
+	if v := JSValue(json.Number("2.0")); v != "2" {
+		t.Errorf("JSValue(json.Number) = %#v", v)
+	}
+}
@@ -0,0 +1,158 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Limits bound the resources of one render, for templates that are not trusted: a
+// recursive partial ({{> self}}) or nested {{#each}} over big data fails the render with a
+// *LimitError instead of exhausting memory or running forever. Zero values mean no limit.
+type Limits struct {
+	MaxPartialDepth int           // partials nested deeper than this fail; the rendered template is at depth 0
+	MaxOutputBytes  int64         // the output written to the render's writer
+	MaxIterations   int64         // {{#each}} iterations and block helper body renders, counted over the render
+	Timeout         time.Duration // wall-clock time of the render, from its start
+}
+
+// Names of the limits, in LimitError.Limit.
+const (
+	LimitPartialDepth = "partial depth"
+	LimitOutputBytes  = "output bytes"
+	LimitIterations   = "loop iterations"
+	LimitTimeout      = "render time"
+)
+
+// LimitError is the error of a render that exceeded one of its Limits. It is the cause of
+// the *RenderError the render returns; use errors.As to get it.
+type LimitError struct {
+	Limit string // one of the Limit constants
+	Max   int64  // the limit; nanoseconds for LimitTimeout
+}
+
+func (e *LimitError) Error() string {
+	if e.Limit == LimitTimeout {
+		return fmt.Sprintf("render limit exceeded: %s over %v", e.Limit, time.Duration(e.Max))
+	}
+	return fmt.Sprintf("render limit exceeded: %s over %d", e.Limit, e.Max)
+}
+
+// RenderOptions are the options of one render: generated RenderXxxWithOptions functions, and
+// RenderWithOptions of the interpreter and the VM, take them.
+type RenderOptions struct {
+	Context  context.Context // see Env.Context; nil means none
+	Registry *Registry       // see Env.Registry
+	Limits   Limits
+	Data     map[string]any // @data variables, see Env.Data
+}
+
+// NewEnv returns the Env of a render with opts.
+func NewEnv(opts RenderOptions) *Env {
+	return &Env{Registry: opts.Registry, Context: opts.Context, Limits: opts.Limits, Data: opts.Data}
+}
+
+// EnterPartial is called at the start of each template and partial of the render and, when
+// it succeeds, LeavePartial at its end. It returns the error of the render's context once it
+// is done, and a *LimitError when the partial is nested deeper than Limits.MaxPartialDepth
+// or the render has run longer than Limits.Timeout.
+func (e *Env) EnterPartial() error {
+	if e == nil {
+		return nil
+	}
+	if e.Limits.Timeout > 0 && e.deadline.IsZero() {
+		e.deadline = time.Now().Add(e.Limits.Timeout)
+	}
+	if limit := e.Limits.MaxPartialDepth; limit > 0 && e.depth > limit {
+		return &LimitError{Limit: LimitPartialDepth, Max: int64(limit)}
+	}
+	if err := e.check(); err != nil {
+		return err
+	}
+	e.depth++
+	return nil
+}
+
+// LeavePartial ends the template or partial started by EnterPartial.
+func (e *Env) LeavePartial() {
+	if e != nil {
+		e.depth--
+	}
+}
+
+// Iterate is called at each {{#each}} iteration and each time a block helper renders its body
+// or {{else}} section. It returns the error of the render's
+// context once it is done, and a *LimitError when the render has run more than
+// Limits.MaxIterations iterations or longer than Limits.Timeout.
+func (e *Env) Iterate() error {
+	if e == nil {
+		return nil
+	}
+	e.iterations++
+	if limit := e.Limits.MaxIterations; limit > 0 && e.iterations > limit {
+		return &LimitError{Limit: LimitIterations, Max: limit}
+	}
+	return e.check()
+}
+
+// check returns the error of the context and of the deadline.
+func (e *Env) check() error {
+	if !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		return &LimitError{Limit: LimitTimeout, Max: int64(e.Limits.Timeout)}
+	}
+	return e.Err()
+}
+
+// Writer returns w, or with Limits.MaxOutputBytes a writer that fails with a *LimitError once
+// the output is over the limit; the render writes its output to it. A LazyBlockWriter stays one.
+func (e *Env) Writer(w io.Writer) io.Writer {
+	if e == nil || e.Limits.MaxOutputBytes <= 0 {
+		return w
+	}
+	lw := &limitWriter{w: w, env: e}
+	if lazy, ok := w.(LazyBlockWriter); ok {
+		return &lazyLimitWriter{limitWriter: lw, lazy: lazy}
+	}
+	return lw
+}
+
+type limitWriter struct {
+	w   io.Writer
+	env *Env
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	limit := l.env.Limits.MaxOutputBytes
+	if l.env.written+int64(len(p)) > limit {
+		return 0, &LimitError{Limit: LimitOutputBytes, Max: limit}
+	}
+	n, err := l.w.Write(p)
+	l.env.written += int64(n)
+	return n, err
+}
+
+// WriteString writes s without converting it to bytes when the destination takes strings.
+func (l *limitWriter) WriteString(s string) (int, error) {
+	limit := l.env.Limits.MaxOutputBytes
+	if l.env.written+int64(len(s)) > limit {
+		return 0, &LimitError{Limit: LimitOutputBytes, Max: limit}
+	}
+	n, err := io.WriteString(l.w, s)
+	l.env.written += int64(n)
+	return n, err
+}
+
+// lazyLimitWriter is a limitWriter for a LazyBlockWriter; lazy blocks are not counted.
+type lazyLimitWriter struct {
+	*limitWriter
+	lazy LazyBlockWriter
+}
+
+func (l *lazyLimitWriter) WriteLazyBlock(block func(io.Writer)) {
+	l.lazy.WriteLazyBlock(block)
+}
+
+func (l *lazyLimitWriter) Flush() error {
+	return l.lazy.Flush()
+}
@@ -0,0 +1,67 @@
+package runtime
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvLimits(t *testing.T) {
+	var nilEnv *Env
+	if err := nilEnv.EnterPartial(); err != nil {
+		t.Errorf("nil Env: EnterPartial = %v", err)
+	}
+	if err := nilEnv.Iterate(); err != nil {
+		t.Errorf("nil Env: Iterate = %v", err)
+	}
+	if w := nilEnv.Writer(io.Discard); w != io.Discard {
+		t.Errorf("nil Env: Writer wraps w")
+	}
+
+	var limitErr *LimitError
+	env := NewEnv(RenderOptions{Limits: Limits{MaxPartialDepth: 2, MaxIterations: 3}})
+	for i := range 3 {
+		if err := env.EnterPartial(); err != nil {
+			t.Fatalf("EnterPartial %d: %v", i, err)
+		}
+	}
+	if err := env.EnterPartial(); !errors.As(err, &limitErr) || limitErr.Limit != LimitPartialDepth || err.Error() != "render limit exceeded: partial depth over 2" {
+		t.Errorf("partial depth: err = %v", err)
+	}
+	env.LeavePartial()
+	if err := env.EnterPartial(); err != nil {
+		t.Errorf("EnterPartial after LeavePartial: %v", err)
+	}
+	for i := range 3 {
+		if err := env.Iterate(); err != nil {
+			t.Fatalf("Iterate %d: %v", i, err)
+		}
+	}
+	if err := env.Iterate(); !errors.As(err, &limitErr) || limitErr.Limit != LimitIterations || limitErr.Max != 3 {
+		t.Errorf("iterations: err = %v", err)
+	}
+
+	env = NewEnv(RenderOptions{Limits: Limits{MaxOutputBytes: 5}})
+	var b strings.Builder
+	w := env.Writer(&b)
+	if _, err := io.WriteString(w, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "def"); !errors.As(err, &limitErr) || limitErr.Limit != LimitOutputBytes || b.String() != "abc" {
+		t.Errorf("output bytes: err = %v, output %q", err, b.String())
+	}
+	if _, ok := env.Writer(NewLazyWriter(&b)).(LazyBlockWriter); !ok {
+		t.Error("Writer of a LazyBlockWriter is not a LazyBlockWriter")
+	}
+
+	env = NewEnv(RenderOptions{Limits: Limits{Timeout: time.Millisecond}})
+	if err := env.EnterPartial(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := env.Iterate(); !errors.As(err, &limitErr) || limitErr.Limit != LimitTimeout || err.Error() != "render limit exceeded: render time over 1ms" {
+		t.Errorf("timeout: err = %v", err)
+	}
+}
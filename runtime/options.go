@@ -0,0 +1,179 @@
+package runtime
+
+import (
+	"context"
+	"io"
+
+	"github.com/andriyg76/hexerr"
+)
+
+// OptionsHelper is a helper that receives a HelperOptions with the current context,
+// the @data frame and the hash. Positional args do not include the hash.
+type OptionsHelper func(args []any, options *HelperOptions) (any, error)
+
+// OptionsBlockHelper is a block helper that receives a HelperOptions; it writes to w,
+// usually by calling options.Fn or options.Inverse with a context of its choice.
+type OptionsBlockHelper func(w io.Writer, args []any, options *HelperOptions) error
+
+// BlockFunc renders a block body (or its {{else}} section) with ctx as the context
+// and data as the @data frame.
+type BlockFunc func(w io.Writer, ctx any, data *DataFrame) error
+
+// HelperOptions is passed to OptionsHelper and OptionsBlockHelper, in the manner of
+// the Handlebars options object.
+type HelperOptions struct {
+	Name     string     // helper name as used in the template
+	Template string     // name of the template that calls the helper
+	Context  any        // current context ("this"); map-backed contexts are passed as their map
+	Data     *DataFrame // current @data frame (@root, @index, @key, ...)
+	Hash     Hash       // hash arguments; nil when there are none
+	// BlockParams is the number of block params the block declares (as |a b|);
+	// pass their values with DataFrame.SetBlockParams.
+	BlockParams int
+	// Ctx is the render's context: the one passed to RenderXxxContext (or RenderContext of
+	// the interpreter and the VM), context.Background() otherwise. Use it for request-scoped
+	// values such as the locale or the user, and to stop long work when it is cancelled.
+	Ctx context.Context
+
+	fn      BlockFunc
+	inverse BlockFunc
+}
+
+// SetBlock sets the block body and {{else}} section; generated code calls it for block helpers.
+func (o *HelperOptions) SetBlock(fn, inverse BlockFunc) {
+	o.fn, o.inverse = fn, inverse
+}
+
+// IsBlock reports whether the helper was called as a block ({{#name}}...{{/name}}).
+func (o *HelperOptions) IsBlock() bool {
+	return o.fn != nil
+}
+
+// HasInverse reports whether the block has an {{else}} section.
+func (o *HelperOptions) HasInverse() bool {
+	return o.inverse != nil
+}
+
+// Fn renders the block body with ctx as its context. When data is nil, o.Data is used.
+// Pass o.Context to keep the caller's context. Fn is a no-op for non-block calls.
+func (o *HelperOptions) Fn(w io.Writer, ctx any, data *DataFrame) error {
+	if o.fn == nil {
+		return nil
+	}
+	if data == nil {
+		data = o.Data
+	}
+	return o.fn(w, ctx, data)
+}
+
+// Inverse renders the {{else}} section with ctx as its context; it is a no-op when there is none.
+func (o *HelperOptions) Inverse(w io.Writer, ctx any, data *DataFrame) error {
+	if o.inverse == nil {
+		return nil
+	}
+	if data == nil {
+		data = o.Data
+	}
+	return o.inverse(w, ctx, data)
+}
+
+// HashValue returns the hash argument key, or def when it is absent.
+func (o *HelperOptions) HashValue(key string, def any) any {
+	if v, ok := o.Hash[key]; ok {
+		return v
+	}
+	return def
+}
+
+// DataFrame holds @data variables. Frames are chained: a lookup that misses in a frame
+// continues in its parent, so a helper can add @index for its body without losing @root.
+type DataFrame struct {
+	parent *DataFrame
+	vars   map[string]any
+	params []any
+}
+
+// NewDataFrame returns an empty frame on top of parent (which may be nil).
+func NewDataFrame(parent *DataFrame) *DataFrame {
+	return &DataFrame{parent: parent}
+}
+
+// NewRootFrame returns a frame with @root set to root (map-backed contexts are stored as their map).
+func NewRootFrame(root any) *DataFrame {
+	return NewDataFrame(nil).Set("root", RawValue(root))
+}
+
+// Set sets @name in this frame and returns f, so calls can be chained.
+func (f *DataFrame) Set(name string, value any) *DataFrame {
+	if f.vars == nil {
+		f.vars = make(map[string]any)
+	}
+	f.vars[name] = value
+	return f
+}
+
+// Lookup returns @name from this frame or the nearest parent that has it.
+func (f *DataFrame) Lookup(name string) (any, bool) {
+	for cur := f; cur != nil; cur = cur.parent {
+		if v, ok := cur.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Get returns @name, or nil when no frame has it. It is safe to call on a nil frame.
+func (f *DataFrame) Get(name string) any {
+	v, _ := f.Lookup(name)
+	return v
+}
+
+// SetBlockParams sets the values of the block params (as |a b|) for a body rendered with f.
+// Unlike @data variables they are not inherited by child frames.
+func (f *DataFrame) SetBlockParams(values ...any) *DataFrame {
+	f.params = values
+	return f
+}
+
+// BlockParam returns the i-th block param value, or nil.
+func (f *DataFrame) BlockParam(i int) any {
+	if f == nil || i < 0 || i >= len(f.params) {
+		return nil
+	}
+	return f.params[i]
+}
+
+// Root returns @root.
+func (f *DataFrame) Root() any {
+	return f.Get("root")
+}
+
+// Parent returns the enclosing frame, or nil.
+func (f *DataFrame) Parent() *DataFrame {
+	if f == nil {
+		return nil
+	}
+	return f.parent
+}
+
+// RawValue returns v.Raw() for generated map-backed context types and v otherwise.
+// Helpers see contexts as plain values (usually map[string]any) rather than generated interfaces.
+func RawValue(v any) any {
+	type rawer interface{ Raw() any }
+	if r, ok := v.(rawer); ok {
+		return r.Raw()
+	}
+	return v
+}
+
+// ElementOf returns v as an element of a slice of type []E. Generated code uses it to give
+// the body of an iterating block helper the typed context of the collection it iterates.
+func ElementOf[E any](v any, _ []E) (E, bool) {
+	e, ok := v.(E)
+	return e, ok
+}
+
+// BlockContextError reports a block helper that rendered its body with a context of the wrong type.
+func BlockContextError(helper string, ctx any) error {
+	return hexerr.Newf("block helper %q rendered its body with %T, not an element of its first argument", helper, ctx)
+}
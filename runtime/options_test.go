@@ -0,0 +1,78 @@
+package runtime
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type rawCtx struct{ m map[string]any }
+
+func (r rawCtx) Raw() any { return r.m }
+
+func TestDataFrame(t *testing.T) {
+	root := NewRootFrame(rawCtx{m: map[string]any{"title": "T"}})
+	child := NewDataFrame(root).Set("index", 2).Set("first", false)
+
+	if got := LookupPath(child.Root(), "title"); got != "T" {
+		t.Errorf("Root() title = %v, want T", got)
+	}
+	if got := child.Get("index"); got != 2 {
+		t.Errorf("Get(index) = %v, want 2", got)
+	}
+	if _, ok := root.Lookup("index"); ok {
+		t.Errorf("parent frame sees child @index")
+	}
+	if child.Parent() != root {
+		t.Errorf("Parent() is not the root frame")
+	}
+	var nilFrame *DataFrame
+	if nilFrame.Get("index") != nil || nilFrame.Parent() != nil {
+		t.Errorf("nil frame lookups should return nil")
+	}
+}
+
+func TestHelperOptionsFn(t *testing.T) {
+	base := NewRootFrame(map[string]any{})
+	opts := &HelperOptions{Name: "twice", Context: "outer", Data: base}
+	var b strings.Builder
+	if err := opts.Fn(&b, "x", nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 0 || opts.IsBlock() {
+		t.Fatalf("Fn without a block should write nothing")
+	}
+
+	opts.SetBlock(func(w io.Writer, ctx any, data *DataFrame) error {
+		_, err := io.WriteString(w, Stringify(ctx)+Stringify(data.Get("index"))+";")
+		return err
+	}, nil)
+	if err := opts.Fn(&b, "a", NewDataFrame(base).Set("index", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.Fn(&b, opts.Context, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.Inverse(&b, "ignored", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != "a0;outer;" {
+		t.Errorf("output = %q, want %q", got, "a0;outer;")
+	}
+	if !opts.IsBlock() || opts.HasInverse() {
+		t.Errorf("IsBlock/HasInverse = %v/%v, want true/false", opts.IsBlock(), opts.HasInverse())
+	}
+}
+
+func TestHelperOptionsHashValue(t *testing.T) {
+	opts := &HelperOptions{Hash: Hash{"sep": ", "}}
+	if got := opts.HashValue("sep", "|"); got != ", " {
+		t.Errorf("HashValue(sep) = %v", got)
+	}
+	if got := opts.HashValue("missing", "|"); got != "|" {
+		t.Errorf("HashValue(missing) = %v", got)
+	}
+	if got := (&HelperOptions{}).HashValue("k", 1); got != 1 {
+		t.Errorf("HashValue on nil hash = %v", got)
+	}
+}
@@ -0,0 +1,160 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"sort"
+)
+
+// OrderedMap is a map with string keys that remembers the order its keys were first set in.
+// {{#each}} and the keys and values helpers iterate it in that order, while Go maps iterate in
+// sorted key order; LoadDataFile returns the objects of data files as OrderedMaps, so they
+// iterate in the order they appear in the file. Paths look keys up as in a map[string]any
+// (see Raw).
+type OrderedMap struct {
+	keys []string
+	m    map[string]any
+}
+
+// NewOrderedMap returns an empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{m: map[string]any{}}
+}
+
+// OrderedMapOf returns an OrderedMap of m with the given keys first, in order, and the other
+// keys of m after them, sorted. Keys that are not in m are skipped. It uses m, not a copy.
+func OrderedMapOf(m map[string]any, keys []string) *OrderedMap {
+	om := &OrderedMap{keys: make([]string, 0, len(m)), m: m}
+	seen := make(map[string]bool, len(m))
+	for _, k := range keys {
+		if _, ok := m[k]; ok && !seen[k] {
+			seen[k] = true
+			om.keys = append(om.keys, k)
+		}
+	}
+	if len(om.keys) < len(m) {
+		rest := make([]string, 0, len(m)-len(om.keys))
+		for k := range m {
+			if !seen[k] {
+				rest = append(rest, k)
+			}
+		}
+		sort.Strings(rest)
+		om.keys = append(om.keys, rest...)
+	}
+	return om
+}
+
+// Set sets the value of key; a new key is added after the others.
+func (m *OrderedMap) Set(key string, v any) *OrderedMap {
+	if m.m == nil {
+		m.m = map[string]any{}
+	}
+	if _, ok := m.m[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.m[key] = v
+	return m
+}
+
+// Get returns the value of key and whether it is set.
+func (m *OrderedMap) Get(key string) (any, bool) {
+	if m == nil {
+		return nil, false
+	}
+	v, ok := m.m[key]
+	return v, ok
+}
+
+// Delete removes key.
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.m[key]; !ok {
+		return
+	}
+	delete(m.m, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Len returns the number of keys.
+func (m *OrderedMap) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.keys)
+}
+
+// Keys returns the keys in order.
+func (m *OrderedMap) Keys() []string {
+	if m == nil {
+		return nil
+	}
+	return m.keys
+}
+
+// Raw returns the keys and values as a map[string]any; lookups by key use it.
+func (m *OrderedMap) Raw() any {
+	if m == nil {
+		return nil
+	}
+	return m.m
+}
+
+// All yields the keys and values in order.
+func (m *OrderedMap) All() iter.Seq2[any, any] {
+	return func(yield func(any, any) bool) {
+		if m == nil {
+			return
+		}
+		for _, k := range m.keys {
+			if !yield(k, m.m[k]) {
+				return
+			}
+		}
+	}
+}
+
+// String formats the keys and values as fmt does a map.
+func (m *OrderedMap) String() string {
+	return fmt.Sprint(m.m)
+}
+
+// MarshalJSON encodes m as a JSON object with its keys in order.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(m.m[k])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// SortedKeys returns the keys of m in sorted order, the order {{#each}} iterates Go maps in.
+func SortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,61 @@
+package runtime
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestOrderedMap(t *testing.T) {
+	m := NewOrderedMap().Set("b", 1).Set("a", 2).Set("c", 3)
+	m.Set("b", 4)
+	m.Delete("c")
+	m.Delete("missing")
+	if got := m.Keys(); !slices.Equal(got, []string{"b", "a"}) || m.Len() != 2 {
+		t.Errorf("Keys = %v", got)
+	}
+	if v, ok := m.Get("b"); v != 4 || !ok {
+		t.Errorf("Get(b) = %v, %v", v, ok)
+	}
+	if got := items(m); got != "^b=4 a=2$" {
+		t.Errorf("Each = %q", got)
+	}
+	if Entries(m)[0].Key != "b" {
+		t.Errorf("Entries = %v", Entries(m))
+	}
+	if ResolvePath(map[string]any{"m": m}, "m.a") != 2 {
+		t.Error("ResolvePath through OrderedMap")
+	}
+	if b, err := json.Marshal(m); string(b) != `{"b":4,"a":2}` || err != nil {
+		t.Errorf("MarshalJSON = %s, %v", b, err)
+	}
+	if !IsTruthy(m) || IsTruthy(NewOrderedMap()) {
+		t.Error("IsTruthy of an OrderedMap is its length")
+	}
+	var nilMap *OrderedMap
+	if nilMap.Len() != 0 || items(nilMap) != "" || IsTruthy(nilMap) {
+		t.Error("nil OrderedMap is not empty")
+	}
+}
+
+func TestOrderedMapOf(t *testing.T) {
+	m := OrderedMapOf(map[string]any{"x": 1, "b": 2, "a": 3, "z": 4}, []string{"z", "missing", "x", "z"})
+	if got := m.Keys(); !slices.Equal(got, []string{"z", "x", "a", "b"}) {
+		t.Errorf("Keys = %v", got)
+	}
+}
+
+func TestEachSortsMaps(t *testing.T) {
+	m := map[string]any{}
+	for _, k := range []string{"d", "b", "e", "a", "c"} {
+		m[k] = k
+	}
+	for range 5 {
+		if got := items(m); got != "^a=a b=b c=c d=d e=e$" {
+			t.Fatalf("Each = %q", got)
+		}
+	}
+	if got := SortedKeys(m); !slices.Equal(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("SortedKeys = %v", got)
+	}
+}
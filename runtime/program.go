@@ -0,0 +1,525 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/andriyg76/hexerr"
+)
+
+// ProgramVersion is the version of the bytecode format written by hbc -format=bytecode.
+// Programs of other versions are rejected by DecodeProgram with ErrProgramVersion;
+// recompile them with the hbc of this runtime.
+const ProgramVersion = 1
+
+// programMagic starts every encoded Program.
+const programMagic = "HBC\x00"
+
+var (
+	// ErrProgramVersion is returned (wrapped) by DecodeProgram for programs written by a
+	// different version of hbc.
+	ErrProgramVersion = hexerr.New("unsupported bytecode version")
+	// ErrProgramChecksum is returned (wrapped) by DecodeProgram for programs whose checksum
+	// does not match their content (truncated or modified files).
+	ErrProgramChecksum = hexerr.New("bytecode checksum mismatch")
+)
+
+// Opcode is a bytecode instruction. The operands A, B, C and D of an Instr are indexes into
+// the tables of its Program, counts, flags or instruction offsets within the template, as
+// documented for each opcode.
+//
+// Expressions push values onto a stack; instructions that take values pop them. Block
+// instructions are followed by their body, which ends with OpReturn, then by their {{else}}
+// section (also ending with OpReturn) when they have one. Their else and end operands are
+// the offsets of the else section and of the first instruction after the block.
+type Opcode uint8
+
+const (
+	// OpText writes Strings[A].
+	OpText Opcode = iota + 1
+	// OpPath pushes the value of the path Strings[A].
+	OpPath
+	// OpName pushes the result of helper Helpers[A] called without arguments when it is a
+	// helper at render time, else the value of the path of the same name.
+	OpName
+	// OpString pushes the string literal Strings[A].
+	OpString
+	// OpNumber pushes the number literal Strings[A] (an int, else a float64).
+	OpNumber
+	// OpBool pushes true when A is 1, else false.
+	OpBool
+	// OpNull pushes nil.
+	OpNull
+	// OpHash pops A key/value pairs (each key an OpString) and pushes them as a Hash.
+	OpHash
+	// OpCall pops the arguments of helper Helpers[A] and pushes its result. B is the
+	// argument count, shifted left by one; its low bit is set when a Hash (OpHash) follows
+	// the arguments.
+	OpCall
+	// OpOutput pops a value and writes it, escaped in the template's mode unless A is 1.
+	OpOutput
+	// OpParams sets the block params of the next block instruction to the space-separated
+	// names Strings[A].
+	OpParams
+	// OpIf pops a value and renders the body when it is truthy (falsy when B has
+	// IfUnless), else the else section at A; C is the end. IfIncludeZero in B makes 0
+	// truthy.
+	OpIf
+	// OpWith pops a value and renders the body with it as the context when it is truthy,
+	// else the else section at A; B is the end.
+	OpWith
+	// OpEach pops a value and renders the body for each of its entries, else (when it has
+	// none) the else section at A; B is the end.
+	OpEach
+	// OpBlock calls block helper Helpers[A] with arguments as for OpCall (B). C is the else
+	// section and D the end. When Helpers[A] is not a helper and the block has no
+	// arguments, the block is a universal section: {{#name}} is {{#with name}}.
+	OpBlock
+	// OpLayoutBlock pops a block name ({{#block "name"}}) and writes the content set for it,
+	// else renders the body (the default content); A is the end.
+	OpLayoutBlock
+	// OpLayoutPartial pops a block name ({{#partial "name"}}) and sets the rendered body as
+	// its content; A is the end.
+	OpLayoutPartial
+	// OpPartial renders template Partials[A]. When B has PartialContext, a context value is
+	// on the stack; when B has PartialHash, a Hash follows it.
+	OpPartial
+	// OpDynamicPartial is OpPartial with the flags in A and the partial name popped from
+	// below the context and hash, looked up among the templates, then in the registries.
+	OpDynamicPartial
+	// OpReturn ends a block body or else section.
+	OpReturn
+
+	opMax = OpReturn
+)
+
+// Flags of OpIf.
+const (
+	IfUnless      = 1
+	IfIncludeZero = 2
+)
+
+// Flags of OpPartial and OpDynamicPartial.
+const (
+	PartialContext = 1
+	PartialHash    = 2
+)
+
+// operandCounts is the number of operands each opcode has in the encoded form.
+var operandCounts = [opMax + 1]int{
+	OpText:           1,
+	OpPath:           1,
+	OpName:           1,
+	OpString:         1,
+	OpNumber:         1,
+	OpBool:           1,
+	OpNull:           0,
+	OpHash:           1,
+	OpCall:           2,
+	OpOutput:         1,
+	OpParams:         1,
+	OpIf:             3,
+	OpWith:           2,
+	OpEach:           2,
+	OpBlock:          4,
+	OpLayoutBlock:    1,
+	OpLayoutPartial:  1,
+	OpPartial:        2,
+	OpDynamicPartial: 1,
+	OpReturn:         0,
+}
+
+// Instr is one bytecode instruction.
+type Instr struct {
+	Op         Opcode
+	A, B, C, D int32
+}
+
+// LinePos maps the instructions from offset PC on to a template source position.
+type LinePos struct {
+	PC   int32
+	Line int32
+	Col  int32
+}
+
+// ProgramTemplate is one template of a Program.
+type ProgramTemplate struct {
+	Name string
+	// Escape is the output mode: "html", "text" or the name of a runtime escaper.
+	Escape string
+	Code   []Instr
+	// Lines maps instructions to source positions, by increasing PC.
+	Lines []LinePos
+}
+
+// Program is a set of templates compiled to bytecode (hbc -format=bytecode) for the VM:
+// a flat instruction list per template with a string table and the helper and partial
+// names the instructions refer to.
+type Program struct {
+	Strings   []string
+	Helpers   []string
+	Partials  []string
+	Templates []ProgramTemplate
+
+	numbers map[int32]any // OpNumber literals by string index, set by validate
+}
+
+// MarshalBinary encodes p in the bytecode format: a header with ProgramVersion, the
+// tables and templates as varints, and a CRC-32 checksum of everything before it.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	var e encoder
+	e.buf.WriteString(programMagic)
+	e.uint(ProgramVersion)
+	e.uint(uint64(len(p.Strings)))
+	for _, s := range p.Strings {
+		e.string(s)
+	}
+	for _, names := range [][]string{p.Helpers, p.Partials} {
+		e.uint(uint64(len(names)))
+		for _, name := range names {
+			e.string(name)
+		}
+	}
+	e.uint(uint64(len(p.Templates)))
+	for _, t := range p.Templates {
+		e.string(t.Name)
+		e.string(t.Escape)
+		e.uint(uint64(len(t.Code)))
+		for _, in := range t.Code {
+			e.buf.WriteByte(byte(in.Op))
+			operands := in.operands()
+			for _, v := range operands[:operandCounts[in.Op]] {
+				e.uint(uint64(v))
+			}
+		}
+		e.uint(uint64(len(t.Lines)))
+		for _, l := range t.Lines {
+			e.uint(uint64(l.PC))
+			e.uint(uint64(l.Line))
+			e.uint(uint64(l.Col))
+		}
+	}
+	return binary.BigEndian.AppendUint32(e.buf.Bytes(), crc32.ChecksumIEEE(e.buf.Bytes())), nil
+}
+
+func (in Instr) operands() [4]int32 {
+	return [4]int32{in.A, in.B, in.C, in.D}
+}
+
+// DecodeProgram decodes a program written by MarshalBinary and checks that it is well
+// formed. Programs of another ProgramVersion give ErrProgramVersion and damaged ones
+// ErrProgramChecksum (use errors.Is).
+func DecodeProgram(b []byte) (*Program, error) {
+	if len(b) < len(programMagic)+4 || string(b[:len(programMagic)]) != programMagic {
+		return nil, hexerr.New("bytecode: not a go-hbars program")
+	}
+	d := decoder{b: b[len(programMagic) : len(b)-4]}
+	if v := d.uint(); v != ProgramVersion {
+		return nil, hexerr.Wrapf(ErrProgramVersion, "bytecode: version %d, want %d (recompile with hbc -format=bytecode)", v, ProgramVersion)
+	}
+	body, sum := b[:len(b)-4], binary.BigEndian.Uint32(b[len(b)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, hexerr.Wrapf(ErrProgramChecksum, "bytecode")
+	}
+	p := &Program{}
+	p.Strings = make([]string, d.count())
+	for i := range p.Strings {
+		p.Strings[i] = d.string()
+	}
+	for _, names := range []*[]string{&p.Helpers, &p.Partials} {
+		*names = make([]string, d.count())
+		for i := range *names {
+			(*names)[i] = d.string()
+		}
+	}
+	p.Templates = make([]ProgramTemplate, d.count())
+	for i := range p.Templates {
+		t := &p.Templates[i]
+		t.Name = d.string()
+		t.Escape = d.string()
+		t.Code = make([]Instr, d.count())
+		for j := range t.Code {
+			op := Opcode(d.byte())
+			if op == 0 || op > opMax {
+				d.fail("invalid opcode %d", op)
+				break
+			}
+			var operands [4]int32
+			for k := range operandCounts[op] {
+				operands[k] = d.int32()
+			}
+			t.Code[j] = Instr{Op: op, A: operands[0], B: operands[1], C: operands[2], D: operands[3]}
+		}
+		t.Lines = make([]LinePos, d.count())
+		for j := range t.Lines {
+			t.Lines[j] = LinePos{PC: d.int32(), Line: d.int32(), Col: d.int32()}
+		}
+	}
+	if d.err == nil && len(d.b) > 0 {
+		d.fail("%d trailing bytes", len(d.b))
+	}
+	if d.err != nil {
+		return nil, hexerr.Wrapf(d.err, "bytecode")
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// validate checks that p is well formed, so that the VM can index its tables and stack
+// without checks, and parses the number literals.
+func (p *Program) validate() error {
+	p.numbers = make(map[int32]any)
+	names := make(map[string]bool, len(p.Templates))
+	for _, t := range p.Templates {
+		if names[t.Name] {
+			return hexerr.Newf("bytecode: duplicate template %q", t.Name)
+		}
+		names[t.Name] = true
+		if err := p.checkSection(t.Code, 0, int32(len(t.Code)), false); err != nil {
+			return hexerr.Wrapf(err, "bytecode: template %q", t.Name)
+		}
+	}
+	return nil
+}
+
+// checkSection checks code[from:to], a template's code or a block section (which ends with
+// OpReturn): the operands of its instructions must be in range, block sections must nest
+// and no instruction may pop a value that the section did not push.
+func (p *Program) checkSection(code []Instr, from, to int32, section bool) error {
+	if section && (to <= from || code[to-1].Op != OpReturn) {
+		return hexerr.Newf("section %d-%d does not end with a return", from, to)
+	}
+	depth := 0
+	for pc := from; pc < to; {
+		in := code[pc]
+		if err := p.checkInstr(in, pc, to); err != nil {
+			return hexerr.Wrapf(err, "instruction %d (op %d)", pc, in.Op)
+		}
+		pops := in.pops()
+		if pops > depth {
+			return hexerr.Newf("instruction %d (op %d): stack underflow", pc, in.Op)
+		}
+		depth -= pops
+		if in.pushes() {
+			depth++
+		}
+		next := pc + 1
+		var sections [][2]int32
+		switch in.Op {
+		case OpIf:
+			sections, next = [][2]int32{{pc + 1, in.A}, {in.A, in.C}}, in.C
+		case OpWith, OpEach:
+			sections, next = [][2]int32{{pc + 1, in.A}, {in.A, in.B}}, in.B
+		case OpBlock:
+			sections, next = [][2]int32{{pc + 1, in.C}, {in.C, in.D}}, in.D
+		case OpLayoutBlock, OpLayoutPartial:
+			sections, next = [][2]int32{{pc + 1, in.A}}, in.A
+		case OpReturn:
+			if !section || pc != to-1 || depth != 0 {
+				return hexerr.Newf("instruction %d: unexpected return", pc)
+			}
+		}
+		for i, sec := range sections {
+			if i > 0 && sec[0] == sec[1] {
+				continue // no else section
+			}
+			if err := p.checkSection(code, sec[0], sec[1], true); err != nil {
+				return err
+			}
+		}
+		pc = next
+	}
+	return nil
+}
+
+func (p *Program) checkInstr(in Instr, pc, end int32) error {
+	for _, v := range in.operands() {
+		if v < 0 {
+			return hexerr.Newf("negative operand %d", v)
+		}
+	}
+	index := func(i int32, table int) error {
+		if int(i) >= table {
+			return hexerr.Newf("index %d out of range", i)
+		}
+		return nil
+	}
+	// Block bodies start after the instruction; the else section and the end follow, within
+	// the enclosing section.
+	offsets := func(elseAt, blockEnd int32) error {
+		if elseAt <= pc || blockEnd < elseAt || blockEnd > end {
+			return hexerr.Newf("invalid block offsets %d, %d", elseAt, blockEnd)
+		}
+		return nil
+	}
+	switch in.Op {
+	case OpText, OpPath, OpString, OpParams:
+		return index(in.A, len(p.Strings))
+	case OpNumber:
+		if err := index(in.A, len(p.Strings)); err != nil {
+			return err
+		}
+		v, err := parseNumber(p.Strings[in.A])
+		if err != nil {
+			return err
+		}
+		p.numbers[in.A] = v
+	case OpName, OpCall:
+		return index(in.A, len(p.Helpers))
+	case OpBlock:
+		if err := index(in.A, len(p.Helpers)); err != nil {
+			return err
+		}
+		return offsets(in.C, in.D)
+	case OpIf:
+		return offsets(in.A, in.C)
+	case OpWith, OpEach:
+		return offsets(in.A, in.B)
+	case OpLayoutBlock, OpLayoutPartial:
+		return offsets(in.A, in.A)
+	case OpPartial:
+		return index(in.A, len(p.Partials))
+	case OpBool, OpNull, OpHash, OpOutput, OpDynamicPartial, OpReturn:
+	default:
+		return hexerr.Newf("invalid opcode %d", in.Op)
+	}
+	return nil
+}
+
+// pops returns the number of values the instruction pops from the stack.
+func (in Instr) pops() int {
+	flag := func(v, f int32) int {
+		if v&f != 0 {
+			return 1
+		}
+		return 0
+	}
+	switch in.Op {
+	case OpHash:
+		return 2 * int(in.A)
+	case OpCall, OpBlock:
+		return int(in.B>>1 + in.B&1)
+	case OpOutput, OpIf, OpWith, OpEach, OpLayoutBlock, OpLayoutPartial:
+		return 1
+	case OpPartial:
+		return flag(in.B, PartialContext) + flag(in.B, PartialHash)
+	case OpDynamicPartial:
+		return 1 + flag(in.A, PartialContext) + flag(in.A, PartialHash)
+	}
+	return 0
+}
+
+// pushes reports whether in pushes a value.
+func (in Instr) pushes() bool {
+	switch in.Op {
+	case OpPath, OpName, OpString, OpNumber, OpBool, OpNull, OpHash, OpCall:
+		return true
+	}
+	return false
+}
+
+// parseNumber parses a number literal as the interpreter does: an int when it has no
+// fraction or exponent and fits, else a float64.
+func parseNumber(s string) (any, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.Atoi(s); err == nil {
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, hexerr.Newf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+// decoder reads the encoding of MarshalBinary; after the first error it returns zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = hexerr.Newf(format, args...)
+	}
+	d.b = nil
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail("truncated data")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int32() int32 {
+	v := d.uint()
+	if v > math.MaxInt32 {
+		d.fail("value %d out of range", v)
+		return 0
+	}
+	return int32(v)
+}
+
+// count reads a table length; it cannot exceed the remaining bytes, as every entry takes at
+// least one byte.
+func (d *decoder) count() int {
+	v := d.uint()
+	if v > uint64(len(d.b)) {
+		d.fail("truncated data")
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) == 0 {
+		d.fail("truncated data")
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
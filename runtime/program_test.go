@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testProgram is "Hi {{#if user}}{{user.Name}}{{else}}nobody{{/if}}! {{shout "x" n=2}}".
+func testProgram() *Program {
+	return &Program{
+		Strings:  []string{"Hi ", "user", "user.Name", "nobody", "! ", "x", "n", "2"},
+		Helpers:  []string{"shout"},
+		Partials: []string{},
+		Templates: []ProgramTemplate{{
+			Name:   "main",
+			Escape: "html",
+			Code: []Instr{
+				{Op: OpText, A: 0},
+				{Op: OpPath, A: 1},
+				{Op: OpIf, A: 6, C: 8},
+				{Op: OpPath, A: 2},
+				{Op: OpOutput},
+				{Op: OpReturn},
+				{Op: OpText, A: 3},
+				{Op: OpReturn},
+				{Op: OpText, A: 4},
+				{Op: OpString, A: 5},
+				{Op: OpString, A: 6},
+				{Op: OpNumber, A: 7},
+				{Op: OpHash, A: 1},
+				{Op: OpCall, A: 0, B: 1<<1 | 1},
+				{Op: OpOutput},
+			},
+			Lines: []LinePos{{PC: 0, Line: 1, Col: 1}, {PC: 1, Line: 1, Col: 4}, {PC: 9, Line: 1, Col: 60}},
+		}},
+	}
+}
+
+func TestProgramRoundTrip(t *testing.T) {
+	p := testProgram()
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got, err := DecodeProgram(b)
+	if err != nil {
+		t.Fatalf("DecodeProgram: %v", err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("decoded program differs:\ngot  %+v\nwant %+v", got, p)
+	}
+
+	type user struct{ Name string }
+	vm, err := NewVM(got, VMOptions{Helpers: map[string]any{
+		"shout": OptionsHelper(func(args []any, options *HelperOptions) (any, error) {
+			return strings.ToUpper(Stringify(args[0])) + Stringify(options.HashValue("n", 0)), nil
+		}),
+	}})
+	if err != nil {
+		t.Fatalf("NewVM: %v", err)
+	}
+	for _, tt := range []struct {
+		data any
+		want string
+	}{
+		{map[string]any{"user": &user{Name: "<Ada>"}}, "Hi &lt;Ada&gt;! X2"},
+		{map[string]any{}, "Hi nobody! X2"},
+	} {
+		out, err := vm.RenderString("main", tt.data)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		if out != tt.want {
+			t.Errorf("got %q, want %q", out, tt.want)
+		}
+	}
+}
+
+func TestDecodeProgramRejects(t *testing.T) {
+	b, err := testProgram().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := append([]byte(nil), b...)
+	stale[len(programMagic)] = ProgramVersion + 1
+	if _, err := DecodeProgram(stale); !errors.Is(err, ErrProgramVersion) {
+		t.Errorf("other version: err = %v, want ErrProgramVersion", err)
+	}
+	damaged := append([]byte(nil), b...)
+	damaged[len(damaged)/2] ^= 0xff
+	if _, err := DecodeProgram(damaged); !errors.Is(err, ErrProgramChecksum) {
+		t.Errorf("damaged program: err = %v, want ErrProgramChecksum", err)
+	}
+	if _, err := DecodeProgram(b[:len(b)-1]); err == nil {
+		t.Error("truncated program: want error")
+	}
+	if _, err := DecodeProgram([]byte("package templates")); err == nil {
+		t.Error("not a program: want error")
+	}
+}
+
+func TestProgramValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		code []Instr
+		want string
+	}{
+		{"stack underflow", []Instr{{Op: OpOutput}}, "stack underflow"},
+		{"string index", []Instr{{Op: OpText, A: 99}}, "index 99 out of range"},
+		{"helper index", []Instr{{Op: OpNull}, {Op: OpCall, A: 5, B: 1 << 1}}, "index 5 out of range"},
+		{"block offsets", []Instr{{Op: OpNull}, {Op: OpWith, A: 9, B: 9}}, "invalid block offsets"},
+		{"section without return", []Instr{{Op: OpNull}, {Op: OpWith, A: 3, B: 3}, {Op: OpText}}, "does not end with a return"},
+		{"unbalanced section", []Instr{{Op: OpNull}, {Op: OpWith, A: 4, B: 4}, {Op: OpNull}, {Op: OpReturn}}, "unexpected return"},
+		{"return outside a section", []Instr{{Op: OpReturn}}, "unexpected return"},
+		{"invalid number", []Instr{{Op: OpNumber, A: 0}, {Op: OpOutput}}, `invalid number "Hi "`},
+		{"invalid opcode", []Instr{{Op: opMax + 1}}, "invalid opcode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProgram()
+			p.Templates[0].Code = tt.code
+			_, err := NewVM(p, VMOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/andriyg76/hexerr"
+)
+
+// PartialFunc renders a partial registered at runtime with ctx as its context.
+// env is the render's Env (nil when rendering without one).
+type PartialFunc func(ctx any, w io.Writer, env *Env) error
+
+// Registry holds helpers and partials that templates look up at render time: helpers not known
+// when the templates were compiled (hbc -missing-helpers=runtime) and partials of dynamic partial
+// calls ({{> (name)}}) that are not in the same generated package. A Registry is safe for
+// concurrent use; register its entries before rendering.
+type Registry struct {
+	mu                 sync.RWMutex
+	helpers            map[string]OptionsHelper
+	blockHelpers       map[string]OptionsBlockHelper
+	partials           map[string]PartialFunc
+	helperMissing      OptionsHelper
+	blockHelperMissing OptionsBlockHelper
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry returns the package-wide registry, consulted by every render after the
+// registry passed to that render (see Env).
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// RegisterHelper registers h as the helper name ({{name ...}} and subexpressions).
+func (r *Registry) RegisterHelper(name string, h OptionsHelper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.helpers == nil {
+		r.helpers = make(map[string]OptionsHelper)
+	}
+	r.helpers[name] = h
+}
+
+// RegisterBlockHelper registers h as the block helper name ({{#name ...}}).
+func (r *Registry) RegisterBlockHelper(name string, h OptionsBlockHelper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blockHelpers == nil {
+		r.blockHelpers = make(map[string]OptionsBlockHelper)
+	}
+	r.blockHelpers[name] = h
+}
+
+// RegisterPartial registers fn as the partial name. Generated packages register all their
+// templates with their RegisterPartials function.
+func (r *Registry) RegisterPartial(name string, fn PartialFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.partials == nil {
+		r.partials = make(map[string]PartialFunc)
+	}
+	r.partials[name] = fn
+}
+
+// SetHelperMissing sets the hook called for a helper that is neither compiled in nor registered,
+// like Handlebars helperMissing; options.Name holds the name. nil removes the hook.
+func (r *Registry) SetHelperMissing(h OptionsHelper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.helperMissing = h
+}
+
+// SetBlockHelperMissing is SetHelperMissing for block helpers (Handlebars blockHelperMissing).
+func (r *Registry) SetBlockHelperMissing(h OptionsBlockHelper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blockHelperMissing = h
+}
+
+// Helper returns the helper registered as name. It is safe to call on a nil registry.
+func (r *Registry) Helper(name string) (OptionsHelper, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.helpers[name]
+	return h, ok
+}
+
+// BlockHelper returns the block helper registered as name. It is safe to call on a nil registry.
+func (r *Registry) BlockHelper(name string) (OptionsBlockHelper, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.blockHelpers[name]
+	return h, ok
+}
+
+// Partial returns the partial registered as name. It is safe to call on a nil registry.
+func (r *Registry) Partial(name string) (PartialFunc, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, ok := r.partials[name]
+	return fn, ok
+}
+
+func (r *Registry) missingHooks() (OptionsHelper, OptionsBlockHelper) {
+	if r == nil {
+		return nil, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.helperMissing, r.blockHelperMissing
+}
+
+// RegisterHelper registers h in the package-wide registry.
+func RegisterHelper(name string, h OptionsHelper) {
+	defaultRegistry.RegisterHelper(name, h)
+}
+
+// RegisterBlockHelper registers h in the package-wide registry.
+func RegisterBlockHelper(name string, h OptionsBlockHelper) {
+	defaultRegistry.RegisterBlockHelper(name, h)
+}
+
+// RegisterPartial registers fn in the package-wide registry.
+func RegisterPartial(name string, fn PartialFunc) {
+	defaultRegistry.RegisterPartial(name, fn)
+}
+
+// SetHelperMissing sets the helperMissing hook of the package-wide registry.
+func SetHelperMissing(h OptionsHelper) {
+	defaultRegistry.SetHelperMissing(h)
+}
+
+// SetBlockHelperMissing sets the blockHelperMissing hook of the package-wide registry.
+func SetBlockHelperMissing(h OptionsBlockHelper) {
+	defaultRegistry.SetBlockHelperMissing(h)
+}
+
+// Env is the per-render state generated render functions pass down to partials and helpers.
+// A nil *Env is valid and uses only the package-wide registry.
+type Env struct {
+	// Registry is consulted before the package-wide registry; it may be nil.
+	Registry *Registry
+	// Context is the render's context (RenderXxxContext); it may be nil. The render stops
+	// with its error when it is cancelled, and helpers get it as HelperOptions.Ctx.
+	Context context.Context
+	// Limits bound the render's resources (see EnterPartial, Iterate and Writer).
+	Limits Limits
+	// Data holds @data variables of the render ({{@site.title}}), in every template and
+	// partial it renders, under @root and the variables of blocks (@index, @key, ...).
+	Data map[string]any
+
+	frame      *DataFrame // the frame of Data
+	depth      int        // templates and partials being rendered
+	iterations int64      // {{#each}} iterations so far
+	written    int64      // bytes written to Writer
+	deadline   time.Time  // end of Limits.Timeout, set by the first EnterPartial
+}
+
+// Ctx returns the render's context, or context.Background() when there is none.
+func (e *Env) Ctx() context.Context {
+	if e == nil || e.Context == nil {
+		return context.Background()
+	}
+	return e.Context
+}
+
+// Err returns the error of the render's context once it is done (context.Canceled or
+// context.DeadlineExceeded); EnterPartial and Iterate check it, at the start of each
+// template and partial and at each {{#each}} iteration. It is nil when there is no context.
+func (e *Env) Err() error {
+	if e == nil || e.Context == nil {
+		return nil
+	}
+	return e.Context.Err()
+}
+
+// RootFrame returns the @data frame of a template rendered with root as @root, on top of the
+// frame of Data.
+func (e *Env) RootFrame(root any) *DataFrame {
+	return NewDataFrame(e.dataFrame()).Set("root", RawValue(root))
+}
+
+// NewScope returns the scope of a template rendered with ctx as its context and @root, with
+// the @data variables of Data.
+func (e *Env) NewScope(ctx any) *Scope {
+	return &Scope{ctx: ctx, context: true, data: e.RootFrame(ctx)}
+}
+
+// DataVar returns the @data variable name of Data, or nil.
+func (e *Env) DataVar(name string) any {
+	if e == nil {
+		return nil
+	}
+	return e.Data[name]
+}
+
+func (e *Env) dataFrame() *DataFrame {
+	if e == nil || len(e.Data) == 0 {
+		return nil
+	}
+	if e.frame == nil {
+		e.frame = &DataFrame{vars: e.Data}
+	}
+	return e.frame
+}
+
+// registries returns the registries to search, in order.
+func (e *Env) registries() []*Registry {
+	if e == nil || e.Registry == nil || e.Registry == defaultRegistry {
+		return []*Registry{defaultRegistry}
+	}
+	return []*Registry{e.Registry, defaultRegistry}
+}
+
+// Helper returns the helper generated code calls for name, a helper that was not known at
+// compile time. It is resolved when called: the helper registered as name, else the
+// helperMissing hook, searching the render's registry before the package-wide one.
+func (e *Env) Helper(name string) OptionsHelper {
+	return func(args []any, options *HelperOptions) (any, error) {
+		regs := e.registries()
+		for _, r := range regs {
+			if h, ok := r.Helper(name); ok {
+				return h(args, options)
+			}
+		}
+		for _, r := range regs {
+			if h, _ := r.missingHooks(); h != nil {
+				return h(args, options)
+			}
+		}
+		return nil, missingHelperError("helper", name, options)
+	}
+}
+
+// BlockHelper is Helper for block helpers (RegisterBlockHelper, SetBlockHelperMissing).
+func (e *Env) BlockHelper(name string) OptionsBlockHelper {
+	return func(w io.Writer, args []any, options *HelperOptions) error {
+		regs := e.registries()
+		for _, r := range regs {
+			if h, ok := r.BlockHelper(name); ok {
+				return h(w, args, options)
+			}
+		}
+		for _, r := range regs {
+			if _, h := r.missingHooks(); h != nil {
+				return h(w, args, options)
+			}
+		}
+		return missingHelperError("block helper", name, options)
+	}
+}
+
+// RenderPartial renders the registered partial name with ctx. Generated code calls it for
+// dynamic partials that are not in its own package; when no registry has the partial,
+// MissingPartialOutput is written and the render continues.
+func (e *Env) RenderPartial(w io.Writer, name string, ctx any) error {
+	for _, r := range e.registries() {
+		if fn, ok := r.Partial(name); ok {
+			return fn(ctx, w, e)
+		}
+	}
+	MissingPartialOutput(w, name)
+	return nil
+}
+
+func missingHelperError(kind, name string, options *HelperOptions) error {
+	if options != nil && options.Template != "" {
+		return hexerr.Newf("template %q: %s %q is not defined", options.Template, kind, name)
+	}
+	return hexerr.Newf("%s %q is not defined", kind, name)
+}
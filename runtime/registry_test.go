@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEnvHelper(t *testing.T) {
+	saved := defaultRegistry
+	defaultRegistry = NewRegistry()
+	t.Cleanup(func() { defaultRegistry = saved })
+	options := &HelperOptions{Name: "shout", Template: "main"}
+
+	var env *Env
+	if _, err := env.Helper("shout")([]any{"hi"}, options); err == nil || err.Error() != `template "main": helper "shout" is not defined` {
+		t.Fatalf("unregistered helper: err = %v", err)
+	}
+	if err := env.BlockHelper("box")(io.Discard, nil, nil); err == nil || err.Error() != `block helper "box" is not defined` {
+		t.Fatalf("unregistered block helper: err = %v", err)
+	}
+
+	SetHelperMissing(func(args []any, options *HelperOptions) (any, error) {
+		return "missing:" + options.Name, nil
+	})
+	call := env.Helper("shout")
+	if got, err := call([]any{"hi"}, options); err != nil || got != "missing:shout" {
+		t.Fatalf("helperMissing: got %v, %v", got, err)
+	}
+	RegisterHelper("shout", func(args []any, _ *HelperOptions) (any, error) {
+		return strings.ToUpper(Stringify(args[0])), nil
+	})
+	// Registration after the call site was built is still seen.
+	if got, err := call([]any{"hi"}, options); err != nil || got != "HI" {
+		t.Fatalf("registered helper: got %v, %v", got, err)
+	}
+	// A render's registry comes before the package-wide one.
+	reg := NewRegistry()
+	reg.RegisterHelper("shout", func(args []any, _ *HelperOptions) (any, error) {
+		return "per-render", nil
+	})
+	if got, err := (&Env{Registry: reg}).Helper("shout")([]any{"hi"}, options); err != nil || got != "per-render" {
+		t.Fatalf("per-render helper: got %v, %v", got, err)
+	}
+
+	SetBlockHelperMissing(func(w io.Writer, args []any, options *HelperOptions) error {
+		return options.Fn(w, options.Context, nil)
+	})
+	var b strings.Builder
+	blockOptions := &HelperOptions{Name: "box", Context: "ctx"}
+	blockOptions.SetBlock(func(w io.Writer, ctx any, _ *DataFrame) error {
+		_, err := io.WriteString(w, "["+Stringify(ctx)+"]")
+		return err
+	}, nil)
+	if err := env.BlockHelper("box")(&b, nil, blockOptions); err != nil || b.String() != "[ctx]" {
+		t.Fatalf("blockHelperMissing: got %q, %v", b.String(), err)
+	}
+}
+
+func TestEnvRenderPartial(t *testing.T) {
+	saved := defaultRegistry
+	defaultRegistry = NewRegistry()
+	t.Cleanup(func() { defaultRegistry = saved })
+	RegisterPartial("card", func(ctx any, w io.Writer, env *Env) error {
+		_, err := io.WriteString(w, "card:"+Stringify(LookupPath(ctx, "title")))
+		return err
+	})
+	reg := NewRegistry()
+	reg.RegisterPartial("card", func(ctx any, w io.Writer, env *Env) error {
+		_, err := io.WriteString(w, "plugin card")
+		return err
+	})
+	ctx := map[string]any{"title": "T"}
+	tests := []struct {
+		env  *Env
+		name string
+		want string
+	}{
+		{nil, "card", "card:T"},
+		{&Env{Registry: reg}, "card", "plugin card"},
+		{&Env{Registry: reg}, "nope", `<!-- partial "nope" is not defined -->`},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		if err := tt.env.RenderPartial(&b, tt.name, ctx); err != nil {
+			t.Fatalf("RenderPartial(%q): %v", tt.name, err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("RenderPartial(%q) = %q, want %q", tt.name, b.String(), tt.want)
+		}
+	}
+}
+
+func TestEnvData(t *testing.T) {
+	var env *Env
+	if v := env.DataVar("site"); v != nil {
+		t.Errorf("nil env: DataVar = %v", v)
+	}
+	if s := env.NewScope("ctx"); s.Path("@root") != "ctx" || s.Path("@site.title") != nil {
+		t.Errorf("nil env: scope @root = %v, @site.title = %v", s.Path("@root"), s.Path("@site.title"))
+	}
+	env = &Env{Data: map[string]any{"site": map[string]any{"title": "Blog"}, "root": "shadowed"}}
+	s := env.NewScope(map[string]any{"title": "Post"})
+	for path, want := range map[string]any{"@site.title": "Blog", "title": "Post", "@root.title": "Post", "@site.missing": nil} {
+		if got := s.Path(path); got != want {
+			t.Errorf("Path(%q) = %v, want %v", path, got, want)
+		}
+	}
+	frame := NewDataFrame(env.RootFrame("ctx")).Set("index", 1)
+	if frame.Get("site") == nil || frame.Get("index") != 1 || frame.Root() != "ctx" {
+		t.Errorf("frame: site = %v, index = %v, root = %v", frame.Get("site"), frame.Get("index"), frame.Root())
+	}
+}
@@ -2,14 +2,18 @@ package runtime
 
 import (
 	"fmt"
-	"html"
 	"io"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
 // SafeString marks a value as pre-escaped HTML.
 type SafeString string
 
-// Stringify converts a value to its string representation.
+// Stringify converts a value to its string representation: TemplateValue.TemplateString, else
+// the result of the value's formatter (see RegisterFormatter), else its String or Error method,
+// else as fmt prints it.
 func Stringify(v any) string {
 	switch t := v.(type) {
 	case nil:
@@ -20,6 +24,17 @@ func Stringify(v any) string {
 		return string(t)
 	case SafeString:
 		return string(t)
+	case TemplateValue:
+		return t.TemplateString()
+	}
+	if s, ok := format(v); ok {
+		return s
+	}
+	var a [32]byte
+	if b, ok := appendNumber(a[:0], v); ok {
+		return string(b)
+	}
+	switch t := v.(type) {
 	case fmt.Stringer:
 		return t.String()
 	case error:
@@ -29,19 +44,29 @@ func Stringify(v any) string {
 	}
 }
 
-// WriteEscaped writes an escaped value into the writer.
+// WriteEscaped writes an escaped value into the writer. SafeString values and the
+// TemplateHTML of TemplateValue values are written as is. Strings are escaped as
+// html.EscapeString does, and numbers and bools are formatted, straight into w, without
+// building the escaped string.
 func WriteEscaped(w io.Writer, v any) error {
 	if w == nil || v == nil {
 		return nil
 	}
 	switch t := v.(type) {
+	case string:
+		return writeEscapedString(w, t)
 	case SafeString:
 		_, err := io.WriteString(w, string(t))
 		return err
-	default:
-		_, err := io.WriteString(w, html.EscapeString(Stringify(v)))
+	case TemplateValue:
+		_, err := io.WriteString(w, t.TemplateHTML())
+		return err
+	}
+	// Numbers and bools have nothing to escape.
+	if ok, err := writeNumber(w, v); ok {
 		return err
 	}
+	return writeEscapedString(w, Stringify(v))
 }
 
 // WriteRaw writes a raw value into the writer.
@@ -49,6 +74,144 @@ func WriteRaw(w io.Writer, v any) error {
 	if w == nil || v == nil {
 		return nil
 	}
+	if s, ok := v.(string); ok {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+	if ok, err := writeNumber(w, v); ok {
+		return err
+	}
 	_, err := io.WriteString(w, Stringify(v))
 	return err
 }
+
+// htmlEscapes are the escapes of html.EscapeString by byte.
+var htmlEscapes = [256]string{'&': "&amp;", '\'': "&#39;", '<': "&lt;", '>': "&gt;", '"': "&#34;"}
+
+// writeEscapedString writes s HTML-escaped: to an io.StringWriter the runs between special
+// characters as they are, so s is written in one piece when it has none, and to other writers
+// the escaped string in one Write.
+func writeEscapedString(w io.Writer, s string) error {
+	switch bw := w.(type) {
+	case *Writer:
+		if bw.err != nil {
+			return bw.err
+		}
+		bw.buf = appendEscaped(bw.buf, s)
+		return bw.flushFull()
+	case io.StringWriter:
+	default:
+		_, err := w.Write(appendEscaped(make([]byte, 0, len(s)+len(s)/8), s))
+		return err
+	}
+	last := 0
+	for i := 0; i < len(s); i++ {
+		esc := htmlEscapes[s[i]]
+		if esc == "" {
+			continue
+		}
+		if last < i {
+			if _, err := io.WriteString(w, s[last:i]); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, esc); err != nil {
+			return err
+		}
+		last = i + 1
+	}
+	if last < len(s) {
+		_, err := io.WriteString(w, s[last:])
+		return err
+	}
+	return nil
+}
+
+// appendEscaped appends s HTML-escaped to dst.
+func appendEscaped(dst []byte, s string) []byte {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		if esc := htmlEscapes[s[i]]; esc != "" {
+			dst = append(append(dst, s[last:i]...), esc...)
+			last = i + 1
+		}
+	}
+	return append(dst, s[last:]...)
+}
+
+// writeNumber writes v when it is a number or bool of a built-in type without a formatter,
+// and reports whether it did.
+func writeNumber(w io.Writer, v any) (bool, error) {
+	if formatters.set.Load() {
+		if _, ok := LookupFormatter(reflect.TypeOf(v)); ok {
+			return false, nil
+		}
+	}
+	switch bw := w.(type) {
+	case *Writer:
+		buf, ok := appendNumber(bw.buf, v)
+		if !ok {
+			return false, nil
+		}
+		if bw.err != nil {
+			return true, bw.err
+		}
+		bw.buf = buf
+		return true, bw.flushFull()
+	case *strings.Builder:
+		var a [32]byte
+		b, ok := appendNumber(a[:0], v)
+		if ok {
+			bw.Write(b)
+		}
+		return ok, nil
+	case interface{ AvailableBuffer() []byte }: // *bytes.Buffer, *bufio.Writer
+		b, ok := appendNumber(bw.AvailableBuffer(), v)
+		if !ok {
+			return false, nil
+		}
+		_, err := w.Write(b)
+		return true, err
+	}
+	// The buffer escapes to w; appending to nil allocates it only for numbers.
+	b, ok := appendNumber(nil, v)
+	if !ok {
+		return false, nil
+	}
+	_, err := w.Write(b)
+	return true, err
+}
+
+// appendNumber appends v to dst as fmt prints it, when v is a number or bool of a built-in
+// type, and reports whether it did.
+func appendNumber(dst []byte, v any) ([]byte, bool) {
+	switch t := v.(type) {
+	case int:
+		return strconv.AppendInt(dst, int64(t), 10), true
+	case int8:
+		return strconv.AppendInt(dst, int64(t), 10), true
+	case int16:
+		return strconv.AppendInt(dst, int64(t), 10), true
+	case int32:
+		return strconv.AppendInt(dst, int64(t), 10), true
+	case int64:
+		return strconv.AppendInt(dst, t, 10), true
+	case uint:
+		return strconv.AppendUint(dst, uint64(t), 10), true
+	case uint8:
+		return strconv.AppendUint(dst, uint64(t), 10), true
+	case uint16:
+		return strconv.AppendUint(dst, uint64(t), 10), true
+	case uint32:
+		return strconv.AppendUint(dst, uint64(t), 10), true
+	case uint64:
+		return strconv.AppendUint(dst, t, 10), true
+	case float32:
+		return strconv.AppendFloat(dst, float64(t), 'g', -1, 32), true
+	case float64:
+		return strconv.AppendFloat(dst, t, 'g', -1, 64), true
+	case bool:
+		return strconv.AppendBool(dst, t), true
+	}
+	return dst, false
+}
@@ -0,0 +1,410 @@
+package runtime
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ResolvePath returns the value at the dot-separated path in v, or nil. An empty path is v.
+// Each segment is looked up with Resolve; the interpreter, the bytecode VM and LookupPath
+// look up template paths with it. A function value in the middle of the path is not called:
+// the value is a function that looks up the rest of the path in its value, called with the
+// render's context when the template uses it (see Value).
+func ResolvePath(v any, path string) any {
+	if path == "" {
+		return v
+	}
+	for {
+		if isFuncValue(v) {
+			return deferPath(v, path)
+		}
+		key, rest, more := strings.Cut(path, ".")
+		v = Resolve(v, key)
+		if !more || v == nil {
+			return v
+		}
+		path = rest
+	}
+}
+
+// Resolve returns the entry key of a map with string keys, the field or zero-arg method key
+// of a struct or other Go value, or the element key (an index) of a slice, or nil.
+// Fields, promoted fields of embedded structs included, match by name, json tag, capitalized
+// name ({{post.title}} finds Title) or lower-cased name ({{post.id}} finds ID), then methods
+// the same way without json tags.
+// A method with one result or with (T, error) gives a function value calling it, so it is called
+// only when the template uses the value (see Value); methods whose only result is an error, such
+// as Close() error, are not exposed. For a function-valued v, the value is a function that looks
+// key up in its value when it is used (see ResolvePath).
+func Resolve(v any, key string) any {
+	val, _, _ := lookup(v, key)
+	return val
+}
+
+// lookup returns the value of key in v (see Resolve), whether v has key, and whether v is an
+// object whose keys can be looked up at all. The key of a function value is found, as a
+// function looking it up when it is used.
+func lookup(v any, key string) (val any, found, object bool) {
+	if isFuncValue(v) {
+		return deferPath(v, key), true, true
+	}
+	v = RawValue(v)
+	switch m := v.(type) {
+	case nil:
+		return nil, false, false
+	case map[string]any:
+		if fn, ok := deferred(m); ok {
+			return deferPath(fn, key), true, true
+		}
+		val, found = m[key]
+		return val, found, true
+	case Hash:
+		val, found = m[key]
+		return val, found, true
+	}
+	orig := reflect.ValueOf(v)
+	rv := indirect(orig)
+	if !rv.IsValid() {
+		return nil, false, false
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false, false
+		}
+		e := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !e.IsValid() {
+			return nil, false, true
+		}
+		return e.Interface(), true, true
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= rv.Len() {
+			return nil, false, true
+		}
+		return rv.Index(i).Interface(), true, true
+	}
+	keys := keysOf(orig.Type())
+	if index, ok := keys.fields[key]; ok && rv.Kind() == reflect.Struct {
+		f, err := rv.FieldByIndexErr(index)
+		if err != nil {
+			// A field promoted through a nil embedded pointer.
+			return nil, true, true
+		}
+		return f.Interface(), true, true
+	}
+	if i, ok := keys.methods[key]; ok {
+		return methodValue(orig.Method(i)), true, true
+	}
+	return nil, false, rv.Kind() == reflect.Struct || len(keys.methods) > 0
+}
+
+// methodValue returns the value of a zero-arg method: a func() any calling it, or for a method
+// returning (T, error) a func() (any, error).
+func methodValue(m reflect.Value) any {
+	if m.Type().NumOut() == 2 {
+		return func() (any, error) {
+			out := m.Call(nil)
+			err, _ := out[1].Interface().(error)
+			return out[0].Interface(), err
+		}
+	}
+	return func() any { return m.Call(nil)[0].Interface() }
+}
+
+// typeKeys are the keys templates can look up in a Go type (see Resolve): field indexes and
+// method indexes (in the type's method set) by key.
+type typeKeys struct {
+	fields  map[string][]int
+	methods map[string]int
+}
+
+var (
+	typeKeysCache sync.Map // reflect.Type -> *typeKeys
+	errorType     = reflect.TypeFor[error]()
+)
+
+// keysOf returns the keys of t, cached per type. The fields are those of the struct t
+// points to.
+func keysOf(t reflect.Type) *typeKeys {
+	if k, ok := typeKeysCache.Load(t); ok {
+		return k.(*typeKeys)
+	}
+	k := &typeKeys{fields: map[string][]int{}, methods: map[string]int{}}
+	st := t
+	for st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	if st.Kind() == reflect.Struct {
+		var fields []reflect.StructField
+		for _, f := range reflect.VisibleFields(st) {
+			if f.IsExported() && !f.Anonymous {
+				fields = append(fields, f)
+			}
+		}
+		// In order of precedence: the first field with a key keeps it.
+		for _, key := range []func(f reflect.StructField) string{
+			func(f reflect.StructField) string { return f.Name },
+			jsonName,
+			func(f reflect.StructField) string { return lowerFirst(f.Name) },
+			func(f reflect.StructField) string { return strings.ToLower(f.Name) },
+		} {
+			for _, f := range fields {
+				if name := key(f); name != "" && name != "-" {
+					if _, ok := k.fields[name]; !ok {
+						k.fields[name] = f.Index
+					}
+				}
+			}
+		}
+	}
+	var methods []int
+	for i := range t.NumMethod() {
+		mt := t.Method(i).Type // with the receiver
+		if mt.NumIn() == 1 && (mt.NumOut() == 1 && mt.Out(0) != errorType || mt.NumOut() == 2 && mt.Out(1) == errorType) {
+			methods = append(methods, i)
+		}
+	}
+	for _, key := range []func(name string) string{func(name string) string { return name }, lowerFirst, strings.ToLower} {
+		for _, i := range methods {
+			name := key(t.Method(i).Name)
+			_, field := k.fields[name]
+			if _, ok := k.methods[name]; !ok && !field {
+				k.methods[name] = i
+			}
+		}
+	}
+	actual, _ := typeKeysCache.LoadOrStore(t, k)
+	return actual.(*typeKeys)
+}
+
+// lowerFirst returns name with its first letter lower-cased: the key that finds name by
+// capitalized name.
+func lowerFirst(name string) string {
+	if name == "" {
+		return ""
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// indirect follows pointers and interfaces; it returns the zero Value for nil.
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return name
+}
+
+// MapOf returns v as the map of a map-backed context type: generated accessors and partial
+// calls use it for values that are not a map[string]any. Maps with string keys are converted;
+// structs and other Go values with methods become a map of every key Resolve finds in them,
+// with their zero-arg methods as function values called when used (see Value). A function
+// value is not called: its map stands for the function's value, whose keys Field and path
+// lookups resolve with the render's context when the template uses them. Other values give
+// nil.
+func MapOf(v any) map[string]any {
+	if isFuncValue(v) {
+		return map[string]any{deferredKey: v}
+	}
+	v = RawValue(v)
+	switch m := v.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		return m
+	case Hash:
+		return m
+	}
+	orig := reflect.ValueOf(v)
+	rv := indirect(orig)
+	if !rv.IsValid() {
+		return nil
+	}
+	if rv.Kind() == reflect.Map {
+		return ContextMap(v)
+	}
+	keys := keysOf(orig.Type())
+	if rv.Kind() != reflect.Struct && len(keys.methods) == 0 {
+		return nil
+	}
+	out := make(map[string]any, len(keys.fields)+len(keys.methods))
+	if rv.Kind() == reflect.Struct {
+		for key, index := range keys.fields {
+			if f, err := rv.FieldByIndexErr(index); err == nil {
+				out[key] = f.Interface()
+			}
+		}
+	}
+	for key, i := range keys.methods {
+		m := orig.Method(i)
+		if m.Type().NumOut() == 2 {
+			out[key] = methodValue(m)
+		} else {
+			out[key] = func() any { return m.Call(nil)[0].Interface() }
+		}
+	}
+	return out
+}
+
+// ContextMap returns v as a map[string]any, for merging partial hash arguments onto a
+// context (MergePartialContext): maps with string keys are converted, structs become maps of
+// their exported fields (by json name when tagged). Other values give nil.
+func ContextMap(v any) map[string]any {
+	switch m := RawValue(v).(type) {
+	case map[string]any:
+		return m
+	case Hash:
+		return m
+	}
+	rv := indirect(reflect.ValueOf(RawValue(v)))
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		out := make(map[string]any, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			out[it.Key().String()] = it.Value().Interface()
+		}
+		return out
+	case reflect.Struct:
+		out := make(map[string]any)
+		for _, f := range reflect.VisibleFields(rv.Type()) {
+			if !f.IsExported() || f.Anonymous {
+				continue
+			}
+			fv, err := rv.FieldByIndexErr(f.Index)
+			if err != nil {
+				continue
+			}
+			name := jsonName(f)
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			out[name] = fv.Interface()
+		}
+		return out
+	}
+	return nil
+}
+
+// SliceOf returns v as a []any: a []any as it is, other slices and arrays converted, the
+// values of an iterator, channel or Iterable collected (see Each), and nil for other values.
+// A function-valued v is called first, with context.Background(), and gives nil when it fails.
+// Generated accessors of typed collections use it; renders iterate typed collections with
+// Elements, which resolves them with the render's context and fails with the error.
+func SliceOf(v any) []any {
+	if isFuncValue(v) {
+		fv, err := Value(context.Background(), v)
+		if err != nil {
+			return nil
+		}
+		v = fv
+	}
+	v = RawValue(v)
+	if s, ok := v.([]any); ok {
+		return s
+	}
+	if sequential(v) {
+		out := []any{}
+		for it := range Each(v) {
+			out = append(out, it.Value)
+		}
+		return out
+	}
+	rv := indirect(reflect.ValueOf(v))
+	if k := rv.Kind(); k != reflect.Slice && k != reflect.Array {
+		return nil
+	}
+	out := make([]any, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out
+}
+
+// sequential reports whether v is an iterator, a channel or an Iterable, which Each consumes
+// lazily.
+func sequential(v any) bool {
+	if _, ok := v.(Iterable); ok {
+		return true
+	}
+	k := indirect(reflect.ValueOf(v)).Kind()
+	return k == reflect.Func || k == reflect.Chan
+}
+
+// Entry is one iteration of {{#each}}: a slice index or a map key, and its value.
+type Entry struct {
+	Key   any
+	Value any
+}
+
+// Entries returns the elements of a slice or array, the entries of an OrderedMap in its
+// order, or the entries of a map with string keys in sorted key order. Other values have no
+// entries.
+func Entries(v any) []Entry {
+	if m, ok := v.(*OrderedMap); ok {
+		out := make([]Entry, 0, m.Len())
+		for k, v := range m.All() {
+			out = append(out, Entry{Key: k, Value: v})
+		}
+		return out
+	}
+	switch c := RawValue(v).(type) {
+	case []any:
+		out := make([]Entry, len(c))
+		for i, item := range c {
+			out[i] = Entry{Key: i, Value: item}
+		}
+		return out
+	case map[string]any:
+		return mapEntries(c)
+	case Hash:
+		return mapEntries(c)
+	}
+	rv := indirect(reflect.ValueOf(RawValue(v)))
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		out := make([]Entry, rv.Len())
+		for i := range out {
+			out[i] = Entry{Key: i, Value: rv.Index(i).Interface()}
+		}
+		return out
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		out := make([]Entry, len(keys))
+		for i, k := range keys {
+			out[i] = Entry{Key: k.String(), Value: rv.MapIndex(k).Interface()}
+		}
+		return out
+	}
+	return nil
+}
+
+func mapEntries(m map[string]any) []Entry {
+	keys := SortedKeys(m)
+	out := make([]Entry, len(keys))
+	for i, k := range keys {
+		out[i] = Entry{Key: k, Value: m[k]}
+	}
+	return out
+}
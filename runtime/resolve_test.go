@@ -0,0 +1,83 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+)
+
+type resolveBase struct {
+	ID   int
+	Slug string `json:"slug"`
+}
+
+type resolveAuthor struct {
+	Name string `json:"name"`
+}
+
+func (a *resolveAuthor) Initials() string { return a.Name[:1] }
+
+type resolvePost struct {
+	resolveBase
+	Author   *resolveAuthor
+	Title    string `json:"headline"`
+	Hidden   string `json:"-"`
+	internal string
+}
+
+func (p resolvePost) URL() string { return "/posts/" + p.Slug }
+
+func (p resolvePost) Body() (string, error) { return "", errors.New("not loaded") }
+
+var resolveClosed int
+
+func (p resolvePost) Close() error { resolveClosed++; return nil }
+
+func TestResolve(t *testing.T) {
+	post := &resolvePost{resolveBase: resolveBase{ID: 7, Slug: "hi"}, Author: &resolveAuthor{Name: "ann"}, Title: "Hi", Hidden: "h", internal: "x"}
+	data := map[string]any{"post": post, "posts": []resolvePost{*post}}
+	for path, want := range map[string]any{
+		"post.Title":           "Hi",
+		"post.headline":        "Hi",
+		"post.title":           "Hi",
+		"post.id":              7,
+		"post.slug":            "hi",
+		"post.Hidden":          "h",
+		"post.internal":        nil,
+		"post.url":             "/posts/hi",
+		"post.URL":             "/posts/hi",
+		"post.author.name":     "ann",
+		"post.author.initials": "a",
+		"posts.0.author.name":  "ann",
+		"post.missing":         nil,
+	} {
+		if got, err := Value(nil, LookupPath(data, path)); got != want || err != nil {
+			t.Errorf("LookupPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if _, err := Value(nil, Resolve(post, "body")); err == nil || err.Error() != "not loaded" {
+		t.Errorf("method with an error: err = %v", err)
+	}
+	if got := LookupPath(post, "close"); got != nil {
+		t.Errorf("method returning only an error: got %v", got)
+	}
+	if resolveClosed != 0 {
+		t.Errorf("Close called %d times", resolveClosed)
+	}
+	if got := LookupPath(resolvePost{}, "author.name"); got != nil {
+		t.Errorf("through a nil pointer: got %v", got)
+	}
+
+	m := MapOf(post)
+	if m["headline"] != "Hi" || m["slug"] != "hi" || m["internal"] != nil {
+		t.Errorf("MapOf fields: %v", m)
+	}
+	if v, err := Value(nil, m["url"]); v != "/posts/hi" || err != nil {
+		t.Errorf("MapOf method url = %v, %v", v, err)
+	}
+	if MapOf(3) != nil || MapOf(nil) != nil {
+		t.Error("MapOf of a scalar is not nil")
+	}
+	if s := SliceOf([]int{1, 2}); len(s) != 2 || s[1] != 2 {
+		t.Errorf("SliceOf = %v", s)
+	}
+}
@@ -0,0 +1,116 @@
+package runtime
+
+import "strings"
+
+// Scope is the evaluation state at a point of a template rendered by pkg/interpreter or the
+// bytecode VM: the context, the block params in effect and the @data frame. Scopes that only
+// bind block params keep the context of the scope they are in.
+type Scope struct {
+	outer   *Scope
+	ctx     any
+	context bool // the scope sets the context (rather than only binding block params)
+	params  map[string]any
+	data    *DataFrame
+}
+
+// NewScope returns the scope of a template rendered with ctx as its context and @root.
+func NewScope(ctx any) *Scope {
+	return &Scope{ctx: ctx, context: true, data: NewRootFrame(ctx)}
+}
+
+// Context returns the current context ("this").
+func (s *Scope) Context() any {
+	return s.ctx
+}
+
+// Data returns the current @data frame.
+func (s *Scope) Data() *DataFrame {
+	return s.data
+}
+
+// WithContext returns a scope inside s with ctx as the context and data as the @data frame.
+func (s *Scope) WithContext(ctx any, data *DataFrame) *Scope {
+	return &Scope{outer: s, ctx: ctx, context: true, data: data}
+}
+
+// WithParams returns a scope inside s binding the block params names to values (missing
+// values are nil); it returns s when there are no names.
+func (s *Scope) WithParams(names []string, values ...any) *Scope {
+	if len(names) == 0 {
+		return s
+	}
+	params := make(map[string]any, len(names))
+	for i, name := range names {
+		if i < len(values) {
+			params[name] = values[i]
+		} else {
+			params[name] = nil
+		}
+	}
+	return &Scope{outer: s, ctx: s.ctx, params: params, data: s.data}
+}
+
+// parent returns the scope of the context enclosing the current one.
+func (s *Scope) parent() (*Scope, bool) {
+	cur := s
+	for cur != nil && !cur.context {
+		cur = cur.outer
+	}
+	if cur == nil {
+		return nil, false
+	}
+	for p := cur.outer; p != nil; p = p.outer {
+		if p.context {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Path resolves a template path the way generated code does: @root and @data variables,
+// ../ for the enclosing context, this and ./ for the current one, block params, and
+// otherwise the current context only (there is no fallback to enclosing contexts).
+func (s *Scope) Path(p string) any {
+	p = strings.TrimSpace(p)
+	switch {
+	case p == "@root" || strings.HasPrefix(p, "@root."):
+		return ResolvePath(s.data.Root(), strings.TrimPrefix(strings.TrimPrefix(p, "@root"), "."))
+	case strings.HasPrefix(p, "@"):
+		name, rest, _ := strings.Cut(p[1:], ".")
+		return ResolvePath(s.data.Get(name), rest)
+	case p == ".." || strings.HasPrefix(p, "../"):
+		parent, ok := s.parent()
+		if !ok {
+			return nil
+		}
+		rest := strings.TrimPrefix(strings.TrimPrefix(p, ".."), "/")
+		if rest == "" {
+			return parent.ctx
+		}
+		return parent.Path(rest)
+	case p == "this" || p == ".":
+		return s.ctx
+	case strings.HasPrefix(p, "this."):
+		return ResolvePath(s.ctx, p[len("this."):])
+	case strings.HasPrefix(p, "./"):
+		return ResolvePath(s.ctx, p[len("./"):])
+	}
+	head, rest, _ := strings.Cut(p, ".")
+	for cur := s; cur != nil; cur = cur.outer {
+		if v, ok := cur.params[head]; ok {
+			return ResolvePath(v, rest)
+		}
+	}
+	return ResolvePath(s.ctx, p)
+}
+
+// EachFrame returns the @data frame of iteration i of n of {{#each}} over an entry with the
+// given key: as in generated code, @index and @key are both the key (the key string for
+// maps); @first and @last are set.
+func EachFrame(parent *DataFrame, key any, i, n int) *DataFrame {
+	return NewDataFrame(parent).
+		Set("index", key).
+		Set("key", key).
+		Set("first", i == 0).
+		Set("last", i == n-1)
+}
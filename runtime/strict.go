@@ -0,0 +1,96 @@
+package runtime
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PathPos identifies a path expression in a template, for errors from strict lookups.
+type PathPos struct {
+	Template string
+	Line     int
+	Column   int
+	Path     string // full data path, e.g. "user.name" for {{name}} inside {{#with user}}
+}
+
+// MissingPathError is the cause of the *RenderError returned by templates compiled in strict
+// mode (or with assumeObjects) when a path cannot be followed in the data.
+type MissingPathError struct {
+	PathPos
+	Segment   string // the path segment that is missing, or the one that is not an object
+	NotObject bool   // Segment exists but is not an object, so the rest of the path cannot be looked up
+}
+
+func (e *MissingPathError) Error() string {
+	var b strings.Builder
+	b.WriteString("template ")
+	b.WriteString(strconv.Quote(e.Template))
+	if e.Line > 0 {
+		b.WriteString(" line ")
+		b.WriteString(strconv.Itoa(e.Line))
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(e.Column))
+	}
+	b.WriteString(": ")
+	e.writeMessage(&b)
+	return b.String()
+}
+
+// writeMessage writes the error message without the position.
+func (e *MissingPathError) writeMessage(b *strings.Builder) {
+	b.WriteString(strconv.Quote(e.Path))
+	if e.NotObject {
+		b.WriteString(" cannot be looked up: ")
+		b.WriteString(strconv.Quote(e.Segment))
+		b.WriteString(" is not an object")
+	} else {
+		b.WriteString(" is not defined (missing ")
+		b.WriteString(strconv.Quote(e.Segment))
+		b.WriteString(")")
+	}
+}
+
+// CheckPath returns a *RenderError with a *MissingPathError cause when a segment of the dotted path is missing in ctx
+// or when a value before the last segment is not an object. Contexts that are not
+// map-backed (for example hand-written implementations of a context interface) are not checked.
+func CheckPath(ctx any, path string, at PathPos) error {
+	return checkPath(ctx, path, at, false)
+}
+
+// CheckPathObjects is CheckPath for assumeObjects mode: a missing last segment is allowed,
+// only missing (or non-object) intermediate values are errors.
+func CheckPathObjects(ctx any, path string, at PathPos) error {
+	return checkPath(ctx, path, at, true)
+}
+
+func checkPath(ctx any, path string, at PathPos, allowMissingLast bool) error {
+	m := contextMapFromAny(ctx)
+	if m == nil || path == "" {
+		return nil
+	}
+	parts := strings.Split(path, ".")
+	var cur any = m
+	for i, key := range parts {
+		v, ok, object := lookup(cur, key)
+		if !object {
+			return missingPath(&MissingPathError{PathPos: at, Segment: parts[i-1], NotObject: true})
+		}
+		if !ok {
+			if allowMissingLast && i == len(parts)-1 {
+				return nil
+			}
+			return missingPath(&MissingPathError{PathPos: at, Segment: key})
+		}
+		cur = v
+	}
+	return nil
+}
+
+// missingPath returns the *RenderError of err at its position.
+func missingPath(err *MissingPathError) error {
+	return &RenderError{
+		Stack: []Frame{{Template: err.Template, Line: err.Line, Column: err.Column}},
+		Path:  err.Path,
+		Err:   err,
+	}
+}
@@ -0,0 +1,50 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPath(t *testing.T) {
+	data := map[string]any{
+		"user":  map[string]any{"name": "Ann", "email": nil},
+		"title": "T",
+		"tags":  "a,b",
+	}
+	at := PathPos{Template: "main", Line: 3, Column: 5, Path: "user.nmae"}
+	tests := []struct {
+		path          string
+		assumeObjects bool
+		want          string
+	}{
+		{"user.name", false, ""},
+		{"user.email", false, ""},
+		{"user.nmae", false, `template "main" line 3:5: "user.nmae" is not defined (missing "nmae")`},
+		{"user.nmae", true, ""},
+		{"account.id", true, `template "main" line 3:5: "user.nmae" is not defined (missing "account")`},
+		{"tags.first", true, `template "main" line 3:5: "user.nmae" cannot be looked up: "tags" is not an object`},
+		{"user.email.domain", false, `template "main" line 3:5: "user.nmae" cannot be looked up: "email" is not an object`},
+	}
+	for _, tt := range tests {
+		check := CheckPath
+		if tt.assumeObjects {
+			check = CheckPathObjects
+		}
+		err := check(rawCtx{m: data}, tt.path, at)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("check(%q, assumeObjects=%v) = %q, want %q", tt.path, tt.assumeObjects, got, tt.want)
+		}
+	}
+
+	var missing *MissingPathError
+	if err := CheckPath(data, "nope", PathPos{Template: "t"}); !errors.As(err, &missing) || missing.Segment != "nope" {
+		t.Errorf("expected *MissingPathError for nope, got %v", err)
+	}
+	if err := CheckPath(struct{}{}, "anything", at); err != nil {
+		t.Errorf("non-map context should not be checked, got %v", err)
+	}
+}
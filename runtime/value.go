@@ -0,0 +1,110 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Lazy is a context value computed on first use and then reused: put NewLazy(loadRelated) in
+// the context, and the query runs once per render only when a template uses the value. A Lazy
+// is safe for concurrent use; one shared by several renders is computed once for all of them.
+type Lazy struct {
+	fn   func(context.Context) (any, error)
+	mu   sync.Mutex
+	done bool
+	v    any
+	err  error
+}
+
+// NewLazy returns a Lazy computed by fn.
+func NewLazy(fn func(context.Context) (any, error)) *Lazy {
+	return &Lazy{fn: fn}
+}
+
+// Value returns the value of l, calling fn with ctx on first use. Its error is returned by
+// every call, except context.Canceled and context.DeadlineExceeded: those belong to the
+// render that was stopped, and the next call computes the value again.
+func (l *Lazy) Value(ctx context.Context) (any, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done {
+		return l.v, l.err
+	}
+	v, err := l.fn(ctx)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return v, err
+	}
+	l.v, l.err, l.done = v, err, true
+	return v, err
+}
+
+// Value returns v or, when v is a function-valued context value, the value it computes:
+// a func() any, func() (any, error) or func(context.Context) (any, error) is called with ctx,
+// and a *Lazy is computed once. Templates see the value rather than the function, as in
+// Handlebars.js; the error of the function fails the render.
+func Value(ctx context.Context, v any) (any, error) {
+	switch fn := v.(type) {
+	case func() any:
+		return fn(), nil
+	case func() (any, error):
+		return fn()
+	case func(context.Context) (any, error):
+		return fn(ctx)
+	case *Lazy:
+		return fn.Value(ctx)
+	}
+	return v, nil
+}
+
+// isFuncValue reports whether v is a function-valued context value (see Value).
+func isFuncValue(v any) bool {
+	switch v.(type) {
+	case func() any, func() (any, error), func(context.Context) (any, error), *Lazy:
+		return true
+	}
+	return false
+}
+
+// deferPath returns the value at path in fn, a function-valued context value, as a function
+// value itself: path lookups do not call functions in the middle of a path, where the
+// render's context and errors are not at hand. Value calls fn with the render's context when
+// the template uses the value, and fn's error fails the render there.
+func deferPath(fn any, path string) func(context.Context) (any, error) {
+	return func(ctx context.Context) (any, error) {
+		v, err := Value(ctx, fn)
+		if err != nil {
+			return nil, err
+		}
+		return Value(ctx, ResolvePath(v, path))
+	}
+}
+
+// deferredKey is the only key of the map MapOf returns for a function value: the map stands
+// for the function's value, computed when a value of the context is used (see Field).
+const deferredKey = "\x00deferred"
+
+// deferred returns the function value a map from MapOf stands for, if m is one.
+func deferred(m map[string]any) (any, bool) {
+	if len(m) != 1 {
+		return nil, false
+	}
+	fn, ok := m[deferredKey]
+	return fn, ok
+}
+
+// Field returns the value of key in m, the map of a map-backed context type. Generated
+// accessors use it, so that the key of a function-valued object is looked up when the
+// template uses it (see MapOf).
+func Field(m map[string]any, key string) any {
+	if fn, ok := deferred(m); ok {
+		return deferPath(fn, key)
+	}
+	return m[key]
+}
+
+// Value returns Value(ctx, v) with the render's context (see Ctx). Generated code, the
+// interpreter and the bytecode VM resolve the context values a template uses with it.
+func (e *Env) Value(v any) (any, error) {
+	return Value(e.Ctx(), v)
+}
@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestValue(t *testing.T) {
+	errLoad := errors.New("load failed")
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req")
+	for _, tt := range []struct {
+		name string
+		v    any
+		want any
+		err  error
+	}{
+		{"plain", "x", "x", nil},
+		{"func", func() any { return 1 }, 1, nil},
+		{"func with error", func() (any, error) { return nil, errLoad }, nil, errLoad},
+		{"func with context", func(ctx context.Context) (any, error) { return ctx.Value(ctxKey{}), nil }, "req", nil},
+		{"lazy", NewLazy(func(context.Context) (any, error) { return []any{1}, nil }), []any{1}, nil},
+	} {
+		got, err := Value(ctx, tt.v)
+		if !errors.Is(err, tt.err) || Stringify(got) != Stringify(tt.want) {
+			t.Errorf("%s: got %v, %v; want %v, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+
+	if v, err := Value(ctx, func(int) any { return 1 }); err != nil {
+		t.Errorf("other function: err = %v", err)
+	} else if _, ok := v.(func(int) any); !ok {
+		t.Errorf("other function: got %v, want the function itself", v)
+	}
+
+	env := &Env{Context: ctx}
+	if v, err := env.Value(func(ctx context.Context) (any, error) { return ctx.Value(ctxKey{}), nil }); v != "req" || err != nil {
+		t.Errorf("Env.Value = %v, %v", v, err)
+	}
+
+	// A function in the middle of a path is called when the value is used, with the render's
+	// context, and its error is the value's.
+	calls := 0
+	m := map[string]any{
+		"author": func(ctx context.Context) (any, error) {
+			calls++
+			return map[string]any{"name": ctx.Value(ctxKey{})}, nil
+		},
+		"broken": func() (any, error) { return nil, errLoad },
+	}
+	for _, v := range []any{ResolvePath(m, "author.name"), LookupPath(m, "author.name"), Field(MapOf(m["author"]), "name")} {
+		if got, err := env.Value(v); got != "req" || err != nil {
+			t.Errorf("through a function: got %v, %v", got, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("author called %d times, want 3", calls)
+	}
+	for _, v := range []any{ResolvePath(m, "broken.name.first"), Field(MapOf(MapOf(m["broken"])), "name")} {
+		if _, err := env.Value(v); !errors.Is(err, errLoad) {
+			t.Errorf("through a failing function: err = %v", err)
+		}
+	}
+	if ResolvePath(map[string]any{"x": 1}, "x") != 1 || Field(map[string]any{"x": 1}, "x") != 1 {
+		t.Error("plain values are not looked up")
+	}
+}
+
+func TestLazy(t *testing.T) {
+	calls := 0
+	l := NewLazy(func(context.Context) (any, error) {
+		calls++
+		return calls, nil
+	})
+	for range 3 {
+		if v, err := l.Value(context.Background()); v != 1 || err != nil {
+			t.Fatalf("Value = %v, %v; want 1", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	l = NewLazy(func(ctx context.Context) (any, error) {
+		calls++
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	})
+	if _, err := l.Value(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled Value: %v, want context.Canceled", err)
+	}
+	if v, err := l.Value(context.Background()); v != "ok" || err != nil || calls != 2 {
+		t.Errorf("Value after cancel = %v, %v with %d calls; want ok computed again", v, err, calls)
+	}
+}
@@ -0,0 +1,561 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/andriyg76/hexerr"
+)
+
+// VMOptions configures a VM.
+type VMOptions struct {
+	// Helpers are the helpers the templates call, by name. Values are Helper, OptionsHelper,
+	// BlockHelper, OptionsBlockHelper or functions with the same signatures. The VM has no
+	// helpers of its own: pass handlebars.Helpers() (helpers/handlebars) for the core helpers.
+	Helpers map[string]any
+	// Registry is searched, before the package-wide registry, for helpers that are not in
+	// Helpers, for the helperMissing / blockHelperMissing hooks and for dynamic partials
+	// that are not templates of the program. It may be nil.
+	Registry *Registry
+	// RecoverHelpers turns panics of helpers into *PanicError errors, handled under
+	// HelperErrors, instead of crashing the render.
+	RecoverHelpers bool
+	// HelperErrors is the policy for errors of helpers: HelperErrorsFail (the default),
+	// HelperErrorsEmpty or HelperErrorsComment (see HandleHelperError). HelperErrorPolicies
+	// overrides it for single helpers.
+	HelperErrors        string
+	HelperErrorPolicies map[string]string
+}
+
+// VM renders the templates of a Program against map[string]any or struct data, with the
+// semantics of pkg/interpreter. It implements renderer.TemplateRenderer and is safe for
+// concurrent use.
+type VM struct {
+	prog      *Program
+	opts      VMOptions
+	templates map[string]*ProgramTemplate
+}
+
+// NewVM returns a VM for p, which must not be modified afterwards.
+func NewVM(p *Program, opts VMOptions) (*VM, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return newVM(p, opts), nil
+}
+
+// LoadVM decodes a program written by hbc -format=bytecode (see DecodeProgram) and returns
+// a VM for it.
+func LoadVM(b []byte, opts VMOptions) (*VM, error) {
+	p, err := DecodeProgram(b)
+	if err != nil {
+		return nil, err
+	}
+	// DecodeProgram has validated p.
+	return newVM(p, opts), nil
+}
+
+func newVM(p *Program, opts VMOptions) *VM {
+	vm := &VM{prog: p, opts: opts, templates: make(map[string]*ProgramTemplate, len(p.Templates))}
+	for i := range p.Templates {
+		vm.templates[p.Templates[i].Name] = &p.Templates[i]
+	}
+	return vm
+}
+
+// Has reports whether the program has a template name.
+func (vm *VM) Has(name string) bool {
+	_, ok := vm.templates[name]
+	return ok
+}
+
+// Render renders template name with data to w. Layout blocks ({{#partial}} and {{#block}})
+// are shared by the template and the partials it renders.
+func (vm *VM) Render(name string, w io.Writer, data any) error {
+	return vm.RenderWithBlocks(name, w, data, NewBlocks())
+}
+
+// RenderString renders template name with data and returns the output.
+func (vm *VM) RenderString(name string, data any) (string, error) {
+	var b strings.Builder
+	if err := vm.Render(name, &b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderWithBlocks is Render with the layout blocks to use. With nil blocks {{#block}}
+// renders its default content and {{#partial}} output is dropped, as in generated code.
+func (vm *VM) RenderWithBlocks(name string, w io.Writer, data any, blocks *Blocks) error {
+	return vm.render(name, w, data, blocks, RenderOptions{})
+}
+
+// RenderContext is Render with ctx as the render's context: the render stops with ctx.Err()
+// once ctx is done, checked at each {{#each}} iteration and each partial, and helpers get
+// ctx as HelperOptions.Ctx.
+func (vm *VM) RenderContext(ctx context.Context, name string, w io.Writer, data any) error {
+	return vm.RenderWithOptions(name, w, data, RenderOptions{Context: ctx})
+}
+
+// RenderWithOptions is Render with the context, registry and limits of opts; a render over
+// a limit fails with a *LimitError. Without opts.Registry, VMOptions.Registry is used.
+func (vm *VM) RenderWithOptions(name string, w io.Writer, data any, opts RenderOptions) error {
+	return vm.render(name, w, data, NewBlocks(), opts)
+}
+
+func (vm *VM) render(name string, w io.Writer, data any, blocks *Blocks, opts RenderOptions) error {
+	t, ok := vm.templates[name]
+	if !ok {
+		return hexerr.Newf("vm: template %q is not defined", name)
+	}
+	if opts.Registry == nil {
+		opts.Registry = vm.opts.Registry
+	}
+	env := NewEnv(opts)
+	r := &vmRender{vm: vm, env: env, blocks: blocks}
+	return r.partial(t, env.Writer(w), data)
+}
+
+// vmRender is the state of one VM.Render call. Values of expressions are pushed onto
+// stack; every instruction sequence that runs leaves it as it found it.
+type vmRender struct {
+	vm     *VM
+	env    *Env
+	blocks *Blocks
+	stack  []any
+}
+
+func (r *vmRender) push(v any) {
+	r.stack = append(r.stack, v)
+}
+
+// path pushes the value of path p in s, calling a function-valued context value (see Value).
+func (r *vmRender) path(s *Scope, p string) error {
+	v, err := r.env.Value(s.Path(p))
+	r.push(v)
+	return err
+}
+
+func (r *vmRender) pop() any {
+	v := r.stack[len(r.stack)-1]
+	r.stack = r.stack[:len(r.stack)-1]
+	return v
+}
+
+// popN pops n values, in the order they were pushed.
+func (r *vmRender) popN(n int) []any {
+	if n == 0 {
+		return nil
+	}
+	values := append([]any(nil), r.stack[len(r.stack)-n:]...)
+	r.stack = r.stack[:len(r.stack)-n]
+	return values
+}
+
+// popArgs pops the arguments of OpCall and OpBlock (see OpCall for argc).
+func (r *vmRender) popArgs(argc int32) ([]any, Hash) {
+	var hash Hash
+	if argc&1 != 0 {
+		hash, _ = r.pop().(Hash)
+	}
+	return r.popN(int(argc >> 1)), hash
+}
+
+func (r *vmRender) errorf(t *ProgramTemplate, pc int32, format string, args ...any) error {
+	return r.wrap(t, pc, hexerr.Newf(format, args...))
+}
+
+// wrap wraps err with the source position of instruction pc of t (see WrapError).
+func (r *vmRender) wrap(t *ProgramTemplate, pc int32, err error) error {
+	line, col := position(t, pc)
+	return WrapError(err, t.Name, line, col)
+}
+
+// helperError handles err, returned by the helper called by instruction pc of t, under the
+// helper's policy (see HandleHelperError); output goes to w.
+func (r *vmRender) helperError(t *ProgramTemplate, pc int32, w io.Writer, helper string, err error) error {
+	policy, ok := r.vm.opts.HelperErrorPolicies[helper]
+	if !ok {
+		policy = r.vm.opts.HelperErrors
+	}
+	line, col := position(t, pc)
+	return HandleHelperError(w, err, policy, helper, t.Name, line, col)
+}
+
+// position returns the source position of instruction pc of t, or 0, 0.
+func position(t *ProgramTemplate, pc int32) (line, col int) {
+	i := sort.Search(len(t.Lines), func(i int) bool { return t.Lines[i].PC > pc }) - 1
+	if i < 0 {
+		return 0, 0
+	}
+	return int(t.Lines[i].Line), int(t.Lines[i].Col)
+}
+
+// partial runs template t with ctx as its context, unless the render's context is done or
+// a limit is exceeded (see Env.EnterPartial).
+func (r *vmRender) partial(t *ProgramTemplate, w io.Writer, ctx any) error {
+	if err := r.env.EnterPartial(); err != nil {
+		return err
+	}
+	defer r.env.LeavePartial()
+	return r.run(t, 0, w, r.env.NewScope(ctx))
+}
+
+// callPartial runs partial for the partial call at instruction pc of t (see wrapPartial).
+func (r *vmRender) callPartial(t *ProgramTemplate, pc int32, partial *ProgramTemplate, w io.Writer, ctx any) error {
+	return r.wrapPartial(t, pc, r.partial(partial, w, ctx))
+}
+
+// wrapPartial wraps err, the error of the partial called at instruction pc of t, with the
+// position of the call (see WrapPartialError).
+func (r *vmRender) wrapPartial(t *ProgramTemplate, pc int32, err error) error {
+	if err == nil {
+		return nil
+	}
+	line, col := position(t, pc)
+	return WrapPartialError(err, t.Name, line, col)
+}
+
+// run executes the code of t from pc to its end or to the OpReturn that ends a block
+// section, with s as the scope.
+func (r *vmRender) run(t *ProgramTemplate, pc int32, w io.Writer, s *Scope) error {
+	strs := r.vm.prog.Strings
+	var params []string // block params of the next block instruction (OpParams)
+	for int(pc) < len(t.Code) {
+		in := t.Code[pc]
+		next := pc + 1
+		var err error
+		switch in.Op {
+		case OpReturn:
+			return nil
+		case OpText:
+			_, err = io.WriteString(w, strs[in.A])
+		case OpPath:
+			err = r.path(s, strs[in.A])
+		case OpName:
+			name := r.vm.prog.Helpers[in.A]
+			if r.isHelper(name) {
+				err = r.call(t, pc, w, s, name, nil, nil)
+			} else {
+				err = r.path(s, name)
+			}
+		case OpString:
+			r.push(strs[in.A])
+		case OpNumber:
+			r.push(r.vm.prog.numbers[in.A])
+		case OpBool:
+			r.push(in.A == 1)
+		case OpNull:
+			r.push(nil)
+		case OpHash:
+			pairs := r.popN(2 * int(in.A))
+			hash := make(Hash, in.A)
+			for i := 0; i < len(pairs); i += 2 {
+				hash[Stringify(pairs[i])] = pairs[i+1]
+			}
+			r.push(hash)
+		case OpCall:
+			args, hash := r.popArgs(in.B)
+			err = r.call(t, pc, w, s, r.vm.prog.Helpers[in.A], args, hash)
+		case OpOutput:
+			err = r.write(t, w, r.pop(), in.A == 1)
+		case OpParams:
+			params = strings.Fields(strs[in.A])
+		case OpIf:
+			v := r.pop()
+			cond := IsTruthy(v)
+			if in.B&IfIncludeZero != 0 {
+				cond = IncludeZeroTruthy(v)
+			}
+			if cond != (in.B&IfUnless != 0) {
+				err = r.run(t, pc+1, w, s.WithParams(params, v))
+			} else {
+				err = r.section(t, in.A, in.C, w, s)
+			}
+			next, params = in.C, nil
+		case OpWith:
+			err = r.with(t, pc, in.A, in.B, w, s, params, r.pop())
+			next, params = in.B, nil
+		case OpEach:
+			err = r.each(t, pc, in.A, in.B, w, s, params, r.pop())
+			next, params = in.B, nil
+		case OpBlock:
+			args, hash := r.popArgs(in.B)
+			err = r.block(t, pc, in, w, s, params, args, hash)
+			next, params = in.D, nil
+		case OpLayoutBlock:
+			if content := r.blockContent(Stringify(r.pop())); content != "" {
+				_, err = io.WriteString(w, content)
+			} else {
+				err = r.run(t, pc+1, w, s)
+			}
+			next = in.A
+		case OpLayoutPartial:
+			name := Stringify(r.pop())
+			if r.blocks != nil {
+				var b strings.Builder
+				if err = r.run(t, pc+1, &b, s); err == nil {
+					r.blocks.Set(name, b.String())
+				}
+			}
+			next = in.A
+		case OpPartial:
+			ctx := r.partialContext(s, in.B)
+			name := r.vm.prog.Partials[in.A]
+			partial, ok := r.vm.templates[name]
+			if !ok {
+				return r.errorf(t, pc, "partial %q is not defined", name)
+			}
+			err = r.callPartial(t, pc, partial, w, ctx)
+		case OpDynamicPartial:
+			ctx := r.partialContext(s, in.A)
+			name := Stringify(r.pop())
+			if partial, ok := r.vm.templates[name]; ok {
+				err = r.callPartial(t, pc, partial, w, ctx)
+			} else {
+				err = r.wrapPartial(t, pc, r.env.RenderPartial(w, name, ctx))
+			}
+		}
+		if err != nil {
+			return r.wrap(t, pc, err)
+		}
+		pc = next
+	}
+	return nil
+}
+
+// blockContent returns the content set for layout block name, or "".
+func (r *vmRender) blockContent(name string) string {
+	if r.blocks == nil {
+		return ""
+	}
+	content, _ := r.blocks.Get(name)
+	return content
+}
+
+// section runs the else section of a block from elseAt; there is none when it is the end.
+func (r *vmRender) section(t *ProgramTemplate, elseAt, end int32, w io.Writer, s *Scope) error {
+	if elseAt == end {
+		return nil
+	}
+	return r.run(t, elseAt, w, s)
+}
+
+func (r *vmRender) write(t *ProgramTemplate, w io.Writer, v any, raw bool) error {
+	switch mode := t.Escape; {
+	case raw || mode == "text":
+		return WriteRaw(w, v)
+	case mode == "html":
+		return WriteEscaped(w, v)
+	default:
+		return WriteEscapedWith(w, mode, v)
+	}
+}
+
+// partialContext pops the context of a partial with the given flags: the context argument
+// (else the current context) with the hash arguments merged onto it.
+func (r *vmRender) partialContext(s *Scope, flags int32) any {
+	var hash Hash
+	if flags&PartialHash != 0 {
+		hash, _ = r.pop().(Hash)
+	}
+	ctx := s.Context()
+	if flags&PartialContext != 0 {
+		ctx = r.pop()
+	}
+	if flags&PartialHash != 0 {
+		ctx = MergePartialContext(ContextMap(ctx), hash)
+	}
+	return ctx
+}
+
+func (r *vmRender) with(t *ProgramTemplate, pc, elseAt, end int32, w io.Writer, s *Scope, params []string, v any) error {
+	if len(params) > 1 {
+		return r.errorf(t, pc, "block %q supports a single param", "with")
+	}
+	if IsTruthy(v) {
+		return r.run(t, pc+1, w, s.WithContext(v, s.Data()).WithParams(params, v))
+	}
+	return r.section(t, elseAt, end, w, s)
+}
+
+func (r *vmRender) each(t *ProgramTemplate, pc, elseAt, end int32, w io.Writer, s *Scope, params []string, v any) error {
+	empty := true
+	for item := range Each(v) {
+		empty = false
+		if err := r.env.Iterate(); err != nil {
+			return err
+		}
+		data := item.Frame(s.Data())
+		if err := r.run(t, pc+1, w, s.WithContext(item.Value, data).WithParams(params, item.Value, item.Key)); err != nil {
+			return err
+		}
+	}
+	if empty {
+		return r.section(t, elseAt, end, w, s)
+	}
+	return nil
+}
+
+// isHelper reports whether OpName name is a helper: of VMOptions.Helpers or of the registries.
+func (r *vmRender) isHelper(name string) bool {
+	if _, ok := r.vm.opts.Helpers[name]; ok {
+		return true
+	}
+	return r.hasRegistryHelper(name, false)
+}
+
+func (r *vmRender) hasRegistryHelper(name string, block bool) bool {
+	for _, reg := range r.env.registries() {
+		var ok bool
+		if block {
+			_, ok = reg.BlockHelper(name)
+		} else {
+			_, ok = reg.Helper(name)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *vmRender) options(t *ProgramTemplate, s *Scope, name string, hash Hash) *HelperOptions {
+	return &HelperOptions{
+		Name:     name,
+		Template: t.Name,
+		Context:  RawValue(s.Context()),
+		Data:     s.Data(),
+		Hash:     hash,
+		Ctx:      r.env.Ctx(),
+	}
+}
+
+// call calls helper name and pushes its result. Names that are not in VMOptions.Helpers are
+// resolved in the registries.
+func (r *vmRender) call(t *ProgramTemplate, pc int32, w io.Writer, s *Scope, name string, args []any, hash Hash) error {
+	h, ok := r.vm.opts.Helpers[name]
+	if !ok {
+		h = r.env.Helper(name)
+	}
+	options := r.options(t, s, name, hash)
+	call := func() (v any, err error) {
+		v, ok, err = CallHelper(h, args, options)
+		return v, err
+	}
+	var v any
+	var err error
+	if r.vm.opts.RecoverHelpers {
+		v, err = RecoverHelperValue(call)
+	} else {
+		v, err = call()
+	}
+	if err != nil {
+		// The helper's value is nil when its policy does not fail the render.
+		v, err = nil, r.helperError(t, pc, w, name, err)
+	} else if !ok {
+		err = r.errorf(t, pc, "helper %q (%T) cannot be called as a value", name, h)
+	}
+	if err != nil {
+		return err
+	}
+	r.push(v)
+	return nil
+}
+
+// block runs OpBlock in: a block helper call, else a universal section.
+func (r *vmRender) block(t *ProgramTemplate, pc int32, in Instr, w io.Writer, s *Scope, params []string, args []any, hash Hash) error {
+	name := r.vm.prog.Helpers[in.A]
+	h, ok := r.vm.opts.Helpers[name]
+	hasArgs := len(args) > 0 || hash != nil
+	if !ok && (r.hasRegistryHelper(name, true) || (hasArgs && runtimeHelperName(name))) {
+		h, ok = r.env.BlockHelper(name), true
+	}
+	if !ok {
+		// Universal section: {{#name}}...{{/name}} is {{#with name}}...{{/with}}.
+		if hasArgs {
+			if len(args) != 1 {
+				return r.errorf(t, pc, "block %q requires a single expression", name)
+			}
+			return r.with(t, pc, in.C, in.D, w, s, params, args[0])
+		}
+		v, err := r.env.Value(s.Path(name))
+		if err != nil {
+			return err
+		}
+		return r.with(t, pc, in.C, in.D, w, s, params, v)
+	}
+
+	options := r.options(t, s, name, hash)
+	options.BlockParams = len(params)
+	var inverse BlockFunc
+	if in.C < in.D {
+		inverse = r.blockFunc(t, pc, in.C, s, nil)
+	}
+	options.SetBlock(r.blockFunc(t, pc, pc+1, s, params), inverse)
+	block := BlockOptions{Fn: func(w io.Writer) error {
+		if err := r.iterate(t, pc); err != nil {
+			return err
+		}
+		return r.run(t, pc+1, w, s)
+	}}
+	if in.C < in.D {
+		block.Inverse = func(w io.Writer) error {
+			if err := r.iterate(t, pc); err != nil {
+				return err
+			}
+			return r.run(t, in.C, w, s)
+		}
+	}
+	call := func() (err error) {
+		ok, err = CallBlockHelper(w, h, args, options, block)
+		return err
+	}
+	var err error
+	if r.vm.opts.RecoverHelpers {
+		err = RecoverHelper(call)
+	} else {
+		err = call()
+	}
+	if err != nil {
+		return r.helperError(t, pc, w, name, err)
+	}
+	if !ok {
+		return r.errorf(t, pc, "helper %q (%T) cannot be called as a block", name, h)
+	}
+	return nil
+}
+
+// blockFunc returns the BlockFunc running the section of t at pc, of the block at instruction
+// at, with the context and frame it is called with; params are bound to the frame's block
+// params.
+func (r *vmRender) blockFunc(t *ProgramTemplate, at, pc int32, s *Scope, params []string) BlockFunc {
+	return func(w io.Writer, ctx any, data *DataFrame) error {
+		if err := r.iterate(t, at); err != nil {
+			return err
+		}
+		values := make([]any, len(params))
+		for i := range params {
+			values[i] = data.BlockParam(i)
+		}
+		return r.run(t, pc, w, s.WithContext(ctx, data).WithParams(params, values...))
+	}
+}
+
+// iterate counts a render of a section of the block helper at instruction pc of t as an
+// iteration (see Env.Iterate), so helpers that render their body per item are limited as
+// {{#each}} is. The error is a *RenderError, which the helper's error policy does not handle.
+func (r *vmRender) iterate(t *ProgramTemplate, pc int32) error {
+	if err := r.env.Iterate(); err != nil {
+		return r.wrap(t, pc, err)
+	}
+	return nil
+}
+
+// runtimeHelperName reports whether name can be a helper looked up at render time: a plain
+// identifier rather than a dotted path, "this" or an @data variable.
+func runtimeHelperName(name string) bool {
+	return name != "" && name != "this" && !strings.ContainsAny(name, "./@[")
+}
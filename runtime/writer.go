@@ -0,0 +1,116 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Writer buffers render output for a destination that is not buffered itself, so the many
+// small writes of a render (the text between values, single values) reach it as a few large
+// ones. WriteEscaped and WriteRaw append values to its buffer without building strings.
+// Call Flush when the render is done; Buffered does that for a render.
+type Writer struct {
+	w   io.Writer
+	buf []byte
+	err error
+}
+
+const (
+	writerSize      = 4096  // output is flushed once this much is buffered
+	writerPoolLimit = 65536 // larger buffers are not kept for reuse
+)
+
+var writerPool = sync.Pool{New: func() any { return NewWriter(nil) }}
+
+// NewWriter returns a Writer that flushes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, buf: make([]byte, 0, writerSize)}
+}
+
+// Reset discards buffered output and the error, and makes b flush to w.
+func (b *Writer) Reset(w io.Writer) {
+	b.w, b.buf, b.err = w, b.buf[:0], nil
+}
+
+// Write buffers p.
+func (b *Writer) Write(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), b.flushFull()
+}
+
+// WriteString buffers s.
+func (b *Writer) WriteString(s string) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	b.buf = append(b.buf, s...)
+	return len(s), b.flushFull()
+}
+
+// WriteByte buffers c.
+func (b *Writer) WriteByte(c byte) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.buf = append(b.buf, c)
+	return b.flushFull()
+}
+
+// Flush writes the buffered output to the destination. After a failed write, writes and
+// flushes return its error.
+func (b *Writer) Flush() error {
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.buf) == 0 {
+		return nil
+	}
+	_, b.err = b.w.Write(b.buf)
+	b.buf = b.buf[:0]
+	return b.err
+}
+
+// flushFull flushes once the buffer is full.
+func (b *Writer) flushFull() error {
+	if len(b.buf) < writerSize {
+		return nil
+	}
+	return b.Flush()
+}
+
+// buffered reports whether writes to w are cheap already: w buffers its output, or is a
+// LazyBlockWriter, which must stay one.
+func buffered(w io.Writer) bool {
+	switch w.(type) {
+	case *Writer, *bytes.Buffer, *strings.Builder, *bufio.Writer, LazyBlockWriter:
+		return true
+	}
+	return false
+}
+
+// Buffered calls render with w, or, when w is not buffered itself (a *Writer,
+// *bytes.Buffer, *strings.Builder, *bufio.Writer or LazyBlockWriter), with a pooled Writer
+// that it flushes to w afterwards, also when render fails. Generated RenderXxx functions
+// render through it.
+func Buffered(w io.Writer, render func(w io.Writer) error) error {
+	if w == nil || buffered(w) {
+		return render(w)
+	}
+	bw := writerPool.Get().(*Writer)
+	bw.Reset(w)
+	err := render(bw)
+	if ferr := bw.Flush(); err == nil {
+		err = ferr
+	}
+	bw.Reset(nil)
+	if cap(bw.buf) <= writerPoolLimit {
+		writerPool.Put(bw)
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// plainWriter is an io.Writer with no other methods.
+type plainWriter struct{ b bytes.Buffer }
+
+func (p *plainWriter) Write(b []byte) (int, error) { return p.b.Write(b) }
+
+type failingWriter struct{ err error }
+
+func (f failingWriter) Write([]byte) (int, error) { return 0, f.err }
+
+var writeValues = []any{
+	"plain", "", `<a href="x">Tom & 'Jerry'</a>`, "ünï<cödé>", "&&", SafeString("<b>"),
+	0, -42, int8(-8), int16(16), int32(32), int64(math.MinInt64), uint(7), uint8(8), uint16(16),
+	uint32(32), uint64(math.MaxUint64), 1.5, 1e6, 1e21, 1e-7, -0.0, math.Inf(-1), math.NaN(),
+	float32(0.1), true, false, []byte("<x>"), testStringer{}, []any{1, "<"},
+}
+
+func TestWriteEscapedWriters(t *testing.T) {
+	writers := map[string]func(io.Writer) io.Writer{
+		"Writer":  func(w io.Writer) io.Writer { return NewWriter(w) },
+		"plain":   func(w io.Writer) io.Writer { return &plainWriter{} },
+		"Builder": func(io.Writer) io.Writer { return &strings.Builder{} },
+		"bufio":   func(w io.Writer) io.Writer { return bufio.NewWriter(w) },
+	}
+	for name, newWriter := range writers {
+		for _, v := range writeValues {
+			var dest bytes.Buffer
+			w := newWriter(&dest)
+			if err := WriteEscaped(w, v); err != nil {
+				t.Fatalf("%s: WriteEscaped(%#v): %v", name, v, err)
+			}
+			if err := WriteRaw(w, v); err != nil {
+				t.Fatalf("%s: WriteRaw(%#v): %v", name, v, err)
+			}
+			got := written(w, &dest)
+			s := fmt.Sprint(v)
+			if b, ok := v.([]byte); ok {
+				s = string(b)
+			}
+			want := html.EscapeString(s) + s
+			if _, ok := v.(SafeString); ok {
+				want = s + s
+			}
+			if got != want {
+				t.Errorf("%s: %#v: got %q, want %q", name, v, got, want)
+			}
+		}
+	}
+}
+
+// written returns the output of w, a writer made for dest.
+func written(w io.Writer, dest *bytes.Buffer) string {
+	switch w := w.(type) {
+	case *Writer:
+		w.Flush()
+	case *bufio.Writer:
+		w.Flush()
+	case *plainWriter:
+		return w.b.String()
+	case *strings.Builder:
+		return w.String()
+	}
+	return dest.String()
+}
+
+func TestWriter(t *testing.T) {
+	var dest plainWriter
+	w := NewWriter(&dest)
+	w.WriteString("a")
+	w.WriteByte('b')
+	w.Write([]byte("c"))
+	if dest.b.Len() != 0 {
+		t.Fatalf("written before Flush: %q", dest.b.String())
+	}
+	if err := w.Flush(); err != nil || dest.b.String() != "abc" {
+		t.Fatalf("Flush: %q, %v", dest.b.String(), err)
+	}
+	big := strings.Repeat("x", writerSize)
+	w.WriteString(big)
+	if dest.b.Len() != 3+writerSize {
+		t.Fatalf("a full buffer is not flushed: %d bytes written", dest.b.Len())
+	}
+
+	errWrite := errors.New("write failed")
+	w.Reset(failingWriter{errWrite})
+	w.WriteString("x")
+	if err := w.Flush(); !errors.Is(err, errWrite) {
+		t.Fatalf("Flush error = %v", err)
+	}
+	if _, err := w.WriteString("y"); !errors.Is(err, errWrite) {
+		t.Fatalf("write after a failed flush: err = %v", err)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	var b strings.Builder
+	err := Buffered(&b, func(w io.Writer) error {
+		if w != io.Writer(&b) {
+			t.Errorf("a strings.Builder is wrapped: %T", w)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dest plainWriter
+	errRender := errors.New("render failed")
+	err = Buffered(&dest, func(w io.Writer) error {
+		if _, ok := w.(*Writer); !ok {
+			t.Errorf("a plain writer is not buffered: %T", w)
+		}
+		io.WriteString(w, "partial")
+		return errRender
+	})
+	if !errors.Is(err, errRender) || dest.b.String() != "partial" {
+		t.Fatalf("got %q, %v; want the output before the error and the error", dest.b.String(), err)
+	}
+
+	errWrite := errors.New("write failed")
+	err = Buffered(failingWriter{errWrite}, func(w io.Writer) error { return WriteEscaped(w, "x") })
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("flush error = %v", err)
+	}
+}
+
+func TestWriteAllocs(t *testing.T) {
+	w := NewWriter(io.Discard)
+	values := []any{"<p class=\"x\">Tom & Jerry</p>", "plain text", 123456789, 3.25, true}
+	n := testing.AllocsPerRun(100, func() {
+		for _, v := range values {
+			WriteEscaped(w, v)
+			WriteRaw(w, v)
+		}
+		w.Flush()
+	})
+	if n != 0 {
+		t.Errorf("WriteEscaped and WriteRaw to a Writer allocate %v times", n)
+	}
+}
+
+// BenchmarkWrite writes a row of template output, text with and without HTML special characters
+// and numbers, to a plain io.Writer, a *bufio.Writer and a *Writer.
+func BenchmarkWrite(b *testing.B) {
+	values := map[string][]any{
+		"text":    {"plain text without specials", "Tom & Jerry <tom@example.com>"},
+		"numbers": {123456789, -42, 3.25, true},
+	}
+	writes := map[string]func(io.Writer, any) error{"WriteEscaped": WriteEscaped, "WriteRaw": WriteRaw}
+	writers := map[string]func() io.Writer{
+		"plain":  func() io.Writer { return struct{ io.Writer }{io.Discard} },
+		"bufio":  func() io.Writer { return bufio.NewWriter(io.Discard) },
+		"Writer": func() io.Writer { return NewWriter(io.Discard) },
+	}
+	for writeName, write := range writes {
+		for valuesName, row := range values {
+			for writerName, newWriter := range writers {
+				b.Run(writeName+"/"+valuesName+"/"+writerName, func(b *testing.B) {
+					w := newWriter()
+					b.ReportAllocs()
+					for b.Loop() {
+						for _, v := range row {
+							write(w, v)
+						}
+					}
+				})
+			}
+		}
+	}
+}